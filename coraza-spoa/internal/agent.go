@@ -4,19 +4,56 @@ import (
 	"context"
 	"errors"
 	"net"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/dropmorepackets/haproxy-go/pkg/encoding"
 	"github.com/dropmorepackets/haproxy-go/spop"
 	"github.com/rs/zerolog"
 )
 
+// Agent 写入 txn.coraza.error 的错误码，与 HAProxy SPOE 自身的错误码区分
+const (
+	errorCodeMalformedMessage = 100 // 消息格式错误
+	errorCodeUnknownApp       = 101 // 找不到应用且策略为 fail_closed
+	errorCodeHandler          = 102 // 应用处理请求或响应出错
+)
+
+// maxReasonLength 传给 HAProxy 的拦截原因最大长度
+const maxReasonLength = 256
+
+// AgentStats Agent 错误计数
+type AgentStats struct {
+	MalformedMessages   uint64 `json:"malformedMessages"`   // 格式错误的消息数
+	UnknownApps         uint64 `json:"unknownApps"`         // 找不到应用且没有可用默认应用的消息数
+	DefaultAppFallbacks uint64 `json:"defaultAppFallbacks"` // 回退到默认应用的消息数
+	HandlerErrors       uint64 `json:"handlerErrors"`       // 应用处理出错的消息数
+}
+
+type agentCounters struct {
+	malformedMessages   atomic.Uint64
+	unknownApps         atomic.Uint64
+	defaultAppFallbacks atomic.Uint64
+	handlerErrors       atomic.Uint64
+}
+
 type Agent struct {
 	Context      context.Context
 	Applications map[string]*Application
 	Logger       zerolog.Logger
+	// DefaultApp 消息中的应用不存在时使用的应用名称
+	DefaultApp string
+	// FailOpen 找不到应用时放行请求，否则设置 txn.coraza.error
+	FailOpen bool
 
-	mtx sync.RWMutex
+	mtx   sync.RWMutex
+	stats agentCounters
+	// draining 被替换后等待事务过期的旧应用及其关闭定时器
+	draining map[*Application]*time.Timer
+	// retiredLogStats 已关闭的旧应用的日志存储计数，热更新后计数继续累加
+	retiredLogStats LogStoreStats
 }
 
 func (a *Agent) Serve(l net.Listener) error {
@@ -28,10 +65,68 @@ func (a *Agent) Serve(l net.Listener) error {
 	return agent.Serve(l)
 }
 
+// ReplaceApplications 热更新应用
+// 被替换的应用不会立即关闭：同名新应用找不到事务时交由旧应用处理响应，旧应用在事务过期后关闭
 func (a *Agent) ReplaceApplications(newApps map[string]*Application) {
 	a.mtx.Lock()
+	defer a.mtx.Unlock()
+
+	oldApps := a.Applications
 	a.Applications = newApps
+
+	if a.draining == nil {
+		a.draining = make(map[*Application]*time.Timer)
+	}
+	for name, old := range oldApps {
+		successor := newApps[name]
+		if successor == old {
+			continue
+		}
+		if successor != nil {
+			successor.predecessor.Store(old)
+		}
+		a.draining[old] = time.AfterFunc(old.drainTimeout(), func() {
+			if successor != nil {
+				successor.predecessor.CompareAndSwap(old, nil)
+				old.handOffLogs(successor)
+			}
+			old.Close()
+
+			// 关闭后再移出排空列表，关闭期间的日志计数不会丢失
+			a.mtx.Lock()
+			delete(a.draining, old)
+			if stats, ok := old.logStoreStats(); ok {
+				a.retiredLogStats.Dropped += stats.Dropped
+				a.retiredLogStats.Spilled += stats.Spilled
+				a.retiredLogStats.Replayed += stats.Replayed
+				a.retiredLogStats.Collapsed += stats.Collapsed
+				a.retiredLogStats.SampledOut += stats.SampledOut
+			}
+			a.mtx.Unlock()
+			a.Logger.Debug().Str("app", name).Msg("旧应用已排空并关闭")
+		})
+	}
+}
+
+// Close 立即关闭所有应用，包括排空中的旧应用
+func (a *Agent) Close() {
+	a.mtx.Lock()
+	apps := make([]*Application, 0, len(a.Applications)+len(a.draining))
+	for app, timer := range a.draining {
+		// 定时器已触发时由定时器负责关闭
+		if timer.Stop() {
+			apps = append(apps, app)
+		}
+	}
+	a.draining = nil
+	for _, app := range a.Applications {
+		apps = append(apps, app)
+	}
 	a.mtx.Unlock()
+
+	for _, app := range apps {
+		app.Close()
+	}
 }
 
 func (a *Agent) HandleSPOE(ctx context.Context, writer *encoding.ActionWriter, message *encoding.Message) {
@@ -54,26 +149,43 @@ func (a *Agent) HandleSPOE(ctx context.Context, writer *encoding.ActionWriter, m
 	k := encoding.AcquireKVEntry()
 	defer encoding.ReleaseKVEntry(k)
 	if !message.KV.Next(k) {
-		a.Logger.Panic().Msg("failed reading kv entry")
+		a.stats.malformedMessages.Add(1)
+		a.Logger.Error().Msg("failed reading kv entry")
+		a.setError(writer, errorCodeMalformedMessage)
 		return
 	}
 
-	appName := string(k.ValueBytes())
 	if !k.NameEquals("app") {
-		// Without knowing the app, we cannot continue. We could fall back to a default application,
-		// but all following code would have to support that as we now already read one of the kv entries.
-		a.Logger.Panic().Str("expected", "app").Str("got", string(k.NameBytes())).Msg("unexpected kv entry")
+		// 已读取的第一个参数无法交还给应用，不能回退到默认应用
+		a.stats.malformedMessages.Add(1)
+		a.Logger.Error().Str("expected", "app").Str("got", string(k.NameBytes())).Msg("unexpected kv entry")
+		a.setError(writer, errorCodeMalformedMessage)
 		return
 	}
+	appName := string(k.ValueBytes())
 
 	a.mtx.RLock()
 	app := a.Applications[appName]
+	defaultApp := a.DefaultApp
+	fallback := app == nil && defaultApp != ""
+	if fallback {
+		app = a.Applications[defaultApp]
+	}
+	failOpen := a.FailOpen
 	a.mtx.RUnlock()
+
 	if app == nil {
-		// If we cannot resolve the app, we fail as this is an invalid configuration.
-		a.Logger.Panic().Str("app", appName).Msg("app not found")
+		a.stats.unknownApps.Add(1)
+		a.Logger.Error().Str("app", appName).Bool("failOpen", failOpen).Msg("app not found")
+		if !failOpen {
+			a.setError(writer, errorCodeUnknownApp)
+		}
 		return
 	}
+	if fallback {
+		a.stats.defaultAppFallbacks.Add(1)
+		a.Logger.Debug().Str("app", appName).Str("defaultApp", defaultApp).Msg("app not found, using default app")
+	}
 
 	err := messageHandler(app, ctx, writer, message)
 	if err == nil {
@@ -86,11 +198,86 @@ func (a *Agent) HandleSPOE(ctx context.Context, writer *encoding.ActionWriter, m
 		_ = writer.SetString(encoding.VarScopeTransaction, "action", interruption.Interruption.Action)
 		_ = writer.SetString(encoding.VarScopeTransaction, "data", interruption.Interruption.Data)
 		_ = writer.SetInt64(encoding.VarScopeTransaction, "ruleid", int64(interruption.Interruption.RuleID))
+		if interruption.RetryAfter > 0 {
+			// Retry-After 以秒为单位，向上取整
+			_ = writer.SetInt64(encoding.VarScopeTransaction, "retry_after", int64((interruption.RetryAfter+time.Second-1)/time.Second))
+		}
+		if reason := blockPageReason(interruption.Reason); reason != "" {
+			_ = writer.SetString(encoding.VarScopeTransaction, "reason", reason)
+		}
 
 		a.Logger.Debug().Err(err).Msg("sending interruption")
 		return
 	}
 
-	// If the error is not an ErrInterrupted, we panic to let the spop stream fail.
-	a.Logger.Panic().Err(err).Msg("Error handling request")
+	// 只使当前事务失败，不影响连接上复用的其他请求
+	a.stats.handlerErrors.Add(1)
+	a.Logger.Error().Err(err).Str("app", appName).Msg("Error handling request")
+	a.setError(writer, errorCodeHandler)
+}
+
+// blockPageReason 清理拦截原因，去掉控制字符和 HTML、JSON 中需要转义的字符后原样写入拦截页面
+func blockPageReason(reason string) string {
+	reason = strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f || strings.ContainsRune(`<>&"'\`, r) {
+			return -1
+		}
+		return r
+	}, reason)
+	if len(reason) > maxReasonLength {
+		reason = strings.ToValidUTF8(reason[:maxReasonLength], "")
+	}
+	return strings.TrimSpace(reason)
+}
+
+// setError 设置 txn.coraza.error，由 HAProxy 按错误处理规则拒绝请求
+func (a *Agent) setError(writer *encoding.ActionWriter, code int64) {
+	if err := writer.SetInt64(encoding.VarScopeTransaction, "error", code); err != nil {
+		a.Logger.Error().Err(err).Msg("failed setting error variable")
+	}
+}
+
+// SetFallback 设置默认应用和未知应用处理策略 support hot reload
+func (a *Agent) SetFallback(defaultApp string, failOpen bool) {
+	a.mtx.Lock()
+	a.DefaultApp = defaultApp
+	a.FailOpen = failOpen
+	a.mtx.Unlock()
+}
+
+// LogStoreStats 获取所有应用的 WAF 日志存储计数，包括排空中和已关闭的旧应用
+// 溢出队列的大小按目录统计，共用队列的应用只计一次
+func (a *Agent) LogStoreStats() LogStoreStats {
+	a.mtx.RLock()
+	total := a.retiredLogStats
+	apps := make([]*Application, 0, len(a.Applications)+len(a.draining))
+	for _, app := range a.Applications {
+		apps = append(apps, app)
+	}
+	for app := range a.draining {
+		apps = append(apps, app)
+	}
+	a.mtx.RUnlock()
+
+	for _, app := range apps {
+		if stats, ok := app.logStoreStats(); ok {
+			total.Dropped += stats.Dropped
+			total.Spilled += stats.Spilled
+			total.Replayed += stats.Replayed
+			total.Collapsed += stats.Collapsed
+			total.SampledOut += stats.SampledOut
+		}
+	}
+	total.SpillBytes, total.SpillSegments = spillQueueSizes()
+	return total
+}
+
+// Stats 获取错误计数
+func (a *Agent) Stats() AgentStats {
+	return AgentStats{
+		MalformedMessages:   a.stats.malformedMessages.Load(),
+		UnknownApps:         a.stats.unknownApps.Load(),
+		DefaultAppFallbacks: a.stats.defaultAppFallbacks.Load(),
+		HandlerErrors:       a.stats.handlerErrors.Load(),
+	}
 }
@@ -0,0 +1,187 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dropmorepackets/haproxy-go/pkg/encoding"
+	"github.com/rs/zerolog"
+)
+
+func newTestApplication(t *testing.T, ttl time.Duration) *Application {
+	t.Helper()
+	app, err := AppConfig{
+		Directives:     "SecRuleEngine On",
+		ResponseCheck:  true,
+		Logger:         zerolog.Nop(),
+		TransactionTTL: ttl,
+	}.NewApplication(ApplicationOptions{})
+	if err != nil {
+		t.Fatalf("创建应用失败: %v", err)
+	}
+	return app
+}
+
+// TestReplaceApplicationsDrainsOldApps 测试热更新后旧应用在事务过期前仍可查找事务，过期后关闭
+func TestReplaceApplicationsDrainsOldApps(t *testing.T) {
+	old := newTestApplication(t, 10*time.Millisecond)
+	removed := newTestApplication(t, 10*time.Millisecond)
+	agent := &Agent{
+		Applications: map[string]*Application{"default": old, "removed": removed},
+		Logger:       zerolog.Nop(),
+	}
+
+	tx := old.waf.NewTransactionWithID("in-flight")
+	old.cache.SetWithExpiration(tx.ID(), &transaction{tx: tx, request: &applicationRequest{}}, old.TransactionTTL)
+
+	successor := newTestApplication(t, 10*time.Millisecond)
+	agent.ReplaceApplications(map[string]*Application{"default": successor})
+
+	if got := successor.predecessor.Load(); got != old {
+		t.Fatalf("新应用应指向被替换的同名应用")
+	}
+	if _, ok := successor.predecessor.Load().cache.Get("in-flight"); !ok {
+		t.Fatalf("排空期间应能从旧应用找到事务")
+	}
+
+	agent.mtx.RLock()
+	draining := len(agent.draining)
+	agent.mtx.RUnlock()
+	if draining != 2 {
+		t.Fatalf("排空中的应用数量 = %d, 期望 2", draining)
+	}
+
+	deadline := time.Now().Add(old.drainTimeout() + 2*time.Second)
+	for {
+		agent.mtx.RLock()
+		draining = len(agent.draining)
+		agent.mtx.RUnlock()
+		if draining == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("旧应用未在排空超时后关闭")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	if successor.predecessor.Load() != nil {
+		t.Fatalf("旧应用关闭后新应用不应再指向旧应用")
+	}
+	if _, ok := old.cache.Get("in-flight"); ok {
+		t.Fatalf("旧应用关闭后事务应已回收")
+	}
+	agent.Close()
+}
+
+// newTestMessage 按 SPOP 消息格式构造消息，kvs 为按顺序写入的参数名和值
+func newTestMessage(t *testing.T, name string, kvs ...string) *encoding.Message {
+	t.Helper()
+	kv := encoding.NewKVWriter(make([]byte, 1024), 0)
+	for i := 0; i+1 < len(kvs); i += 2 {
+		if err := kv.SetString(kvs[i], kvs[i+1]); err != nil {
+			t.Fatalf("写入参数失败: %v", err)
+		}
+	}
+
+	buf := append([]byte{byte(len(name))}, name...)
+	buf = append(buf, byte(len(kvs)/2))
+	buf = append(buf, kv.Bytes()...)
+
+	message := encoding.AcquireMessage()
+	if !encoding.NewMessageScanner(buf).Next(message) {
+		t.Fatalf("解析消息失败")
+	}
+	return message
+}
+
+// TestHandleSPOEFallback 测试格式错误的消息和未知应用按默认应用及处理策略处理，而不是使连接失败
+func TestHandleSPOEFallback(t *testing.T) {
+	tests := []struct {
+		name       string
+		defaultApp string
+		failOpen   bool
+		kvs        []string
+		wantError  bool
+		wantStats  AgentStats
+	}{
+		{
+			name:      "第一个参数不是app",
+			kvs:       []string{"method", "GET"},
+			wantError: true,
+			wantStats: AgentStats{MalformedMessages: 1},
+		},
+		{
+			name:      "未知应用默认拒绝",
+			kvs:       []string{"app", "unknown"},
+			wantError: true,
+			wantStats: AgentStats{UnknownApps: 1},
+		},
+		{
+			name:      "未知应用放行",
+			failOpen:  true,
+			kvs:       []string{"app", "unknown"},
+			wantStats: AgentStats{UnknownApps: 1},
+		},
+		{
+			name:       "默认应用不存在时按策略处理",
+			defaultApp: "missing",
+			kvs:        []string{"app", "unknown"},
+			wantError:  true,
+			wantStats:  AgentStats{UnknownApps: 1},
+		},
+		{
+			name:       "回退到默认应用",
+			defaultApp: "coraza",
+			kvs:        []string{"app", "unknown", "method", "GET", "path", "/", "version", "1.1"},
+			wantStats:  AgentStats{DefaultAppFallbacks: 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			agent := &Agent{
+				Applications: map[string]*Application{"coraza": newTestApplication(t, time.Second)},
+				Logger:       zerolog.Nop(),
+				DefaultApp:   tt.defaultApp,
+				FailOpen:     tt.failOpen,
+			}
+			defer agent.Close()
+
+			writer := encoding.NewActionWriter(make([]byte, 1024), 0)
+			agent.HandleSPOE(context.Background(), writer, newTestMessage(t, "coraza-req", tt.kvs...))
+
+			if got := bytes.Contains(writer.Bytes(), []byte("error")); got != tt.wantError {
+				t.Errorf("设置 txn.coraza.error = %v, 期望 %v", got, tt.wantError)
+			}
+			if got := agent.Stats(); got != tt.wantStats {
+				t.Errorf("错误计数 = %+v, 期望 %+v", got, tt.wantStats)
+			}
+		})
+	}
+}
+
+// TestBlockPageReason 测试拦截原因去掉控制字符和需要转义的字符，并限制长度
+func TestBlockPageReason(t *testing.T) {
+	tests := []struct {
+		name   string
+		reason string
+		want   string
+	}{
+		{"规则消息", "Inbound Anomaly Score Exceeded (Total Score: 5)", "Inbound Anomaly Score Exceeded (Total Score: 5)"},
+		{"去掉 HTML 和 JSON 特殊字符", `<script>"a'b\c&</script>`, "scriptabc/script"},
+		{"去掉控制字符", "visit\r\n\tlimit", "visitlimit"},
+		{"超长截断", strings.Repeat("原", maxReasonLength), strings.Repeat("原", maxReasonLength/3)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := blockPageReason(tt.reason); got != tt.want {
+				t.Errorf("blockPageReason() = %q, 期望 %q", got, tt.want)
+			}
+		})
+	}
+}
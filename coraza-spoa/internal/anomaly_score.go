@@ -0,0 +1,58 @@
+package internal
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/HUAHUAI23/simple-waf/pkg/model"
+	"github.com/corazawaf/coraza/v3/experimental/plugins/plugintypes"
+	"github.com/corazawaf/coraza/v3/types"
+)
+
+// crsParanoiaLevels CRS 的偏执等级数量
+const crsParanoiaLevels = 4
+
+// readAnomalyScore 读取事务中 CRS 设置的累计异常分数，未加载 CRS 时返回 nil
+func readAnomalyScore(tx types.Transaction) *model.AnomalyScore {
+	state, ok := tx.(plugintypes.TransactionState)
+	if !ok {
+		return nil
+	}
+	vars := state.Variables().TX()
+
+	found := false
+	get := func(key string) int {
+		values := vars.Get(key)
+		if len(values) == 0 {
+			return 0
+		}
+		found = true
+		v, _ := strconv.Atoi(values[0])
+		return v
+	}
+
+	score := &model.AnomalyScore{
+		Inbound:           get("blocking_inbound_anomaly_score"),
+		Outbound:          get("blocking_outbound_anomaly_score"),
+		InboundThreshold:  get("inbound_anomaly_score_threshold"),
+		OutboundThreshold: get("outbound_anomaly_score_threshold"),
+		InboundByPL:       make([]int, crsParanoiaLevels),
+		OutboundByPL:      make([]int, crsParanoiaLevels),
+	}
+	for pl := 1; pl <= crsParanoiaLevels; pl++ {
+		score.InboundByPL[pl-1] = get(fmt.Sprintf("inbound_anomaly_score_pl%d", pl))
+		score.OutboundByPL[pl-1] = get(fmt.Sprintf("outbound_anomaly_score_pl%d", pl))
+	}
+	if !found {
+		return nil
+	}
+	return score
+}
+
+// reachesWarning 请求或响应的拦截异常分数是否达到告警分数
+func reachesWarning(score *model.AnomalyScore, warning int) bool {
+	if score == nil || warning <= 0 {
+		return false
+	}
+	return score.Inbound >= warning || score.Outbound >= warning
+}
@@ -0,0 +1,64 @@
+package internal
+
+import (
+	"testing"
+
+	"github.com/corazawaf/coraza/v3"
+)
+
+// TestReadAnomalyScore 测试从事务读取 CRS 异常分数以及告警分数判断
+func TestReadAnomalyScore(t *testing.T) {
+	waf, err := coraza.NewWAF(coraza.NewWAFConfig().WithDirectives(`
+SecRuleEngine On
+SecAction "id:1,phase:1,pass,nolog,setvar:tx.inbound_anomaly_score_threshold=5,setvar:tx.inbound_anomaly_score_pl1=0,setvar:tx.inbound_anomaly_score_pl2=0"
+SecRule ARGS:q "@contains attack" "id:100,phase:1,pass,log,setvar:tx.inbound_anomaly_score_pl1=+3,setvar:tx.inbound_anomaly_score_pl2=+2"
+SecAction "id:200,phase:1,pass,nolog,setvar:tx.blocking_inbound_anomaly_score=%{tx.inbound_anomaly_score_pl1}"
+`))
+	if err != nil {
+		t.Fatalf("编译指令失败: %v", err)
+	}
+
+	tx := waf.NewTransaction()
+	defer tx.Close()
+	tx.ProcessURI("/?q=attack", "GET", "HTTP/1.1")
+	tx.ProcessRequestHeaders()
+
+	score := readAnomalyScore(tx)
+	if score == nil {
+		t.Fatal("应读取到异常分数")
+	}
+	if score.Inbound != 3 || score.InboundThreshold != 5 {
+		t.Errorf("拦截异常分数不正确: %+v", score)
+	}
+	if score.InboundByPL[0] != 3 || score.InboundByPL[1] != 2 || score.InboundByPL[2] != 0 {
+		t.Errorf("偏执等级异常分数不正确: %v", score.InboundByPL)
+	}
+
+	tests := []struct {
+		name    string
+		warning int
+		want    bool
+	}{
+		{"未配置告警分数", 0, false},
+		{"达到告警分数", 3, true},
+		{"未达到告警分数", 4, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := reachesWarning(score, tt.warning); got != tt.want {
+				t.Errorf("reachesWarning(%d) = %v, want %v", tt.warning, got, tt.want)
+			}
+		})
+	}
+
+	// 未加载 CRS 时不返回异常分数
+	plain, err := coraza.NewWAF(coraza.NewWAFConfig().WithDirectives("SecRuleEngine On"))
+	if err != nil {
+		t.Fatalf("编译指令失败: %v", err)
+	}
+	plainTx := plain.NewTransaction()
+	defer plainTx.Close()
+	if score := readAnomalyScore(plainTx); score != nil {
+		t.Errorf("未加载 CRS 时应返回 nil: %+v", score)
+	}
+}
@@ -5,10 +5,12 @@ import (
 	"context"
 	"fmt"
 	"math/rand"
+	"net/http"
 	"net/netip"
 	"os"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"go.mongodb.org/mongo-driver/v2/mongo"
@@ -28,16 +30,22 @@ import (
 
 // MongoDB 配置
 type MongoConfig struct {
-	Client     *mongo.Client
-	Database   string
-	Collection string
+	Client      *mongo.Client
+	Database    string
+	Collection  string
+	Spill       model.LogSpillConfig       // 磁盘溢出队列配置，MongoDB 不可用时日志写入磁盘
+	Aggregation model.LogAggregationConfig // 日志聚合与采样配置，泛洪时合并重复的日志
 }
 
 type AppConfig struct {
+	// Name 应用名称，记录在 WAF 日志中，日志存储按名称将日志分发到应用的日志输出
+	Name           string
 	Directives     string
 	ResponseCheck  bool
 	Logger         zerolog.Logger
 	TransactionTTL time.Duration
+	// WarningAnomalyScore 告警分数，未被拦截的事务异常分数达到该值时记录 near_miss 日志，为 0 时不记录
+	WarningAnomalyScore int
 }
 
 // ApplicationOptions 应用程序配置选项 配置应用是否开启 ip 解析，日志记录
@@ -46,14 +54,38 @@ type ApplicationOptions struct {
 	GeoIPConfig          *GeoIP2Options        // GeoIP配置，用于IP地理位置处理
 	RuleEngineDbConfig   *MongoDBConfig        // 规则引擎数据库配置
 	FlowControllerConfig *FlowControllerConfig // 流量控制器配置
+	LogRedactor          *LogRedactor          // 日志脱敏器，为 nil 时不脱敏
+	DecisionLogConfig    *DecisionLogConfig    // 流控与封禁IP决策记录配置，为 nil 时不记录
+	AuditLogConfig       *AuditLogConfig       // Coraza 审计日志配置，为 nil 时不记录
+	LogSinks             []model.LogSinkConfig // MongoDB 之外的 WAF 日志输出，与日志存储共用环形缓冲区
+}
+
+// AuditLogConfig Coraza 审计日志配置
+type AuditLogConfig struct {
+	Client   *mongo.Client        // MongoDB客户端
+	Database string               // 数据库名称
+	AppName  string               // 应用名称，记录在审计日志中
+	Config   model.AuditLogConfig // 记录的部分、长度限制和保留天数
+}
+
+// DecisionLogConfig 流控与封禁IP决策记录配置
+type DecisionLogConfig struct {
+	SampleRate float64 // 采样率，不在 (0,1) 范围内时全部记录
 }
 
 // FlowControllerConfig 流量控制器配置
 type FlowControllerConfig struct {
-	Client   *mongo.Client // MongoDB客户端
-	Database string        // 数据库名称
+	Client    *mongo.Client // MongoDB客户端
+	Database  string        // 数据库名称
+	Namespace string        // 命名空间，隔离不同应用的限流计数
 }
 
+// 事务缓存的默认过期时间和回收间隔
+const (
+	defaultTransactionExpire    = time.Second * 10
+	transactionEvictionInterval = time.Second * 1
+)
+
 type Application struct {
 	waf            coraza.WAF
 	cache          cache.ExpiringCache
@@ -62,6 +94,14 @@ type Application struct {
 	ruleEngine     *RuleEngine
 	flowController *flowcontroller.FlowController
 	ipRecorder     flowcontroller.IPRecorder
+	redactor       *LogRedactor
+	decisionLog    *DecisionLogConfig
+	auditLogStore  *AuditLogStore
+	logSinks       *LogSinkGroup
+
+	// predecessor 热更新时被替换的同名应用，排空期间处理在其上开始的事务的响应
+	predecessor atomic.Pointer[Application]
+	closeOnce   sync.Once
 
 	AppConfig
 }
@@ -162,6 +202,8 @@ func (a *Application) HandleRequest(ctx context.Context, writer *encoding.Action
 		}
 	}
 
+	// 请求ID由 HAProxy 的 unique-id 提供，与响应头 X-Request-ID 一致
+	// 旧版本生成的 HAProxy 配置未发送 id 时随机生成
 	if len(req.ID) == 0 {
 		const idLength = 16
 		var sb strings.Builder
@@ -182,29 +224,36 @@ func (a *Application) HandleRequest(ctx context.Context, writer *encoding.Action
 				Time("blocked_until", record.BlockedUntil).
 				Msg("请求被拒绝：IP已被限制")
 
-			return ErrInterrupted{
-				Interruption: &types.Interruption{
-					Action: "deny",
-					Status: 403,
-					Data:   fmt.Sprintf("IP has been blocked until %s due to %s", record.BlockedUntil.Format(time.RFC3339), record.Reason),
-				},
+			data := fmt.Sprintf("IP has been blocked until %s due to %s", record.BlockedUntil.Format(time.RFC3339), record.Reason)
+			enforcement := flowcontroller.Enforcement{Action: flowcontroller.ActionDeny}
+			if a.flowController != nil {
+				enforcement = a.flowController.Enforcement(record.Reason, record.BlockedUntil)
+			}
+			if err := a.saveDecisionLog(model.DecisionEngineIPBan, enforcement.Action, model.DecisionModeEnforce, record.Reason, data, &req); err != nil {
+				a.Logger.Error().Err(err).Str("ip", realIP).Msg("failed to save decision log")
 			}
+			return enforcementInterruption(enforcement, record.Reason, data)
 		}
 	}
 
 	host := getHostFromRequest(&req)
 	// 进行高频访问检查
 	if a.flowController != nil {
-		allowed, err := a.flowController.CheckVisit(realIP, buildFullURL(host, req.Path, req.Query))
+		verdict, err := a.flowController.EvaluateVisit(realIP, buildFullURL(host, req.Path, req.Query))
 		if err != nil {
 			a.Logger.Error().Err(err).Str("ip", realIP).Msg("流控检查失败")
-		} else if !allowed {
-			return ErrInterrupted{
-				Interruption: &types.Interruption{
-					Action: "deny",
-					Status: 429,
-					Data:   "Too many requests",
-				},
+		} else if verdict != flowcontroller.VerdictAllow {
+			const data = "Too many requests"
+			enforcement := a.flowController.Enforcement(flowcontroller.ReasonVisit, time.Time{})
+			mode := model.DecisionModeEnforce
+			if verdict == flowcontroller.VerdictObserve {
+				mode = model.DecisionModeObserve
+			}
+			if err := a.saveDecisionLog(model.DecisionEngineFlow, enforcement.Action, mode, flowcontroller.ReasonVisit, data, &req); err != nil {
+				a.Logger.Error().Err(err).Str("ip", realIP).Msg("failed to save decision log")
+			}
+			if verdict == flowcontroller.VerdictDeny {
+				return enforcementInterruption(enforcement, flowcontroller.ReasonVisit, data)
 			}
 		}
 	}
@@ -261,6 +310,7 @@ func (a *Application) HandleRequest(ctx context.Context, writer *encoding.Action
 					Action: "deny",
 					Status: 403,
 				},
+				Reason: ruleName,
 			}
 		}
 	}
@@ -286,14 +336,16 @@ func (a *Application) HandleRequest(ctx context.Context, writer *encoding.Action
 
 			interruption := tx.Interruption()
 			if matchedRules := tx.MatchedRules(); len(matchedRules) > 0 {
-				err := a.saveFirewallLog(matchedRules, interruption, &req, req.Headers)
+				err := a.saveFirewallLog(matchedRules, interruption, readAnomalyScore(tx), &req, req.Headers)
 				if err != nil {
 					a.Logger.Error().Err(err).Msg("failed to save firewall log")
 				}
 			}
+		} else if a.logStore != nil {
+			a.recordNearMiss(tx, &req)
 		}
 
-		tx.ProcessLogging()
+		a.processLogging(tx)
 		if err := tx.Close(); err != nil {
 			a.Logger.Error().Str("tx", tx.ID()).Err(err).Msg("failed to close transaction")
 		}
@@ -318,21 +370,21 @@ func (a *Application) HandleRequest(ctx context.Context, writer *encoding.Action
 	}
 
 	if it := tx.ProcessRequestHeaders(); it != nil {
-		return ErrInterrupted{it}
+		return wafInterruption(tx, it)
 	}
 
 	switch it, _, err := tx.WriteRequestBody(req.Body); {
 	case err != nil:
 		return err
 	case it != nil:
-		return ErrInterrupted{it}
+		return wafInterruption(tx, it)
 	}
 
 	switch it, err := tx.ProcessRequestBody(); {
 	case err != nil:
 		return err
 	case it != nil:
-		return ErrInterrupted{it}
+		return wafInterruption(tx, it)
 	}
 
 	return nil
@@ -493,10 +545,17 @@ func (a *Application) HandleResponse(ctx context.Context, writer *encoding.Actio
 
 	cv, ok := a.cache.Get(res.ID)
 	if !ok {
+		// 热更新前开始的事务保存在排空中的旧应用中，由旧应用按原规则集完成响应检测和日志记录
+		for prev := a.predecessor.Load(); prev != nil && !ok; prev = prev.predecessor.Load() {
+			if cv, ok = prev.cache.Get(res.ID); ok {
+				a = prev
+			}
+		}
+	}
+	if !ok {
+		// 事务已过期回收，或检测器重启后旧应用已关闭
 		a.Logger.Error().Str("id", res.ID).Msg("transaction not found")
 		return nil
-		// TODO: 是否需要报错，还是仅记录，检测器重启时这里会报错，因为 application 被替换，a.cache.Get 会拿不到 res.ID 对应的 transaction
-		// return fmt.Errorf("transaction not found: %s", res.ID)
 	}
 	a.cache.Remove(res.ID)
 
@@ -514,12 +573,9 @@ func (a *Application) HandleResponse(ctx context.Context, writer *encoding.Actio
 	// 获取真实客户端IP
 	realIP := getRealClientIP(t.request)
 	host := getHostFromRequest(t.request)
-	if res.Status >= 400 {
-		// 检查错误响应并记录
-		// 记录错误
-		if a.flowController != nil {
-			_, _ = a.flowController.RecordError(realIP, buildFullURL(host, t.request.Path, t.request.Query))
-		}
+	// 按错误限制及错误策略的状态码、路径筛选条件记录错误
+	if a.flowController != nil {
+		_, _ = a.flowController.RecordError(realIP, string(t.request.Path), buildFullURL(host, t.request.Path, t.request.Query), int(res.Status))
 	}
 
 	defer func() {
@@ -532,14 +588,16 @@ func (a *Application) HandleResponse(ctx context.Context, writer *encoding.Actio
 
 			interruption := tx.Interruption()
 			if matchedRules := tx.MatchedRules(); len(matchedRules) > 0 && t.request != nil {
-				err := a.saveFirewallLog(matchedRules, interruption, t.request, t.request.Headers)
+				err := a.saveFirewallLog(matchedRules, interruption, readAnomalyScore(tx), t.request, t.request.Headers)
 				if err != nil {
 					a.Logger.Error().Err(err).Msg("failed to save firewall log")
 				}
 			}
+		} else if a.logStore != nil && t.request != nil {
+			a.recordNearMiss(tx, t.request)
 		}
 
-		tx.ProcessLogging()
+		a.processLogging(tx)
 		if err := tx.Close(); err != nil {
 			a.Logger.Error().Str("tx", tx.ID()).Err(err).Msg("failed to close transaction")
 		}
@@ -554,21 +612,21 @@ func (a *Application) HandleResponse(ctx context.Context, writer *encoding.Actio
 	}
 
 	if it := tx.ProcessResponseHeaders(int(res.Status), "HTTP/"+res.Version); it != nil {
-		return ErrInterrupted{it}
+		return wafInterruption(tx, it)
 	}
 
 	switch it, _, err := tx.WriteResponseBody(res.Body); {
 	case err != nil:
 		return err
 	case it != nil:
-		return ErrInterrupted{it}
+		return wafInterruption(tx, it)
 	}
 
 	switch it, err := tx.ProcessResponseBody(); {
 	case err != nil:
 		return err
 	case it != nil:
-		return ErrInterrupted{it}
+		return wafInterruption(tx, it)
 	}
 
 exit:
@@ -648,6 +706,7 @@ func (a *Application) saveMicroEngineLog(rule *Rule, req *applicationRequest, he
 	now := time.Now()
 	// 初始化防火墙日志
 	firewallLog := model.WAFLog{
+		AppName:      a.Name,
 		CreatedAt:    now,
 		Request:      buildRequestString(req, headers),
 		Response:     "", // 暂时不处理响应
@@ -657,6 +716,9 @@ func (a *Application) saveMicroEngineLog(rule *Rule, req *applicationRequest, he
 		SrcPort:      int(req.SrcPort),
 		DstPort:      int(req.DstPort),
 		RequestID:    req.ID,
+		Engine:       model.DecisionEngineMicro,
+		Action:       flowcontroller.ActionDeny,
+		Mode:         model.DecisionModeEnforce,
 		Logs:         logs, // 直接在初始化时设置日志
 		Payload:      logMessage,
 		Date:         now.Format("2006-01-02"),
@@ -673,11 +735,37 @@ func (a *Application) saveMicroEngineLog(rule *Rule, req *applicationRequest, he
 		}
 	}
 
-	// 使用日志存储器异步存储
+	// 脱敏后使用日志存储器异步存储
+	a.redactor.Redact(&firewallLog)
+	return a.logStore.Store(firewallLog)
+}
+
+func (a *Application) saveFirewallLog(matchedRules []types.MatchedRule, interruption *types.Interruption, score *model.AnomalyScore, req *applicationRequest, headers []byte) error {
+	firewallLog := a.buildFirewallLog(matchedRules, interruption.RuleID, req, headers)
+	firewallLog.Action = interruption.Action
+	firewallLog.Mode = model.DecisionModeEnforce
+	firewallLog.AnomalyScore = score
+
+	// 脱敏后使用日志存储器异步存储
+	a.redactor.Redact(&firewallLog)
 	return a.logStore.Store(firewallLog)
 }
 
-func (a *Application) saveFirewallLog(matchedRules []types.MatchedRule, interruption *types.Interruption, req *applicationRequest, headers []byte) error {
+// saveNearMissLog 记录未被拦截但异常分数达到告警分数的请求
+func (a *Application) saveNearMissLog(matchedRules []types.MatchedRule, score *model.AnomalyScore, req *applicationRequest, headers []byte) error {
+	firewallLog := a.buildFirewallLog(matchedRules, 0, req, headers)
+	firewallLog.Action = "pass"
+	firewallLog.Mode = model.DecisionModeNearMiss
+	firewallLog.AnomalyScore = score
+	firewallLog.Message = fmt.Sprintf("near miss: inbound score %d/%d, outbound score %d/%d, last message: %s",
+		score.Inbound, score.InboundThreshold, score.Outbound, score.OutboundThreshold, firewallLog.Message)
+
+	a.redactor.Redact(&firewallLog)
+	return a.logStore.Store(firewallLog)
+}
+
+// buildFirewallLog 根据匹配的规则构建 Coraza 日志，ruleID 为中断事务的规则，该规则无匹配数据时同样记录
+func (a *Application) buildFirewallLog(matchedRules []types.MatchedRule, ruleID int, req *applicationRequest, headers []byte) model.WAFLog {
 	// 构建日志条目
 	logs := make([]model.Log, 0)
 
@@ -686,6 +774,7 @@ func (a *Application) saveFirewallLog(matchedRules []types.MatchedRule, interrup
 
 	// 初始化防火墙日志
 	firewallLog := model.WAFLog{
+		AppName:      a.Name,
 		CreatedAt:    now,
 		Request:      buildRequestString(req, headers),
 		Response:     "", // 暂时不处理响应
@@ -695,6 +784,7 @@ func (a *Application) saveFirewallLog(matchedRules []types.MatchedRule, interrup
 		SrcPort:      int(req.SrcPort),
 		DstPort:      int(req.DstPort),
 		RequestID:    req.ID,
+		Engine:       model.DecisionEngineCoraza,
 		Date:         now.Format("2006-01-02"),
 		Hour:         now.Hour(),
 		HourGroupSix: now.Hour() / 6,
@@ -711,7 +801,7 @@ func (a *Application) saveFirewallLog(matchedRules []types.MatchedRule, interrup
 
 	// 遍历所有匹配的规则
 	for _, matchedRule := range matchedRules {
-		if data := matchedRule.Data(); matchedRule.Rule().ID() == interruption.RuleID || len(data) > 0 {
+		if data := matchedRule.Data(); matchedRule.Rule().ID() == ruleID || len(data) > 0 {
 			// 添加日志条目
 			log := model.Log{
 				Message:    matchedRule.Message(),
@@ -765,8 +855,76 @@ func (a *Application) saveFirewallLog(matchedRules []types.MatchedRule, interrup
 
 	// 添加收集的所有日志
 	firewallLog.Logs = logs
+	return firewallLog
+}
+
+// recordNearMiss 事务未被拦截但异常分数达到应用的告警分数时记录 near_miss 日志
+func (a *Application) recordNearMiss(tx types.Transaction, req *applicationRequest) {
+	if a.WarningAnomalyScore <= 0 {
+		return
+	}
+	score := readAnomalyScore(tx)
+	if !reachesWarning(score, a.WarningAnomalyScore) {
+		return
+	}
+	if err := a.saveNearMissLog(tx.MatchedRules(), score, req, req.Headers); err != nil {
+		a.Logger.Error().Err(err).Msg("failed to save near miss log")
+	}
+}
 
-	// 使用日志存储器异步存储
+// saveDecisionLog 记录流控和封禁IP的拒绝决策，与攻击日志写入同一集合，泛洪时按采样率记录
+func (a *Application) saveDecisionLog(engine, action, mode, reason, data string, req *applicationRequest) error {
+	if a.logStore == nil || a.decisionLog == nil {
+		return nil
+	}
+	if rate := a.decisionLog.SampleRate; rate > 0 && rate < 1 && rand.Float64() >= rate {
+		return nil
+	}
+
+	realIP := getRealClientIP(req)
+	logMessage := fmt.Sprintf("request %s by %s, reason: %s", action, engine, reason)
+	if mode == model.DecisionModeObserve {
+		logMessage = fmt.Sprintf("request would be %s by %s (observe), reason: %s", action, engine, reason)
+	}
+
+	now := time.Now()
+	firewallLog := model.WAFLog{
+		AppName:   a.Name,
+		CreatedAt: now,
+		Request:   buildRequestString(req, req.Headers),
+		Domain:    getHostFromRequest(req),
+		URI:       buildURLFromBytes(req.Path, req.Query),
+		SrcIP:     realIP,
+		DstIP:     req.DstIp.String(),
+		SrcPort:   int(req.SrcPort),
+		DstPort:   int(req.DstPort),
+		RequestID: req.ID,
+		Engine:    engine,
+		Action:    action,
+		Mode:      mode,
+		Message:   logMessage,
+		Payload:   data,
+		Logs: []model.Log{
+			{
+				Message: logMessage,
+				Payload: data,
+				LogRaw:  logMessage,
+			},
+		},
+		Date:         now.Format("2006-01-02"),
+		Hour:         now.Hour(),
+		HourGroupSix: now.Hour() / 6,
+		Minute:       now.Minute(),
+	}
+
+	// 获取并添加源IP的地理位置信息
+	if a.ipProcessor != nil && realIP != "" {
+		if srcIPInfo := a.ipProcessor.GetIPInfo(realIP); srcIPInfo != nil {
+			firewallLog.SrcIPInfo = srcIPInfo
+		}
+	}
+
+	a.redactor.Redact(&firewallLog)
 	return a.logStore.Store(firewallLog)
 }
 
@@ -782,13 +940,74 @@ func (a AppConfig) NewApplicationWithContext(ctx context.Context, options Applic
 		ctx = context.Background()
 	}
 
+	debugLogger := debuglog.Default().
+		WithLevel(debuglog.LevelDebug).
+		WithOutput(os.Stdout)
+
+	// 审计日志存储需在编译指令前注册，写入插件初始化时按名称查找
+	directives := a.Directives
+	if options.AuditLogConfig != nil && options.AuditLogConfig.Client != nil {
+		app.auditLogStore = NewAuditLogStore(
+			options.AuditLogConfig.Client,
+			options.AuditLogConfig.Database,
+			options.AuditLogConfig.AppName,
+			options.AuditLogConfig.Config,
+			options.LogRedactor,
+			a.Logger,
+		)
+		directives += app.auditLogStore.Directives()
+	}
+
+	var config coraza.WAFConfig
+	switch {
+	case isDev && isDebug:
+		config = coraza.NewWAFConfig().
+			WithDirectives(directives).
+			WithErrorCallback(app.logCallback).
+			WithDebugLogger(debugLogger).
+			WithRootFS(mergefs.Merge(coreruleset.FS, io.OSFS))
+	case isDebug:
+		config = coraza.NewWAFConfig().
+			WithDirectives(directives).
+			WithErrorCallback(app.logCallback).
+			WithRootFS(mergefs.Merge(coreruleset.FS, io.OSFS))
+	default:
+		config = coraza.NewWAFConfig().
+			WithDirectives(directives).
+			WithRootFS(mergefs.Merge(coreruleset.FS, io.OSFS))
+	}
+
+	// 先编译指令，编译失败时不会启动日志存储、流量控制器等后台任务
+	waf, err := coraza.NewWAF(config)
+	if err != nil {
+		if app.auditLogStore != nil {
+			app.auditLogStore.Close()
+		}
+		return nil, fmt.Errorf("编译指令失败: %w", err)
+	}
+	if app.auditLogStore != nil {
+		app.auditLogStore.Start()
+	}
+	app.waf = waf
+	app.redactor = options.LogRedactor
+	app.decisionLog = options.DecisionLogConfig
+
 	if options.MongoConfig != nil && options.MongoConfig.Client != nil {
-		logStore := NewMongoLogStore(
+		storeConfig := DefaultConfig()
+		storeConfig.Spill = options.MongoConfig.Spill
+		storeConfig.Aggregation = options.MongoConfig.Aggregation
+		logStore := NewMongoLogStoreWithConfig(
 			options.MongoConfig.Client,
 			options.MongoConfig.Database,
 			options.MongoConfig.Collection,
+			storeConfig,
 			a.Logger,
 		)
+		// 日志输出挂载到应用自己的日志存储，随应用关闭
+		if group := NewLogSinkGroup(a.Name, options.LogSinks, a.Logger); group != nil {
+			logStore.AttachSinks(group)
+			app.logSinks = group
+		}
 		logStore.Start()
 		app.logStore = logStore
 	}
@@ -822,8 +1041,8 @@ func (a AppConfig) NewApplicationWithContext(ctx context.Context, options Applic
 
 	// 初始化流量控制器
 	if options.FlowControllerConfig != nil && options.FlowControllerConfig.Client != nil {
-		// 先创建IP记录器
-		ipRecorder := flowcontroller.NewMongoIPRecorder(
+		// 先获取各应用共用的IP记录器，应用关闭时释放
+		ipRecorder := flowcontroller.AcquireMongoIPRecorder(
 			options.FlowControllerConfig.Client,
 			options.FlowControllerConfig.Database,
 			10000, // 默认容量
@@ -835,12 +1054,17 @@ func (a AppConfig) NewApplicationWithContext(ctx context.Context, options Applic
 		flowController, err := flowcontroller.NewFlowControllerFromMongoConfig(
 			options.FlowControllerConfig.Client,
 			options.FlowControllerConfig.Database,
+			options.FlowControllerConfig.Namespace,
 			a.Logger,
 			ipRecorder,
 		)
 		if err != nil {
 			a.Logger.Warn().Err(err).Msg("初始化流量控制器失败")
 		} else {
+			// 配置了ASN数据库时支持按ASN升级封禁
+			if resolver, ok := app.ipProcessor.(flowcontroller.ASNResolver); ok {
+				flowController.SetASNResolver(resolver)
+			}
 			app.flowController = flowController
 			if err := app.flowController.Initialize(); err != nil {
 				a.Logger.Warn().Err(err).Msg("流量控制器初始化失败")
@@ -848,39 +1072,7 @@ func (a AppConfig) NewApplicationWithContext(ctx context.Context, options Applic
 		}
 	}
 
-	debugLogger := debuglog.Default().
-		WithLevel(debuglog.LevelDebug).
-		WithOutput(os.Stdout)
-
-	var config coraza.WAFConfig
-	switch {
-	case isDev && isDebug:
-		config = coraza.NewWAFConfig().
-			WithDirectives(a.Directives).
-			WithErrorCallback(app.logCallback).
-			WithDebugLogger(debugLogger).
-			WithRootFS(mergefs.Merge(coreruleset.FS, io.OSFS))
-	case isDebug:
-		config = coraza.NewWAFConfig().
-			WithDirectives(a.Directives).
-			WithErrorCallback(app.logCallback).
-			WithRootFS(mergefs.Merge(coreruleset.FS, io.OSFS))
-	default:
-		config = coraza.NewWAFConfig().
-			WithDirectives(a.Directives).
-			WithRootFS(mergefs.Merge(coreruleset.FS, io.OSFS))
-	}
-
-	waf, err := coraza.NewWAF(config)
-	if err != nil {
-		return nil, err
-	}
-	app.waf = waf
-
-	const defaultExpire = time.Second * 10
-	const defaultEvictionInterval = time.Second * 1
-
-	app.cache = cache.NewTTLWithCallback(defaultExpire, defaultEvictionInterval, func(key, value any) {
+	app.cache = cache.NewTTLWithCallback(defaultTransactionExpire, transactionEvictionInterval, func(key, value any) {
 		// 当transaction超时时关闭它
 		t := value.(*transaction)
 		if !t.m.TryLock() {
@@ -893,7 +1085,7 @@ func (a AppConfig) NewApplicationWithContext(ctx context.Context, options Applic
 		// 因为如果事务中断，应该在请求或响应处理阶段就已经记录了日志
 
 		// Process Logging won't do anything if TX was already logged.
-		t.tx.ProcessLogging()
+		app.processLogging(t.tx)
 		if err := t.tx.Close(); err != nil {
 			a.Logger.Error().Err(err).Str("tx", t.tx.ID()).Msg("error closing transaction")
 		}
@@ -902,6 +1094,88 @@ func (a AppConfig) NewApplicationWithContext(ctx context.Context, options Applic
 	return app, nil
 }
 
+// drainTimeout 应用被替换后仍需保留的时间，此后其缓存的事务均已过期
+func (a *Application) drainTimeout() time.Duration {
+	ttl := a.TransactionTTL
+	if ttl <= 0 {
+		ttl = defaultTransactionExpire
+	}
+	// 缓存按回收间隔更新基准时间，额外等待两个回收周期确保事务被回收
+	return ttl + 2*transactionEvictionInterval
+}
+
+// handOffLogs 热更新时关闭前调用，日志存储缓冲区中剩余的日志移交给同名新应用的日志存储
+func (a *Application) handOffLogs(successor *Application) {
+	from, ok := a.logStore.(*MongoLogStore)
+	if !ok {
+		return
+	}
+	if to, ok := successor.logStore.(*MongoLogStore); ok {
+		from.HandOff(to)
+	}
+}
+
+// logStoreStats 获取应用日志存储的计数，未使用 MongoDB 日志存储时返回 false
+func (a *Application) logStoreStats() (LogStoreStats, bool) {
+	store, ok := a.logStore.(*MongoLogStore)
+	if !ok {
+		return LogStoreStats{}, false
+	}
+	return store.Stats(), true
+}
+
+// Close 关闭应用的后台任务并释放资源，可重复调用
+// 已过期的事务会被回收，日志存储在关闭前写入或移交缓冲中的日志
+func (a *Application) Close() {
+	a.closeOnce.Do(func() {
+		a.predecessor.Store(nil)
+		if a.cache != nil {
+			a.cache.EvictExpired()
+		}
+		if a.flowController != nil {
+			if err := a.flowController.Close(); err != nil {
+				a.Logger.Error().Err(err).Msg("关闭流量控制器失败")
+			}
+		}
+		// IP记录器由各应用共用，只释放引用，最后一个应用释放时停止写入
+		if recorder, ok := a.ipRecorder.(*flowcontroller.MongoIPRecorder); ok {
+			flowcontroller.ReleaseMongoIPRecorder(recorder)
+		}
+		if a.ipProcessor != nil {
+			a.ipProcessor.Close()
+		}
+		if a.logStore != nil {
+			a.logStore.Close()
+		}
+		if a.logSinks != nil {
+			a.logSinks.Close()
+		}
+		if a.auditLogStore != nil {
+			a.auditLogStore.Close()
+		}
+	})
+}
+
+// processLogging 执行事务的日志阶段，启用审计日志时由审计日志存储记录
+func (a *Application) processLogging(tx types.Transaction) {
+	if a.auditLogStore != nil {
+		a.auditLogStore.ProcessLogging(tx)
+		return
+	}
+	tx.ProcessLogging()
+}
+
+// Validate 编译指令以校验其能否被 Coraza 加载，不创建应用及其后台任务
+func (a AppConfig) Validate() error {
+	config := coraza.NewWAFConfig().
+		WithDirectives(a.Directives).
+		WithRootFS(mergefs.Merge(coreruleset.FS, io.OSFS))
+	if _, err := coraza.NewWAF(config); err != nil {
+		return fmt.Errorf("编译指令失败: %w", err)
+	}
+	return nil
+}
+
 // NewDefaultApplication creates a new Application with background context
 func (a AppConfig) NewApplication(options ApplicationOptions) (*Application, error) {
 	return a.NewApplicationWithContext(context.Background(), options, false)
@@ -926,6 +1200,44 @@ func (a *Application) logCallback(mr types.MatchedRule) {
 
 type ErrInterrupted struct {
 	Interruption *types.Interruption
+	// RetryAfter 流控处置时建议客户端等待的时间，通过 txn.coraza.retry_after 传给 HAProxy
+	RetryAfter time.Duration
+	// Reason 拦截原因，即触发拦截的规则消息或封禁原因，通过 txn.coraza.reason 传给 HAProxy 渲染拦截页面
+	Reason string
+}
+
+// wafInterruption 将 Coraza 中断转换为 ErrInterrupted，拦截原因取触发中断的规则消息
+func wafInterruption(tx types.Transaction, it *types.Interruption) ErrInterrupted {
+	interruption := ErrInterrupted{Interruption: it}
+	for _, rule := range tx.MatchedRules() {
+		if rule.Rule().ID() == it.RuleID && rule.Message() != "" {
+			interruption.Reason = rule.Message()
+			break
+		}
+	}
+	return interruption
+}
+
+// enforcementInterruption 将流控处置方式转换为中断，HAProxy 前端按 action 执行对应的规则
+func enforcementInterruption(enforcement flowcontroller.Enforcement, reason, data string) ErrInterrupted {
+	status := http.StatusTooManyRequests
+	switch enforcement.Action {
+	case flowcontroller.ActionDeny:
+		status = http.StatusForbidden
+	case flowcontroller.ActionRedirect:
+		status = http.StatusFound
+		// HAProxy 使用 txn.coraza.data 作为跳转地址
+		data = enforcement.RedirectURL
+	}
+	return ErrInterrupted{
+		Interruption: &types.Interruption{
+			Action: enforcement.Action,
+			Status: status,
+			Data:   data,
+		},
+		RetryAfter: enforcement.RetryAfter,
+		Reason:     reason,
+	}
 }
 
 func (e ErrInterrupted) Error() string {
@@ -3,8 +3,16 @@ package internal
 import (
 	"bufio"
 	"bytes"
+	"net/http"
 	"strings"
 	"testing"
+	"time"
+
+	flowcontroller "github.com/HUAHUAI23/simple-waf/coraza-spoa/internal/flow-controller"
+	"github.com/HUAHUAI23/simple-waf/pkg/model"
+	"github.com/corazawaf/coraza/v3"
+	"github.com/rs/zerolog"
+	"go.mongodb.org/mongo-driver/v2/mongo"
 )
 
 // 原始的bufio.Scanner实现（用于对比验证）
@@ -208,3 +216,178 @@ Forwarded: for=192.168.1.100;proto=https;by=proxy`),
 		})
 	}
 }
+
+// TestEnforcementInterruption 测试流控处置方式转换为中断的状态码和跳转地址
+func TestEnforcementInterruption(t *testing.T) {
+	tests := []struct {
+		name        string
+		enforcement flowcontroller.Enforcement
+		status      int
+		data        string
+	}{
+		{
+			name:        "deny 返回 403",
+			enforcement: flowcontroller.Enforcement{Action: flowcontroller.ActionDeny},
+			status:      http.StatusForbidden,
+			data:        "blocked",
+		},
+		{
+			name:        "throttle 返回 429",
+			enforcement: flowcontroller.Enforcement{Action: flowcontroller.ActionThrottle, RetryAfter: 30 * time.Second},
+			status:      http.StatusTooManyRequests,
+			data:        "blocked",
+		},
+		{
+			name:        "tarpit 返回 429",
+			enforcement: flowcontroller.Enforcement{Action: flowcontroller.ActionTarpit, RetryAfter: time.Minute},
+			status:      http.StatusTooManyRequests,
+			data:        "blocked",
+		},
+		{
+			name:        "redirect 跳转到等待页",
+			enforcement: flowcontroller.Enforcement{Action: flowcontroller.ActionRedirect, RedirectURL: "https://example.com/wait", RetryAfter: time.Minute},
+			status:      http.StatusFound,
+			data:        "https://example.com/wait",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := enforcementInterruption(tt.enforcement, flowcontroller.ReasonVisit, "blocked")
+			if err.Interruption.Action != tt.enforcement.Action {
+				t.Errorf("Action = %q, want %q", err.Interruption.Action, tt.enforcement.Action)
+			}
+			if err.Interruption.Status != tt.status {
+				t.Errorf("Status = %d, want %d", err.Interruption.Status, tt.status)
+			}
+			if err.Interruption.Data != tt.data {
+				t.Errorf("Data = %q, want %q", err.Interruption.Data, tt.data)
+			}
+			if err.Reason != flowcontroller.ReasonVisit {
+				t.Errorf("Reason = %q, want %q", err.Reason, flowcontroller.ReasonVisit)
+			}
+			if err.RetryAfter != tt.enforcement.RetryAfter {
+				t.Errorf("RetryAfter = %v, want %v", err.RetryAfter, tt.enforcement.RetryAfter)
+			}
+		})
+	}
+}
+
+// TestWAFInterruptionReason 测试 Coraza 中断的拦截原因取触发中断的规则消息
+func TestWAFInterruptionReason(t *testing.T) {
+	waf, err := coraza.NewWAF(coraza.NewWAFConfig().WithDirectives(`
+SecRuleEngine On
+SecRule ARGS:q "@contains attack" "id:100,phase:1,pass,log,msg:'Attack probe'"
+SecRule ARGS:q "@contains attack" "id:101,phase:1,deny,status:403,log,msg:'Attack blocked'"
+`))
+	if err != nil {
+		t.Fatalf("编译指令失败: %v", err)
+	}
+
+	tx := waf.NewTransaction()
+	defer tx.Close()
+	tx.ProcessURI("/?q=attack", "GET", "HTTP/1.1")
+	it := tx.ProcessRequestHeaders()
+	if it == nil {
+		t.Fatal("请求应被拦截")
+	}
+
+	if got := wafInterruption(tx, it); got.Interruption != it || got.Reason != "Attack blocked" {
+		t.Errorf("wafInterruption() = %+v, 期望拦截原因为触发中断的规则消息", got)
+	}
+}
+
+// memoryLogStore 将日志保存在内存中的日志存储
+type memoryLogStore struct {
+	logs []model.WAFLog
+}
+
+func (s *memoryLogStore) Store(log model.WAFLog) error {
+	s.logs = append(s.logs, log)
+	return nil
+}
+
+func (s *memoryLogStore) Start() {}
+
+func (s *memoryLogStore) Close() {}
+
+// TestSaveDecisionLogSampling 测试决策记录按采样率写入，采样率不在 (0,1) 范围内时全部记录
+func TestSaveDecisionLogSampling(t *testing.T) {
+	const total = 10000
+	tests := []struct {
+		name     string
+		config   *DecisionLogConfig
+		min, max int
+	}{
+		{"未配置时不记录", nil, 0, 0},
+		{"采样率为 0 时全部记录", &DecisionLogConfig{}, total, total},
+		{"采样率为 1 时全部记录", &DecisionLogConfig{SampleRate: 1}, total, total},
+		{"采样率为 0.1 时约记录十分之一", &DecisionLogConfig{SampleRate: 0.1}, total / 20, total * 3 / 20},
+	}
+
+	req := &applicationRequest{Path: []byte("/login"), Headers: []byte("Host: example.com")}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &memoryLogStore{}
+			app := &Application{logStore: store, decisionLog: tt.config}
+			for i := 0; i < total; i++ {
+				if err := app.saveDecisionLog(model.DecisionEngineFlow, flowcontroller.ActionThrottle, model.DecisionModeEnforce, flowcontroller.ReasonVisit, "Too many requests", req); err != nil {
+					t.Fatalf("记录决策失败: %v", err)
+				}
+			}
+			if len(store.logs) < tt.min || len(store.logs) > tt.max {
+				t.Errorf("记录了 %d 条，期望在 %d 和 %d 之间", len(store.logs), tt.min, tt.max)
+			}
+		})
+	}
+}
+
+// TestSaveDecisionLogObserve 测试监控模式的决策记录标记为 observe
+func TestSaveDecisionLogObserve(t *testing.T) {
+	store := &memoryLogStore{}
+	app := &Application{logStore: store, decisionLog: &DecisionLogConfig{}}
+	req := &applicationRequest{Path: []byte("/login"), Headers: []byte("Host: example.com")}
+
+	if err := app.saveDecisionLog(model.DecisionEngineFlow, flowcontroller.ActionThrottle, model.DecisionModeObserve, flowcontroller.ReasonVisit, "Too many requests", req); err != nil {
+		t.Fatalf("记录决策失败: %v", err)
+	}
+	if len(store.logs) != 1 {
+		t.Fatalf("记录了 %d 条，期望 1 条", len(store.logs))
+	}
+	log := store.logs[0]
+	if log.Engine != model.DecisionEngineFlow || log.Action != flowcontroller.ActionThrottle || log.Mode != model.DecisionModeObserve {
+		t.Errorf("决策记录字段错误: engine=%s action=%s mode=%s", log.Engine, log.Action, log.Mode)
+	}
+	if !strings.Contains(log.Message, "would be") || log.URI != "/login" {
+		t.Errorf("决策记录内容错误: message=%q uri=%q", log.Message, log.URI)
+	}
+}
+
+// TestApplicationCloseSharedIPRecorder 测试共用IP记录器的应用分别关闭，最后一个应用关闭后才释放记录器
+func TestApplicationCloseSharedIPRecorder(t *testing.T) {
+	client, err := mongo.Connect()
+	if err != nil {
+		t.Fatalf("创建客户端失败: %v", err)
+	}
+	recorder := flowcontroller.AcquireMongoIPRecorder(client, "waf", 100, zerolog.Nop())
+	apps := []*Application{
+		{ipRecorder: recorder, AppConfig: AppConfig{Logger: zerolog.Nop()}},
+		{ipRecorder: flowcontroller.AcquireMongoIPRecorder(client, "waf", 100, zerolog.Nop()), AppConfig: AppConfig{Logger: zerolog.Nop()}},
+	}
+
+	apps[0].Close()
+	apps[0].Close()
+	// 仍有应用使用时再次获取到同一个记录器
+	current := flowcontroller.AcquireMongoIPRecorder(client, "waf", 100, zerolog.Nop())
+	if current != recorder {
+		t.Fatal("仍有应用使用时不应释放IP记录器")
+	}
+	flowcontroller.ReleaseMongoIPRecorder(current)
+
+	apps[1].Close()
+	next := flowcontroller.AcquireMongoIPRecorder(client, "waf", 100, zerolog.Nop())
+	defer flowcontroller.ReleaseMongoIPRecorder(next)
+	if next == recorder {
+		t.Fatal("最后一个应用关闭后应释放IP记录器")
+	}
+}
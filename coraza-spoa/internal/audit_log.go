@@ -0,0 +1,319 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/HUAHUAI23/simple-waf/pkg/model"
+	"github.com/corazawaf/coraza/v3/experimental/plugins"
+	"github.com/corazawaf/coraza/v3/experimental/plugins/plugintypes"
+	"github.com/corazawaf/coraza/v3/types"
+	"github.com/rs/zerolog"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// auditLogWriterName 审计日志写入插件名称，通过 SecAuditLogType 指定
+const auditLogWriterName = "simple_waf_mongo"
+
+// 审计日志存储的缓冲和批量写入参数
+const (
+	auditLogBufferSize    = 1024
+	auditLogBatchSize     = 100
+	auditLogBatchInterval = time.Second
+)
+
+func init() {
+	plugins.RegisterAuditLogWriter(auditLogWriterName, func() plugintypes.AuditLogWriter {
+		return &auditLogWriter{}
+	})
+}
+
+// auditLogStores 审计日志写入插件通过 SecAuditLog 指定的名称查找所属应用的存储
+var (
+	auditLogStores   sync.Map // string -> *AuditLogStore
+	auditLogStoreSeq atomic.Uint64
+)
+
+// ValidateAuditLogConfig 校验审计日志配置
+func ValidateAuditLogConfig(config model.AuditLogConfig) error {
+	if !config.Enabled {
+		return nil
+	}
+	if _, err := types.ParseAuditLogParts(config.Parts); err != nil {
+		return fmt.Errorf("无效的审计日志部分 %q: %w", config.Parts, err)
+	}
+	if config.BodyLimit < 0 {
+		return fmt.Errorf("无效的审计日志请求体长度限制: %d", config.BodyLimit)
+	}
+	if config.RetentionDays <= 0 {
+		return fmt.Errorf("无效的审计日志保留天数: %d", config.RetentionDays)
+	}
+	return nil
+}
+
+// AuditLogStore 将应用的 Coraza 审计日志异步批量写入 MongoDB
+// 每个应用使用独立的存储，随应用关闭而关闭
+type AuditLogStore struct {
+	name       string
+	appName    string
+	config     model.AuditLogConfig
+	collection *mongo.Collection
+	redactor   *LogRedactor
+	logger     zerolog.Logger
+	records    chan model.AuditLog
+	// pending 正在记录日志的事务，写入时从中读取异常评分
+	pending   sync.Map // string -> types.Transaction
+	closing   chan struct{}
+	closeOnce sync.Once
+	wg        sync.WaitGroup
+}
+
+// NewAuditLogStore 创建审计日志存储并注册到写入插件，需调用 Start 启动写入
+func NewAuditLogStore(client *mongo.Client, database, appName string, config model.AuditLogConfig, redactor *LogRedactor, logger zerolog.Logger) *AuditLogStore {
+	var auditLog model.AuditLog
+	s := &AuditLogStore{
+		name:       fmt.Sprintf("%s-%d", appName, auditLogStoreSeq.Add(1)),
+		appName:    appName,
+		config:     config,
+		collection: client.Database(database).Collection(auditLog.GetCollectionName()),
+		redactor:   redactor,
+		logger:     logger,
+		records:    make(chan model.AuditLog, auditLogBufferSize),
+		closing:    make(chan struct{}),
+	}
+	auditLogStores.Store(s.name, s)
+	return s
+}
+
+// Directives 返回启用审计日志写入插件的指令，追加在应用指令之后以覆盖应用中的审计日志设置
+func (s *AuditLogStore) Directives() string {
+	return fmt.Sprintf("\nSecAuditEngine RelevantOnly\nSecAuditLogParts %s\nSecAuditLogType %s\nSecAuditLog %s\n",
+		s.config.Parts, auditLogWriterName, s.name)
+}
+
+// Start 启动写入协程
+func (s *AuditLogStore) Start() {
+	s.wg.Add(1)
+	go s.writer()
+}
+
+// Close 注销存储，写入缓冲中的审计日志后返回，可重复调用
+func (s *AuditLogStore) Close() {
+	s.closeOnce.Do(func() {
+		auditLogStores.Delete(s.name)
+		close(s.closing)
+		s.wg.Wait()
+	})
+}
+
+// ProcessLogging 执行事务的日志阶段，写入审计日志时附带事务的异常评分
+func (s *AuditLogStore) ProcessLogging(tx types.Transaction) {
+	id := tx.ID()
+	s.pending.Store(id, tx)
+	defer s.pending.Delete(id)
+	tx.ProcessLogging()
+}
+
+// store 将审计日志放入缓冲，缓冲已满或存储已关闭时丢弃
+func (s *AuditLogStore) store(record model.AuditLog) {
+	select {
+	case <-s.closing:
+		return
+	default:
+	}
+	select {
+	case s.records <- record:
+	default:
+		s.logger.Warn().Str("tx", record.RequestID).Msg("审计日志缓冲已满，丢弃审计日志")
+	}
+}
+
+// writer 按批次或间隔写入审计日志，关闭时写入缓冲中剩余的日志
+func (s *AuditLogStore) writer() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(auditLogBatchInterval)
+	defer ticker.Stop()
+
+	batch := make([]interface{}, 0, auditLogBatchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if _, err := s.collection.InsertMany(ctx, batch); err != nil {
+			s.logger.Error().Err(err).Int("count", len(batch)).Msg("写入审计日志失败")
+		}
+		batch = batch[:0]
+	}
+
+	for {
+		select {
+		case record := <-s.records:
+			batch = append(batch, record)
+			if len(batch) >= auditLogBatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-s.closing:
+			for {
+				select {
+				case record := <-s.records:
+					batch = append(batch, record)
+					if len(batch) >= auditLogBatchSize {
+						flush()
+					}
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+// buildRecord 将 Coraza 审计日志转换为存储的记录，请求体和响应体按长度限制截断
+func (s *AuditLogStore) buildRecord(al plugintypes.AuditLog) model.AuditLog {
+	tx := al.Transaction()
+	now := time.Now()
+	createdAt := now
+	if ts := tx.UnixTimestamp(); ts > 0 {
+		createdAt = time.Unix(0, ts)
+	}
+
+	record := model.AuditLog{
+		RequestID:       tx.ID(),
+		AppName:         s.appName,
+		Parts:           "A" + string(al.Parts()) + "Z",
+		ClientIP:        tx.ClientIP(),
+		ClientPort:      tx.ClientPort(),
+		HostIP:          tx.HostIP(),
+		HostPort:        tx.HostPort(),
+		Interrupted:     tx.IsInterrupted(),
+		HighestSeverity: tx.HighestSeverity(),
+		Messages:        make([]model.AuditLogMessage, 0, len(al.Messages())),
+		CreatedAt:       createdAt,
+		ExpireAt:        now.AddDate(0, 0, s.config.RetentionDays),
+	}
+
+	if tx.HasRequest() {
+		req := tx.Request()
+		body, truncated := truncateBody(req.Body(), s.config.BodyLimit)
+		record.Request = &model.AuditLogRequest{
+			Method:        req.Method(),
+			URI:           req.URI(),
+			Protocol:      req.Protocol(),
+			Headers:       req.Headers(),
+			Body:          body,
+			BodyTruncated: truncated,
+			Length:        req.Length(),
+		}
+		for _, file := range req.Files() {
+			record.Request.Files = append(record.Request.Files, model.AuditLogFile{
+				Name: file.Name(),
+				Size: file.Size(),
+				Mime: file.Mime(),
+			})
+		}
+	}
+
+	if tx.HasResponse() {
+		res := tx.Response()
+		body, truncated := truncateBody(res.Body(), s.config.BodyLimit)
+		record.Response = &model.AuditLogResponse{
+			Protocol:      res.Protocol(),
+			Status:        res.Status(),
+			Headers:       res.Headers(),
+			Body:          body,
+			BodyTruncated: truncated,
+		}
+	}
+
+	for _, msg := range al.Messages() {
+		data := msg.Data()
+		record.Messages = append(record.Messages, model.AuditLogMessage{
+			RuleID:   data.ID(),
+			Message:  data.Msg(),
+			Data:     data.Data(),
+			Severity: int(data.Severity()),
+			Tags:     data.Tags(),
+			File:     data.File(),
+			Line:     data.Line(),
+		})
+	}
+
+	if v, ok := s.pending.Load(tx.ID()); ok {
+		record.AnomalyScores = anomalyScores(v.(types.Transaction))
+	}
+
+	s.redactor.RedactAuditLog(&record)
+	return record
+}
+
+// truncateBody 按长度限制截断内容，limit 不大于 0 时不截断
+func truncateBody(body string, limit int) (string, bool) {
+	if limit <= 0 || len(body) <= limit {
+		return body, false
+	}
+	return body[:limit], true
+}
+
+// anomalyScores 读取事务中 CRS 设置的异常评分变量
+func anomalyScores(tx types.Transaction) map[string]int {
+	state, ok := tx.(plugintypes.TransactionState)
+	if !ok {
+		return nil
+	}
+
+	var scores map[string]int
+	for _, md := range state.Variables().TX().FindAll() {
+		if !strings.Contains(md.Key(), "anomaly_score") {
+			continue
+		}
+		score, err := strconv.Atoi(md.Value())
+		if err != nil {
+			continue
+		}
+		if scores == nil {
+			scores = make(map[string]int)
+		}
+		scores[md.Key()] = score
+	}
+	return scores
+}
+
+// auditLogWriter Coraza 审计日志写入插件，将审计日志交给 SecAuditLog 指定的存储
+type auditLogWriter struct {
+	store *AuditLogStore
+}
+
+// Init 根据 SecAuditLog 查找存储
+func (w *auditLogWriter) Init(config plugintypes.AuditLogConfig) error {
+	v, ok := auditLogStores.Load(config.Target)
+	if !ok {
+		return fmt.Errorf("审计日志存储 %s 不存在", config.Target)
+	}
+	w.store = v.(*AuditLogStore)
+	return nil
+}
+
+// Write 转换审计日志并放入存储的缓冲
+func (w *auditLogWriter) Write(al plugintypes.AuditLog) error {
+	if w.store == nil {
+		return nil
+	}
+	w.store.store(w.store.buildRecord(al))
+	return nil
+}
+
+// Close 存储随应用关闭，此处无需处理
+func (w *auditLogWriter) Close() error {
+	return nil
+}
@@ -0,0 +1,111 @@
+package internal
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/HUAHUAI23/simple-waf/pkg/model"
+	"github.com/corazawaf/coraza/v3"
+	"github.com/rs/zerolog"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// TestAuditLogStoreCapture 测试审计日志写入插件记录相关事务，并附带异常评分、截断请求体和脱敏
+func TestAuditLogStoreCapture(t *testing.T) {
+	client, err := mongo.Connect()
+	if err != nil {
+		t.Fatalf("创建客户端失败: %v", err)
+	}
+	redactor, err := NewLogRedactor(model.LogRedactionConfig{Enabled: true, Headers: []string{"Authorization"}})
+	if err != nil {
+		t.Fatalf("创建脱敏器失败: %v", err)
+	}
+
+	// 未启动写入协程，审计日志保留在缓冲中
+	store := NewAuditLogStore(client, "waf", "test", model.AuditLogConfig{
+		Enabled:       true,
+		Parts:         "ABCKZ",
+		BodyLimit:     8,
+		RetentionDays: 1,
+	}, redactor, zerolog.Nop())
+	defer store.Close()
+
+	waf, err := coraza.NewWAF(coraza.NewWAFConfig().WithDirectives(`
+SecRuleEngine On
+SecRequestBodyAccess On
+SecAction "id:1,phase:1,pass,nolog,setvar:tx.inbound_anomaly_score_pl1=0"
+SecRule ARGS:q "@contains attack" "id:100,phase:2,deny,status:403,log,auditlog,msg:'attack',setvar:tx.inbound_anomaly_score_pl1=+5"
+` + store.Directives()))
+	if err != nil {
+		t.Fatalf("编译指令失败: %v", err)
+	}
+
+	run := func(id, query string) {
+		tx := waf.NewTransactionWithID(id)
+		tx.ProcessConnection("192.168.1.1", 52134, "10.0.0.1", 80)
+		tx.ProcessURI("/search?q="+query, "POST", "HTTP/1.1")
+		tx.AddRequestHeader("Authorization", "Bearer secret")
+		tx.ProcessRequestHeaders()
+		if _, _, err := tx.WriteRequestBody([]byte("0123456789abcdef")); err != nil {
+			t.Fatalf("写入请求体失败: %v", err)
+		}
+		if _, err := tx.ProcessRequestBody(); err != nil {
+			t.Fatalf("处理请求体失败: %v", err)
+		}
+		store.ProcessLogging(tx)
+		_ = tx.Close()
+	}
+
+	run("clean", "hello")
+	run("tx-1", "attack")
+
+	if len(store.records) != 1 {
+		t.Fatalf("应只记录相关事务，实际记录 %d 条", len(store.records))
+	}
+	record := <-store.records
+
+	if record.RequestID != "tx-1" || record.AppName != "test" || !record.Interrupted {
+		t.Errorf("事务信息不正确: %+v", record)
+	}
+	if record.AnomalyScores["inbound_anomaly_score_pl1"] != 5 {
+		t.Errorf("异常评分不正确: %v", record.AnomalyScores)
+	}
+	if len(record.Messages) != 1 || record.Messages[0].RuleID != 100 {
+		t.Errorf("匹配规则不正确: %+v", record.Messages)
+	}
+	if record.Request == nil {
+		t.Fatal("缺少请求信息")
+	}
+	if record.Request.Body != "01234567" || !record.Request.BodyTruncated {
+		t.Errorf("请求体应被截断: %q", record.Request.Body)
+	}
+	if auth := strings.Join(record.Request.Headers["authorization"], ""); auth != redactionMask {
+		t.Errorf("请求头应被脱敏: %q", auth)
+	}
+	if !record.ExpireAt.After(record.CreatedAt) {
+		t.Errorf("过期时间应晚于事务时间: %v, %v", record.ExpireAt, record.CreatedAt)
+	}
+}
+
+// TestValidateAuditLogConfig 测试审计日志配置校验
+func TestValidateAuditLogConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  model.AuditLogConfig
+		wantErr bool
+	}{
+		{"未启用", model.AuditLogConfig{Parts: "X"}, false},
+		{"默认配置", model.GetDefaultAuditLogConfig(), false},
+		{"部分不以A开头", model.AuditLogConfig{Enabled: true, Parts: "BZ", RetentionDays: 1}, true},
+		{"无效的部分", model.AuditLogConfig{Enabled: true, Parts: "AXZ", RetentionDays: 1}, true},
+		{"保留天数为0", model.AuditLogConfig{Enabled: true, Parts: "ABZ"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidateAuditLogConfig(tt.config); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateAuditLogConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
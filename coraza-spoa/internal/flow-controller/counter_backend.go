@@ -0,0 +1,257 @@
+package flowcontroller
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog"
+)
+
+// 计数后端类型
+const (
+	CounterBackendLocal = "local" // 进程内计数
+	CounterBackendRedis = "redis" // Redis 协议的共享计数
+)
+
+// CounterBackendConfig 计数后端配置
+type CounterBackendConfig struct {
+	Type      string        // 后端类型
+	Addr      string        // Redis地址
+	Password  string        // Redis密码
+	DB        int           // Redis数据库编号
+	KeyPrefix string        // 计数键前缀
+	Timeout   time.Duration // 单次计数请求超时时间
+}
+
+// CounterBackend 限流计数后端，负责按规则创建限流器
+type CounterBackend interface {
+	// NewLimiter 为指定资源创建限流器
+	NewLimiter(resource string, rule LimitRule) Limiter
+	// Close 释放后端连接等资源
+	Close() error
+}
+
+// NewCounterBackend 根据配置创建计数后端
+// namespace 用于隔离不同应用的计数，未知类型回退为本地计数
+func NewCounterBackend(config CounterBackendConfig, namespace string, logger zerolog.Logger) CounterBackend {
+	switch config.Type {
+	case CounterBackendRedis:
+		return NewRedisCounterBackend(config, namespace, logger)
+	case "", CounterBackendLocal:
+		return LocalCounterBackend{}
+	default:
+		logger.Warn().Str("type", config.Type).Msg("未知的计数后端类型，使用本地计数")
+		return LocalCounterBackend{}
+	}
+}
+
+// LocalCounterBackend 进程内计数后端
+type LocalCounterBackend struct{}
+
+// NewLimiter 创建本地限流器
+func (LocalCounterBackend) NewLimiter(_ string, rule LimitRule) Limiter {
+	return NewLocalLimiter(rule)
+}
+
+// Close 本地后端无需释放资源
+func (LocalCounterBackend) Close() error {
+	return nil
+}
+
+// slidingWindowScript 原子滑动窗口计数
+// 使用有序集合记录窗口内的事件，时间取自 Redis 服务器，避免多实例时钟偏差
+// KEYS[1]: 计数键 ARGV[1]: 窗口（毫秒） ARGV[2]: 上限 ARGV[3]: 事件成员唯一后缀
+var slidingWindowScript = redis.NewScript(`
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+local window = tonumber(ARGV[1])
+local limit = tonumber(ARGV[2])
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', now - window)
+local count = redis.call('ZCARD', KEYS[1])
+local allowed = 0
+if count < limit then
+	redis.call('ZADD', KEYS[1], now, now .. '-' .. ARGV[3])
+	allowed = 1
+end
+redis.call('PEXPIRE', KEYS[1], window)
+return allowed
+`)
+
+// fixedWindowScript 原子固定窗口计数
+// 窗口按 Redis 服务器时间对齐，每个窗口使用独立的计数键，过期后自动删除
+// KEYS[1]: 计数键 ARGV[1]: 窗口（毫秒） ARGV[2]: 上限
+var fixedWindowScript = redis.NewScript(`
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+local window = tonumber(ARGV[1])
+local key = KEYS[1] .. ':' .. math.floor(now / window)
+local count = redis.call('INCR', key)
+if count == 1 then
+	redis.call('PEXPIRE', key, window)
+end
+if count <= tonumber(ARGV[2]) then
+	return 1
+end
+return 0
+`)
+
+// tokenBucketScript 原子令牌桶计数
+// KEYS[1]: 计数键 ARGV[1]: 桶容量 ARGV[2]: 每毫秒补充的令牌数 ARGV[3]: 键过期时间（毫秒）
+var tokenBucketScript = redis.NewScript(`
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+local capacity = tonumber(ARGV[1])
+local rate = tonumber(ARGV[2])
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(state[1])
+local ts = tonumber(state[2])
+if tokens == nil or ts == nil then
+	tokens = capacity
+	ts = now
+end
+if now > ts then
+	tokens = math.min(capacity, tokens + (now - ts) * rate)
+	ts = now
+end
+local allowed = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+end
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'ts', ts)
+redis.call('PEXPIRE', KEYS[1], ARGV[3])
+return allowed
+`)
+
+// RedisCounterBackend Redis 协议的共享计数后端
+// 多个引擎实例指向同一 Redis 时共享同一计数，Redis 不可用时由熔断器切换到本地计数
+type RedisCounterBackend struct {
+	client    *redis.Client
+	keyPrefix string
+	timeout   time.Duration
+	breaker   *CircuitBreaker
+	logger    zerolog.Logger
+	seq       atomic.Uint64 // 事件序号，保证同一毫秒内的成员唯一
+	instance  string        // 实例标识，保证多实例间的成员唯一
+}
+
+// NewRedisCounterBackend 创建 Redis 计数后端
+func NewRedisCounterBackend(config CounterBackendConfig, namespace string, logger zerolog.Logger) *RedisCounterBackend {
+	timeout := config.Timeout
+	if timeout <= 0 {
+		timeout = 50 * time.Millisecond
+	}
+	keyPrefix := config.KeyPrefix
+	if keyPrefix == "" {
+		keyPrefix = "ruiqi:flow"
+	}
+	if namespace != "" {
+		keyPrefix = keyPrefix + ":" + namespace
+	}
+
+	client := redis.NewClient(&redis.Options{
+		Addr:         config.Addr,
+		Password:     config.Password,
+		DB:           config.DB,
+		DialTimeout:  timeout,
+		ReadTimeout:  timeout,
+		WriteTimeout: timeout,
+		MaxRetries:   -1, // 失败直接回退本地计数，不重试
+	})
+
+	logger.Info().
+		Str("addr", config.Addr).
+		Str("key_prefix", keyPrefix).
+		Dur("timeout", timeout).
+		Msg("使用Redis限流计数后端")
+
+	return &RedisCounterBackend{
+		client:    client,
+		keyPrefix: keyPrefix,
+		timeout:   timeout,
+		breaker:   NewCircuitBreaker(3, 10*time.Second, 3),
+		logger:    logger,
+		instance:  fmt.Sprintf("%x", time.Now().UnixNano()),
+	}
+}
+
+// NewLimiter 按规则中的算法创建共享限流器，附带同规则的本地限流器作为回退
+// 滑动窗口在 Redis 上按事件日志精确计数，本地回退使用滑动窗口计数估算
+func (b *RedisCounterBackend) NewLimiter(resource string, rule LimitRule) Limiter {
+	rule = rule.normalize()
+	window := rule.StatDuration.Milliseconds()
+	limit := rule.limit()
+
+	l := &redisLimiter{
+		backend:   b,
+		keyPrefix: b.keyPrefix + ":" + resource + ":",
+		fallback:  NewLocalLimiter(rule),
+	}
+	switch rule.Algorithm {
+	case AlgorithmSlidingWindow:
+		l.script = slidingWindowScript
+		l.args = func() []interface{} {
+			return []interface{}{window, limit, fmt.Sprintf("%s-%d", b.instance, b.seq.Add(1))}
+		}
+	case AlgorithmFixedWindow:
+		l.script = fixedWindowScript
+		l.args = func() []interface{} {
+			return []interface{}{window, limit}
+		}
+	default:
+		rate := float64(rule.Threshold) / float64(window)
+		// 键在桶补满后过期，过期后重新按满桶计算，结果一致
+		ttl := window
+		if rule.Threshold > 0 {
+			ttl = max(window, window*limit/rule.Threshold)
+		}
+		l.script = tokenBucketScript
+		l.args = func() []interface{} {
+			return []interface{}{limit, rate, ttl}
+		}
+	}
+	return l
+}
+
+// Close 关闭 Redis 连接
+func (b *RedisCounterBackend) Close() error {
+	return b.client.Close()
+}
+
+// redisLimiter Redis 限流器，计数逻辑由 Lua 脚本原子执行
+type redisLimiter struct {
+	backend   *RedisCounterBackend
+	keyPrefix string
+	script    *redis.Script
+	args      func() []interface{} // 每次计数的脚本参数
+	fallback  Limiter
+}
+
+// Allow 在 Redis 上原子计数，失败或熔断时使用本地计数
+func (l *redisLimiter) Allow(key string) bool {
+	b := l.backend
+	if b.breaker.IsOpen() {
+		return l.fallback.Allow(key)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), b.timeout)
+	defer cancel()
+
+	allowed, err := l.script.Run(ctx, b.client, []string{l.keyPrefix + key}, l.args()...).Int()
+	if err != nil {
+		b.breaker.RecordFailure()
+		b.logger.Debug().Err(err).Str("key", key).Msg("Redis限流计数失败，回退到本地计数")
+		return l.fallback.Allow(key)
+	}
+
+	b.breaker.RecordSuccess()
+	return allowed == 1
+}
+
+// Close 关闭回退限流器，Redis 连接由后端统一关闭
+func (l *redisLimiter) Close() {
+	l.fallback.Close()
+}
@@ -0,0 +1,94 @@
+package flowcontroller
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// TestRedisCounterBackendFallback Redis 不可达时回退到本地计数
+func TestRedisCounterBackendFallback(t *testing.T) {
+	backend := NewRedisCounterBackend(CounterBackendConfig{
+		Type:    CounterBackendRedis,
+		Addr:    "127.0.0.1:1", // 无服务监听的端口
+		Timeout: 20 * time.Millisecond,
+	}, "test", zerolog.Nop())
+	defer backend.Close()
+
+	limiter := backend.NewLimiter(ResourceVisit, LimitRule{
+		Threshold:    3,
+		StatDuration: time.Minute,
+	})
+	defer limiter.Close()
+
+	for i := 0; i < 3; i++ {
+		if !limiter.Allow("10.0.0.1") {
+			t.Fatalf("第 %d 次请求应被放行", i+1)
+		}
+	}
+	if limiter.Allow("10.0.0.1") {
+		t.Fatal("超过阈值的请求应被拒绝")
+	}
+	if !limiter.Allow("10.0.0.2") {
+		t.Fatal("其他IP不应受影响")
+	}
+	if !backend.breaker.IsOpen() {
+		t.Fatal("连续失败后熔断器应打开")
+	}
+}
+
+// TestRedisCounterBackendShared 多个实例共享同一 Redis 计数
+// 需要本地 redis-server，通过 REDIS_ADDR 指定地址，例如 REDIS_ADDR=127.0.0.1:6379
+func TestRedisCounterBackendShared(t *testing.T) {
+	addr := os.Getenv("REDIS_ADDR")
+	if addr == "" {
+		t.Skip("未设置 REDIS_ADDR，跳过 Redis 集成测试")
+	}
+
+	config := CounterBackendConfig{
+		Type:      CounterBackendRedis,
+		Addr:      addr,
+		KeyPrefix: fmt.Sprintf("ruiqi:test:%d", time.Now().UnixNano()),
+		Timeout:   time.Second,
+	}
+	rule := LimitRule{Threshold: 4, BurstCount: 1, StatDuration: time.Minute}
+
+	// 模拟两个引擎实例
+	agentA := NewRedisCounterBackend(config, "app", zerolog.Nop())
+	defer agentA.Close()
+	agentB := NewRedisCounterBackend(config, "app", zerolog.Nop())
+	defer agentB.Close()
+	limiterA := agentA.NewLimiter(ResourceVisit, rule)
+	defer limiterA.Close()
+	limiterB := agentB.NewLimiter(ResourceVisit, rule)
+	defer limiterB.Close()
+
+	allowed := 0
+	for i := 0; i < 10; i++ {
+		limiter := limiterA
+		if i%2 == 1 {
+			limiter = limiterB
+		}
+		if limiter.Allow("10.0.0.1") {
+			allowed++
+		}
+	}
+	if allowed != 5 {
+		t.Fatalf("两个实例合计应放行 5 次，实际 %d 次", allowed)
+	}
+	if agentA.breaker.IsOpen() || agentB.breaker.IsOpen() {
+		t.Fatal("Redis 可用时熔断器不应打开")
+	}
+
+	// 不同命名空间的计数互不影响
+	other := NewRedisCounterBackend(config, "other-app", zerolog.Nop())
+	defer other.Close()
+	otherLimiter := other.NewLimiter(ResourceVisit, rule)
+	defer otherLimiter.Close()
+	if !otherLimiter.Allow("10.0.0.1") {
+		t.Fatal("其他应用的计数不应受影响")
+	}
+}
@@ -0,0 +1,60 @@
+package flowcontroller
+
+import (
+	"time"
+
+	"github.com/HUAHUAI23/simple-waf/pkg/model"
+)
+
+// 拒绝请求时的处置动作，由 HAProxy 前端按 txn.coraza.action 执行
+const (
+	ActionDeny     = model.FlowControlActionDeny     // 返回 403
+	ActionThrottle = model.FlowControlActionThrottle // 返回 429 并携带 Retry-After
+	ActionTarpit   = model.FlowControlActionTarpit   // 延迟 tarpit 超时后返回 429
+	ActionDrop     = model.FlowControlActionDrop     // 不响应直接断开连接
+	ActionRedirect = model.FlowControlActionRedirect // 302 跳转到等待页
+)
+
+// Enforcement 拒绝请求时的处置方式
+type Enforcement struct {
+	Action      string        // 处置动作
+	RedirectURL string        // redirect 动作的跳转地址
+	RetryAfter  time.Duration // 建议客户端等待的时间，即封禁剩余时长
+}
+
+// Enforcement 返回指定封禁原因对应的处置方式
+// blockedUntil 为零值时按规则的封禁时长计算，用于刚触发限制的请求；
+// 找不到对应规则（如网段升级封禁、手动封禁或规则已删除）时直接拒绝
+func (fc *FlowController) Enforcement(reason string, blockedUntil time.Time) Enforcement {
+	fc.mutex.RLock()
+	rule := fc.ruleByReason(reason)
+	fc.mutex.RUnlock()
+
+	enforcement := Enforcement{Action: ActionDeny}
+	if rule != nil {
+		enforcement.Action = rule.action
+		enforcement.RedirectURL = rule.redirectURL
+		if blockedUntil.IsZero() {
+			blockedUntil = time.Now().Add(rule.blockDuration)
+		}
+	}
+	if !blockedUntil.IsZero() {
+		enforcement.RetryAfter = max(time.Until(blockedUntil), time.Second)
+	}
+	return enforcement
+}
+
+// ruleByReason 按封禁原因查找规则，调用方需持有读锁
+func (fc *FlowController) ruleByReason(reason string) *limitRule {
+	for _, rule := range []*limitRule{fc.visitRule, fc.attackRule} {
+		if rule != nil && rule.reason == reason {
+			return rule
+		}
+	}
+	for _, rule := range fc.errorRules {
+		if rule.reason == reason {
+			return rule.limitRule
+		}
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+package flowcontroller
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/HUAHUAI23/simple-waf/pkg/model"
+)
+
+// recordedBlock 测试记录器记录的一次封禁
+type recordedBlock struct {
+	ip       string
+	reason   string
+	duration time.Duration
+}
+
+// testRecorder 只记录调用的IP记录器
+type testRecorder struct {
+	mu        sync.Mutex
+	blocked   []recordedBlock
+	simulated []recordedBlock
+}
+
+func (r *testRecorder) RecordBlockedIP(ip string, reason string, _ string, duration time.Duration) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.blocked = append(r.blocked, recordedBlock{ip: ip, reason: reason, duration: duration})
+	return nil
+}
+
+func (r *testRecorder) RecordSimulatedBlock(ip string, reason string, _ string, duration time.Duration) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.simulated = append(r.simulated, recordedBlock{ip: ip, reason: reason, duration: duration})
+	return nil
+}
+
+func (r *testRecorder) RecordBlockedPrefix(PrefixBan) error { return nil }
+
+func (r *testRecorder) ConfigureSubnetEscalation(SubnetEscalationConfig, ASNResolver) {}
+
+func (r *testRecorder) IsIPBlocked(string) (bool, *model.BlockedIPRecord) { return false, nil }
+
+func (r *testRecorder) GetBlockedIPs() ([]model.BlockedIPRecord, error) { return nil, nil }
+
+func (r *testRecorder) Close() error { return nil }
+
+func (r *testRecorder) GetMetrics() *Metrics { return &Metrics{} }
+
+// newTestFlowController 创建使用本地计数后端的已初始化流控处理器
+func newTestFlowController(t *testing.T, config FlowControlConfig) (*FlowController, *testRecorder) {
+	t.Helper()
+	recorder := &testRecorder{}
+	fc := NewFlowController(config, zerolog.Nop(), recorder)
+	if err := fc.Initialize(); err != nil {
+		t.Fatalf("初始化流控处理器失败: %v", err)
+	}
+	t.Cleanup(func() { fc.Close() })
+	return fc, recorder
+}
+
+// TestEnforcement 校验各封禁原因对应的处置方式，且与控制台同步封禁IP时使用的判断一致
+func TestEnforcement(t *testing.T) {
+	var modelConfig model.FlowControlConfig
+	modelConfig.VisitLimit.Enabled = true
+	modelConfig.VisitLimit.Threshold = 10
+	modelConfig.VisitLimit.StatDuration = 60
+	modelConfig.AttackLimit.Enabled = true
+	modelConfig.AttackLimit.Action = ActionRedirect
+	modelConfig.AttackLimit.Threshold = 10
+	modelConfig.AttackLimit.StatDuration = 60
+	modelConfig.ErrorLimit.Action = ActionThrottle
+	modelConfig.ErrorPolicies = []model.ErrorPolicyConfig{
+		{Name: "login", Enabled: true, Action: ActionRedirect, RedirectURL: "https://example.com/wait", Threshold: 10, StatDuration: 60},
+		{Name: "disabled", Action: ActionThrottle, Threshold: 10, StatDuration: 60},
+	}
+	fc, _ := newTestFlowController(t, ConvertFromModelConfig(modelConfig))
+
+	tests := []struct {
+		name        string
+		reason      string
+		action      string
+		redirectURL string
+	}{
+		{"访问限制默认返回 429", ReasonVisit, ActionThrottle, ""},
+		{"redirect 缺少跳转地址时直接拒绝", ReasonAttack, ActionDeny, ""},
+		{"命名错误策略使用策略的动作", ReasonError + ":login", ActionRedirect, "https://example.com/wait"},
+		{"未启用的错误限制直接拒绝", ReasonError, ActionDeny, ""},
+		{"未启用的策略直接拒绝", ReasonError + ":disabled", ActionDeny, ""},
+		{"未知原因直接拒绝", "manual", ActionDeny, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := fc.Enforcement(tt.reason, time.Now().Add(time.Hour))
+			if got.Action != tt.action || (tt.action == ActionRedirect && got.RedirectURL != tt.redirectURL) {
+				t.Errorf("处置方式为 %s %q，期望 %s %q", got.Action, got.RedirectURL, tt.action, tt.redirectURL)
+			}
+			if action, _ := modelConfig.EnforcementAction(tt.reason); action != got.Action {
+				t.Errorf("控制台的处置动作为 %s，引擎为 %s", action, got.Action)
+			}
+		})
+	}
+}
+
+// TestEnforcementRetryAfter 校验建议等待时间为封禁剩余时长，且至少为 1 秒
+func TestEnforcementRetryAfter(t *testing.T) {
+	fc, _ := newTestFlowController(t, FlowControlConfig{
+		VisitLimit: LimitConfig{Enabled: true, Threshold: 1, StatDuration: time.Minute, BlockDuration: 10 * time.Minute},
+	})
+
+	tests := []struct {
+		name         string
+		reason       string
+		blockedUntil time.Time
+		min, max     time.Duration
+	}{
+		{"按封禁到期时间计算", ReasonVisit, time.Now().Add(5 * time.Minute), 4 * time.Minute, 5 * time.Minute},
+		{"刚触发限制时按规则的封禁时长计算", ReasonVisit, time.Time{}, 9 * time.Minute, 10 * time.Minute},
+		{"已到期时至少为 1 秒", ReasonVisit, time.Now().Add(-time.Minute), time.Second, time.Second},
+		{"未知原因且无到期时间时不设置", "manual", time.Time{}, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := fc.Enforcement(tt.reason, tt.blockedUntil).RetryAfter
+			if got < tt.min || got > tt.max {
+				t.Errorf("RetryAfter 为 %v，期望在 %v 和 %v 之间", got, tt.min, tt.max)
+			}
+		})
+	}
+}
@@ -0,0 +1,100 @@
+package flowcontroller
+
+import (
+	"path"
+	"strconv"
+	"strings"
+)
+
+// ErrorLimitConfig 错误限流配置，在通用限流配置基础上增加状态码和路径筛选
+type ErrorLimitConfig struct {
+	LimitConfig
+	StatusCodes []string // 计入的状态码或状态码类别（如 404、4xx），为空时计入所有 4xx/5xx 响应
+	Paths       []string // 计入的请求路径，支持前缀和通配符，为空时不限路径
+}
+
+// ErrorPolicy 命名错误策略，封禁原因为 high_frequency_error:<Name>
+type ErrorPolicy struct {
+	Name string
+	ErrorLimitConfig
+}
+
+// errorMatcher 错误响应筛选条件
+type errorMatcher struct {
+	codes   map[int]struct{} // 精确匹配的状态码
+	classes map[int]struct{} // 匹配的状态码类别，如 4 表示 4xx
+	paths   []string         // 路径规则
+}
+
+// newErrorMatcher 解析状态码与路径配置，返回无法识别的状态码配置
+func newErrorMatcher(statusCodes []string, paths []string) (*errorMatcher, []string) {
+	m := &errorMatcher{
+		codes:   make(map[int]struct{}),
+		classes: make(map[int]struct{}),
+	}
+
+	var invalid []string
+	for _, raw := range statusCodes {
+		value := strings.ToLower(strings.TrimSpace(raw))
+		if len(value) == 3 && strings.HasSuffix(value, "xx") && value[0] >= '1' && value[0] <= '5' {
+			m.classes[int(value[0]-'0')] = struct{}{}
+			continue
+		}
+		code, err := strconv.Atoi(value)
+		if err != nil || code < 100 || code > 599 {
+			invalid = append(invalid, raw)
+			continue
+		}
+		m.codes[code] = struct{}{}
+	}
+
+	// 未配置状态码时与旧行为一致，计入所有 4xx/5xx 响应
+	if len(m.codes) == 0 && len(m.classes) == 0 {
+		m.classes[4] = struct{}{}
+		m.classes[5] = struct{}{}
+	}
+
+	for _, p := range paths {
+		if p = strings.TrimSpace(p); p != "" {
+			m.paths = append(m.paths, p)
+		}
+	}
+	return m, invalid
+}
+
+// match 判断响应是否计入该策略
+func (m *errorMatcher) match(status int, requestPath string) bool {
+	if _, ok := m.codes[status]; !ok {
+		if _, ok := m.classes[status/100]; !ok {
+			return false
+		}
+	}
+
+	if len(m.paths) == 0 {
+		return true
+	}
+	for _, p := range m.paths {
+		if matchPath(p, requestPath) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchPath 路径匹配：含 * 时按通配符匹配，否则按路径段前缀匹配，/login 匹配 /login 与 /login/xxx
+func matchPath(pattern, requestPath string) bool {
+	if strings.Contains(pattern, "*") {
+		ok, err := path.Match(pattern, requestPath)
+		return err == nil && ok
+	}
+	if requestPath == pattern {
+		return true
+	}
+	return strings.HasPrefix(requestPath, strings.TrimSuffix(pattern, "/")+"/")
+}
+
+// errorRule 错误限流规则
+type errorRule struct {
+	*limitRule
+	matcher *errorMatcher
+}
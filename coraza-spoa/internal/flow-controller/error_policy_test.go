@@ -0,0 +1,42 @@
+package flowcontroller
+
+import "testing"
+
+func TestErrorMatcher(t *testing.T) {
+	tests := []struct {
+		name   string
+		codes  []string
+		paths  []string
+		status int
+		path   string
+		want   bool
+	}{
+		{"默认计入4xx", nil, nil, 404, "/a", true},
+		{"默认计入5xx", nil, nil, 502, "/a", true},
+		{"默认不计入3xx", nil, nil, 302, "/a", false},
+		{"精确状态码", []string{"401", "403"}, nil, 403, "/a", true},
+		{"精确状态码不匹配", []string{"401", "403"}, nil, 404, "/a", false},
+		{"状态码类别", []string{"5XX"}, nil, 503, "/a", true},
+		{"路径前缀", []string{"401"}, []string{"/login"}, 401, "/login/submit", true},
+		{"路径完全匹配", []string{"401"}, []string{"/login"}, 401, "/login", true},
+		{"路径段边界", []string{"401"}, []string{"/login"}, 401, "/loginx", false},
+		{"路径通配符", []string{"4xx"}, []string{"/api/*/auth"}, 401, "/api/v1/auth", true},
+		{"路径不匹配", []string{"401"}, []string{"/login"}, 401, "/home", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, invalid := newErrorMatcher(tt.codes, tt.paths)
+			if len(invalid) > 0 {
+				t.Fatalf("不应有无效状态码: %v", invalid)
+			}
+			if got := m.match(tt.status, tt.path); got != tt.want {
+				t.Fatalf("match(%d, %q) = %v, want %v", tt.status, tt.path, got, tt.want)
+			}
+		})
+	}
+
+	if _, invalid := newErrorMatcher([]string{"abc", "6xx", "404"}, nil); len(invalid) != 2 {
+		t.Fatalf("应识别出 2 个无效状态码，实际 %v", invalid)
+	}
+}
@@ -6,10 +6,6 @@ import (
 	"sync"
 	"time"
 
-	sentinel "github.com/alibaba/sentinel-golang/api"
-	"github.com/alibaba/sentinel-golang/core/base"
-	"github.com/alibaba/sentinel-golang/core/config"
-	"github.com/alibaba/sentinel-golang/core/hotspot"
 	"github.com/rs/zerolog"
 	"go.mongodb.org/mongo-driver/v2/bson"
 	"go.mongodb.org/mongo-driver/v2/mongo"
@@ -20,58 +16,102 @@ import (
 // FlowControlConfig 定义流控配置
 type FlowControlConfig struct {
 	// 高频访问限制配置
-	VisitLimit struct {
-		Enabled        bool          // 是否启用
-		Threshold      int64         // 阈值
-		StatDuration   time.Duration // 统计时间窗口
-		BlockDuration  time.Duration // 封禁时长
-		BurstCount     int64         // 突发请求数
-		ParamsCapacity int64         // 缓存容量
-	}
+	VisitLimit LimitConfig
 
 	// 高频攻击限制配置
-	AttackLimit struct {
-		Enabled        bool          // 是否启用
-		Threshold      int64         // 阈值
-		StatDuration   time.Duration // 统计时间窗口
-		BlockDuration  time.Duration // 封禁时长
-		BurstCount     int64         // 突发请求数
-		ParamsCapacity int64         // 缓存容量
-	}
+	AttackLimit LimitConfig
 
 	// 高频错误限制配置
-	ErrorLimit struct {
-		Enabled        bool          // 是否启用
-		Threshold      int64         // 阈值
-		StatDuration   time.Duration // 统计时间窗口
-		BlockDuration  time.Duration // 封禁时长
-		BurstCount     int64         // 突发请求数
-		ParamsCapacity int64         // 缓存容量
-	}
+	ErrorLimit ErrorLimitConfig
+
+	// 命名错误策略
+	ErrorPolicies []ErrorPolicy
+
+	// 网段升级封禁配置
+	SubnetEscalation SubnetEscalationConfig
+
+	// 计数后端配置
+	CounterBackend CounterBackendConfig
+}
+
+// LimitConfig 单项限流配置
+type LimitConfig struct {
+	Enabled        bool          // 是否启用
+	Mode           string        // 运行模式：enforce 拦截，monitor 仅记录
+	Algorithm      string        // 限流算法：token_bucket、sliding_window 或 fixed_window
+	Action         string        // 拒绝请求时的处置动作
+	RedirectURL    string        // redirect 动作的跳转地址
+	Threshold      int64         // 阈值
+	StatDuration   time.Duration // 统计时间窗口
+	BlockDuration  time.Duration // 封禁时长
+	BurstCount     int64         // 突发请求数
+	ParamsCapacity int64         // 缓存容量
 }
 
 // FlowController 流控处理器
+// 每个应用持有独立的实例，限流计数互不影响
 type FlowController struct {
 	config      FlowControlConfig // 配置
 	logger      zerolog.Logger    // 日志
 	ipRecorder  IPRecorder        // IP记录器
+	namespace   string            // 命名空间，用于隔离共享计数后端中不同应用的计数
+	asnResolver ASNResolver       // ASN查询，用于按ASN升级封禁
+	backend     CounterBackend    // 计数后端
+	visitRule   *limitRule        // 访问限制规则，未启用时为 nil
+	attackRule  *limitRule        // 攻击限制规则，未启用时为 nil
+	errorRules  []*errorRule      // 错误限制规则及命名错误策略
 	initialized bool              // 是否已初始化
-	mutex       sync.Mutex        // 互斥锁
+	mutex       sync.RWMutex      // 读写锁，保护限流规则的替换
+}
+
+// limitRule 单项限流规则的运行状态
+type limitRule struct {
+	resource      string        // 资源名称
+	reason        string        // 封禁原因
+	message       string        // 封禁日志
+	monitor       bool          // 是否为监控模式
+	blockDuration time.Duration // 封禁时长
+	action        string        // 拒绝请求时的处置动作
+	redirectURL   string        // redirect 动作的跳转地址
+	limiter       Limiter       // 限流器
+	simulated     Limiter       // 监控模式下按封禁时长对模拟封禁去重，避免持续超限时反复记录
+}
+
+// close 释放规则持有的限流器
+func (r *limitRule) close() {
+	r.limiter.Close()
+	if r.simulated != nil {
+		r.simulated.Close()
+	}
 }
 
-// 资源名称常量
+// 资源名称常量，用于日志中区分限流器
 const (
 	ResourceVisit  = "waf:visit"  // 访问资源
 	ResourceAttack = "waf:attack" // 攻击资源
 	ResourceError  = "waf:error"  // 错误资源
 )
 
+// 封禁原因常量，命名错误策略的封禁原因为 ReasonError:<name>
+const (
+	ReasonVisit  = model.FlowControlReasonVisit  // 高频访问
+	ReasonAttack = model.FlowControlReasonAttack // 高频攻击
+	ReasonError  = model.FlowControlReasonError  // 高频错误
+
+	ReasonSubnetEscalation = model.FlowControlReasonSubnetEscalation // 网段升级封禁
+	ReasonASNEscalation    = model.FlowControlReasonASNEscalation    // ASN 升级封禁
+)
+
 // ConvertFromModelConfig 将模型配置转换为流控配置
 func ConvertFromModelConfig(modelConfig model.FlowControlConfig) FlowControlConfig {
 	config := FlowControlConfig{}
 
 	// 访问限制配置
 	config.VisitLimit.Enabled = modelConfig.VisitLimit.Enabled
+	config.VisitLimit.Mode = modelConfig.VisitLimit.Mode
+	config.VisitLimit.Algorithm = modelConfig.VisitLimit.Algorithm
+	config.VisitLimit.Action = modelConfig.VisitLimit.Action
+	config.VisitLimit.RedirectURL = modelConfig.VisitLimit.RedirectURL
 	config.VisitLimit.Threshold = modelConfig.VisitLimit.Threshold
 	config.VisitLimit.StatDuration = time.Duration(modelConfig.VisitLimit.StatDuration) * time.Second
 	config.VisitLimit.BlockDuration = time.Duration(modelConfig.VisitLimit.BlockDuration) * time.Second
@@ -80,6 +120,10 @@ func ConvertFromModelConfig(modelConfig model.FlowControlConfig) FlowControlConf
 
 	// 攻击限制配置
 	config.AttackLimit.Enabled = modelConfig.AttackLimit.Enabled
+	config.AttackLimit.Mode = modelConfig.AttackLimit.Mode
+	config.AttackLimit.Algorithm = modelConfig.AttackLimit.Algorithm
+	config.AttackLimit.Action = modelConfig.AttackLimit.Action
+	config.AttackLimit.RedirectURL = modelConfig.AttackLimit.RedirectURL
 	config.AttackLimit.Threshold = modelConfig.AttackLimit.Threshold
 	config.AttackLimit.StatDuration = time.Duration(modelConfig.AttackLimit.StatDuration) * time.Second
 	config.AttackLimit.BlockDuration = time.Duration(modelConfig.AttackLimit.BlockDuration) * time.Second
@@ -88,51 +132,81 @@ func ConvertFromModelConfig(modelConfig model.FlowControlConfig) FlowControlConf
 
 	// 错误限制配置
 	config.ErrorLimit.Enabled = modelConfig.ErrorLimit.Enabled
+	config.ErrorLimit.Mode = modelConfig.ErrorLimit.Mode
+	config.ErrorLimit.Algorithm = modelConfig.ErrorLimit.Algorithm
+	config.ErrorLimit.Action = modelConfig.ErrorLimit.Action
+	config.ErrorLimit.RedirectURL = modelConfig.ErrorLimit.RedirectURL
 	config.ErrorLimit.Threshold = modelConfig.ErrorLimit.Threshold
 	config.ErrorLimit.StatDuration = time.Duration(modelConfig.ErrorLimit.StatDuration) * time.Second
 	config.ErrorLimit.BlockDuration = time.Duration(modelConfig.ErrorLimit.BlockDuration) * time.Second
 	config.ErrorLimit.BurstCount = modelConfig.ErrorLimit.BurstCount
 	config.ErrorLimit.ParamsCapacity = modelConfig.ErrorLimit.ParamsCapacity
+	config.ErrorLimit.StatusCodes = modelConfig.ErrorLimit.StatusCodes
+	config.ErrorLimit.Paths = modelConfig.ErrorLimit.Paths
+
+	// 命名错误策略
+	for _, policy := range modelConfig.ErrorPolicies {
+		config.ErrorPolicies = append(config.ErrorPolicies, ErrorPolicy{
+			Name: policy.Name,
+			ErrorLimitConfig: ErrorLimitConfig{
+				LimitConfig: LimitConfig{
+					Enabled:        policy.Enabled,
+					Mode:           policy.Mode,
+					Algorithm:      policy.Algorithm,
+					Action:         policy.Action,
+					RedirectURL:    policy.RedirectURL,
+					Threshold:      policy.Threshold,
+					StatDuration:   time.Duration(policy.StatDuration) * time.Second,
+					BlockDuration:  time.Duration(policy.BlockDuration) * time.Second,
+					BurstCount:     policy.BurstCount,
+					ParamsCapacity: policy.ParamsCapacity,
+				},
+				StatusCodes: policy.StatusCodes,
+				Paths:       policy.Paths,
+			},
+		})
+	}
+
+	// 网段升级封禁配置
+	config.SubnetEscalation.Enabled = modelConfig.SubnetEscalation.Enabled
+	config.SubnetEscalation.IPv4PrefixLen = modelConfig.SubnetEscalation.IPv4PrefixLen
+	config.SubnetEscalation.IPv6PrefixLen = modelConfig.SubnetEscalation.IPv6PrefixLen
+	config.SubnetEscalation.ByASN = modelConfig.SubnetEscalation.ByASN
+	config.SubnetEscalation.Threshold = modelConfig.SubnetEscalation.Threshold
+	config.SubnetEscalation.Window = time.Duration(modelConfig.SubnetEscalation.Window) * time.Second
+	config.SubnetEscalation.BlockDuration = time.Duration(modelConfig.SubnetEscalation.BlockDuration) * time.Second
+
+	// 计数后端配置
+	config.CounterBackend.Type = modelConfig.CounterBackend.Type
+	config.CounterBackend.Addr = modelConfig.CounterBackend.Addr
+	config.CounterBackend.Password = modelConfig.CounterBackend.Password
+	config.CounterBackend.DB = modelConfig.CounterBackend.DB
+	config.CounterBackend.KeyPrefix = modelConfig.CounterBackend.KeyPrefix
+	config.CounterBackend.Timeout = time.Duration(modelConfig.CounterBackend.Timeout) * time.Millisecond
 
 	return config
 }
 
-// 添加单例实例和锁
-var (
-	flowControllerInstance *FlowController
-	flowControllerMutex    sync.Mutex
-)
-
-// NewFlowControllerFromMongoConfig 从Mongo配置创建新的流控处理器（单例模式）
+// NewFlowControllerFromMongoConfig 从Mongo配置创建新的流控处理器
 // @Summary 从MongoDB配置创建流控处理器
-// @Description 从MongoDB数据库中加载配置并创建或更新流控处理器，采用单例模式
+// @Description 从MongoDB数据库中加载配置并创建流控处理器，每次调用返回独立实例
 // @Param client *mongo.Client - MongoDB客户端
 // @Param database string - 数据库名称
+// @Param namespace string - 命名空间，通常为应用名称
 // @Param logger zerolog.Logger - 日志记录器
 // @Param recorder IPRecorder - IP记录器
 // @Return *FlowController - 创建的流控处理器
 // @Return error - 错误信息
-func NewFlowControllerFromMongoConfig(client *mongo.Client, database string, logger zerolog.Logger, recorder IPRecorder) (*FlowController, error) {
-	flowControllerMutex.Lock()
-	defer flowControllerMutex.Unlock()
-
+func NewFlowControllerFromMongoConfig(client *mongo.Client, database string, namespace string, logger zerolog.Logger, recorder IPRecorder) (*FlowController, error) {
 	// 尝试加载配置
 	config, err := loadFlowControlConfig(client, database, logger)
 	if err != nil {
 		return nil, err
 	}
 
-	// 如果实例已存在，则更新配置
-	if flowControllerInstance != nil {
-		logger.Info().Msg("更新现有流控处理器配置")
-		flowControllerInstance.UpdateConfig(config)
-		return flowControllerInstance, nil
-	}
-
-	// 创建新实例
-	logger.Info().Msg("创建新的流控处理器实例")
+	logger.Info().Str("namespace", namespace).Msg("创建新的流控处理器实例")
 	fc := NewFlowController(config, logger, recorder)
-	flowControllerInstance = fc
+	fc.namespace = namespace
 	return fc, nil
 }
 
@@ -171,10 +245,7 @@ func (fc *FlowController) UpdateConfig(config FlowControlConfig) {
 
 	// 重新加载规则
 	if fc.initialized {
-		// 清空现有规则
-		hotspot.ClearRules()
-
-		// 重新配置各类流控规则
+		fc.closeLimiters()
 		fc.setupAllRules()
 
 		fc.logger.Info().Msg("流控规则已更新")
@@ -190,6 +261,14 @@ func NewFlowController(config FlowControlConfig, logger zerolog.Logger, recorder
 	}
 }
 
+// SetASNResolver 设置ASN查询，需在 Initialize 之前调用
+func (fc *FlowController) SetASNResolver(resolver ASNResolver) {
+	fc.mutex.Lock()
+	defer fc.mutex.Unlock()
+
+	fc.asnResolver = resolver
+}
+
 // Initialize 初始化流控处理器
 func (fc *FlowController) Initialize() error {
 	fc.mutex.Lock()
@@ -199,41 +278,6 @@ func (fc *FlowController) Initialize() error {
 		return nil
 	}
 
-	// 创建 Sentinel 配置
-	conf := config.NewDefaultConfig()
-
-	// 应用配置
-	conf.Sentinel.App.Name = "ruiqi-waf-flow-controller"
-	conf.Sentinel.App.Type = 1 // API Gateway 类型
-
-	// 日志配置
-	conf.Sentinel.Log.Dir = "/tmp/sentinel-logs"
-	conf.Sentinel.Log.UsePid = true // 使用 PID 避免多进程冲突
-
-	// 日志文件数量配置
-	conf.Sentinel.Log.Metric.MaxFileCount = 3
-
-	// 度量导出配置
-	conf.Sentinel.Exporter.Metric.HttpAddr = ":8719"    // Sentinel 默认度量端口
-	conf.Sentinel.Exporter.Metric.HttpPath = "/metrics" // Prometheus 风格的度量路径
-
-	// 记录配置信息
-	fc.logger.Info().
-		Str("app_name", conf.Sentinel.App.Name).
-		Int32("app_type", conf.Sentinel.App.Type).
-		Str("log_dir", conf.Sentinel.Log.Dir).
-		Bool("log_use_pid", conf.Sentinel.Log.UsePid).
-		Uint32("log_max_files", conf.Sentinel.Log.Metric.MaxFileCount).
-		Str("metrics_addr", conf.Sentinel.Exporter.Metric.HttpAddr).
-		Str("metrics_path", conf.Sentinel.Exporter.Metric.HttpPath).
-		Msg("初始化 Sentinel 配置")
-
-	// 初始化 Sentinel
-	err := sentinel.InitWithConfig(conf)
-	if err != nil {
-		return fmt.Errorf("初始化Sentinel失败: %v", err)
-	}
-
 	// 配置各类流控规则
 	fc.setupAllRules()
 
@@ -242,106 +286,199 @@ func (fc *FlowController) Initialize() error {
 	return nil
 }
 
+// setupAllRules 根据配置创建各类限流规则，调用方需持有写锁
 func (fc *FlowController) setupAllRules() {
-	var allRules []*hotspot.Rule
+	count := 0
+	fc.backend = NewCounterBackend(fc.config.CounterBackend, fc.namespace, fc.logger)
 
-	// 添加访问限制规则
+	// 访问限制规则
 	if fc.config.VisitLimit.Enabled {
-		allRules = append(allRules, &hotspot.Rule{
-			Resource:          ResourceVisit,
-			MetricType:        hotspot.QPS,
-			ControlBehavior:   hotspot.Reject,
-			ParamIndex:        0, // 第一个参数，即IP
-			Threshold:         fc.config.VisitLimit.Threshold,
-			BurstCount:        fc.config.VisitLimit.BurstCount,
-			DurationInSec:     int64(fc.config.VisitLimit.StatDuration.Seconds()),
-			ParamsMaxCapacity: fc.config.VisitLimit.ParamsCapacity,
-		})
+		fc.visitRule = fc.newLimitRule(ResourceVisit, ReasonVisit, "IP访问受限", fc.config.VisitLimit)
+		count++
+		fc.logRuleLoaded(fc.visitRule, fc.config.VisitLimit, "访问限流规则加载成功")
 	}
 
-	// 添加攻击限制规则
+	// 攻击限制规则
 	if fc.config.AttackLimit.Enabled {
-		allRules = append(allRules, &hotspot.Rule{
-			Resource:          ResourceAttack,
-			MetricType:        hotspot.QPS,
-			ControlBehavior:   hotspot.Reject,
-			ParamIndex:        0, // 第一个参数，即IP
-			Threshold:         fc.config.AttackLimit.Threshold,
-			BurstCount:        fc.config.AttackLimit.BurstCount,
-			DurationInSec:     int64(fc.config.AttackLimit.StatDuration.Seconds()),
-			ParamsMaxCapacity: fc.config.AttackLimit.ParamsCapacity,
-		})
+		fc.attackRule = fc.newLimitRule(ResourceAttack, ReasonAttack, "IP因高频攻击被限制", fc.config.AttackLimit)
+		count++
+		fc.logRuleLoaded(fc.attackRule, fc.config.AttackLimit, "攻击限流规则加载成功")
 	}
 
-	// 添加错误限制规则
+	// 错误限制规则
 	if fc.config.ErrorLimit.Enabled {
-		allRules = append(allRules, &hotspot.Rule{
-			Resource:          ResourceError,
-			MetricType:        hotspot.QPS,
-			ControlBehavior:   hotspot.Reject,
-			ParamIndex:        0, // 第一个参数，即IP
-			Threshold:         fc.config.ErrorLimit.Threshold,
-			BurstCount:        fc.config.ErrorLimit.BurstCount,
-			DurationInSec:     int64(fc.config.ErrorLimit.StatDuration.Seconds()),
-			ParamsMaxCapacity: fc.config.ErrorLimit.ParamsCapacity,
+		fc.errorRules = append(fc.errorRules, fc.newErrorRule(ResourceError, ReasonError, fc.config.ErrorLimit))
+		count++
+		fc.logRuleLoaded(fc.errorRules[len(fc.errorRules)-1].limitRule, fc.config.ErrorLimit.LimitConfig, "错误限流规则加载成功")
+	}
+
+	// 命名错误策略，按配置顺序依次计数
+	for _, policy := range fc.config.ErrorPolicies {
+		if !policy.Enabled || policy.Name == "" {
+			continue
+		}
+		rule := fc.newErrorRule(ResourceError+":"+policy.Name, ReasonError+":"+policy.Name, policy.ErrorLimitConfig)
+		fc.errorRules = append(fc.errorRules, rule)
+		count++
+		fc.logRuleLoaded(rule.limitRule, policy.LimitConfig, "错误策略加载成功")
+	}
+
+	// 网段升级封禁由共享的IP记录器执行
+	fc.ipRecorder.ConfigureSubnetEscalation(fc.config.SubnetEscalation, fc.asnResolver)
+
+	fc.logger.Info().Int("count", count).Msg("所有限流规则加载成功")
+}
+
+// newLimitRule 根据单项配置创建限流规则
+func (fc *FlowController) newLimitRule(resource, reason, message string, config LimitConfig) *limitRule {
+	rule := &limitRule{
+		resource:      resource,
+		reason:        reason,
+		message:       message,
+		monitor:       config.Mode == model.FlowControlModeMonitor,
+		blockDuration: config.BlockDuration,
+		redirectURL:   config.RedirectURL,
+		// 访问限制默认返回 429，其余限制默认直接拒绝，与控制台同步封禁IP时的判断一致
+		action: model.ResolveFlowControlAction(reason, config.Action, config.RedirectURL),
+		limiter: fc.backend.NewLimiter(resource, LimitRule{
+			Algorithm:      config.Algorithm,
+			Threshold:      config.Threshold,
+			BurstCount:     config.BurstCount,
+			StatDuration:   config.StatDuration,
+			ParamsCapacity: config.ParamsCapacity,
+		}),
+	}
+
+	if rule.monitor {
+		// 每个封禁时长内同一IP只记录一次模拟封禁，与拦截模式下的记录频率一致
+		rule.simulated = NewTokenBucketLimiter(LimitRule{
+			Threshold:      1,
+			StatDuration:   config.BlockDuration,
+			ParamsCapacity: config.ParamsCapacity,
 		})
 	}
+	return rule
+}
 
-	// 一次性加载所有规则
-	_, err := hotspot.LoadRules(allRules)
-	if err != nil {
-		fc.logger.Error().Err(err).Msg("加载热点限流规则失败")
-	} else {
-		fc.logger.Info().Int("count", len(allRules)).Msg("所有限流规则加载成功")
+// newErrorRule 根据错误限流配置创建带筛选条件的规则
+func (fc *FlowController) newErrorRule(resource, reason string, config ErrorLimitConfig) *errorRule {
+	matcher, invalid := newErrorMatcher(config.StatusCodes, config.Paths)
+	if len(invalid) > 0 {
+		fc.logger.Warn().
+			Str("resource", resource).
+			Strs("status_codes", invalid).
+			Msg("忽略无法识别的状态码配置")
+	}
 
-		fc.logger.Info().
-			Int64("threshold", fc.config.VisitLimit.Threshold).
-			Int64("burstCount", fc.config.VisitLimit.BurstCount).
-			Int64("durationInSec", int64(fc.config.VisitLimit.StatDuration.Seconds())).
-			Msg("访问限流规则加载成功")
+	return &errorRule{
+		limitRule: fc.newLimitRule(resource, reason, "IP因高频错误被限制", config.LimitConfig),
+		matcher:   matcher,
+	}
+}
 
-		fc.logger.Info().
-			Int64("threshold", fc.config.AttackLimit.Threshold).
-			Int64("burstCount", fc.config.AttackLimit.BurstCount).
-			Int64("durationInSec", int64(fc.config.AttackLimit.StatDuration.Seconds())).
-			Msg("攻击限流规则加载成功")
+// logRuleLoaded 输出规则加载日志
+func (fc *FlowController) logRuleLoaded(rule *limitRule, config LimitConfig, msg string) {
+	mode := model.FlowControlModeEnforce
+	if rule.monitor {
+		mode = model.FlowControlModeMonitor
+	}
+	fc.logger.Info().
+		Str("resource", rule.resource).
+		Str("mode", mode).
+		Str("algorithm", config.Algorithm).
+		Str("action", rule.action).
+		Int64("threshold", config.Threshold).
+		Int64("burstCount", config.BurstCount).
+		Int64("durationInSec", int64(config.StatDuration.Seconds())).
+		Msg(msg)
+}
+
+// closeLimiters 关闭并清空所有限流规则及计数后端，调用方需持有写锁
+func (fc *FlowController) closeLimiters() {
+	for _, rule := range []*limitRule{fc.visitRule, fc.attackRule} {
+		if rule != nil {
+			rule.close()
+		}
+	}
+	for _, rule := range fc.errorRules {
+		rule.close()
+	}
+	fc.visitRule = nil
+	fc.attackRule = nil
+	fc.errorRules = nil
+
+	if fc.backend != nil {
+		if err := fc.backend.Close(); err != nil {
+			fc.logger.Error().Err(err).Msg("关闭限流计数后端失败")
+		}
+		fc.backend = nil
+	}
+}
+
+// Verdict 限流检查结果
+type Verdict int
+
+const (
+	VerdictAllow   Verdict = iota // 放行
+	VerdictDeny                   // 超过阈值，拦截并封禁IP
+	VerdictObserve                // 监控模式下超过阈值，记录模拟封禁后放行
+)
 
+// check 对IP计数一次，返回是否需要拦截
+func (fc *FlowController) check(rule *limitRule, ip string, requestUri string) bool {
+	return fc.evaluate(rule, ip, requestUri) == VerdictDeny
+}
+
+// evaluate 对IP计数一次并返回检查结果
+// 监控模式下超过阈值只记录模拟封禁，始终放行，每个封禁时长内同一IP只返回一次 VerdictObserve
+func (fc *FlowController) evaluate(rule *limitRule, ip string, requestUri string) Verdict {
+	// 未启用该限制或未超过阈值
+	if rule == nil || rule.limiter.Allow(ip) {
+		return VerdictAllow
+	}
+
+	if rule.monitor {
+		if !rule.simulated.Allow(ip) {
+			return VerdictAllow
+		}
+		fc.ipRecorder.RecordSimulatedBlock(ip, rule.reason, requestUri, rule.blockDuration)
 		fc.logger.Info().
-			Int64("threshold", fc.config.ErrorLimit.Threshold).
-			Int64("burstCount", fc.config.ErrorLimit.BurstCount).
-			Int64("durationInSec", int64(fc.config.ErrorLimit.StatDuration.Seconds())).
-			Msg("错误限流规则加载成功")
+			Str("ip", ip).
+			Str("reason", rule.reason).
+			Dur("block_duration", rule.blockDuration).
+			Msg(rule.message + "（监控模式，未拦截）")
+		return VerdictObserve
 	}
+
+	// 记录被限制的IP
+	fc.ipRecorder.RecordBlockedIP(ip, rule.reason, requestUri, rule.blockDuration)
+	fc.logger.Warn().
+		Str("ip", ip).
+		Str("reason", rule.reason).
+		Dur("block_duration", rule.blockDuration).
+		Msg(rule.message)
+	return VerdictDeny
 }
 
 // CheckVisit 检查IP访问请求是否被允许
 func (fc *FlowController) CheckVisit(ip string, requestUri string) (bool, error) {
+	verdict, err := fc.EvaluateVisit(ip, requestUri)
+	return verdict != VerdictDeny, err
+}
+
+// EvaluateVisit 检查IP访问请求，返回检查结果，用于区分拦截和监控模式下的模拟拦截
+func (fc *FlowController) EvaluateVisit(ip string, requestUri string) (Verdict, error) {
 	if !fc.initialized {
 		if err := fc.Initialize(); err != nil {
-			return true, err
+			return VerdictAllow, err
 		}
 	}
 
-	// 使用热点参数限流，将IP作为第一个参数传入
-	entry, blockError := sentinel.Entry(ResourceVisit,
-		sentinel.WithArgs(ip),
-		sentinel.WithTrafficType(base.Inbound),
-	)
-
-	if blockError != nil {
-		// 记录被限制的IP
-		fc.ipRecorder.RecordBlockedIP(ip, "high_frequency_visit", requestUri, fc.config.VisitLimit.BlockDuration)
-		fc.logger.Warn().
-			Str("ip", ip).
-			Str("reason", "high_frequency_visit").
-			Dur("block_duration", fc.config.VisitLimit.BlockDuration).
-			Msg("IP访问受限")
-		return false, nil
-	}
+	fc.mutex.RLock()
+	rule := fc.visitRule
+	fc.mutex.RUnlock()
 
-	// 别忘了释放资源
-	defer entry.Exit()
-	return true, nil
+	return fc.evaluate(rule, ip, requestUri), nil
 }
 
 // RecordAttack 记录IP触发的攻击检测，返回是否被限制
@@ -352,61 +489,41 @@ func (fc *FlowController) RecordAttack(ip string, requestUri string) (bool, erro
 		}
 	}
 
-	// 使用热点参数限流，将IP作为第一个参数传入
-	entry, blockError := sentinel.Entry(ResourceAttack,
-		sentinel.WithArgs(ip),
-		sentinel.WithTrafficType(base.Inbound),
-	)
+	fc.mutex.RLock()
+	rule := fc.attackRule
+	fc.mutex.RUnlock()
 
-	if blockError != nil {
-		// 记录被限制的IP
-		fc.ipRecorder.RecordBlockedIP(ip, "high_frequency_attack", requestUri, fc.config.AttackLimit.BlockDuration)
-		fc.logger.Warn().
-			Str("ip", ip).
-			Str("reason", "high_frequency_attack").
-			Dur("block_duration", fc.config.AttackLimit.BlockDuration).
-			Msg("IP因高频攻击被限制")
-		return true, nil
-	}
-
-	// 别忘了释放资源
-	defer entry.Exit()
-	return false, nil
+	return fc.check(rule, ip, requestUri), nil
 }
 
-// RecordError 记录IP返回的错误响应，返回是否被限制
-func (fc *FlowController) RecordError(ip string, requestUri string) (bool, error) {
+// RecordError 记录IP的响应状态，按错误限制及各错误策略的筛选条件计数，返回是否被限制
+// 每个匹配的策略都计数，任一策略触发封禁即视为被限制
+func (fc *FlowController) RecordError(ip string, requestPath string, requestUri string, status int) (bool, error) {
 	if !fc.initialized {
 		if err := fc.Initialize(); err != nil {
 			return false, err
 		}
 	}
 
-	// 使用热点参数限流，将IP作为第一个参数传入
-	entry, blockError := sentinel.Entry(ResourceError,
-		sentinel.WithArgs(ip),
-		sentinel.WithTrafficType(base.Inbound),
-	)
+	fc.mutex.RLock()
+	rules := fc.errorRules
+	fc.mutex.RUnlock()
 
-	if blockError != nil {
-		// 记录被限制的IP
-		fc.ipRecorder.RecordBlockedIP(ip, "high_frequency_error", requestUri, fc.config.ErrorLimit.BlockDuration)
-		fc.logger.Warn().
-			Str("ip", ip).
-			Str("reason", "high_frequency_error").
-			Dur("block_duration", fc.config.ErrorLimit.BlockDuration).
-			Msg("IP因高频错误被限制")
-		return true, nil
+	blocked := false
+	for _, rule := range rules {
+		if !rule.matcher.match(status, requestPath) {
+			continue
+		}
+		if fc.check(rule.limitRule, ip, requestUri) {
+			blocked = true
+		}
 	}
-
-	// 别忘了释放资源
-	defer entry.Exit()
-	return false, nil
+	return blocked, nil
 }
 
 // Close 关闭流控系统
 // @Summary 关闭流控系统
-// @Description 释放流控系统占用的资源，包括关闭IP记录器
+// @Description 释放流控处理器自身的限流器；IP记录器由多个应用共享，由创建者负责关闭
 // @Return error 错误信息
 func (fc *FlowController) Close() error {
 	fc.mutex.Lock()
@@ -414,21 +531,11 @@ func (fc *FlowController) Close() error {
 
 	fc.logger.Info().Msg("正在关闭流控系统")
 
-	// 清空限流规则
 	if fc.initialized {
-		// 清空热点参数规则
-		hotspot.ClearRules()
+		fc.closeLimiters()
 		fc.initialized = false
 	}
 
-	// 关闭IP记录器
-	if fc.ipRecorder != nil {
-		if err := fc.ipRecorder.Close(); err != nil {
-			fc.logger.Error().Err(err).Msg("关闭IP记录器失败")
-			return err
-		}
-	}
-
 	fc.logger.Info().Msg("流控系统已关闭")
 	return nil
 }
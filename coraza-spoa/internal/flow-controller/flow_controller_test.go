@@ -0,0 +1,182 @@
+package flowcontroller
+
+import (
+	"testing"
+	"time"
+
+	"github.com/HUAHUAI23/simple-waf/pkg/model"
+)
+
+// setRuleClock 将规则的限流器替换为固定时钟，返回用于推进时间的函数
+func setRuleClock(t *testing.T, rule *limitRule, start time.Time) func(time.Time) {
+	t.Helper()
+	now := start
+	for _, limiter := range []Limiter{rule.limiter, rule.simulated} {
+		if limiter == nil {
+			continue
+		}
+		keyed, ok := limiter.(*keyedLimiter)
+		if !ok {
+			t.Fatalf("限流器类型为 %T，期望本地限流器", limiter)
+		}
+		keyed.nowFunc = func() time.Time { return now }
+	}
+	return func(at time.Time) { now = at }
+}
+
+// TestMonitorModeNeverDenies 测试监控模式下超过阈值始终放行，每个封禁时长内同一IP只记录一次模拟封禁
+func TestMonitorModeNeverDenies(t *testing.T) {
+	fc, recorder := newTestFlowController(t, FlowControlConfig{
+		VisitLimit: LimitConfig{
+			Enabled:       true,
+			Mode:          model.FlowControlModeMonitor,
+			Threshold:     1,
+			StatDuration:  time.Minute,
+			BlockDuration: 10 * time.Minute,
+		},
+	})
+	start := time.Unix(1700000000, 0)
+	setNow := setRuleClock(t, fc.visitRule, start)
+
+	// 30 分钟内每 7 秒发起 3 次请求，持续超过阈值
+	observed := 0
+	for at := time.Duration(0); at < 30*time.Minute; at += 7 * time.Second {
+		setNow(start.Add(at))
+		for i := 0; i < 3; i++ {
+			verdict, err := fc.EvaluateVisit("10.0.0.1", "/")
+			if err != nil {
+				t.Fatalf("流控检查失败: %v", err)
+			}
+			switch verdict {
+			case VerdictDeny:
+				t.Fatalf("监控模式在 %v 返回了拦截", at)
+			case VerdictObserve:
+				observed++
+			}
+		}
+	}
+
+	if len(recorder.blocked) != 0 {
+		t.Errorf("监控模式不应封禁IP: %v", recorder.blocked)
+	}
+	// 首次超限及此后每隔一个封禁时长各记录一次
+	if len(recorder.simulated) != 3 || observed != 3 {
+		t.Fatalf("记录了 %d 次模拟封禁、%d 次 VerdictObserve，期望各 3 次", len(recorder.simulated), observed)
+	}
+	for _, block := range recorder.simulated {
+		if block.ip != "10.0.0.1" || block.reason != ReasonVisit || block.duration != 10*time.Minute {
+			t.Errorf("模拟封禁记录错误: %+v", block)
+		}
+	}
+
+	// 不同IP分别去重
+	setNow(start.Add(30 * time.Minute))
+	fc.EvaluateVisit("10.0.0.2", "/")
+	if verdict, _ := fc.EvaluateVisit("10.0.0.2", "/"); verdict != VerdictObserve {
+		t.Errorf("其他IP首次超限应返回 VerdictObserve，实际为 %v", verdict)
+	}
+}
+
+// TestEvaluateVisitVerdicts 测试访问检查在拦截和监控模式下返回的结果
+func TestEvaluateVisitVerdicts(t *testing.T) {
+	tests := []struct {
+		name      string
+		mode      string
+		verdicts  []Verdict
+		blocked   int
+		simulated int
+	}{
+		{
+			name:     "拦截模式超过阈值后拦截并封禁IP",
+			mode:     model.FlowControlModeEnforce,
+			verdicts: []Verdict{VerdictAllow, VerdictAllow, VerdictDeny, VerdictDeny},
+			blocked:  2,
+		},
+		{
+			name:     "未配置模式时按拦截模式处理",
+			verdicts: []Verdict{VerdictAllow, VerdictAllow, VerdictDeny},
+			blocked:  1,
+		},
+		{
+			name:      "监控模式首次超过阈值时返回 VerdictObserve，之后放行",
+			mode:      model.FlowControlModeMonitor,
+			verdicts:  []Verdict{VerdictAllow, VerdictAllow, VerdictObserve, VerdictAllow},
+			simulated: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fc, recorder := newTestFlowController(t, FlowControlConfig{
+				VisitLimit: LimitConfig{
+					Enabled:       true,
+					Mode:          tt.mode,
+					Threshold:     2,
+					StatDuration:  time.Minute,
+					BlockDuration: 10 * time.Minute,
+				},
+			})
+			setRuleClock(t, fc.visitRule, time.Unix(1700000000, 0))
+
+			for i, want := range tt.verdicts {
+				verdict, err := fc.EvaluateVisit("10.0.0.1", "/")
+				if err != nil {
+					t.Fatalf("流控检查失败: %v", err)
+				}
+				if verdict != want {
+					t.Errorf("第 %d 次请求的结果为 %v，期望 %v", i+1, verdict, want)
+				}
+			}
+			if len(recorder.blocked) != tt.blocked {
+				t.Errorf("封禁了 %d 次，期望 %d 次", len(recorder.blocked), tt.blocked)
+			}
+			if len(recorder.simulated) != tt.simulated {
+				t.Errorf("记录了 %d 次模拟封禁，期望 %d 次", len(recorder.simulated), tt.simulated)
+			}
+
+			// CheckVisit 只在拦截时拒绝
+			allowed, _ := fc.CheckVisit("10.0.0.1", "/")
+			if wantDeny := tt.verdicts[len(tt.verdicts)-1] == VerdictDeny; allowed == wantDeny {
+				t.Errorf("CheckVisit 返回 %v，期望 %v", allowed, !wantDeny)
+			}
+		})
+	}
+
+	// 未启用访问限制时始终放行
+	fc, _ := newTestFlowController(t, FlowControlConfig{})
+	for i := 0; i < 10; i++ {
+		if verdict, _ := fc.EvaluateVisit("10.0.0.1", "/"); verdict != VerdictAllow {
+			t.Fatalf("未启用访问限制时返回了 %v", verdict)
+		}
+	}
+}
+
+// TestRecordErrorCountsEveryPolicy 测试每个匹配的错误策略都计数，前面的策略触发封禁后后面的策略依然计数
+func TestRecordErrorCountsEveryPolicy(t *testing.T) {
+	limit := LimitConfig{Enabled: true, Threshold: 1, StatDuration: time.Minute, BlockDuration: 10 * time.Minute}
+	fc, recorder := newTestFlowController(t, FlowControlConfig{
+		ErrorPolicies: []ErrorPolicy{
+			{Name: "not_found", ErrorLimitConfig: ErrorLimitConfig{LimitConfig: limit, StatusCodes: []string{"404"}}},
+			{Name: "client_error", ErrorLimitConfig: ErrorLimitConfig{LimitConfig: limit, StatusCodes: []string{"4xx"}}},
+			{Name: "login", ErrorLimitConfig: ErrorLimitConfig{LimitConfig: limit, Paths: []string{"/login"}}},
+		},
+	})
+
+	for i, want := range []bool{false, true} {
+		blocked, err := fc.RecordError("10.0.0.1", "/api", "/api", 404)
+		if err != nil {
+			t.Fatalf("记录错误失败: %v", err)
+		}
+		if blocked != want {
+			t.Errorf("第 %d 次错误的结果为 %v，期望 %v", i+1, blocked, want)
+		}
+	}
+
+	reasons := make(map[string]bool)
+	for _, block := range recorder.blocked {
+		reasons[block.reason] = true
+	}
+	if len(recorder.blocked) != 2 || !reasons[ReasonError+":not_found"] || !reasons[ReasonError+":client_error"] {
+		t.Errorf("封禁记录为 %v，期望两个匹配的策略各封禁一次", recorder.blocked)
+	}
+}
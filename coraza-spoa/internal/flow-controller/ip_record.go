@@ -4,6 +4,7 @@ import (
 	"container/heap"
 	"context"
 	"hash/fnv"
+	"net/netip"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -43,6 +44,8 @@ func DefaultConfig() RecorderConfig {
 // Metrics 监控指标
 type Metrics struct {
 	TotalBlocked    atomic.Uint64
+	TotalSimulated  atomic.Uint64 // 监控模式下的模拟封禁次数
+	TotalPrefixes   atomic.Uint64 // 网段升级封禁次数
 	TotalExpired    atomic.Uint64
 	CurrentBlocked  atomic.Uint64
 	CleanupDuration atomic.Value // time.Duration
@@ -60,6 +63,12 @@ type MemoryBlockedIP struct {
 // IPRecorder IP记录器接口
 type IPRecorder interface {
 	RecordBlockedIP(ip string, reason string, requestUri string, duration time.Duration) error
+	// RecordSimulatedBlock 记录监控模式下的模拟封禁，不影响 IsIPBlocked 的结果
+	RecordSimulatedBlock(ip string, reason string, requestUri string, duration time.Duration) error
+	// RecordBlockedPrefix 记录网段封禁，网段内的所有IP都视为被封禁
+	RecordBlockedPrefix(ban PrefixBan) error
+	// ConfigureSubnetEscalation 配置网段升级封禁任务，resolver 为空时不按ASN聚合
+	ConfigureSubnetEscalation(config SubnetEscalationConfig, resolver ASNResolver)
 	IsIPBlocked(ip string) (bool, *model.BlockedIPRecord)
 	GetBlockedIPs() ([]model.BlockedIPRecord, error)
 	Close() error
@@ -142,7 +151,12 @@ type MemoryIPRecorder struct {
 	logger          zerolog.Logger
 	cleanupInterval atomic.Value // time.Duration
 	stopCleaner     chan struct{}
+	closeOnce       sync.Once
 	Metrics         *Metrics // 公开以便 MongoIPRecorder 共享
+
+	prefixBans  *prefixBanSet                   // 网段封禁
+	escalator   atomic.Pointer[subnetEscalator] // 网段升级任务，未启用时为 nil
+	escalatorMu sync.Mutex                      // 保护升级任务的创建与替换
 }
 
 // 单例实例
@@ -186,6 +200,7 @@ func NewMemoryIPRecorderWithConfig(config RecorderConfig, logger zerolog.Logger)
 			logger:      logger,
 			stopCleaner: make(chan struct{}),
 			Metrics:     &Metrics{},
+			prefixBans:  newPrefixBanSet(),
 		}
 
 		recorder.cleanupInterval.Store(config.CleanupInterval)
@@ -281,6 +296,9 @@ func (r *MemoryIPRecorder) cleanupExpired() {
 	now := time.Now()
 	var totalRemoved int
 
+	// 网段封禁数量较少，直接在此清理
+	r.prefixBans.cleanup(now)
+
 	// 并行清理各个分片
 	var wg sync.WaitGroup
 	removedChan := make(chan int, len(r.shards))
@@ -388,6 +406,11 @@ func (r *MemoryIPRecorder) ensureShardCapacity(s *shard) {
 
 // RecordBlockedIP 记录被限制的IP - 内存中只保存必要字段
 func (r *MemoryIPRecorder) RecordBlockedIP(ip string, reason string, requestUri string, duration time.Duration) error {
+	// 交给网段升级任务聚合
+	if escalator := r.escalator.Load(); escalator != nil {
+		escalator.observe(ip, time.Now())
+	}
+
 	s := r.getShard(ip)
 
 	s.mu.Lock()
@@ -440,6 +463,73 @@ func (r *MemoryIPRecorder) RecordBlockedIP(ip string, reason string, requestUri
 	return nil
 }
 
+// RecordBlockedPrefix 记录网段封禁
+func (r *MemoryIPRecorder) RecordBlockedPrefix(ban PrefixBan) error {
+	if !r.prefixBans.add(ban) {
+		return nil
+	}
+
+	r.Metrics.TotalPrefixes.Add(1)
+	r.logger.Info().
+		Str("prefix", ban.Prefix.String()).
+		Str("type", ban.Type).
+		Str("reason", ban.Reason).
+		Time("until", ban.BlockedUntil).
+		Msg("网段已被限制")
+	return nil
+}
+
+// ConfigureSubnetEscalation 配置网段升级封禁任务，升级结果记录到内存
+func (r *MemoryIPRecorder) ConfigureSubnetEscalation(config SubnetEscalationConfig, resolver ASNResolver) {
+	r.configureEscalation(config, resolver, func(ban PrefixBan) {
+		_ = r.RecordBlockedPrefix(ban)
+	})
+}
+
+// configureEscalation 创建、更新或停止网段升级任务
+// 多个应用共享同一记录器，重复配置时原地更新，保留已聚合的封禁事件
+func (r *MemoryIPRecorder) configureEscalation(config SubnetEscalationConfig, resolver ASNResolver, onEscalate func(ban PrefixBan)) {
+	r.escalatorMu.Lock()
+	defer r.escalatorMu.Unlock()
+
+	current := r.escalator.Load()
+	if !config.Enabled {
+		if current != nil {
+			current.close()
+			r.escalator.Store(nil)
+			r.logger.Info().Msg("网段升级封禁已停用")
+		}
+		return
+	}
+
+	if current != nil {
+		current.update(config, resolver)
+		return
+	}
+
+	r.escalator.Store(newSubnetEscalator(config, resolver, onEscalate, r.logger))
+	r.logger.Info().
+		Int("ipv4_prefix", config.IPv4PrefixLen).
+		Int("ipv6_prefix", config.IPv6PrefixLen).
+		Bool("by_asn", config.ByASN && resolver != nil).
+		Int("threshold", config.Threshold).
+		Msg("网段升级封禁已启用")
+}
+
+// RecordSimulatedBlock 记录模拟封禁 - 内存中只计数，不加入封禁列表
+func (r *MemoryIPRecorder) RecordSimulatedBlock(ip string, reason string, requestUri string, duration time.Duration) error {
+	r.Metrics.TotalSimulated.Add(1)
+
+	r.logger.Info().
+		Str("ip", ip).
+		Str("reason", reason).
+		Str("request_uri", requestUri).
+		Time("until", time.Now().Add(duration)).
+		Msg("IP触发模拟封禁（监控模式）")
+
+	return nil
+}
+
 // IsIPBlocked 检查IP是否被限制 - 返回简化的结果
 func (r *MemoryIPRecorder) IsIPBlocked(ip string) (bool, *model.BlockedIPRecord) {
 	// 使用defer recover防止任何可能的panic
@@ -455,7 +545,7 @@ func (r *MemoryIPRecorder) IsIPBlocked(ip string) (bool, *model.BlockedIPRecord)
 	memoryRecord, exists := s.blockedIPs[ip]
 	if !exists {
 		r.Metrics.CacheMisses.Add(1)
-		return false, nil
+		return r.isPrefixBlocked(ip)
 	}
 
 	// 安全检查时间
@@ -463,7 +553,7 @@ func (r *MemoryIPRecorder) IsIPBlocked(ip string) (bool, *model.BlockedIPRecord)
 	if memoryRecord.BlockedUntil.IsZero() || now.After(memoryRecord.BlockedUntil) {
 		// 过期了，直接返回false，不删除（避免加锁）
 		r.Metrics.CacheMisses.Add(1)
-		return false, nil
+		return r.isPrefixBlocked(ip)
 	}
 
 	r.Metrics.CacheHits.Add(1)
@@ -478,6 +568,32 @@ func (r *MemoryIPRecorder) IsIPBlocked(ip string) (bool, *model.BlockedIPRecord)
 	return true, fullRecord
 }
 
+// isPrefixBlocked 通过前缀树检查IP是否位于被封禁的网段
+func (r *MemoryIPRecorder) isPrefixBlocked(ip string) (bool, *model.BlockedIPRecord) {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false, nil
+	}
+	ban := r.prefixBans.lookup(addr)
+	if ban == nil {
+		return false, nil
+	}
+	record := prefixBanRecord(*ban)
+	return true, &record
+}
+
+// prefixBanRecord 将网段封禁转换为封禁记录，IP 字段保存网段
+func prefixBanRecord(ban PrefixBan) model.BlockedIPRecord {
+	return model.BlockedIPRecord{
+		IP:           ban.Prefix.String(),
+		Type:         ban.Type,
+		ASN:          ban.ASN,
+		IPCount:      ban.IPCount,
+		Reason:       ban.Reason,
+		BlockedUntil: ban.BlockedUntil,
+	}
+}
+
 // GetBlockedIPs 获取所有被限制的IP - 返回简化的记录
 func (r *MemoryIPRecorder) GetBlockedIPs() ([]model.BlockedIPRecord, error) {
 	now := time.Now()
@@ -500,6 +616,10 @@ func (r *MemoryIPRecorder) GetBlockedIPs() ([]model.BlockedIPRecord, error) {
 		s.mu.RUnlock()
 	}
 
+	for _, ban := range r.prefixBans.active(now) {
+		records = append(records, prefixBanRecord(ban))
+	}
+
 	return records, nil
 }
 
@@ -517,9 +637,14 @@ func (r *MemoryIPRecorder) GetMetrics() *Metrics {
 	return r.Metrics
 }
 
-// Close 关闭记录器并释放资源
+// Close 关闭记录器并释放资源，可重复调用
 func (r *MemoryIPRecorder) Close() error {
-	close(r.stopCleaner)
+	r.closeOnce.Do(func() {
+		if escalator := r.escalator.Load(); escalator != nil {
+			escalator.close()
+		}
+		close(r.stopCleaner)
+	})
 	return nil
 }
 
@@ -672,6 +797,7 @@ type MongoIPRecorder struct {
 	// 使用环形缓冲区替代channel
 	writeBuffer     *RingBuffer
 	stopWriter      chan struct{}
+	stopOnce        sync.Once
 	avgWriteLatency atomic.Value // time.Duration
 }
 
@@ -691,34 +817,80 @@ func NewMongoIPRecorder(client *mongo.Client, database string, capacity int, log
 // NewMongoIPRecorderWithConfig 使用配置创建MongoDB IP记录器
 func NewMongoIPRecorderWithConfig(client *mongo.Client, database string, config RecorderConfig, logger zerolog.Logger) *MongoIPRecorder {
 	mongoIPRecorderOnce.Do(func() {
-		var blockedIPs model.BlockedIPRecord
-
-		// 先创建内存记录器
-		memoryRecorder := NewMemoryIPRecorderWithConfig(config, logger)
-
-		recorder := &MongoIPRecorder{
-			client:         client,
-			database:       database,
-			collection:     blockedIPs.GetCollectionName(),
-			memory:         memoryRecorder,
-			logger:         logger,
-			config:         config,
-			metrics:        memoryRecorder.Metrics, // 共享metrics
-			circuitBreaker: NewCircuitBreaker(5, 30*time.Second, 3),
-			writeBuffer:    NewRingBuffer(config.WriteQueueSize),
-			stopWriter:     make(chan struct{}),
-		}
-
-		// 启动批量写入
-		go recorder.adaptiveBatchWriteLoop()
-
-		mongoIPRecorderInstance = recorder
-		logger.Info().Msg("创建新的MongoIPRecorder实例")
+		mongoIPRecorderInstance = newMongoIPRecorder(client, database, config, logger)
 	})
 
 	return mongoIPRecorderInstance
 }
 
+// newMongoIPRecorder 创建MongoDB IP记录器并启动批量写入，内存记录器为进程内共用的单例
+func newMongoIPRecorder(client *mongo.Client, database string, config RecorderConfig, logger zerolog.Logger) *MongoIPRecorder {
+	var blockedIPs model.BlockedIPRecord
+
+	// 先创建内存记录器
+	memoryRecorder := NewMemoryIPRecorderWithConfig(config, logger)
+
+	recorder := &MongoIPRecorder{
+		client:         client,
+		database:       database,
+		collection:     blockedIPs.GetCollectionName(),
+		memory:         memoryRecorder,
+		logger:         logger,
+		config:         config,
+		metrics:        memoryRecorder.Metrics, // 共享metrics
+		circuitBreaker: NewCircuitBreaker(5, 30*time.Second, 3),
+		writeBuffer:    NewRingBuffer(config.WriteQueueSize),
+		stopWriter:     make(chan struct{}),
+	}
+
+	// 启动批量写入
+	go recorder.adaptiveBatchWriteLoop()
+
+	logger.Info().Msg("创建新的MongoIPRecorder实例")
+
+	return recorder
+}
+
+// sharedMongoIPRecorder 各应用共用的MongoDB IP记录器，按引用计数管理批量写入的生命周期
+var sharedMongoIPRecorder struct {
+	mu       sync.Mutex
+	recorder *MongoIPRecorder
+	refs     int
+}
+
+// AcquireMongoIPRecorder 获取各应用共用的MongoDB IP记录器，没有使用者时创建新的记录器
+// 使用者不再需要时调用 ReleaseMongoIPRecorder 释放，不能直接关闭记录器
+func AcquireMongoIPRecorder(client *mongo.Client, database string, capacity int, logger zerolog.Logger) *MongoIPRecorder {
+	sharedMongoIPRecorder.mu.Lock()
+	defer sharedMongoIPRecorder.mu.Unlock()
+
+	if sharedMongoIPRecorder.recorder == nil {
+		config := DefaultConfig()
+		config.Capacity = capacity
+		sharedMongoIPRecorder.recorder = newMongoIPRecorder(client, database, config, logger)
+	}
+	sharedMongoIPRecorder.refs++
+	return sharedMongoIPRecorder.recorder
+}
+
+// ReleaseMongoIPRecorder 释放共用的MongoDB IP记录器，最后一个使用者释放时写入剩余的封禁记录并停止批量写入
+// 内存中的封禁记录保留，服务重新启动后继续生效
+func ReleaseMongoIPRecorder(recorder *MongoIPRecorder) {
+	sharedMongoIPRecorder.mu.Lock()
+	if recorder == nil || recorder != sharedMongoIPRecorder.recorder {
+		sharedMongoIPRecorder.mu.Unlock()
+		return
+	}
+	if sharedMongoIPRecorder.refs--; sharedMongoIPRecorder.refs > 0 {
+		sharedMongoIPRecorder.mu.Unlock()
+		return
+	}
+	sharedMongoIPRecorder.recorder = nil
+	sharedMongoIPRecorder.mu.Unlock()
+
+	recorder.stopWriting()
+}
+
 // adaptiveBatchSize 动态调整批量大小
 func (r *MongoIPRecorder) adaptiveBatchSize() int {
 	latency, ok := r.avgWriteLatency.Load().(time.Duration)
@@ -847,6 +1019,68 @@ func (r *MongoIPRecorder) RecordBlockedIP(ip string, reason string, requestUri s
 	}
 
 	// 异步写入到环形缓冲区
+	now := time.Now()
+	record := model.BlockedIPRecord{
+		IP:           ip,
+		Type:         BlockTypeIP,
+		Reason:       reason,
+		RequestUri:   requestUri,
+		BlockedAt:    now,
+		BlockedUntil: now.Add(duration),
+	}
+
+	if !r.writeBuffer.Push(record) {
+		r.logger.Warn().
+			Str("ip", ip).
+			Msg("MongoDB写入缓冲区已满，丢弃记录")
+	}
+
+	return nil
+}
+
+// RecordBlockedPrefix 记录网段封禁并持久化
+func (r *MongoIPRecorder) RecordBlockedPrefix(ban PrefixBan) error {
+	if err := r.memory.RecordBlockedPrefix(ban); err != nil {
+		return err
+	}
+
+	if r.circuitBreaker.IsOpen() {
+		r.logger.Warn().
+			Str("prefix", ban.Prefix.String()).
+			Msg("MongoDB熔断器已打开，跳过持久化")
+		return nil
+	}
+
+	record := prefixBanRecord(ban)
+	record.BlockedAt = time.Now()
+	if !r.writeBuffer.Push(record) {
+		r.logger.Warn().
+			Str("prefix", ban.Prefix.String()).
+			Msg("MongoDB写入缓冲区已满，丢弃记录")
+	}
+	return nil
+}
+
+// ConfigureSubnetEscalation 配置网段升级封禁任务，升级结果同时持久化
+func (r *MongoIPRecorder) ConfigureSubnetEscalation(config SubnetEscalationConfig, resolver ASNResolver) {
+	r.memory.configureEscalation(config, resolver, func(ban PrefixBan) {
+		_ = r.RecordBlockedPrefix(ban)
+	})
+}
+
+// RecordSimulatedBlock 记录模拟封禁，持久化时标记为 simulated
+func (r *MongoIPRecorder) RecordSimulatedBlock(ip string, reason string, requestUri string, duration time.Duration) error {
+	if err := r.memory.RecordSimulatedBlock(ip, reason, requestUri, duration); err != nil {
+		return err
+	}
+
+	if r.circuitBreaker.IsOpen() {
+		r.logger.Warn().
+			Str("ip", ip).
+			Msg("MongoDB熔断器已打开，跳过持久化")
+		return nil
+	}
+
 	now := time.Now()
 	record := model.BlockedIPRecord{
 		IP:           ip,
@@ -854,6 +1088,8 @@ func (r *MongoIPRecorder) RecordBlockedIP(ip string, reason string, requestUri s
 		RequestUri:   requestUri,
 		BlockedAt:    now,
 		BlockedUntil: now.Add(duration),
+		Type:         BlockTypeIP,
+		Simulated:    true,
 	}
 
 	if !r.writeBuffer.Push(record) {
@@ -886,8 +1122,15 @@ func (r *MongoIPRecorder) GetMetrics() *Metrics {
 	return r.metrics
 }
 
-// Close 关闭记录器并释放资源
+// Close 关闭记录器并释放资源，可重复调用
 func (r *MongoIPRecorder) Close() error {
-	close(r.stopWriter)
+	r.stopWriting()
 	return r.memory.Close()
 }
+
+// stopWriting 停止批量写入，写入循环退出前写入剩余的封禁记录，可重复调用
+func (r *MongoIPRecorder) stopWriting() {
+	r.stopOnce.Do(func() {
+		close(r.stopWriter)
+	})
+}
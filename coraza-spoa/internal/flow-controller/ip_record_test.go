@@ -0,0 +1,69 @@
+package flowcontroller
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// writerStopped 判断记录器的批量写入是否已停止
+func writerStopped(recorder *MongoIPRecorder) bool {
+	select {
+	case <-recorder.stopWriter:
+		return true
+	default:
+		return false
+	}
+}
+
+// TestSharedMongoIPRecorder 测试共用的IP记录器在最后一个使用者释放时才停止写入，内存中的封禁记录保留
+func TestSharedMongoIPRecorder(t *testing.T) {
+	client, err := mongo.Connect()
+	if err != nil {
+		t.Fatalf("创建客户端失败: %v", err)
+	}
+
+	first := AcquireMongoIPRecorder(client, "waf", 100, zerolog.Nop())
+	second := AcquireMongoIPRecorder(client, "waf", 100, zerolog.Nop())
+	if first != second {
+		t.Fatal("各使用者应获取同一个记录器")
+	}
+	if err := first.memory.RecordBlockedIP("10.0.0.1", ReasonAttack, "/", time.Hour); err != nil {
+		t.Fatalf("记录封禁失败: %v", err)
+	}
+
+	ReleaseMongoIPRecorder(first)
+	if writerStopped(first) {
+		t.Fatal("仍有使用者时不应停止写入")
+	}
+	ReleaseMongoIPRecorder(second)
+	if !writerStopped(first) {
+		t.Fatal("最后一个使用者释放后应停止写入")
+	}
+	// 重复释放被忽略
+	ReleaseMongoIPRecorder(second)
+
+	third := AcquireMongoIPRecorder(client, "waf", 100, zerolog.Nop())
+	defer ReleaseMongoIPRecorder(third)
+	if third == first || writerStopped(third) {
+		t.Fatal("全部释放后再次获取应创建新的记录器")
+	}
+	if blocked, _ := third.IsIPBlocked("10.0.0.1"); !blocked {
+		t.Fatal("重新获取后内存中的封禁记录应继续生效")
+	}
+}
+
+// TestMongoIPRecorderCloseTwice 测试记录器可重复关闭
+func TestMongoIPRecorderCloseTwice(t *testing.T) {
+	recorder := &MongoIPRecorder{
+		memory:     &MemoryIPRecorder{stopCleaner: make(chan struct{})},
+		stopWriter: make(chan struct{}),
+	}
+	for i := 0; i < 2; i++ {
+		if err := recorder.Close(); err != nil {
+			t.Fatalf("第 %d 次关闭失败: %v", i+1, err)
+		}
+	}
+}
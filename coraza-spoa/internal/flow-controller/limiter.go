@@ -0,0 +1,348 @@
+package flowcontroller
+
+import (
+	"sync"
+	"time"
+
+	"github.com/HUAHUAI23/simple-waf/pkg/model"
+)
+
+// Limiter 按键（通常为IP）计数的限流器
+// 每个 FlowController 持有自己的 Limiter 实例，不依赖进程级的全局规则表，
+// 因此多个应用可以使用各自的配置共存，替换应用时也不会互相覆盖计数
+type Limiter interface {
+	// Allow 记录一次事件，返回该键是否仍在阈值内
+	Allow(key string) bool
+	// Close 释放限流器资源
+	Close()
+}
+
+// 限流算法
+//
+// 三种算法的上限均为 Threshold+BurstCount，区别在于计数何时恢复：
+//   - token_bucket：桶容量为 Threshold+BurstCount，每个 StatDuration 匀速补充 Threshold 个令牌，
+//     适合限制持续速率并容忍短时突发，长窗口下（如每小时 1000 次）耗尽后按 StatDuration/Threshold 的间隔逐个恢复
+//   - sliding_window：滑动窗口计数，按上一窗口计数的剩余占比加上当前窗口计数估算最近 StatDuration 内的事件数，
+//     估算值小于上限时放行，不会出现窗口交界处的双倍突发
+//   - fixed_window：按 Unix 时间对齐的固定窗口计数，窗口内最多放行上限次，到达下一个窗口起点时清零
+const (
+	AlgorithmTokenBucket   = model.FlowLimitAlgorithmTokenBucket
+	AlgorithmSlidingWindow = model.FlowLimitAlgorithmSlidingWindow
+	AlgorithmFixedWindow   = model.FlowLimitAlgorithmFixedWindow
+)
+
+// LimitRule 限流规则参数
+type LimitRule struct {
+	Algorithm      string        // 限流算法，为空时使用令牌桶
+	Threshold      int64         // 统计窗口内允许的事件数
+	BurstCount     int64         // 额外允许的突发数
+	StatDuration   time.Duration // 统计时间窗口
+	ParamsCapacity int64         // 最多跟踪的键数量
+}
+
+// normalize 修正非法参数
+func (r LimitRule) normalize() LimitRule {
+	if r.Threshold < 0 {
+		r.Threshold = 0
+	}
+	if r.BurstCount < 0 {
+		r.BurstCount = 0
+	}
+	if r.StatDuration <= 0 {
+		r.StatDuration = time.Second
+	}
+	if r.ParamsCapacity <= 0 {
+		r.ParamsCapacity = 10000
+	}
+	switch r.Algorithm {
+	case AlgorithmTokenBucket, AlgorithmSlidingWindow, AlgorithmFixedWindow:
+	default:
+		r.Algorithm = AlgorithmTokenBucket
+	}
+	return r
+}
+
+// limit 窗口内允许的事件总数
+func (r LimitRule) limit() int64 {
+	return r.Threshold + r.BurstCount
+}
+
+// counter 单个键的计数状态，由所在分片的锁保护
+type counter interface {
+	// allow 记录一次事件并返回是否放行
+	allow(now int64) bool
+	// idle 返回该状态是否已恢复为初始状态，可以安全回收
+	idle(now int64) bool
+}
+
+// tokenBucketParams 令牌桶参数
+// 桶容量为 Threshold+BurstCount，每个统计窗口补充 Threshold 个令牌
+type tokenBucketParams struct {
+	capacity float64
+	rate     float64 // 每纳秒补充的令牌数
+}
+
+func (p *tokenBucketParams) newCounter(now int64) counter {
+	return &tokenBucket{params: p, tokens: p.capacity, last: now}
+}
+
+// tokenBucket 令牌桶计数状态
+type tokenBucket struct {
+	params *tokenBucketParams
+	tokens float64
+	last   int64 // 上次补充令牌的时间（纳秒）
+}
+
+func (b *tokenBucket) refill(now int64) {
+	elapsed := now - b.last
+	if elapsed <= 0 {
+		return
+	}
+	b.tokens += float64(elapsed) * b.params.rate
+	if b.tokens > b.params.capacity {
+		b.tokens = b.params.capacity
+	}
+	b.last = now
+}
+
+func (b *tokenBucket) allow(now int64) bool {
+	b.refill(now)
+	if b.tokens >= 1 {
+		b.tokens--
+		return true
+	}
+	return false
+}
+
+func (b *tokenBucket) idle(now int64) bool {
+	b.refill(now)
+	return b.tokens >= b.params.capacity
+}
+
+// windowParams 窗口计数参数
+type windowParams struct {
+	limit  int64 // 窗口内允许的事件数
+	window int64 // 窗口长度（纳秒）
+}
+
+// windowStart 返回 now 所在窗口的起点，窗口按 Unix 时间对齐
+func (p *windowParams) windowStart(now int64) int64 {
+	return now - now%p.window
+}
+
+func (p *windowParams) newFixedWindow(now int64) counter {
+	return &fixedWindow{params: p, start: p.windowStart(now)}
+}
+
+func (p *windowParams) newSlidingWindow(now int64) counter {
+	return &slidingWindow{params: p, start: p.windowStart(now)}
+}
+
+// fixedWindow 固定窗口计数状态
+type fixedWindow struct {
+	params *windowParams
+	start  int64 // 当前窗口起点（纳秒）
+	count  int64
+}
+
+func (w *fixedWindow) allow(now int64) bool {
+	if start := w.params.windowStart(now); start != w.start {
+		w.start = start
+		w.count = 0
+	}
+	if w.count < w.params.limit {
+		w.count++
+		return true
+	}
+	return false
+}
+
+func (w *fixedWindow) idle(now int64) bool {
+	return w.count == 0 || w.params.windowStart(now) != w.start
+}
+
+// slidingWindow 滑动窗口计数状态，保存当前与上一窗口的计数
+type slidingWindow struct {
+	params *windowParams
+	start  int64 // 当前窗口起点（纳秒）
+	prev   int64 // 上一窗口计数
+	curr   int64 // 当前窗口计数
+}
+
+// advance 推进到 now 所在的窗口
+func (w *slidingWindow) advance(now int64) {
+	start := w.params.windowStart(now)
+	if start == w.start {
+		return
+	}
+	if start-w.start == w.params.window {
+		w.prev = w.curr
+	} else {
+		w.prev = 0
+	}
+	w.curr = 0
+	w.start = start
+}
+
+func (w *slidingWindow) allow(now int64) bool {
+	w.advance(now)
+	// 上一窗口仍落在最近 window 内的部分按比例计入
+	remaining := float64(w.params.window-(now-w.start)) / float64(w.params.window)
+	estimated := float64(w.prev)*remaining + float64(w.curr)
+	if estimated < float64(w.params.limit) {
+		w.curr++
+		return true
+	}
+	return false
+}
+
+func (w *slidingWindow) idle(now int64) bool {
+	w.advance(now)
+	return w.prev == 0 && w.curr == 0
+}
+
+// limiterShard 限流器分片
+type limiterShard struct {
+	mu       sync.Mutex
+	counters map[string]counter
+}
+
+// keyedLimiter 分片存储的本地限流器，计数状态由 newCounter 决定
+type keyedLimiter struct {
+	shards           []*limiterShard
+	shardMask        uint32
+	capacityPerShard int
+	newCounter       func(now int64) counter
+	nowFunc          func() time.Time
+	stopCh           chan struct{}
+	closeOnce        sync.Once
+}
+
+const limiterShardCount = 16
+
+func newKeyedLimiter(capacity int64, cleanupInterval time.Duration, newCounter func(now int64) counter) *keyedLimiter {
+	capacityPerShard := int(capacity) / limiterShardCount
+	if capacityPerShard < 1 {
+		capacityPerShard = 1
+	}
+
+	l := &keyedLimiter{
+		shards:           make([]*limiterShard, limiterShardCount),
+		shardMask:        limiterShardCount - 1,
+		capacityPerShard: capacityPerShard,
+		newCounter:       newCounter,
+		nowFunc:          time.Now,
+		stopCh:           make(chan struct{}),
+	}
+	for i := range l.shards {
+		l.shards[i] = &limiterShard{counters: make(map[string]counter)}
+	}
+
+	go l.cleanupLoop(cleanupInterval)
+	return l
+}
+
+// NewLocalLimiter 按规则中的算法创建本地限流器
+func NewLocalLimiter(rule LimitRule) Limiter {
+	rule = rule.normalize()
+	switch rule.Algorithm {
+	case AlgorithmSlidingWindow:
+		return NewSlidingWindowLimiter(rule)
+	case AlgorithmFixedWindow:
+		return NewFixedWindowLimiter(rule)
+	default:
+		return NewTokenBucketLimiter(rule)
+	}
+}
+
+// NewTokenBucketLimiter 创建本地令牌桶限流器
+func NewTokenBucketLimiter(rule LimitRule) Limiter {
+	rule = rule.normalize()
+	params := &tokenBucketParams{
+		capacity: float64(rule.limit()),
+		rate:     float64(rule.Threshold) / float64(rule.StatDuration.Nanoseconds()),
+	}
+	return newKeyedLimiter(rule.ParamsCapacity, rule.StatDuration, params.newCounter)
+}
+
+// NewSlidingWindowLimiter 创建本地滑动窗口限流器
+func NewSlidingWindowLimiter(rule LimitRule) Limiter {
+	rule = rule.normalize()
+	params := &windowParams{limit: rule.limit(), window: rule.StatDuration.Nanoseconds()}
+	return newKeyedLimiter(rule.ParamsCapacity, rule.StatDuration, params.newSlidingWindow)
+}
+
+// NewFixedWindowLimiter 创建本地固定窗口限流器
+func NewFixedWindowLimiter(rule LimitRule) Limiter {
+	rule = rule.normalize()
+	params := &windowParams{limit: rule.limit(), window: rule.StatDuration.Nanoseconds()}
+	return newKeyedLimiter(rule.ParamsCapacity, rule.StatDuration, params.newFixedWindow)
+}
+
+// Allow 记录一次事件并返回是否放行
+func (l *keyedLimiter) Allow(key string) bool {
+	now := l.nowFunc().UnixNano()
+	s := l.shards[fnv32(key)&l.shardMask]
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.counters[key]
+	if !ok {
+		if len(s.counters) >= l.capacityPerShard {
+			l.evictLocked(s, now)
+		}
+		c = l.newCounter(now)
+		s.counters[key] = c
+	}
+	return c.allow(now)
+}
+
+// evictLocked 分片已满时腾出空间：优先回收空闲状态，否则淘汰任意一个键
+func (l *keyedLimiter) evictLocked(s *limiterShard, now int64) {
+	for key, c := range s.counters {
+		if c.idle(now) {
+			delete(s.counters, key)
+		}
+	}
+	for key := range s.counters {
+		if len(s.counters) < l.capacityPerShard {
+			return
+		}
+		delete(s.counters, key)
+	}
+}
+
+// cleanupLoop 定期回收已恢复初始状态的计数，控制内存占用
+func (l *keyedLimiter) cleanupLoop(interval time.Duration) {
+	if interval < time.Second {
+		interval = time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-l.stopCh:
+			return
+		case <-ticker.C:
+			now := l.nowFunc().UnixNano()
+			for _, s := range l.shards {
+				s.mu.Lock()
+				for key, c := range s.counters {
+					if c.idle(now) {
+						delete(s.counters, key)
+					}
+				}
+				s.mu.Unlock()
+			}
+		}
+	}
+}
+
+// Close 停止清理协程
+func (l *keyedLimiter) Close() {
+	l.closeOnce.Do(func() {
+		close(l.stopCh)
+	})
+}
@@ -0,0 +1,121 @@
+package flowcontroller
+
+import (
+	"testing"
+	"time"
+)
+
+// limiterStep 在相对窗口起点的时间偏移处发起若干次请求，期望放行的次数
+type limiterStep struct {
+	at      time.Duration
+	count   int
+	allowed int
+}
+
+// TestLocalLimiterBoundaries 校验各算法在窗口交界处的放行次数
+func TestLocalLimiterBoundaries(t *testing.T) {
+	// 对齐到分钟的起点，窗口算法按 Unix 时间对齐
+	base := time.Unix(1700000040, 0)
+
+	tests := []struct {
+		name  string
+		rule  LimitRule
+		steps []limiterStep
+	}{
+		{
+			name: "令牌桶容量为阈值加突发数",
+			rule: LimitRule{Algorithm: AlgorithmTokenBucket, Threshold: 2, BurstCount: 1, StatDuration: time.Minute},
+			steps: []limiterStep{
+				{0, 4, 3},
+				{29 * time.Second, 1, 0},
+				{30 * time.Second, 2, 1}, // 每30秒补充1个令牌
+				{60 * time.Second, 1, 1},
+				{10 * time.Minute, 4, 3}, // 补满后不超过容量
+			},
+		},
+		{
+			name: "空算法按令牌桶处理",
+			rule: LimitRule{Threshold: 2, StatDuration: time.Minute},
+			steps: []limiterStep{
+				{0, 3, 2},
+				{30 * time.Second, 2, 1},
+			},
+		},
+		{
+			name: "固定窗口在窗口起点清零",
+			rule: LimitRule{Algorithm: AlgorithmFixedWindow, Threshold: 3, StatDuration: time.Minute},
+			steps: []limiterStep{
+				{0, 4, 3},
+				{60*time.Second - time.Nanosecond, 1, 0},
+				{60 * time.Second, 4, 3},
+				{119 * time.Second, 1, 0},
+			},
+		},
+		{
+			name: "固定窗口交界处允许双倍突发",
+			rule: LimitRule{Algorithm: AlgorithmFixedWindow, Threshold: 3, StatDuration: time.Minute},
+			steps: []limiterStep{
+				{59 * time.Second, 3, 3},
+				{60 * time.Second, 3, 3},
+			},
+		},
+		{
+			name: "固定窗口计入突发数",
+			rule: LimitRule{Algorithm: AlgorithmFixedWindow, Threshold: 3, BurstCount: 2, StatDuration: time.Minute},
+			steps: []limiterStep{
+				{0, 6, 5},
+			},
+		},
+		{
+			name: "滑动窗口按上一窗口剩余占比计数",
+			rule: LimitRule{Algorithm: AlgorithmSlidingWindow, Threshold: 4, StatDuration: time.Minute},
+			steps: []limiterStep{
+				{0, 5, 4},
+				{60 * time.Second, 1, 0},  // 上一窗口权重为1，估算值 4
+				{75 * time.Second, 2, 1},  // 权重0.75，估算值 3，放行1次后为 4
+				{90 * time.Second, 2, 1},  // 权重0.5，估算值 2+1，放行1次后为 4
+				{120 * time.Second, 4, 2}, // 上一窗口计数 2，权重1
+			},
+		},
+		{
+			name: "滑动窗口交界处不允许双倍突发",
+			rule: LimitRule{Algorithm: AlgorithmSlidingWindow, Threshold: 3, StatDuration: time.Minute},
+			steps: []limiterStep{
+				{59 * time.Second, 3, 3},
+				{60 * time.Second, 3, 0},
+				{80 * time.Second, 3, 1}, // 3*2/3 = 2
+			},
+		},
+		{
+			name: "滑动窗口跨越多个窗口后清零",
+			rule: LimitRule{Algorithm: AlgorithmSlidingWindow, Threshold: 3, StatDuration: time.Minute},
+			steps: []limiterStep{
+				{0, 3, 3},
+				{120 * time.Second, 4, 3},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limiter := NewLocalLimiter(tt.rule).(*keyedLimiter)
+			defer limiter.Close()
+
+			var now time.Time
+			limiter.nowFunc = func() time.Time { return now }
+
+			for i, step := range tt.steps {
+				now = base.Add(step.at)
+				allowed := 0
+				for j := 0; j < step.count; j++ {
+					if limiter.Allow("10.0.0.1") {
+						allowed++
+					}
+				}
+				if allowed != step.allowed {
+					t.Fatalf("第 %d 步（%v）放行 %d 次，期望 %d 次", i+1, step.at, allowed, step.allowed)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,150 @@
+package flowcontroller
+
+import (
+	"net/netip"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/HUAHUAI23/simple-waf/pkg/model"
+)
+
+// 封禁记录类型
+const (
+	BlockTypeIP     = model.BlockTypeIP
+	BlockTypePrefix = model.BlockTypePrefix
+	BlockTypeASN    = model.BlockTypeASN
+)
+
+// PrefixBan 网段封禁
+type PrefixBan struct {
+	Prefix       netip.Prefix // 被封禁的网段
+	Type         string       // 封禁类型：prefix 或 asn
+	ASN          uint         // 按ASN聚合时的ASN编号
+	Reason       string       // 封禁原因
+	IPCount      int          // 触发升级时窗口内被封禁的不同IP数
+	BlockedUntil time.Time    // 封禁结束时间
+}
+
+// trieNode 二叉前缀树节点
+type trieNode struct {
+	children [2]*trieNode
+	ban      *PrefixBan
+}
+
+// prefixTrie 按地址位构建的只读前缀树，IPv4 与 IPv6 分开存储
+type prefixTrie struct {
+	v4 *trieNode
+	v6 *trieNode
+}
+
+func newPrefixTrie(bans map[netip.Prefix]*PrefixBan) *prefixTrie {
+	t := &prefixTrie{v4: &trieNode{}, v6: &trieNode{}}
+	for prefix, ban := range bans {
+		root := t.v6
+		if prefix.Addr().Is4() {
+			root = t.v4
+		}
+		node := root
+		bytes := prefix.Addr().AsSlice()
+		for i := 0; i < prefix.Bits(); i++ {
+			bit := (bytes[i/8] >> (7 - uint(i%8))) & 1
+			if node.children[bit] == nil {
+				node.children[bit] = &trieNode{}
+			}
+			node = node.children[bit]
+		}
+		node.ban = ban
+	}
+	return t
+}
+
+// lookup 返回包含该地址且仍在封禁期内的网段，命中多个时返回最短前缀
+func (t *prefixTrie) lookup(addr netip.Addr, now time.Time) *PrefixBan {
+	node := t.v6
+	if addr.Is4() {
+		node = t.v4
+	}
+	bytes := addr.AsSlice()
+	for i := 0; node != nil; i++ {
+		if node.ban != nil && now.Before(node.ban.BlockedUntil) {
+			return node.ban
+		}
+		if i == len(bytes)*8 {
+			break
+		}
+		node = node.children[(bytes[i/8]>>(7-uint(i%8)))&1]
+	}
+	return nil
+}
+
+// prefixBanSet 网段封禁集合
+// 写入时重建前缀树并原子替换，查询无锁，与 IsIPBlocked 的无锁读取方式保持一致
+type prefixBanSet struct {
+	mu   sync.Mutex
+	bans map[netip.Prefix]*PrefixBan
+	trie atomic.Pointer[prefixTrie]
+}
+
+func newPrefixBanSet() *prefixBanSet {
+	return &prefixBanSet{bans: make(map[netip.Prefix]*PrefixBan)}
+}
+
+// add 添加或延长网段封禁，返回是否为新增
+func (s *prefixBanSet) add(ban PrefixBan) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing, exists := s.bans[ban.Prefix]
+	if exists && !ban.BlockedUntil.After(existing.BlockedUntil) {
+		return false
+	}
+	s.bans[ban.Prefix] = &ban
+	s.trie.Store(newPrefixTrie(s.bans))
+	return !exists
+}
+
+// lookup 查询地址所在的封禁网段
+func (s *prefixBanSet) lookup(addr netip.Addr) *PrefixBan {
+	t := s.trie.Load()
+	if t == nil {
+		return nil
+	}
+	return t.lookup(addr.Unmap(), time.Now())
+}
+
+// cleanup 移除过期的网段封禁，返回移除数量
+func (s *prefixBanSet) cleanup(now time.Time) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	removed := 0
+	for prefix, ban := range s.bans {
+		if !now.Before(ban.BlockedUntil) {
+			delete(s.bans, prefix)
+			removed++
+		}
+	}
+	if removed > 0 {
+		if len(s.bans) == 0 {
+			s.trie.Store(nil)
+		} else {
+			s.trie.Store(newPrefixTrie(s.bans))
+		}
+	}
+	return removed
+}
+
+// active 返回仍在封禁期内的网段
+func (s *prefixBanSet) active(now time.Time) []PrefixBan {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	bans := make([]PrefixBan, 0, len(s.bans))
+	for _, ban := range s.bans {
+		if now.Before(ban.BlockedUntil) {
+			bans = append(bans, *ban)
+		}
+	}
+	return bans
+}
@@ -0,0 +1,271 @@
+package flowcontroller
+
+import (
+	"fmt"
+	"net/netip"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// SubnetEscalationConfig 网段升级封禁配置
+type SubnetEscalationConfig struct {
+	Enabled       bool          // 是否启用
+	IPv4PrefixLen int           // IPv4 聚合前缀长度，如 24
+	IPv6PrefixLen int           // IPv6 聚合前缀长度，如 48
+	ByASN         bool          // 是否同时按ASN聚合，需要ASN数据库
+	Threshold     int           // 窗口内同一前缀被封禁的不同IP数超过该值时封禁整个前缀
+	Window        time.Duration // 统计窗口
+	BlockDuration time.Duration // 网段封禁时长
+}
+
+// normalize 修正非法参数
+func (c SubnetEscalationConfig) normalize() SubnetEscalationConfig {
+	if c.IPv4PrefixLen <= 0 || c.IPv4PrefixLen > 32 {
+		c.IPv4PrefixLen = 24
+	}
+	if c.IPv6PrefixLen <= 0 || c.IPv6PrefixLen > 128 {
+		c.IPv6PrefixLen = 48
+	}
+	if c.Threshold <= 0 {
+		c.Threshold = 10
+	}
+	if c.Window <= 0 {
+		c.Window = 10 * time.Minute
+	}
+	if c.BlockDuration <= 0 {
+		c.BlockDuration = time.Hour
+	}
+	return c
+}
+
+// ASNResolver 查询IP所属的ASN及其在ASN数据库中的网段
+type ASNResolver interface {
+	LookupASN(addr netip.Addr) (asn uint, network netip.Prefix, ok bool)
+}
+
+// 升级检查间隔
+const subnetEscalationInterval = 10 * time.Second
+
+// ASN网段的最短前缀，ASN数据库中更大的网段按配置的前缀长度封禁，避免误封过大范围
+const (
+	minASNPrefixLenV4 = 16
+	minASNPrefixLenV6 = 32
+)
+
+// escalationGroup 同一聚合键下近期被封禁的IP
+type escalationGroup struct {
+	prefix   netip.Prefix              // 按前缀聚合时的网段
+	asn      uint                      // 按ASN聚合时的ASN编号
+	ips      map[netip.Addr]time.Time  // IP -> 最近一次被封禁的时间
+	networks map[netip.Prefix]struct{} // 按ASN聚合时，被封禁IP所在的ASN网段
+}
+
+// subnetEscalator 网段升级封禁任务
+// 观察单IP封禁事件，定期按前缀或ASN聚合，超过阈值时回调 onEscalate 封禁整个网段
+type subnetEscalator struct {
+	mu         sync.Mutex
+	config     SubnetEscalationConfig
+	resolver   ASNResolver
+	groups     map[string]*escalationGroup
+	escalated  map[uint]time.Time    // 已升级的ASN -> 封禁结束时间
+	pending    map[netip.Prefix]uint // 已升级ASN下新出现的网段，等待下次检查时封禁
+	onEscalate func(ban PrefixBan)
+	logger     zerolog.Logger
+	stopCh     chan struct{}
+	closeOnce  sync.Once
+}
+
+func newSubnetEscalator(config SubnetEscalationConfig, resolver ASNResolver, onEscalate func(ban PrefixBan), logger zerolog.Logger) *subnetEscalator {
+	e := &subnetEscalator{
+		config:     config.normalize(),
+		resolver:   resolver,
+		groups:     make(map[string]*escalationGroup),
+		escalated:  make(map[uint]time.Time),
+		pending:    make(map[netip.Prefix]uint),
+		onEscalate: onEscalate,
+		logger:     logger,
+		stopCh:     make(chan struct{}),
+	}
+	go e.loop()
+	return e
+}
+
+// observe 记录一次单IP封禁
+func (e *subnetEscalator) observe(ip string, now time.Time) {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return
+	}
+	addr = addr.Unmap()
+
+	e.mu.Lock()
+	config, resolver := e.config, e.resolver
+	e.mu.Unlock()
+
+	bits := config.IPv6PrefixLen
+	if addr.Is4() {
+		bits = config.IPv4PrefixLen
+	}
+	prefix, err := addr.Prefix(bits)
+	if err != nil {
+		return
+	}
+
+	var (
+		asn     uint
+		network netip.Prefix
+		hasASN  bool
+	)
+	if config.ByASN && resolver != nil {
+		asn, network, hasASN = resolver.LookupASN(addr)
+		hasASN = hasASN && asn != 0
+		if hasASN && (!network.IsValid() || network.Bits() < minASNPrefixLen(addr)) {
+			network = prefix
+		}
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.groupLocked("prefix:"+prefix.String(), func() *escalationGroup {
+		return &escalationGroup{prefix: prefix}
+	}).ips[addr] = now
+
+	if hasASN {
+		// 已升级的ASN出现新网段时直接等待封禁，不再重新计数
+		if until, ok := e.escalated[asn]; ok && now.Before(until) {
+			e.pending[network] = asn
+			return
+		}
+		group := e.groupLocked(fmt.Sprintf("asn:%d", asn), func() *escalationGroup {
+			return &escalationGroup{asn: asn, networks: make(map[netip.Prefix]struct{})}
+		})
+		group.ips[addr] = now
+		group.networks[network] = struct{}{}
+	}
+}
+
+// update 更新配置，已聚合的封禁事件保留
+func (e *subnetEscalator) update(config SubnetEscalationConfig, resolver ASNResolver) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.config = config.normalize()
+	e.resolver = resolver
+}
+
+func minASNPrefixLen(addr netip.Addr) int {
+	if addr.Is4() {
+		return minASNPrefixLenV4
+	}
+	return minASNPrefixLenV6
+}
+
+func (e *subnetEscalator) groupLocked(key string, create func() *escalationGroup) *escalationGroup {
+	group, ok := e.groups[key]
+	if !ok {
+		group = create()
+		group.ips = make(map[netip.Addr]time.Time)
+		e.groups[key] = group
+	}
+	return group
+}
+
+// evaluate 清理窗口外的记录，返回需要封禁的网段
+func (e *subnetEscalator) evaluate(now time.Time) []PrefixBan {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	var bans []PrefixBan
+	until := now.Add(e.config.BlockDuration)
+
+	for key, group := range e.groups {
+		for ip, at := range group.ips {
+			if now.Sub(at) > e.config.Window {
+				delete(group.ips, ip)
+			}
+		}
+
+		count := len(group.ips)
+		if count <= e.config.Threshold {
+			if count == 0 {
+				delete(e.groups, key)
+			}
+			continue
+		}
+
+		if group.networks == nil {
+			bans = append(bans, PrefixBan{
+				Prefix:       group.prefix,
+				Type:         BlockTypePrefix,
+				Reason:       ReasonSubnetEscalation,
+				IPCount:      count,
+				BlockedUntil: until,
+			})
+		} else {
+			for network := range group.networks {
+				bans = append(bans, PrefixBan{
+					Prefix:       network,
+					Type:         BlockTypeASN,
+					ASN:          group.asn,
+					Reason:       ReasonASNEscalation,
+					IPCount:      count,
+					BlockedUntil: until,
+				})
+			}
+			e.escalated[group.asn] = until
+		}
+		delete(e.groups, key)
+	}
+
+	for network, asn := range e.pending {
+		bans = append(bans, PrefixBan{
+			Prefix:       network,
+			Type:         BlockTypeASN,
+			ASN:          asn,
+			Reason:       ReasonASNEscalation,
+			BlockedUntil: e.escalated[asn],
+		})
+		delete(e.pending, network)
+	}
+
+	for asn, asnUntil := range e.escalated {
+		if !now.Before(asnUntil) {
+			delete(e.escalated, asn)
+		}
+	}
+
+	return bans
+}
+
+func (e *subnetEscalator) loop() {
+	ticker := time.NewTicker(subnetEscalationInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-e.stopCh:
+			return
+		case now := <-ticker.C:
+			for _, ban := range e.evaluate(now) {
+				e.logger.Warn().
+					Str("prefix", ban.Prefix.String()).
+					Str("type", ban.Type).
+					Uint("asn", ban.ASN).
+					Int("ip_count", ban.IPCount).
+					Time("until", ban.BlockedUntil).
+					Msg("网段内被封禁IP过多，升级为网段封禁")
+				e.onEscalate(ban)
+			}
+		}
+	}
+}
+
+// close 停止升级任务
+func (e *subnetEscalator) close() {
+	e.closeOnce.Do(func() {
+		close(e.stopCh)
+	})
+}
@@ -0,0 +1,121 @@
+package flowcontroller
+
+import (
+	"fmt"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+type staticASNResolver map[string]uint
+
+func (r staticASNResolver) LookupASN(addr netip.Addr) (uint, netip.Prefix, bool) {
+	prefix, _ := addr.Prefix(20)
+	asn, ok := r[prefix.String()]
+	return asn, prefix, ok
+}
+
+func TestSubnetEscalatorPrefix(t *testing.T) {
+	e := newSubnetEscalator(SubnetEscalationConfig{
+		Enabled:       true,
+		Threshold:     3,
+		Window:        time.Minute,
+		BlockDuration: time.Hour,
+	}, nil, func(PrefixBan) {}, zerolog.Nop())
+	defer e.close()
+
+	now := time.Now()
+	for i := 1; i <= 3; i++ {
+		e.observe(fmt.Sprintf("10.1.2.%d", i), now)
+	}
+	if bans := e.evaluate(now); len(bans) != 0 {
+		t.Fatalf("未超过阈值不应升级，实际 %v", bans)
+	}
+
+	// 同一IP重复封禁不重复计数
+	e.observe("10.1.2.3", now)
+	if bans := e.evaluate(now); len(bans) != 0 {
+		t.Fatalf("重复IP不应计数，实际 %v", bans)
+	}
+
+	e.observe("10.1.2.4", now)
+	e.observe("10.1.3.1", now)
+	bans := e.evaluate(now)
+	if len(bans) != 1 || bans[0].Prefix.String() != "10.1.2.0/24" || bans[0].Type != BlockTypePrefix || bans[0].IPCount != 4 {
+		t.Fatalf("应升级封禁 10.1.2.0/24，实际 %v", bans)
+	}
+
+	// 窗口外的封禁不计数
+	later := now.Add(2 * time.Minute)
+	for i := 1; i <= 4; i++ {
+		e.observe(fmt.Sprintf("10.9.9.%d", i), now)
+	}
+	if bans := e.evaluate(later); len(bans) != 0 {
+		t.Fatalf("窗口外的封禁不应升级，实际 %v", bans)
+	}
+}
+
+func TestSubnetEscalatorASN(t *testing.T) {
+	resolver := staticASNResolver{"10.0.0.0/20": 64500, "10.0.16.0/20": 64500}
+	e := newSubnetEscalator(SubnetEscalationConfig{
+		Enabled:   true,
+		ByASN:     true,
+		Threshold: 2,
+	}, resolver, func(PrefixBan) {}, zerolog.Nop())
+	defer e.close()
+
+	now := time.Now()
+	e.observe("10.0.1.1", now)
+	e.observe("10.0.2.1", now)
+	e.observe("10.0.17.1", now)
+
+	bans := e.evaluate(now)
+	if len(bans) != 2 {
+		t.Fatalf("应封禁ASN下的 2 个网段，实际 %v", bans)
+	}
+	for _, ban := range bans {
+		if ban.Type != BlockTypeASN || ban.ASN != 64500 {
+			t.Fatalf("封禁类型错误: %+v", ban)
+		}
+	}
+
+	// 已升级的ASN出现新网段时直接封禁
+	resolver["10.0.32.0/20"] = 64500
+	e.observe("10.0.33.1", now)
+	bans = e.evaluate(now)
+	if len(bans) != 1 || bans[0].Prefix.String() != "10.0.32.0/20" {
+		t.Fatalf("应直接封禁新网段，实际 %v", bans)
+	}
+}
+
+func TestPrefixBanSetLookup(t *testing.T) {
+	set := newPrefixBanSet()
+	until := time.Now().Add(time.Hour)
+	set.add(PrefixBan{Prefix: netip.MustParsePrefix("192.0.2.0/24"), Type: BlockTypePrefix, BlockedUntil: until})
+	set.add(PrefixBan{Prefix: netip.MustParsePrefix("2001:db8::/48"), Type: BlockTypePrefix, BlockedUntil: until})
+	set.add(PrefixBan{Prefix: netip.MustParsePrefix("198.51.100.0/24"), Type: BlockTypePrefix, BlockedUntil: time.Now().Add(-time.Second)})
+
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{"192.0.2.1", true},
+		{"192.0.2.255", true},
+		{"192.0.3.1", false},
+		{"::ffff:192.0.2.9", true},
+		{"2001:db8:0:ffff::1", true},
+		{"2001:db8:1::1", false},
+		{"198.51.100.1", false}, // 已过期
+	}
+	for _, tt := range tests {
+		if got := set.lookup(netip.MustParseAddr(tt.ip)) != nil; got != tt.want {
+			t.Errorf("lookup(%s) = %v, want %v", tt.ip, got, tt.want)
+		}
+	}
+
+	if removed := set.cleanup(time.Now()); removed != 1 {
+		t.Fatalf("应清理 1 条过期网段，实际 %d", removed)
+	}
+}
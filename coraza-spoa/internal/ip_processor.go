@@ -3,10 +3,12 @@ package internal
 import (
 	"context"
 	"net"
+	"net/netip"
 	"sync"
 
 	"github.com/HUAHUAI23/simple-waf/pkg/model"
 	"github.com/oschwald/geoip2-golang"
+	"github.com/oschwald/maxminddb-golang"
 	"github.com/rs/zerolog"
 )
 
@@ -21,12 +23,14 @@ type IPProcessor interface {
 
 // GeoIP2Processor 是基于MaxMind GeoIP2数据库的IP处理器实现
 type GeoIP2Processor struct {
-	cityDB *geoip2.Reader  // 城市数据库
-	asnDB  *geoip2.Reader  // ASN数据库
-	logger zerolog.Logger  // 日志记录器
-	mutex  sync.RWMutex    // 读写锁
-	ctx    context.Context // 上下文
-	closed bool            // 是否已关闭
+	cityDB *geoip2.Reader    // 城市数据库
+	asnDB  *geoip2.Reader    // ASN数据库
+	asnNet *maxminddb.Reader // ASN数据库的底层读取器，用于查询IP所在网段
+	logger zerolog.Logger    // 日志记录器
+	mutex  sync.RWMutex      // 读写锁
+	ctx    context.Context   // 上下文
+	done   chan struct{}     // 关闭时通知监听协程退出
+	closed bool              // 是否已关闭
 }
 
 // GeoIP2Options 包含GeoIP2处理器的配置选项
@@ -40,6 +44,7 @@ func NewGeoIP2Processor(ctx context.Context, options GeoIP2Options, logger zerol
 	processor := &GeoIP2Processor{
 		logger: logger,
 		ctx:    ctx,
+		done:   make(chan struct{}),
 	}
 
 	// 尝试打开City数据库
@@ -62,6 +67,14 @@ func NewGeoIP2Processor(ctx context.Context, options GeoIP2Options, logger zerol
 		} else {
 			processor.asnDB = asnDB
 		}
+
+		// geoip2 不提供网段查询，单独打开底层读取器，数据库通过 mmap 加载，不会重复占用内存
+		asnNet, err := maxminddb.Open(options.ASNDBPath)
+		if err != nil {
+			logger.Warn().Err(err).Str("path", options.ASNDBPath).Msg("打开ASN网段数据库失败，按ASN升级封禁将不可用")
+		} else {
+			processor.asnNet = asnNet
+		}
 	} else {
 		logger.Warn().Msg("未提供ASN数据库路径，ASN信息将不可用")
 	}
@@ -77,10 +90,13 @@ func NewGeoIP2Processor(ctx context.Context, options GeoIP2Options, logger zerol
 	return processor, nil
 }
 
-// watchContext 监听上下文取消信号，当上下文取消时自动释放资源
+// watchContext 监听上下文取消信号，当上下文取消时自动释放资源，手动关闭时退出
 func (p *GeoIP2Processor) watchContext() {
-	<-p.ctx.Done()
-	p.closeResources()
+	select {
+	case <-p.ctx.Done():
+		p.closeResources()
+	case <-p.done:
+	}
 }
 
 // closeResources 关闭数据库并标记处理器为已关闭
@@ -103,6 +119,12 @@ func (p *GeoIP2Processor) closeResources() {
 		p.asnDB = nil
 	}
 
+	if p.asnNet != nil {
+		p.asnNet.Close()
+		p.asnNet = nil
+	}
+
+	close(p.done)
 	p.closed = true
 	p.logger.Debug().Msg("IP处理器资源已释放")
 }
@@ -213,6 +235,31 @@ func (p *GeoIP2Processor) GetIPInfo(ipStr string) *model.IPInfo {
 	return ipInfo
 }
 
+// LookupASN 查询IP所属的ASN编号及其在ASN数据库中的网段，实现 flowcontroller.ASNResolver
+func (p *GeoIP2Processor) LookupASN(addr netip.Addr) (uint, netip.Prefix, bool) {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	if p.closed || p.asnNet == nil {
+		return 0, netip.Prefix{}, false
+	}
+
+	var record struct {
+		AutonomousSystemNumber uint `maxminddb:"autonomous_system_number"`
+	}
+	network, ok, err := p.asnNet.LookupNetwork(net.IP(addr.AsSlice()), &record)
+	if err != nil || !ok {
+		return 0, netip.Prefix{}, false
+	}
+
+	networkAddr, ok := netip.AddrFromSlice(network.IP)
+	if !ok {
+		return 0, netip.Prefix{}, false
+	}
+	bits, _ := network.Mask.Size()
+	return record.AutonomousSystemNumber, netip.PrefixFrom(networkAddr.Unmap(), bits), true
+}
+
 // NewIPProcessor 创建新的IP处理器实例的工厂方法
 func NewIPProcessor(ctx context.Context, cityDBPath, asnDBPath string, logger zerolog.Logger) (IPProcessor, error) {
 	if cityDBPath == "" && asnDBPath == "" {
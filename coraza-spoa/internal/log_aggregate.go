@@ -0,0 +1,230 @@
+package internal
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/HUAHUAI23/simple-waf/pkg/model"
+)
+
+// 日志聚合的默认参数
+const (
+	aggregateDefaultWindow  = 10 // 秒
+	aggregateDefaultMaxKeys = 10000
+	aggregateFlushInterval  = time.Second
+)
+
+// ValidateLogAggregationConfig 校验日志聚合配置，未启用时不校验
+func ValidateLogAggregationConfig(config model.LogAggregationConfig) error {
+	if !config.Enabled {
+		return nil
+	}
+	if config.Window < 0 || config.MaxPerSecond < 0 || config.MaxKeys < 0 {
+		return fmt.Errorf("无效的日志聚合配置: window=%d maxPerSecond=%d maxKeys=%d",
+			config.Window, config.MaxPerSecond, config.MaxKeys)
+	}
+	return nil
+}
+
+// aggregateKey 聚合的维度
+type aggregateKey struct {
+	srcIP   string
+	ruleID  int
+	uri     string
+	engine  string
+	domain  string
+	dstPort int
+	mode    string
+	action  string
+}
+
+// aggregateEntry 聚合中的记录，weight 为代表的事件数
+type aggregateEntry struct {
+	log      model.WAFLog
+	weight   float64
+	first    time.Time
+	last     time.Time
+	deadline time.Time
+}
+
+// logAggregator 合并泛洪时的重复日志
+//
+// 窗口内来源IP、规则ID、URI、引擎、域名、目标端口、决策模式和处置动作相同的日志合并为第一条日志，窗口结束时写出，记录事件数和首次、最后一次事件时间。
+// 每秒新建的记录超过上限后，新建记录按上一秒的新建请求数计算的概率采样，保留的记录按采样率放大事件数，
+// 已有记录的重复事件始终计数。聚合期间的日志最多延迟一个窗口写出
+type logAggregator struct {
+	window       time.Duration
+	maxPerSecond int
+	maxKeys      int
+	emit         func(model.WAFLog)
+
+	mu       sync.Mutex
+	entries  map[aggregateKey]*aggregateEntry
+	closed   bool
+	second   int64 // 当前统计的秒
+	created  int   // 当前秒新建的记录数
+	attempts int   // 当前秒请求新建记录的日志数
+	previous int   // 上一秒请求新建记录的日志数
+
+	collapsed  atomic.Uint64 // 合并到已有记录的日志数
+	sampledOut atomic.Uint64 // 采样丢弃的日志数
+}
+
+func newLogAggregator(config model.LogAggregationConfig, emit func(model.WAFLog)) *logAggregator {
+	window := config.Window
+	if window == 0 {
+		window = aggregateDefaultWindow
+	}
+	maxKeys := config.MaxKeys
+	if maxKeys == 0 {
+		maxKeys = aggregateDefaultMaxKeys
+	}
+	return &logAggregator{
+		window:       time.Duration(window) * time.Second,
+		maxPerSecond: config.MaxPerSecond,
+		maxKeys:      maxKeys,
+		emit:         emit,
+		entries:      make(map[aggregateKey]*aggregateEntry),
+	}
+}
+
+// Add 聚合一条日志，关闭后直接写出
+func (g *logAggregator) Add(log model.WAFLog) {
+	now := log.CreatedAt
+	if now.IsZero() {
+		now = time.Now()
+	}
+	key := aggregateKey{
+		srcIP:   log.SrcIP,
+		ruleID:  log.RuleID,
+		uri:     log.URI,
+		engine:  log.Engine,
+		domain:  log.Domain,
+		dstPort: log.DstPort,
+		mode:    log.Mode,
+		action:  log.Action,
+	}
+
+	g.mu.Lock()
+	if g.closed {
+		g.mu.Unlock()
+		g.emit(log)
+		return
+	}
+
+	var expired *aggregateEntry
+	if entry, ok := g.entries[key]; ok {
+		if now.Before(entry.deadline) {
+			entry.weight++
+			if now.After(entry.last) {
+				entry.last = now
+			}
+			g.mu.Unlock()
+			g.collapsed.Add(1)
+			return
+		}
+		// 窗口已结束但尚未写出，写出后新建记录
+		delete(g.entries, key)
+		expired = entry
+	}
+
+	weight, ok := g.sample(now)
+	if !ok {
+		g.mu.Unlock()
+		g.sampledOut.Add(1)
+		if expired != nil {
+			g.emit(expired.record())
+		}
+		return
+	}
+
+	entry := &aggregateEntry{log: log, weight: weight, first: now, last: now, deadline: now.Add(g.window)}
+	if len(g.entries) >= g.maxKeys {
+		// 聚合的记录数达到上限，不聚合直接写出
+		g.mu.Unlock()
+		if expired != nil {
+			g.emit(expired.record())
+		}
+		g.emit(entry.record())
+		return
+	}
+	g.entries[key] = entry
+	g.mu.Unlock()
+
+	if expired != nil {
+		g.emit(expired.record())
+	}
+}
+
+// sample 判断是否新建记录，返回新建记录代表的事件数
+func (g *logAggregator) sample(now time.Time) (float64, bool) {
+	// 乱序到达的较早的日志计入当前秒
+	if sec := now.Unix(); sec > g.second {
+		if sec == g.second+1 {
+			g.previous = g.attempts
+		} else {
+			g.previous = 0
+		}
+		g.second, g.created, g.attempts = sec, 0, 0
+	}
+	g.attempts++
+
+	if g.maxPerSecond <= 0 || g.created < g.maxPerSecond {
+		g.created++
+		return 1, true
+	}
+	demand := g.previous
+	if g.attempts > demand {
+		demand = g.attempts
+	}
+	rate := float64(g.maxPerSecond) / float64(demand)
+	if rand.Float64() >= rate {
+		return 0, false
+	}
+	g.created++
+	return 1 / rate, true
+}
+
+// Flush 写出窗口已结束的记录
+func (g *logAggregator) Flush(now time.Time) {
+	var records []model.WAFLog
+	g.mu.Lock()
+	for key, entry := range g.entries {
+		if !now.Before(entry.deadline) {
+			records = append(records, entry.record())
+			delete(g.entries, key)
+		}
+	}
+	g.mu.Unlock()
+
+	for _, record := range records {
+		g.emit(record)
+	}
+}
+
+// Close 写出所有聚合中的记录，之后的日志不再聚合
+func (g *logAggregator) Close() {
+	g.mu.Lock()
+	g.closed = true
+	entries := g.entries
+	g.entries = make(map[aggregateKey]*aggregateEntry)
+	g.mu.Unlock()
+
+	for _, entry := range entries {
+		g.emit(entry.record())
+	}
+}
+
+// record 生成写出的日志，事件数四舍五入且至少为 1
+func (e *aggregateEntry) record() model.WAFLog {
+	log := e.log
+	log.Count = int(math.Max(1, math.Round(e.weight)))
+	first, last := e.first, e.last
+	log.FirstSeenAt = &first
+	log.LastSeenAt = &last
+	return log
+}
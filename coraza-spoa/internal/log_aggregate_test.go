@@ -0,0 +1,162 @@
+package internal
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/HUAHUAI23/simple-waf/pkg/model"
+)
+
+// collectAggregated 创建将写出的记录收集到切片的聚合器
+func collectAggregated(config model.LogAggregationConfig) (*logAggregator, *[]model.WAFLog) {
+	var records []model.WAFLog
+	return newLogAggregator(config, func(log model.WAFLog) {
+		records = append(records, log)
+	}), &records
+}
+
+func aggregateTestLog(srcIP string, ruleID int, uri string, at time.Time) model.WAFLog {
+	return model.WAFLog{SrcIP: srcIP, RuleID: ruleID, URI: uri, Engine: model.DecisionEngineCoraza, CreatedAt: at}
+}
+
+// TestLogAggregatorCollapse 测试窗口内相同来源IP、规则ID和URI的日志合并为一条记录
+func TestLogAggregatorCollapse(t *testing.T) {
+	g, records := collectAggregated(model.LogAggregationConfig{Enabled: true, Window: 10})
+	start := time.Unix(1700000000, 0)
+
+	for i := 0; i < 5; i++ {
+		g.Add(aggregateTestLog("10.0.0.1", 942100, "/login", start.Add(time.Duration(i)*time.Second)))
+	}
+	g.Add(aggregateTestLog("10.0.0.1", 942100, "/search", start))
+	g.Add(aggregateTestLog("10.0.0.2", 942100, "/login", start))
+
+	g.Flush(start.Add(9 * time.Second))
+	if len(*records) != 0 {
+		t.Fatalf("窗口结束前不应写出记录: %d", len(*records))
+	}
+
+	g.Flush(start.Add(10 * time.Second))
+	if len(*records) != 3 {
+		t.Fatalf("写出 %d 条记录，期望 3 条", len(*records))
+	}
+	total := 0
+	for _, record := range *records {
+		total += record.Count
+		if record.URI == "/login" && record.SrcIP == "10.0.0.1" {
+			if record.Count != 5 {
+				t.Errorf("合并的记录事件数为 %d，期望 5", record.Count)
+			}
+			if !record.FirstSeenAt.Equal(start) || !record.LastSeenAt.Equal(start.Add(4*time.Second)) {
+				t.Errorf("首次和最后一次事件时间错误: %v %v", record.FirstSeenAt, record.LastSeenAt)
+			}
+		}
+	}
+	if total != 7 {
+		t.Errorf("事件总数为 %d，期望 7", total)
+	}
+	if got := g.collapsed.Load(); got != 4 {
+		t.Errorf("合并的日志数为 %d，期望 4", got)
+	}
+
+	// 窗口结束后相同的日志新建记录
+	g.Add(aggregateTestLog("10.0.0.1", 942100, "/login", start.Add(11*time.Second)))
+	g.Close()
+	if len(*records) != 4 || (*records)[3].Count != 1 {
+		t.Fatalf("关闭时应写出聚合中的记录: %d", len(*records))
+	}
+
+	// 关闭后不再聚合
+	g.Add(aggregateTestLog("10.0.0.1", 942100, "/login", start.Add(12*time.Second)))
+	if len(*records) != 5 || (*records)[4].Count != 0 {
+		t.Error("关闭后的日志应直接写出")
+	}
+}
+
+// TestLogAggregatorKeyDimensions 测试域名、目标端口、决策模式或处置动作不同的日志不合并
+func TestLogAggregatorKeyDimensions(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	base := aggregateTestLog("10.0.0.1", 942100, "/login", start)
+	base.Domain, base.DstPort, base.Mode, base.Action = "a.example.com", 443, model.DecisionModeEnforce, "deny"
+
+	tests := []struct {
+		name   string
+		modify func(*model.WAFLog)
+	}{
+		{"域名不同", func(log *model.WAFLog) { log.Domain = "b.example.com" }},
+		{"目标端口不同", func(log *model.WAFLog) { log.DstPort = 8443 }},
+		{"决策模式不同", func(log *model.WAFLog) { log.Mode = model.DecisionModeObserve }},
+		{"处置动作不同", func(log *model.WAFLog) { log.Action = "drop" }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g, records := collectAggregated(model.LogAggregationConfig{Enabled: true, Window: 10})
+			other := base
+			tt.modify(&other)
+			g.Add(base)
+			g.Add(base)
+			g.Add(other)
+			g.Close()
+
+			if len(*records) != 2 {
+				t.Fatalf("写出 %d 条记录，期望 2 条", len(*records))
+			}
+			// 关闭时写出的顺序不固定
+			merged, single := (*records)[0], (*records)[1]
+			if merged.Count < single.Count {
+				merged, single = single, merged
+			}
+			if merged.Count != 2 || single.Count != 1 {
+				t.Fatalf("事件数为 %d 和 %d，期望相同的日志合并为 2、不同的日志单独为 1", merged.Count, single.Count)
+			}
+			if merged.Domain != base.Domain || merged.DstPort != base.DstPort || merged.Mode != base.Mode || merged.Action != base.Action {
+				t.Errorf("合并的记录不是相同维度的日志: %+v", merged)
+			}
+		})
+	}
+}
+
+// TestLogAggregatorSampling 测试每秒新建记录数超过上限后采样，保留的记录按采样率放大事件数
+func TestLogAggregatorSampling(t *testing.T) {
+	g, records := collectAggregated(model.LogAggregationConfig{Enabled: true, Window: 1, MaxPerSecond: 100})
+	start := time.Unix(1700000000, 0)
+
+	// 连续两秒每秒 10000 个不同 URI 的攻击
+	const perSecond = 10000
+	for sec := 0; sec < 2; sec++ {
+		at := start.Add(time.Duration(sec) * time.Second)
+		for i := 0; i < perSecond; i++ {
+			g.Add(aggregateTestLog("10.0.0.1", 942100, "/item/"+strconv.Itoa(i), at))
+		}
+		g.Flush(at.Add(time.Second))
+	}
+
+	if len(*records) >= 2*perSecond/10 {
+		t.Fatalf("超过上限后应采样: 写出 %d 条记录", len(*records))
+	}
+	total := 0
+	for _, record := range *records {
+		total += record.Count
+	}
+	// 第二秒按上一秒的请求数采样，事件总数为估计值
+	if total < perSecond || total > 3*perSecond {
+		t.Errorf("采样后的事件总数 %d 与实际的 %d 相差过大", total, 2*perSecond)
+	}
+	if g.sampledOut.Load()+uint64(len(*records)) != 2*perSecond {
+		t.Errorf("采样丢弃 %d 条，写出 %d 条，合计应为 %d", g.sampledOut.Load(), len(*records), 2*perSecond)
+	}
+}
+
+// TestLogAggregatorMaxKeys 测试聚合的记录数达到上限后新的日志直接写出
+func TestLogAggregatorMaxKeys(t *testing.T) {
+	g, records := collectAggregated(model.LogAggregationConfig{Enabled: true, MaxKeys: 2})
+	start := time.Unix(1700000000, 0)
+
+	g.Add(aggregateTestLog("10.0.0.1", 1, "/a", start))
+	g.Add(aggregateTestLog("10.0.0.1", 1, "/b", start))
+	g.Add(aggregateTestLog("10.0.0.1", 1, "/c", start))
+	if len(*records) != 1 || (*records)[0].URI != "/c" || (*records)[0].Count != 1 {
+		t.Fatalf("超过上限的日志应直接写出: %v", *records)
+	}
+}
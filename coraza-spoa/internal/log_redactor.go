@@ -0,0 +1,227 @@
+package internal
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"regexp"
+	"strings"
+
+	"github.com/HUAHUAI23/simple-waf/pkg/model"
+)
+
+// redactionMask mask 方式替换敏感值使用的掩码
+const redactionMask = "******"
+
+// LogRedactor 在攻击日志写入存储前对敏感信息脱敏
+// 未启用脱敏时为 nil，nil 值的方法不做任何处理
+type LogRedactor struct {
+	hashMode bool
+	hashKey  []byte
+	headers  map[string]struct{}
+	// valueRes 按名称匹配敏感值，第二个分组为需要替换的值
+	valueRes []*regexp.Regexp
+	patterns []*regexp.Regexp
+}
+
+// NewLogRedactor 根据脱敏配置创建脱敏器，未启用时返回 nil
+func NewLogRedactor(config model.LogRedactionConfig) (*LogRedactor, error) {
+	if !config.Enabled {
+		return nil, nil
+	}
+
+	r := &LogRedactor{
+		headers: make(map[string]struct{}, len(config.Headers)),
+	}
+	switch config.Mode {
+	case "", model.RedactionModeMask:
+	case model.RedactionModeHash:
+		r.hashMode = true
+		r.hashKey = []byte(config.HashKey)
+	default:
+		return nil, fmt.Errorf("无效的脱敏方式: %s", config.Mode)
+	}
+
+	headerNames := make([]string, 0, len(config.Headers))
+	for _, header := range config.Headers {
+		header = strings.ToLower(strings.TrimSpace(header))
+		if header == "" {
+			continue
+		}
+		r.headers[header] = struct{}{}
+		headerNames = append(headerNames, regexp.QuoteMeta(header))
+	}
+
+	fieldNames := make([]string, 0, len(config.Fields))
+	for _, field := range config.Fields {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		fieldNames = append(fieldNames, regexp.QuoteMeta(field))
+	}
+
+	if len(fieldNames) > 0 {
+		fields := strings.Join(fieldNames, "|")
+		r.valueRes = append(r.valueRes,
+			// JSON 字段："password": "value"
+			regexp.MustCompile(`(?i)("(?:`+fields+`)"\s*:\s*")((?:[^"\\]|\\.)*)`),
+			// 表单和查询参数：password=value
+			regexp.MustCompile(`(?i)((?:^|[?&;\s])(?:`+fields+`)=)([^&;\s"]*)`),
+		)
+	}
+
+	// Coraza 匹配数据中的变量：ARGS:password: value、REQUEST_HEADERS:authorization: value
+	if names := append(fieldNames, headerNames...); len(names) > 0 {
+		r.valueRes = append(r.valueRes,
+			regexp.MustCompile(`(?i)([A-Z_]+:(?:`+strings.Join(names, "|")+`): )([^"\]\n]*)`),
+		)
+	}
+
+	for _, pattern := range config.Patterns {
+		re, err := regexp.Compile(pattern.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("脱敏规则 %s 的正则表达式无效: %w", pattern.Name, err)
+		}
+		r.patterns = append(r.patterns, re)
+	}
+
+	return r, nil
+}
+
+// Redact 对日志中的请求、载荷和规则匹配信息脱敏
+func (r *LogRedactor) Redact(log *model.WAFLog) {
+	if r == nil || log == nil {
+		return
+	}
+
+	log.Request = r.redactText(r.redactHeaders(log.Request))
+	log.Response = r.redactText(log.Response)
+	log.Payload = r.redactText(log.Payload)
+	log.Message = r.redactText(log.Message)
+	log.URI = r.redactText(log.URI)
+	for i := range log.Logs {
+		log.Logs[i].Message = r.redactText(log.Logs[i].Message)
+		log.Logs[i].Payload = r.redactText(log.Logs[i].Payload)
+		log.Logs[i].LogRaw = r.redactText(log.Logs[i].LogRaw)
+	}
+}
+
+// RedactAuditLog 对审计日志中的请求头、响应头、请求体、响应体和规则匹配数据脱敏
+func (r *LogRedactor) RedactAuditLog(log *model.AuditLog) {
+	if r == nil || log == nil {
+		return
+	}
+
+	if req := log.Request; req != nil {
+		req.URI = r.redactText(req.URI)
+		req.Body = r.redactText(req.Body)
+		r.redactHeaderMap(req.Headers)
+	}
+	if res := log.Response; res != nil {
+		res.Body = r.redactText(res.Body)
+		r.redactHeaderMap(res.Headers)
+	}
+	for i := range log.Messages {
+		log.Messages[i].Message = r.redactText(log.Messages[i].Message)
+		log.Messages[i].Data = r.redactText(log.Messages[i].Data)
+	}
+}
+
+// redactHeaderMap 替换请求头或响应头中敏感请求头的值
+func (r *LogRedactor) redactHeaderMap(headers map[string][]string) {
+	for name, values := range headers {
+		if _, ok := r.headers[strings.ToLower(name)]; !ok {
+			continue
+		}
+		redacted := make([]string, len(values))
+		for i, value := range values {
+			redacted[i] = r.replace(value)
+		}
+		headers[name] = redacted
+	}
+}
+
+// redactHeaders 替换请求字符串中敏感请求头的值
+// 请求字符串首行为请求行，随后是请求头，遇到空行后为请求体
+func (r *LogRedactor) redactHeaders(request string) string {
+	if len(r.headers) == 0 || request == "" {
+		return request
+	}
+
+	lines := strings.Split(request, "\n")
+	for i := 1; i < len(lines); i++ {
+		line := strings.TrimSuffix(lines[i], "\r")
+		if line == "" {
+			break
+		}
+		colon := strings.IndexByte(line, ':')
+		if colon <= 0 {
+			continue
+		}
+		if _, ok := r.headers[strings.ToLower(strings.TrimSpace(line[:colon]))]; !ok {
+			continue
+		}
+		value := strings.TrimSpace(line[colon+1:])
+		if value == "" {
+			continue
+		}
+		lines[i] = line[:colon+1] + " " + r.replace(value) + lines[i][len(line):]
+	}
+	return strings.Join(lines, "\n")
+}
+
+// redactText 按字段名称和正则表达式替换文本中的敏感值
+func (r *LogRedactor) redactText(text string) string {
+	if text == "" {
+		return text
+	}
+	for _, re := range r.valueRes {
+		text = replaceSubmatch(re, text, r.replace)
+	}
+	for _, re := range r.patterns {
+		text = re.ReplaceAllStringFunc(text, r.replace)
+	}
+	return text
+}
+
+// replace 返回敏感值的替换结果，hash 方式保留 SHA-256（或 HMAC-SHA256）摘要的前 16 位十六进制
+func (r *LogRedactor) replace(value string) string {
+	if !r.hashMode {
+		return redactionMask
+	}
+
+	var h hash.Hash
+	if len(r.hashKey) > 0 {
+		h = hmac.New(sha256.New, r.hashKey)
+	} else {
+		h = sha256.New()
+	}
+	h.Write([]byte(value))
+	return "hash:" + hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+// replaceSubmatch 替换正则表达式每个匹配中第二个分组的内容，空值保持不变
+func replaceSubmatch(re *regexp.Regexp, text string, fn func(string) string) string {
+	matches := re.FindAllStringSubmatchIndex(text, -1)
+	if matches == nil {
+		return text
+	}
+
+	var sb strings.Builder
+	sb.Grow(len(text))
+	last := 0
+	for _, m := range matches {
+		start, end := m[4], m[5]
+		if start < 0 || start == end {
+			continue
+		}
+		sb.WriteString(text[last:start])
+		sb.WriteString(fn(text[start:end]))
+		last = end
+	}
+	sb.WriteString(text[last:])
+	return sb.String()
+}
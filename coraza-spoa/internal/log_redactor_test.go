@@ -0,0 +1,130 @@
+package internal
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/HUAHUAI23/simple-waf/pkg/model"
+)
+
+// TestLogRedactorRedact 测试请求头、字段名称和正则表达式脱敏
+func TestLogRedactorRedact(t *testing.T) {
+	redactor, err := NewLogRedactor(model.LogRedactionConfig{
+		Enabled: true,
+		Headers: []string{"Authorization", "Cookie"},
+		Fields:  []string{"password", "token"},
+		Patterns: []model.RedactionPattern{
+			{Name: "card_number", Pattern: `\b[3-6]\d{3}(?:[ -]?\d{4}){3}\b`},
+		},
+	})
+	if err != nil {
+		t.Fatalf("创建脱敏器失败: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		input   string
+		want    []string
+		notWant []string
+	}{
+		{
+			name:    "请求头",
+			input:   "GET /?a=1 HTTP/1.1\nHost: example.com\r\nAuthorization: Bearer secret\r\ncookie: sid=abc\r\n",
+			want:    []string{"Host: example.com", "Authorization: ******\r\n", "cookie: ******\r\n"},
+			notWant: []string{"Bearer secret", "sid=abc"},
+		},
+		{
+			name:    "请求体中的同名内容不按请求头处理",
+			input:   "POST / HTTP/1.1\nHost: example.com\r\n\r\n\nAuthorization: keep",
+			want:    []string{"Authorization: keep"},
+			notWant: []string{redactionMask},
+		},
+		{
+			name:    "查询参数和表单字段",
+			input:   "GET /login?user=bob&password=p%40ss&Token=t1 HTTP/1.1",
+			want:    []string{"user=bob", "password=******", "Token=******"},
+			notWant: []string{"p%40ss", "t1 "},
+		},
+		{
+			name:    "JSON字段",
+			input:   `{"user":"bob","password" : "p\"ss","token":""}`,
+			want:    []string{`"user":"bob"`, `"password" : "******"`, `"token":""`},
+			notWant: []string{`p\"ss`},
+		},
+		{
+			name:    "Coraza匹配数据",
+			input:   `Matched Data: ' or 1=1 found within ARGS:password: ' or 1=1--`,
+			want:    []string{"ARGS:password: ******"},
+			notWant: []string{"1=1--"},
+		},
+		{
+			name:    "正则表达式",
+			input:   "card=4111 1111 1111 1111&ts=1700000000000",
+			want:    []string{"card=******", "ts=1700000000000"},
+			notWant: []string{"4111"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			log := model.WAFLog{Request: tt.input}
+			redactor.Redact(&log)
+			for _, want := range tt.want {
+				if !strings.Contains(log.Request, want) {
+					t.Errorf("结果 %q 缺少 %q", log.Request, want)
+				}
+			}
+			for _, notWant := range tt.notWant {
+				if strings.Contains(log.Request, notWant) {
+					t.Errorf("结果 %q 不应包含 %q", log.Request, notWant)
+				}
+			}
+		})
+	}
+}
+
+// TestLogRedactorHashMode 测试 hash 方式对相同的值得到相同的结果
+func TestLogRedactorHashMode(t *testing.T) {
+	redactor, err := NewLogRedactor(model.LogRedactionConfig{
+		Enabled: true,
+		Mode:    model.RedactionModeHash,
+		HashKey: "key",
+		Fields:  []string{"token"},
+	})
+	if err != nil {
+		t.Fatalf("创建脱敏器失败: %v", err)
+	}
+
+	log := model.WAFLog{Payload: "token=abc", Logs: []model.Log{{Payload: "token=abc"}}}
+	redactor.Redact(&log)
+	if !strings.HasPrefix(log.Payload, "token=hash:") || strings.Contains(log.Payload, "abc") {
+		t.Fatalf("hash 结果不正确: %q", log.Payload)
+	}
+	if log.Logs[0].Payload != log.Payload {
+		t.Errorf("相同的值应得到相同的结果: %q != %q", log.Logs[0].Payload, log.Payload)
+	}
+}
+
+// TestNewLogRedactorInvalidConfig 测试无效配置和未启用时的处理
+func TestNewLogRedactorInvalidConfig(t *testing.T) {
+	if r, err := NewLogRedactor(model.LogRedactionConfig{Patterns: []model.RedactionPattern{{Pattern: "("}}}); r != nil || err != nil {
+		t.Errorf("未启用时应返回 nil: %v, %v", r, err)
+	}
+	if _, err := NewLogRedactor(model.GetDefaultLogRedactionConfig()); err != nil {
+		t.Errorf("默认配置应有效: %v", err)
+	}
+	if _, err := NewLogRedactor(model.LogRedactionConfig{Enabled: true, Mode: "drop"}); err == nil {
+		t.Error("无效的脱敏方式应返回错误")
+	}
+	if _, err := NewLogRedactor(model.LogRedactionConfig{Enabled: true, Patterns: []model.RedactionPattern{{Name: "bad", Pattern: "("}}}); err == nil {
+		t.Error("无效的正则表达式应返回错误")
+	}
+
+	// nil 脱敏器不修改日志
+	var redactor *LogRedactor
+	log := model.WAFLog{Request: "Authorization: secret"}
+	redactor.Redact(&log)
+	if log.Request != "Authorization: secret" {
+		t.Errorf("nil 脱敏器不应修改日志: %q", log.Request)
+	}
+}
@@ -0,0 +1,174 @@
+package internal
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"sync"
+
+	"github.com/HUAHUAI23/simple-waf/pkg/model"
+	"github.com/rs/zerolog"
+)
+
+// 每个日志输出的队列长度（批次数），队列满时丢弃新的批次
+const logSinkQueueSize = 64
+
+// LogSink 日志输出，从日志存储的环形缓冲区按批次接收 WAF 日志
+// Write 只由输出的写入协程调用，无需并发安全
+type LogSink interface {
+	Write(logs []model.WAFLog) error
+	Close() error
+}
+
+// ValidateLogSinkConfig 校验日志输出配置，未启用的输出不校验
+func ValidateLogSinkConfig(config model.LogSinkConfig) error {
+	if !config.Enabled {
+		return nil
+	}
+	switch config.Type {
+	case model.LogSinkSyslog:
+		switch config.Syslog.Network {
+		case "udp", "tcp", "tls":
+		default:
+			return fmt.Errorf("日志输出 %s 的 syslog 传输协议无效: %q", config.Name, config.Syslog.Network)
+		}
+		if _, _, err := net.SplitHostPort(config.Syslog.Address); err != nil {
+			return fmt.Errorf("日志输出 %s 的 syslog 地址无效: %v", config.Name, err)
+		}
+		switch config.Syslog.Format {
+		case "", model.SyslogFormatJSON, model.SyslogFormatCEF, model.SyslogFormatLEEF:
+		default:
+			return fmt.Errorf("日志输出 %s 的 syslog 消息格式无效: %q", config.Name, config.Syslog.Format)
+		}
+		if config.Syslog.Facility < 0 || config.Syslog.Facility > 23 {
+			return fmt.Errorf("日志输出 %s 的 syslog facility 无效: %d", config.Name, config.Syslog.Facility)
+		}
+	case model.LogSinkFile:
+		if config.File.Path == "" {
+			return fmt.Errorf("日志输出 %s 缺少文件路径", config.Name)
+		}
+		if config.File.MaxSize < 0 || config.File.MaxBackups < 0 {
+			return fmt.Errorf("日志输出 %s 的文件轮转配置无效", config.Name)
+		}
+	case model.LogSinkWebhook:
+		u, err := url.Parse(config.Webhook.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("日志输出 %s 的 webhook 地址无效: %q", config.Name, config.Webhook.URL)
+		}
+		if config.Webhook.BatchSize < 0 || config.Webhook.Timeout < 0 || config.Webhook.MaxRetries < 0 {
+			return fmt.Errorf("日志输出 %s 的 webhook 批量或重试配置无效", config.Name)
+		}
+	default:
+		return fmt.Errorf("日志输出 %s 的类型无效: %q", config.Name, config.Type)
+	}
+	return nil
+}
+
+// NewLogSink 按配置创建日志输出，连接和文件在首次写入时建立
+func NewLogSink(config model.LogSinkConfig) (LogSink, error) {
+	if err := ValidateLogSinkConfig(config); err != nil {
+		return nil, err
+	}
+	switch config.Type {
+	case model.LogSinkSyslog:
+		return newSyslogSink(config.Syslog)
+	case model.LogSinkFile:
+		return newFileSink(config.File), nil
+	default:
+		return newWebhookSink(config.Webhook), nil
+	}
+}
+
+// LogSinkGroup 一个应用的日志输出集合
+// 每个输出使用独立的队列和写入协程，慢速或不可用的输出不会阻塞日志存储和其他输出
+type LogSinkGroup struct {
+	app    string
+	sinks  []*queuedSink
+	mu     sync.RWMutex
+	closed bool
+}
+
+// queuedSink 带队列的日志输出
+type queuedSink struct {
+	name   string
+	sink   LogSink
+	queue  chan []model.WAFLog
+	done   chan struct{}
+	logger zerolog.Logger
+}
+
+// NewLogSinkGroup 按配置创建应用的日志输出集合并启动写入协程，跳过未启用和配置无效的输出
+// 没有可用的输出时返回 nil
+func NewLogSinkGroup(app string, configs []model.LogSinkConfig, logger zerolog.Logger) *LogSinkGroup {
+	group := &LogSinkGroup{app: app}
+	for _, config := range configs {
+		if !config.Enabled {
+			continue
+		}
+		sink, err := NewLogSink(config)
+		if err != nil {
+			logger.Error().Err(err).Str("sink", config.Name).Msg("创建日志输出失败")
+			continue
+		}
+		qs := &queuedSink{
+			name:   config.Name,
+			sink:   sink,
+			queue:  make(chan []model.WAFLog, logSinkQueueSize),
+			done:   make(chan struct{}),
+			logger: logger,
+		}
+		go qs.run()
+		group.sinks = append(group.sinks, qs)
+	}
+	if len(group.sinks) == 0 {
+		return nil
+	}
+	return group
+}
+
+// Dispatch 将一批日志放入每个输出的队列，队列已满或集合已关闭时丢弃
+func (g *LogSinkGroup) Dispatch(logs []model.WAFLog) {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	if g.closed {
+		return
+	}
+	for _, qs := range g.sinks {
+		select {
+		case qs.queue <- logs:
+		default:
+			qs.logger.Warn().Str("sink", qs.name).Int("count", len(logs)).Msg("日志输出队列已满，丢弃日志")
+		}
+	}
+}
+
+// Close 写入队列中剩余的日志后关闭所有输出，可重复调用
+func (g *LogSinkGroup) Close() {
+	g.mu.Lock()
+	if g.closed {
+		g.mu.Unlock()
+		return
+	}
+	g.closed = true
+	for _, qs := range g.sinks {
+		close(qs.queue)
+	}
+	g.mu.Unlock()
+
+	for _, qs := range g.sinks {
+		<-qs.done
+		if err := qs.sink.Close(); err != nil {
+			qs.logger.Error().Err(err).Str("sink", qs.name).Msg("关闭日志输出失败")
+		}
+	}
+}
+
+// run 写入协程，依次写入队列中的批次，写入失败的批次记录错误后丢弃
+func (qs *queuedSink) run() {
+	defer close(qs.done)
+	for logs := range qs.queue {
+		if err := qs.sink.Write(logs); err != nil {
+			qs.logger.Error().Err(err).Str("sink", qs.name).Int("count", len(logs)).Msg("写入日志输出失败")
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package internal
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/HUAHUAI23/simple-waf/pkg/model"
+)
+
+// 文件输出的默认轮转参数
+const (
+	fileSinkDefaultMaxSize    = 100 // MB
+	fileSinkDefaultMaxBackups = 5
+)
+
+// fileSink 每行写入一条 JSON 格式的 WAF 日志，文件超过最大大小时轮转
+// 轮转时 <path>.N 依次后移为 <path>.N+1，当前文件重命名为 <path>.1，超过保留数量的备份被删除
+type fileSink struct {
+	path       string
+	maxSize    int64
+	maxBackups int
+	file       *os.File
+	size       int64
+}
+
+func newFileSink(config model.FileSinkConfig) *fileSink {
+	maxSize := config.MaxSize
+	if maxSize == 0 {
+		maxSize = fileSinkDefaultMaxSize
+	}
+	maxBackups := config.MaxBackups
+	if maxBackups == 0 {
+		maxBackups = fileSinkDefaultMaxBackups
+	}
+	return &fileSink{
+		path:       config.Path,
+		maxSize:    int64(maxSize) * 1024 * 1024,
+		maxBackups: maxBackups,
+	}
+}
+
+// Write 按行写入一批日志，写入前文件已超过最大大小时先轮转
+func (s *fileSink) Write(logs []model.WAFLog) error {
+	if s.file == nil {
+		if err := s.open(); err != nil {
+			return err
+		}
+	}
+
+	w := bufio.NewWriter(s.file)
+	for _, log := range logs {
+		if s.size >= s.maxSize {
+			if err := w.Flush(); err != nil {
+				return fmt.Errorf("写入日志文件失败: %w", err)
+			}
+			if err := s.rotate(); err != nil {
+				return err
+			}
+			w.Reset(s.file)
+		}
+
+		data, err := json.Marshal(log)
+		if err != nil {
+			return fmt.Errorf("序列化日志失败: %w", err)
+		}
+		data = append(data, '\n')
+		if _, err := w.Write(data); err != nil {
+			return fmt.Errorf("写入日志文件失败: %w", err)
+		}
+		s.size += int64(len(data))
+	}
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("写入日志文件失败: %w", err)
+	}
+	return nil
+}
+
+// Close 关闭文件
+func (s *fileSink) Close() error {
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
+
+// open 以追加方式打开文件，不存在时创建文件和目录
+func (s *fileSink) open() error {
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return fmt.Errorf("创建日志目录失败: %w", err)
+	}
+	file, err := os.OpenFile(s.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("打开日志文件失败: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return fmt.Errorf("读取日志文件信息失败: %w", err)
+	}
+	s.file = file
+	s.size = info.Size()
+	return nil
+}
+
+// rotate 关闭当前文件，后移已有的备份并重新打开文件
+func (s *fileSink) rotate() error {
+	if err := s.Close(); err != nil {
+		return fmt.Errorf("关闭日志文件失败: %w", err)
+	}
+
+	_ = os.Remove(s.backupPath(s.maxBackups))
+	for i := s.maxBackups - 1; i >= 1; i-- {
+		if err := os.Rename(s.backupPath(i), s.backupPath(i+1)); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("轮转日志文件失败: %w", err)
+		}
+	}
+	if err := os.Rename(s.path, s.backupPath(1)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("轮转日志文件失败: %w", err)
+	}
+	return s.open()
+}
+
+func (s *fileSink) backupPath(n int) string {
+	return fmt.Sprintf("%s.%d", s.path, n)
+}
@@ -0,0 +1,282 @@
+package internal
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/HUAHUAI23/simple-waf/pkg/model"
+)
+
+const (
+	syslogDefaultFacility = 16 // local0
+	syslogAppName         = "simple-waf"
+	syslogMsgID           = "waf"
+	syslogTimeout         = 5 * time.Second
+	// syslogUDPMaxSize UDP 消息的最大字节数，超出的部分截断，避免超过数据报大小限制
+	syslogUDPMaxSize = 8192
+	// syslogTimestampFormat RFC 5424 的时间戳最多 6 位小数
+	syslogTimestampFormat = "2006-01-02T15:04:05.000000Z07:00"
+)
+
+// CEF 和 LEEF 头部中的厂商、产品和版本
+const (
+	siemVendor  = "RuiQi"
+	siemProduct = "WAF"
+	siemVersion = "1.0"
+)
+
+// siemSeverities syslog 严重级别(0-7)对应的 CEF/LEEF 严重级别(1-10)
+var siemSeverities = []int{10, 9, 8, 7, 5, 3, 2, 1}
+
+// syslogSink 按 RFC 5424 发送 syslog 消息，UDP 每个数据报一条消息，TCP 和 TLS 使用八位组计数分帧（RFC 6587）
+type syslogSink struct {
+	network   string
+	address   string
+	format    string
+	facility  int
+	tlsConfig *tls.Config
+	hostname  string
+	pid       int
+	conn      net.Conn
+}
+
+func newSyslogSink(config model.SyslogSinkConfig) (*syslogSink, error) {
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "-"
+	}
+	s := &syslogSink{
+		network:  config.Network,
+		address:  config.Address,
+		format:   config.Format,
+		facility: config.Facility,
+		hostname: hostname,
+		pid:      os.Getpid(),
+	}
+	if s.format == "" {
+		s.format = model.SyslogFormatJSON
+	}
+	if s.facility == 0 {
+		s.facility = syslogDefaultFacility
+	}
+	if s.network == "tls" {
+		host, _, err := net.SplitHostPort(config.Address)
+		if err != nil {
+			return nil, err
+		}
+		s.tlsConfig = &tls.Config{
+			ServerName:         host,
+			InsecureSkipVerify: config.InsecureSkipVerify,
+			MinVersion:         tls.VersionTLS12,
+		}
+	}
+	return s, nil
+}
+
+// Write 逐条发送日志
+func (s *syslogSink) Write(logs []model.WAFLog) error {
+	for _, log := range logs {
+		msg, err := s.message(log)
+		if err != nil {
+			return err
+		}
+		if err := s.send(msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close 关闭连接
+func (s *syslogSink) Close() error {
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
+
+// send 发送一条消息，连接断开时重新连接并重试一次
+func (s *syslogSink) send(msg []byte) error {
+	frame := msg
+	if s.network == "udp" {
+		if len(frame) > syslogUDPMaxSize {
+			frame = frame[:syslogUDPMaxSize]
+		}
+	} else {
+		frame = append([]byte(strconv.Itoa(len(msg))+" "), msg...)
+	}
+
+	var lastErr error
+	for attempt := 0; attempt < 2; attempt++ {
+		if s.conn == nil {
+			conn, err := s.dial()
+			if err != nil {
+				return fmt.Errorf("连接 syslog 服务器失败: %w", err)
+			}
+			s.conn = conn
+		}
+		_ = s.conn.SetWriteDeadline(time.Now().Add(syslogTimeout))
+		if _, err := s.conn.Write(frame); err != nil {
+			lastErr = err
+			_ = s.Close()
+			continue
+		}
+		return nil
+	}
+	return fmt.Errorf("发送 syslog 消息失败: %w", lastErr)
+}
+
+func (s *syslogSink) dial() (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: syslogTimeout}
+	if s.network == "tls" {
+		return tls.DialWithDialer(dialer, "tcp", s.address, s.tlsConfig)
+	}
+	return dialer.Dial(s.network, s.address)
+}
+
+// message 构建 RFC 5424 消息，不包含结构化数据，消息内容按配置的格式输出
+func (s *syslogSink) message(log model.WAFLog) ([]byte, error) {
+	var body string
+	switch s.format {
+	case model.SyslogFormatCEF:
+		body = formatCEF(log)
+	case model.SyslogFormatLEEF:
+		body = formatLEEF(log)
+	default:
+		data, err := json.Marshal(log)
+		if err != nil {
+			return nil, fmt.Errorf("序列化日志失败: %w", err)
+		}
+		body = string(data)
+	}
+
+	pri := s.facility*8 + syslogSeverity(log)
+	header := fmt.Sprintf("<%d>1 %s %s %s %d %s - ",
+		pri, logTime(log).UTC().Format(syslogTimestampFormat), s.hostname, syslogAppName, s.pid, syslogMsgID)
+	return []byte(header + body), nil
+}
+
+// syslogSeverity 日志的 syslog 严重级别
+// 规则的严重级别与 syslog 一致，流控、封禁IP等未设置严重级别的记录按 warning 处理
+func syslogSeverity(log model.WAFLog) int {
+	if log.Severity <= 0 || log.Severity > 7 {
+		return 4
+	}
+	return log.Severity
+}
+
+// logTime 日志的事件时间，未设置时使用当前时间
+func logTime(log model.WAFLog) time.Time {
+	if log.CreatedAt.IsZero() {
+		return time.Now()
+	}
+	return log.CreatedAt
+}
+
+// signatureID 事件标识，规则拦截使用规则ID，其余使用决策引擎
+func signatureID(log model.WAFLog) string {
+	if log.RuleID > 0 {
+		return strconv.Itoa(log.RuleID)
+	}
+	if log.Engine != "" {
+		return log.Engine
+	}
+	return model.DecisionEngineCoraza
+}
+
+// formatCEF 按 ArcSight CEF 格式化日志
+func formatCEF(log model.WAFLog) string {
+	header := strings.NewReplacer(`\`, `\\`, `|`, `\|`, "\r", " ", "\n", " ")
+	value := strings.NewReplacer(`\`, `\\`, `=`, `\=`, "\r\n", `\n`, "\n", `\n`, "\r", `\r`)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "CEF:0|%s|%s|%s|%s|%s|%d|",
+		siemVendor, siemProduct, siemVersion,
+		header.Replace(signatureID(log)), header.Replace(log.Message), siemSeverities[syslogSeverity(log)])
+
+	first := true
+	add := func(key, v string) {
+		if v == "" {
+			return
+		}
+		if !first {
+			b.WriteByte(' ')
+		}
+		first = false
+		b.WriteString(key)
+		b.WriteByte('=')
+		b.WriteString(value.Replace(v))
+	}
+	add("rt", strconv.FormatInt(logTime(log).UnixMilli(), 10))
+	add("src", log.SrcIP)
+	add("spt", portString(log.SrcPort))
+	add("dst", log.DstIP)
+	add("dpt", portString(log.DstPort))
+	add("dhost", log.Domain)
+	add("request", log.URI)
+	add("act", log.Action)
+	add("externalId", log.RequestID)
+	add("cs1Label", "engine")
+	add("cs1", log.Engine)
+	add("cs2Label", "mode")
+	add("cs2", log.Mode)
+	add("cs3Label", "app")
+	add("cs3", log.AppName)
+	add("cs4Label", "payload")
+	add("cs4", log.Payload)
+	return b.String()
+}
+
+// formatLEEF 按 QRadar LEEF 1.0 格式化日志，属性以制表符分隔，devTime 为毫秒时间戳
+func formatLEEF(log model.WAFLog) string {
+	header := strings.NewReplacer(`\`, `\\`, `|`, `\|`, "\r", " ", "\n", " ")
+	value := strings.NewReplacer("\t", " ", "\r", " ", "\n", " ")
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "LEEF:1.0|%s|%s|%s|%s|", siemVendor, siemProduct, siemVersion, header.Replace(signatureID(log)))
+
+	first := true
+	add := func(key, v string) {
+		if v == "" {
+			return
+		}
+		if !first {
+			b.WriteByte('\t')
+		}
+		first = false
+		b.WriteString(key)
+		b.WriteByte('=')
+		b.WriteString(value.Replace(v))
+	}
+	add("devTime", strconv.FormatInt(logTime(log).UnixMilli(), 10))
+	add("cat", log.Engine)
+	add("sev", strconv.Itoa(siemSeverities[syslogSeverity(log)]))
+	add("src", log.SrcIP)
+	add("srcPort", portString(log.SrcPort))
+	add("dst", log.DstIP)
+	add("dstPort", portString(log.DstPort))
+	add("domain", log.Domain)
+	add("url", log.URI)
+	add("action", log.Action)
+	add("mode", log.Mode)
+	add("requestId", log.RequestID)
+	add("app", log.AppName)
+	add("msg", log.Message)
+	add("payload", log.Payload)
+	return b.String()
+}
+
+func portString(port int) string {
+	if port <= 0 {
+		return ""
+	}
+	return strconv.Itoa(port)
+}
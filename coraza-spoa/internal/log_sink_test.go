@@ -0,0 +1,336 @@
+package internal
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/HUAHUAI23/simple-waf/pkg/model"
+	"github.com/rs/zerolog"
+)
+
+func sampleSinkLog() model.WAFLog {
+	return model.WAFLog{
+		AppName:   "app1",
+		RuleID:    942100,
+		Severity:  2,
+		SrcIP:     "1.2.3.4",
+		SrcPort:   5678,
+		Domain:    "example.com",
+		URI:       "/?id=1=1",
+		Action:    "deny",
+		RequestID: "req-1",
+		Engine:    model.DecisionEngineCoraza,
+		Message:   "SQL Injection | libinjection",
+		CreatedAt: time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC),
+	}
+}
+
+// readOctetFrame 读取一条八位组计数分帧的 syslog 消息
+func readOctetFrame(t *testing.T, r *bufio.Reader) string {
+	t.Helper()
+	lenStr, err := r.ReadString(' ')
+	if err != nil {
+		t.Fatalf("读取帧长度失败: %v", err)
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(lenStr))
+	if err != nil {
+		t.Fatalf("帧长度无效: %q", lenStr)
+	}
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		t.Fatalf("读取帧内容失败: %v", err)
+	}
+	return string(buf)
+}
+
+// TestSyslogSinkUDP 测试通过 UDP 发送 CEF 格式的 syslog 消息
+func TestSyslogSinkUDP(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("监听 UDP 失败: %v", err)
+	}
+	defer conn.Close()
+
+	sink, err := newSyslogSink(model.SyslogSinkConfig{Network: "udp", Address: conn.LocalAddr().String(), Format: model.SyslogFormatCEF})
+	if err != nil {
+		t.Fatalf("创建 syslog 输出失败: %v", err)
+	}
+	defer sink.Close()
+	if err := sink.Write([]model.WAFLog{sampleSinkLog()}); err != nil {
+		t.Fatalf("写入失败: %v", err)
+	}
+
+	buf := make([]byte, 65536)
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("读取消息失败: %v", err)
+	}
+	msg := string(buf[:n])
+	// facility 16，严重级别 2：16*8+2
+	if !strings.HasPrefix(msg, "<130>1 2025-01-02T03:04:05.000000Z ") {
+		t.Errorf("RFC 5424 头部不正确: %q", msg)
+	}
+	for _, want := range []string{
+		`CEF:0|RuiQi|WAF|1.0|942100|SQL Injection \| libinjection|8|`,
+		`request=/?id\=1\=1`,
+		"src=1.2.3.4",
+		"cs3=app1",
+	} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("消息缺少 %q: %q", want, msg)
+		}
+	}
+}
+
+// TestSyslogSinkTCP 测试通过 TCP 发送八位组计数分帧的 LEEF 消息
+func TestSyslogSinkTCP(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("监听 TCP 失败: %v", err)
+	}
+	defer ln.Close()
+
+	frames := make(chan string, 2)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		for i := 0; i < 2; i++ {
+			frames <- readOctetFrame(t, r)
+		}
+	}()
+
+	sink, err := newSyslogSink(model.SyslogSinkConfig{Network: "tcp", Address: ln.Addr().String(), Format: model.SyslogFormatLEEF})
+	if err != nil {
+		t.Fatalf("创建 syslog 输出失败: %v", err)
+	}
+	defer sink.Close()
+	second := sampleSinkLog()
+	second.RuleID = 0
+	second.Severity = 0
+	second.Engine = model.DecisionEngineFlow
+	if err := sink.Write([]model.WAFLog{sampleSinkLog(), second}); err != nil {
+		t.Fatalf("写入失败: %v", err)
+	}
+
+	first := <-frames
+	if !strings.Contains(first, "LEEF:1.0|RuiQi|WAF|1.0|942100|") || !strings.Contains(first, "\tsrc=1.2.3.4\t") {
+		t.Errorf("LEEF 消息不正确: %q", first)
+	}
+	got := <-frames
+	// 未设置严重级别时按 warning 处理
+	if !strings.HasPrefix(got, "<132>1 ") || !strings.Contains(got, "|"+model.DecisionEngineFlow+"|") {
+		t.Errorf("LEEF 消息不正确: %q", got)
+	}
+}
+
+// TestSyslogSinkTLS 测试通过 TLS 发送 JSON 格式的 syslog 消息
+func TestSyslogSinkTLS(t *testing.T) {
+	// 使用 httptest 的自签名证书
+	srv := httptest.NewTLSServer(nil)
+	certificates := srv.TLS.Certificates
+	srv.Close()
+
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: certificates})
+	if err != nil {
+		t.Fatalf("监听 TLS 失败: %v", err)
+	}
+	defer ln.Close()
+
+	frames := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		frames <- readOctetFrame(t, bufio.NewReader(conn))
+	}()
+
+	sink, err := newSyslogSink(model.SyslogSinkConfig{Network: "tls", Address: ln.Addr().String(), InsecureSkipVerify: true})
+	if err != nil {
+		t.Fatalf("创建 syslog 输出失败: %v", err)
+	}
+	defer sink.Close()
+	if err := sink.Write([]model.WAFLog{sampleSinkLog()}); err != nil {
+		t.Fatalf("写入失败: %v", err)
+	}
+
+	msg := <-frames
+	idx := strings.Index(msg, " - {")
+	if idx < 0 {
+		t.Fatalf("消息缺少 JSON 内容: %q", msg)
+	}
+	var log model.WAFLog
+	if err := json.Unmarshal([]byte(msg[idx+3:]), &log); err != nil {
+		t.Fatalf("解析 JSON 失败: %v", err)
+	}
+	if log.RequestID != "req-1" || log.AppName != "app1" {
+		t.Errorf("JSON 内容不正确: %+v", log)
+	}
+}
+
+// TestFileSinkRotation 测试文件输出按大小轮转并保留指定数量的备份
+func TestFileSinkRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "logs", "waf.log")
+	sink := newFileSink(model.FileSinkConfig{Path: path, MaxBackups: 2})
+	// 测试中使用较小的文件大小
+	sink.maxSize = 1
+
+	for i := 0; i < 4; i++ {
+		log := sampleSinkLog()
+		log.RequestID = strconv.Itoa(i)
+		if err := sink.Write([]model.WAFLog{log}); err != nil {
+			t.Fatalf("写入失败: %v", err)
+		}
+	}
+	if err := sink.Close(); err != nil {
+		t.Fatalf("关闭失败: %v", err)
+	}
+
+	// 每条日志一个文件，最新的在当前文件中，超过 2 个的备份被删除
+	for file, want := range map[string]string{path: "3", path + ".1": "2", path + ".2": "1"} {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatalf("读取 %s 失败: %v", file, err)
+		}
+		var log model.WAFLog
+		if err := json.Unmarshal(data, &log); err != nil || !strings.HasSuffix(string(data), "\n") {
+			t.Fatalf("%s 不是一行 JSON: %q", file, data)
+		}
+		if log.RequestID != want {
+			t.Errorf("%s 的日志为 %s，期望 %s", file, log.RequestID, want)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("超过保留数量的备份未删除")
+	}
+}
+
+// TestWebhookSink 测试 webhook 输出按批次发送，5xx 响应后重试
+func TestWebhookSink(t *testing.T) {
+	var mu sync.Mutex
+	var batches [][]model.WAFLog
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		calls++
+		if calls == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if r.Header.Get("Content-Type") != "application/json" || r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		var batch []model.WAFLog
+		if err := json.NewDecoder(r.Body).Decode(&batch); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		batches = append(batches, batch)
+	}))
+	defer srv.Close()
+
+	sink := newWebhookSink(model.WebhookSinkConfig{
+		URL:        srv.URL,
+		Headers:    map[string]string{"Authorization": "Bearer token"},
+		BatchSize:  2,
+		MaxRetries: 1,
+	})
+	defer sink.Close()
+	logs := []model.WAFLog{sampleSinkLog(), sampleSinkLog(), sampleSinkLog()}
+	if err := sink.Write(logs); err != nil {
+		t.Fatalf("写入失败: %v", err)
+	}
+	if calls != 3 || len(batches) != 2 || len(batches[0]) != 2 || len(batches[1]) != 1 {
+		t.Errorf("请求 %d 次，批次 %d 个，期望重试 1 次后发送 2 个批次", calls, len(batches))
+	}
+
+	// 4xx 响应不重试
+	reject := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		calls++
+		mu.Unlock()
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer reject.Close()
+	calls = 0
+	sink = newWebhookSink(model.WebhookSinkConfig{URL: reject.URL, MaxRetries: 3})
+	if err := sink.Write(logs); err == nil || calls != 1 {
+		t.Errorf("4xx 响应应直接失败: err=%v calls=%d", err, calls)
+	}
+}
+
+// TestLogSinkGroupClose 测试关闭输出集合时写入队列中剩余的日志
+func TestLogSinkGroupClose(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "waf.log")
+	group := NewLogSinkGroup("app1", []model.LogSinkConfig{
+		{Name: "disabled", Type: model.LogSinkWebhook},
+		{Name: "file", Type: model.LogSinkFile, Enabled: true, File: model.FileSinkConfig{Path: path}},
+	}, zerolog.Nop())
+	if group == nil || len(group.sinks) != 1 {
+		t.Fatal("应只创建已启用的输出")
+	}
+	group.Dispatch([]model.WAFLog{sampleSinkLog(), sampleSinkLog()})
+	group.Close()
+	group.Dispatch([]model.WAFLog{sampleSinkLog()})
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("读取日志文件失败: %v", err)
+	}
+	if lines := strings.Count(string(data), "\n"); lines != 2 {
+		t.Errorf("写入 %d 行，期望 2 行", lines)
+	}
+
+	if NewLogSinkGroup("app1", nil, zerolog.Nop()) != nil {
+		t.Error("没有输出时应返回 nil")
+	}
+}
+
+// TestValidateLogSinkConfig 测试日志输出配置校验
+func TestValidateLogSinkConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  model.LogSinkConfig
+		wantErr bool
+	}{
+		{"未启用不校验", model.LogSinkConfig{Type: "unknown"}, false},
+		{"未知类型", model.LogSinkConfig{Enabled: true, Type: "unknown"}, true},
+		{"syslog", model.LogSinkConfig{Enabled: true, Type: model.LogSinkSyslog, Syslog: model.SyslogSinkConfig{Network: "tls", Address: "siem:6514", Format: model.SyslogFormatLEEF}}, false},
+		{"syslog 协议无效", model.LogSinkConfig{Enabled: true, Type: model.LogSinkSyslog, Syslog: model.SyslogSinkConfig{Network: "http", Address: "siem:514"}}, true},
+		{"syslog 缺少端口", model.LogSinkConfig{Enabled: true, Type: model.LogSinkSyslog, Syslog: model.SyslogSinkConfig{Network: "udp", Address: "siem"}}, true},
+		{"syslog 格式无效", model.LogSinkConfig{Enabled: true, Type: model.LogSinkSyslog, Syslog: model.SyslogSinkConfig{Network: "udp", Address: "siem:514", Format: "xml"}}, true},
+		{"syslog facility 无效", model.LogSinkConfig{Enabled: true, Type: model.LogSinkSyslog, Syslog: model.SyslogSinkConfig{Network: "udp", Address: "siem:514", Facility: 24}}, true},
+		{"文件", model.LogSinkConfig{Enabled: true, Type: model.LogSinkFile, File: model.FileSinkConfig{Path: "/var/log/waf.log"}}, false},
+		{"文件缺少路径", model.LogSinkConfig{Enabled: true, Type: model.LogSinkFile}, true},
+		{"webhook", model.LogSinkConfig{Enabled: true, Type: model.LogSinkWebhook, Webhook: model.WebhookSinkConfig{URL: "https://siem.example.com/ingest"}}, false},
+		{"webhook 地址无效", model.LogSinkConfig{Enabled: true, Type: model.LogSinkWebhook, Webhook: model.WebhookSinkConfig{URL: "ftp://siem"}}, true},
+		{"webhook 重试次数无效", model.LogSinkConfig{Enabled: true, Type: model.LogSinkWebhook, Webhook: model.WebhookSinkConfig{URL: "http://siem", MaxRetries: -1}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidateLogSinkConfig(tt.config); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateLogSinkConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,115 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/HUAHUAI23/simple-waf/pkg/model"
+)
+
+// webhook 输出的默认参数
+const (
+	webhookDefaultBatchSize = 100
+	webhookDefaultTimeout   = 5000 // 毫秒
+	webhookRetryBackoff     = 100 * time.Millisecond
+)
+
+// webhookSink 将日志按批次以 JSON 数组 POST 到 HTTP 地址
+// 网络错误、429 和 5xx 响应按指数退避重试，其他非 2xx 响应不重试
+type webhookSink struct {
+	url        string
+	headers    map[string]string
+	batchSize  int
+	maxRetries int
+	client     *http.Client
+}
+
+func newWebhookSink(config model.WebhookSinkConfig) *webhookSink {
+	batchSize := config.BatchSize
+	if batchSize == 0 {
+		batchSize = webhookDefaultBatchSize
+	}
+	timeout := config.Timeout
+	if timeout == 0 {
+		timeout = webhookDefaultTimeout
+	}
+	return &webhookSink{
+		url:        config.URL,
+		headers:    config.Headers,
+		batchSize:  batchSize,
+		maxRetries: config.MaxRetries,
+		client:     &http.Client{Timeout: time.Duration(timeout) * time.Millisecond},
+	}
+}
+
+// Write 按批次大小拆分日志并依次发送
+func (s *webhookSink) Write(logs []model.WAFLog) error {
+	for start := 0; start < len(logs); start += s.batchSize {
+		end := start + s.batchSize
+		if end > len(logs) {
+			end = len(logs)
+		}
+		body, err := json.Marshal(logs[start:end])
+		if err != nil {
+			return fmt.Errorf("序列化日志失败: %w", err)
+		}
+		if err := s.post(body); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close 关闭空闲连接
+func (s *webhookSink) Close() error {
+	s.client.CloseIdleConnections()
+	return nil
+}
+
+// post 发送一个批次，可重试的失败按 100ms、200ms、400ms... 退避后重试
+func (s *webhookSink) post(body []byte) error {
+	var lastErr error
+	for attempt := 0; attempt <= s.maxRetries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(webhookRetryBackoff << (attempt - 1))
+		}
+		retryable, err := s.send(body)
+		if err == nil {
+			return nil
+		}
+		lastErr = err
+		if !retryable {
+			break
+		}
+	}
+	return fmt.Errorf("发送 webhook 失败: %w", lastErr)
+}
+
+// send 发送一次请求，返回失败是否可重试
+func (s *webhookSink) send(body []byte) (bool, error) {
+	req, err := http.NewRequest(http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range s.headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	err = fmt.Errorf("响应状态码 %d", resp.StatusCode)
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500, err
+}
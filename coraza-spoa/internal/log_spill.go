@@ -0,0 +1,369 @@
+package internal
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/HUAHUAI23/simple-waf/pkg/model"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// 磁盘溢出队列的默认参数
+const (
+	spillDefaultMaxSize     = 1024 // MB
+	spillDefaultSegmentSize = 16   // MB
+	spillSegmentExt         = ".seg"
+)
+
+// ErrSpillFull 磁盘溢出队列已达到最大大小
+var ErrSpillFull = errors.New("磁盘溢出队列已满")
+
+// ValidateLogSpillConfig 校验磁盘溢出队列配置，未启用时不校验
+func ValidateLogSpillConfig(config model.LogSpillConfig) error {
+	if !config.Enabled {
+		return nil
+	}
+	if !filepath.IsAbs(config.Dir) {
+		return fmt.Errorf("日志溢出目录必须是绝对路径: %q", config.Dir)
+	}
+	if config.MaxSize < 0 || config.SegmentSize < 0 {
+		return fmt.Errorf("无效的日志溢出队列大小: maxSize=%d segmentSize=%d", config.MaxSize, config.SegmentSize)
+	}
+	maxSize, segmentSize := spillSizes(config)
+	if segmentSize > maxSize {
+		return fmt.Errorf("日志溢出分段大小 %dMB 超过队列最大大小 %dMB", segmentSize, maxSize)
+	}
+	return nil
+}
+
+func spillSizes(config model.LogSpillConfig) (maxSize, segmentSize int) {
+	maxSize = config.MaxSize
+	if maxSize == 0 {
+		maxSize = spillDefaultMaxSize
+	}
+	segmentSize = config.SegmentSize
+	if segmentSize == 0 {
+		segmentSize = spillDefaultSegmentSize
+	}
+	return maxSize, segmentSize
+}
+
+// spillSegment 分段文件
+type spillSegment struct {
+	seq  uint64
+	size int64
+}
+
+// SpillQueue WAF日志的磁盘溢出队列
+//
+// 日志以 BSON 文档依次追加到分段文件，文件按递增的序号命名。回放从最早的分段开始按写入顺序读取，
+// 确认后推进读取位置，分段读完后删除。进程重启后继续回放目录中遗留的分段，
+// 异常退出时写了一半的文档在回放时丢弃
+type SpillQueue struct {
+	dir          string
+	maxBytes     int64
+	segmentBytes int64
+
+	// replaying 回放锁，共用队列的多个日志存储同一时间只有一个回放
+	replaying sync.Mutex
+
+	mu        sync.Mutex
+	segments  []spillSegment // 未回放完的分段，按写入顺序排列
+	bytes     int64          // 分段文件的总大小
+	writer    *os.File       // 最后一个分段的写入句柄，为 nil 时下次写入创建新的分段
+	reader    *os.File       // 第一个分段的读取句柄
+	readPos   int64          // 第一个分段中已确认的读取位置
+	unackedTo int64          // 第一个分段中已读取未确认的位置
+}
+
+// NewSpillQueue 打开磁盘溢出队列，目录不存在时创建，目录中遗留的分段排在新写入的日志之前
+func NewSpillQueue(config model.LogSpillConfig) (*SpillQueue, error) {
+	if err := os.MkdirAll(config.Dir, 0755); err != nil {
+		return nil, fmt.Errorf("创建日志溢出目录失败: %w", err)
+	}
+	entries, err := os.ReadDir(config.Dir)
+	if err != nil {
+		return nil, fmt.Errorf("读取日志溢出目录失败: %w", err)
+	}
+
+	maxSize, segmentSize := spillSizes(config)
+	q := &SpillQueue{
+		dir:          config.Dir,
+		maxBytes:     int64(maxSize) * 1024 * 1024,
+		segmentBytes: int64(segmentSize) * 1024 * 1024,
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, spillSegmentExt) {
+			continue
+		}
+		seq, err := strconv.ParseUint(strings.TrimSuffix(name, spillSegmentExt), 10, 64)
+		if err != nil {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil, fmt.Errorf("读取日志溢出分段失败: %w", err)
+		}
+		q.segments = append(q.segments, spillSegment{seq: seq, size: info.Size()})
+		q.bytes += info.Size()
+	}
+	sort.Slice(q.segments, func(i, j int) bool { return q.segments[i].seq < q.segments[j].seq })
+	return q, nil
+}
+
+// sharedSpillQueue 被多个日志存储共用的溢出队列
+type sharedSpillQueue struct {
+	queue *SpillQueue
+	refs  int
+}
+
+// spillQueues 按目录共用的溢出队列，热更新时新旧应用的日志存储写入同一个队列
+var spillQueues = struct {
+	sync.Mutex
+	byDir map[string]*sharedSpillQueue
+}{byDir: make(map[string]*sharedSpillQueue)}
+
+// acquireSpillQueue 打开目录的溢出队列，目录已被打开时共用同一个队列并按新的配置更新大小限制
+func acquireSpillQueue(config model.LogSpillConfig) (*SpillQueue, error) {
+	dir := filepath.Clean(config.Dir)
+	spillQueues.Lock()
+	defer spillQueues.Unlock()
+
+	if shared, ok := spillQueues.byDir[dir]; ok {
+		maxSize, segmentSize := spillSizes(config)
+		shared.queue.mu.Lock()
+		shared.queue.maxBytes = int64(maxSize) * 1024 * 1024
+		shared.queue.segmentBytes = int64(segmentSize) * 1024 * 1024
+		shared.queue.mu.Unlock()
+		shared.refs++
+		return shared.queue, nil
+	}
+
+	config.Dir = dir
+	queue, err := NewSpillQueue(config)
+	if err != nil {
+		return nil, err
+	}
+	spillQueues.byDir[dir] = &sharedSpillQueue{queue: queue, refs: 1}
+	return queue, nil
+}
+
+// releaseSpillQueue 释放溢出队列，最后一个使用者释放时关闭队列
+func releaseSpillQueue(queue *SpillQueue) {
+	spillQueues.Lock()
+	defer spillQueues.Unlock()
+
+	shared, ok := spillQueues.byDir[queue.dir]
+	if !ok || shared.queue != queue {
+		return
+	}
+	if shared.refs--; shared.refs > 0 {
+		return
+	}
+	delete(spillQueues.byDir, queue.dir)
+	queue.Close()
+}
+
+// spillQueueSizes 返回所有打开的溢出队列的分段文件总大小和分段数
+func spillQueueSizes() (int64, int) {
+	spillQueues.Lock()
+	defer spillQueues.Unlock()
+
+	var bytes int64
+	var segments int
+	for _, shared := range spillQueues.byDir {
+		b, n := shared.queue.Size()
+		bytes += b
+		segments += n
+	}
+	return bytes, segments
+}
+
+// Append 将一批日志追加到最后一个分段并同步到磁盘
+// 队列剩余空间不足时整批丢弃并返回 ErrSpillFull
+func (q *SpillQueue) Append(logs []interface{}) error {
+	var data []byte
+	for _, log := range logs {
+		doc, err := bson.Marshal(log)
+		if err != nil {
+			return fmt.Errorf("序列化日志失败: %w", err)
+		}
+		data = append(data, doc...)
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	size := int64(len(data))
+	if q.bytes+size > q.maxBytes {
+		return ErrSpillFull
+	}
+	last := len(q.segments) - 1
+	if q.writer == nil || (q.segments[last].size > 0 && q.segments[last].size+size > q.segmentBytes) {
+		if err := q.rotate(); err != nil {
+			return err
+		}
+		last = len(q.segments) - 1
+	}
+
+	if _, err := q.writer.Write(data); err != nil {
+		// 写入失败时不再向该分段追加，已写入的部分在回放时按不完整的文档丢弃
+		q.closeWriter()
+		return fmt.Errorf("写入日志溢出分段失败: %w", err)
+	}
+	if err := q.writer.Sync(); err != nil {
+		q.closeWriter()
+		return fmt.Errorf("同步日志溢出分段失败: %w", err)
+	}
+	q.segments[last].size += size
+	q.bytes += size
+	return nil
+}
+
+// Read 从最早的分段读取最多 max 条日志，返回的文档可直接写入 MongoDB
+// 调用 Ack 前再次调用时从上次确认的位置重新读取
+func (q *SpillQueue) Read(max int) ([]interface{}, error) {
+	if max <= 0 {
+		return nil, nil
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for len(q.segments) > 0 {
+		seg := q.segments[0]
+		if q.reader == nil {
+			file, err := os.Open(q.segmentPath(seg.seq))
+			if err != nil {
+				return nil, fmt.Errorf("打开日志溢出分段失败: %w", err)
+			}
+			q.reader = file
+		}
+
+		var docs []interface{}
+		pos := q.readPos
+		header := make([]byte, 4)
+		for len(docs) < max && pos < seg.size {
+			if _, err := q.reader.ReadAt(header, pos); err != nil {
+				break
+			}
+			n := int64(binary.LittleEndian.Uint32(header))
+			if n < 5 || pos+n > seg.size {
+				break
+			}
+			doc := make([]byte, n)
+			if _, err := q.reader.ReadAt(doc, pos); err != nil && err != io.EOF {
+				return nil, fmt.Errorf("读取日志溢出分段失败: %w", err)
+			}
+			docs = append(docs, bson.Raw(doc))
+			pos += n
+		}
+
+		if len(docs) > 0 {
+			q.unackedTo = pos
+			return docs, nil
+		}
+		if pos < seg.size {
+			// 异常退出时遗留的不完整文档，丢弃分段的剩余部分
+			q.readPos = seg.size
+		}
+		if q.isWriting(seg.seq) {
+			return nil, nil
+		}
+		q.removeFirst()
+	}
+	return nil, nil
+}
+
+// Ack 确认上次 Read 返回的日志已写入，读完的分段被删除
+func (q *SpillQueue) Ack() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(q.segments) == 0 || q.unackedTo <= q.readPos {
+		return
+	}
+	q.readPos = q.unackedTo
+	if q.readPos < q.segments[0].size {
+		return
+	}
+	// 分段已读完，正在写入的分段关闭写入句柄，下次写入创建新的分段
+	if q.isWriting(q.segments[0].seq) {
+		q.closeWriter()
+	}
+	q.removeFirst()
+}
+
+// Size 返回分段文件的总大小和分段数
+func (q *SpillQueue) Size() (int64, int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.bytes, len(q.segments)
+}
+
+// Close 关闭文件句柄，未回放的分段保留在目录中，之后的写入创建新的分段
+func (q *SpillQueue) Close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.closeWriter()
+	if q.reader != nil {
+		_ = q.reader.Close()
+		q.reader = nil
+	}
+	q.unackedTo = q.readPos
+}
+
+// rotate 创建新的分段作为写入分段
+func (q *SpillQueue) rotate() error {
+	q.closeWriter()
+	var seq uint64 = 1
+	if len(q.segments) > 0 {
+		seq = q.segments[len(q.segments)-1].seq + 1
+	}
+	file, err := os.OpenFile(q.segmentPath(seq), os.O_CREATE|os.O_WRONLY|os.O_EXCL, 0644)
+	if err != nil {
+		return fmt.Errorf("创建日志溢出分段失败: %w", err)
+	}
+	q.writer = file
+	q.segments = append(q.segments, spillSegment{seq: seq})
+	return nil
+}
+
+// isWriting 分段是否为正在写入的分段
+func (q *SpillQueue) isWriting(seq uint64) bool {
+	return q.writer != nil && q.segments[len(q.segments)-1].seq == seq
+}
+
+func (q *SpillQueue) closeWriter() {
+	if q.writer != nil {
+		_ = q.writer.Close()
+		q.writer = nil
+	}
+}
+
+// removeFirst 删除第一个分段
+func (q *SpillQueue) removeFirst() {
+	seg := q.segments[0]
+	if q.reader != nil {
+		_ = q.reader.Close()
+		q.reader = nil
+	}
+	_ = os.Remove(q.segmentPath(seg.seq))
+	q.bytes -= seg.size
+	q.segments = q.segments[1:]
+	q.readPos = 0
+	q.unackedTo = 0
+}
+
+func (q *SpillQueue) segmentPath(seq uint64) string {
+	return filepath.Join(q.dir, fmt.Sprintf("%020d%s", seq, spillSegmentExt))
+}
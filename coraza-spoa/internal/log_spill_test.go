@@ -0,0 +1,228 @@
+package internal
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/HUAHUAI23/simple-waf/pkg/model"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+func spillTestLogs(from, to int) []interface{} {
+	logs := make([]interface{}, 0, to-from)
+	for i := from; i < to; i++ {
+		logs = append(logs, model.WAFLog{RequestID: strconv.Itoa(i), URI: "/"})
+	}
+	return logs
+}
+
+// readSpillIDs 读取并确认溢出队列中的所有日志，返回请求ID
+func readSpillIDs(t *testing.T, q *SpillQueue, max int) []string {
+	t.Helper()
+	var ids []string
+	for {
+		docs, err := q.Read(max)
+		if err != nil {
+			t.Fatalf("读取失败: %v", err)
+		}
+		if len(docs) == 0 {
+			return ids
+		}
+		for _, doc := range docs {
+			var log model.WAFLog
+			if err := bson.Unmarshal(doc.(bson.Raw), &log); err != nil {
+				t.Fatalf("解析文档失败: %v", err)
+			}
+			ids = append(ids, log.RequestID)
+		}
+		q.Ack()
+	}
+}
+
+func assertIDs(t *testing.T, got []string, from, to int) {
+	t.Helper()
+	if len(got) != to-from {
+		t.Fatalf("读取 %d 条日志，期望 %d 条: %v", len(got), to-from, got)
+	}
+	for i, id := range got {
+		if id != strconv.Itoa(from+i) {
+			t.Fatalf("第 %d 条日志为 %s，期望 %d", i, id, from+i)
+		}
+	}
+}
+
+// TestSpillQueueOrder 测试溢出队列跨分段按写入顺序回放，读完的分段被删除
+func TestSpillQueueOrder(t *testing.T) {
+	dir := t.TempDir()
+	q, err := NewSpillQueue(model.LogSpillConfig{Enabled: true, Dir: dir})
+	if err != nil {
+		t.Fatalf("打开溢出队列失败: %v", err)
+	}
+	// 测试中使用较小的分段，每批日志一个分段
+	q.segmentBytes = 1
+
+	for i := 0; i < 3; i++ {
+		if err := q.Append(spillTestLogs(i*4, i*4+4)); err != nil {
+			t.Fatalf("写入失败: %v", err)
+		}
+	}
+	if _, segments := q.Size(); segments != 3 {
+		t.Fatalf("分段数为 %d，期望 3", segments)
+	}
+
+	// 未确认时重新读取同一批日志
+	first, _ := q.Read(3)
+	again, _ := q.Read(3)
+	if len(first) != 3 || len(again) != 3 || string(first[0].(bson.Raw)) != string(again[0].(bson.Raw)) {
+		t.Fatal("未确认的日志应被重新读取")
+	}
+
+	assertIDs(t, readSpillIDs(t, q, 3), 0, 12)
+	if bytes, segments := q.Size(); bytes != 0 || segments != 0 {
+		t.Errorf("回放完成后队列应为空: bytes=%d segments=%d", bytes, segments)
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 0 {
+		t.Errorf("回放完成后分段文件应被删除: %d", len(entries))
+	}
+
+	// 回放完成后继续写入
+	if err := q.Append(spillTestLogs(12, 14)); err != nil {
+		t.Fatalf("写入失败: %v", err)
+	}
+	assertIDs(t, readSpillIDs(t, q, 10), 12, 14)
+}
+
+// TestSpillQueueReopen 测试重新打开溢出队列时回放遗留的分段，并丢弃不完整的文档
+func TestSpillQueueReopen(t *testing.T) {
+	dir := t.TempDir()
+	config := model.LogSpillConfig{Enabled: true, Dir: dir}
+	q, err := NewSpillQueue(config)
+	if err != nil {
+		t.Fatalf("打开溢出队列失败: %v", err)
+	}
+	if err := q.Append(spillTestLogs(0, 5)); err != nil {
+		t.Fatalf("写入失败: %v", err)
+	}
+	// 读取未确认时关闭，重新打开后从头回放
+	if docs, _ := q.Read(2); len(docs) != 2 {
+		t.Fatal("应读取到 2 条日志")
+	}
+	q.Close()
+
+	// 模拟异常退出时写了一半的文档
+	path := filepath.Join(dir, "00000000000000000001.seg")
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatalf("打开分段失败: %v", err)
+	}
+	_, _ = file.Write([]byte{0xff, 0x00, 0x00, 0x00, 0x03})
+	_ = file.Close()
+
+	q, err = NewSpillQueue(config)
+	if err != nil {
+		t.Fatalf("重新打开溢出队列失败: %v", err)
+	}
+	// 新写入的日志排在遗留的分段之后
+	if err := q.Append(spillTestLogs(5, 7)); err != nil {
+		t.Fatalf("写入失败: %v", err)
+	}
+	assertIDs(t, readSpillIDs(t, q, 100), 0, 7)
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("遗留的分段回放后应被删除")
+	}
+}
+
+// TestSpillQueueFull 测试队列达到最大大小后拒绝写入
+func TestSpillQueueFull(t *testing.T) {
+	q, err := NewSpillQueue(model.LogSpillConfig{Enabled: true, Dir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("打开溢出队列失败: %v", err)
+	}
+	defer q.Close()
+	if err := q.Append(spillTestLogs(0, 1)); err != nil {
+		t.Fatalf("写入失败: %v", err)
+	}
+	used, _ := q.Size()
+	q.maxBytes = used * 2
+
+	if err := q.Append(spillTestLogs(1, 2)); err != nil {
+		t.Fatalf("写入失败: %v", err)
+	}
+	if err := q.Append(spillTestLogs(2, 3)); !errors.Is(err, ErrSpillFull) {
+		t.Fatalf("队列已满时应返回 ErrSpillFull: %v", err)
+	}
+	// 回放后释放空间
+	assertIDs(t, readSpillIDs(t, q, 100), 0, 2)
+	if err := q.Append(spillTestLogs(2, 3)); err != nil {
+		t.Fatalf("回放后应可继续写入: %v", err)
+	}
+}
+
+// TestValidateLogSpillConfig 测试磁盘溢出队列配置校验
+func TestValidateLogSpillConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  model.LogSpillConfig
+		wantErr bool
+	}{
+		{"未启用不校验", model.LogSpillConfig{Dir: "relative"}, false},
+		{"默认大小", model.LogSpillConfig{Enabled: true, Dir: "/var/lib/waf"}, false},
+		{"相对路径", model.LogSpillConfig{Enabled: true, Dir: "spill"}, true},
+		{"大小为负数", model.LogSpillConfig{Enabled: true, Dir: "/var/lib/waf", MaxSize: -1}, true},
+		{"分段超过队列大小", model.LogSpillConfig{Enabled: true, Dir: "/var/lib/waf", MaxSize: 8, SegmentSize: 16}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidateLogSpillConfig(tt.config); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateLogSpillConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// TestAcquireSpillQueue 测试同一目录的溢出队列被共用，最后一个使用者释放时关闭
+func TestAcquireSpillQueue(t *testing.T) {
+	dir := t.TempDir()
+	first, err := acquireSpillQueue(model.LogSpillConfig{Enabled: true, Dir: dir})
+	if err != nil {
+		t.Fatalf("打开溢出队列失败: %v", err)
+	}
+	second, err := acquireSpillQueue(model.LogSpillConfig{Enabled: true, Dir: dir + "/", MaxSize: 8})
+	if err != nil {
+		t.Fatalf("打开溢出队列失败: %v", err)
+	}
+	if first != second {
+		t.Fatal("同一目录应共用溢出队列")
+	}
+	if first.maxBytes != 8*1024*1024 {
+		t.Errorf("大小限制应按新的配置更新: %d", first.maxBytes)
+	}
+
+	releaseSpillQueue(first)
+	if err := second.Append(spillTestLogs(0, 1)); err != nil {
+		t.Fatalf("仍有使用者时队列应可写入: %v", err)
+	}
+	releaseSpillQueue(second)
+
+	spillQueues.Lock()
+	_, ok := spillQueues.byDir[filepath.Clean(dir)]
+	spillQueues.Unlock()
+	if ok {
+		t.Error("最后一个使用者释放后队列应被移除")
+	}
+
+	// 重新打开时回放遗留的分段
+	third, err := acquireSpillQueue(model.LogSpillConfig{Enabled: true, Dir: dir})
+	if err != nil {
+		t.Fatalf("重新打开溢出队列失败: %v", err)
+	}
+	defer releaseSpillQueue(third)
+	if third == first {
+		t.Fatal("释放后应打开新的队列")
+	}
+	assertIDs(t, readSpillIDs(t, third, 10), 0, 1)
+}
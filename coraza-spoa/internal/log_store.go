@@ -2,6 +2,8 @@ package internal
 
 import (
 	"context"
+	"errors"
+	"path/filepath"
 	"runtime"
 	"sync"
 	"sync/atomic"
@@ -10,6 +12,7 @@ import (
 	"github.com/HUAHUAI23/simple-waf/pkg/model"
 	"github.com/rs/zerolog"
 	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
 )
 
 // LogStore 定义日志存储接口
@@ -117,9 +120,21 @@ type MongoLogStore struct {
 	ringBuffers []*RingBuffer // 多个环形缓冲区，减少竞争
 	numBuffers  int
 	logger      zerolog.Logger
-	state       atomic.Uint32 // 0: stopped, 1: running, 2: closing
+	state       atomic.Uint32                 // 0: stopped, 1: running, 2: closing, 3: closed
+	sinks       atomic.Pointer[LogSinkGroup]  // 应用的日志输出，写入 MongoDB 后分发
+	successor   atomic.Pointer[MongoLogStore] // 热更新时同名新应用的日志存储，关闭时缓冲区中的日志移交给它
 	wg          sync.WaitGroup
 
+	// 磁盘溢出队列，MongoDB 不可用时写入，恢复后回放
+	spill    *SpillQueue
+	degraded atomic.Bool // MongoDB 写入失败，写入协程直接写入溢出队列，由回放协程探测恢复
+	dropped  atomic.Uint64
+	spilled  atomic.Uint64
+	replayed atomic.Uint64
+
+	// 日志聚合器，为 nil 时不聚合
+	aggregator *logAggregator
+
 	// 性能优化参数
 	writerCount    int           // 写入协程数
 	batchSize      atomic.Int32  // 动态批大小
@@ -129,10 +144,21 @@ type MongoLogStore struct {
 	bufferSelector atomic.Uint64 // 用于选择buffer
 }
 
-// 单例实例
-var (
-	mongoLogStoreOnce     sync.Once
-	mongoLogStoreInstance *MongoLogStore
+// LogStoreStats WAF日志存储计数
+type LogStoreStats struct {
+	Dropped       uint64 `json:"dropped"`       // 丢弃的日志数：缓冲区已满、MongoDB 拒绝或无法写入溢出队列
+	Spilled       uint64 `json:"spilled"`       // 写入磁盘溢出队列的日志数
+	Replayed      uint64 `json:"replayed"`      // 从溢出队列回放到 MongoDB 的日志数
+	SpillBytes    int64  `json:"spillBytes"`    // 溢出队列当前占用的磁盘空间（字节）
+	SpillSegments int    `json:"spillSegments"` // 溢出队列当前的分段文件数
+	Collapsed     uint64 `json:"collapsed"`     // 合并到已有记录的日志数
+	SampledOut    uint64 `json:"sampledOut"`    // 超过每秒记录数上限后采样丢弃的日志数
+}
+
+// 回放协程探测 MongoDB 恢复的间隔和单批次写入超时
+const (
+	spillReplayInterval = time.Second
+	spillReplayTimeout  = 5 * time.Second
 )
 
 // StoreConfig 存储配置
@@ -143,6 +169,8 @@ type StoreConfig struct {
 	BatchInterval time.Duration
 	MaxBatchSize  int
 	MinBatchSize  int
+	Spill         model.LogSpillConfig       // 磁盘溢出队列配置
+	Aggregation   model.LogAggregationConfig // 日志聚合与采样配置
 }
 
 // DefaultConfig 默认配置
@@ -158,56 +186,73 @@ func DefaultConfig() StoreConfig {
 	}
 }
 
-// NewMongoLogStore 创建新的MongoDB日志存储器（单例模式）
+// NewMongoLogStore 创建新的MongoDB日志存储器，每个应用使用独立的存储，随应用关闭而关闭
 func NewMongoLogStore(client *mongo.Client, database, collection string, logger zerolog.Logger) *MongoLogStore {
 	config := DefaultConfig()
 	return NewMongoLogStoreWithConfig(client, database, collection, config, logger)
 }
 
 // NewMongoLogStoreWithConfig 使用配置创建存储器
+// 启用磁盘溢出队列时，写入同一集合的日志存储共用 <dir>/<集合名称> 下的队列
 func NewMongoLogStoreWithConfig(client *mongo.Client, database, collection string, config StoreConfig, logger zerolog.Logger) *MongoLogStore {
-	mongoLogStoreOnce.Do(func() {
-		if config.NumBuffers <= 0 {
-			config.NumBuffers = runtime.NumCPU()
-		}
-		if config.WriterCount <= 0 {
-			config.WriterCount = config.NumBuffers / 2
-			if config.WriterCount == 0 {
-				config.WriterCount = 1
-			}
+	if config.NumBuffers <= 0 {
+		config.NumBuffers = runtime.NumCPU()
+	}
+	if config.WriterCount <= 0 {
+		config.WriterCount = config.NumBuffers / 2
+		if config.WriterCount == 0 {
+			config.WriterCount = 1
 		}
+	}
 
-		store := &MongoLogStore{
-			mongo:         client,
-			mongoDB:       database,
-			collection:    client.Database(database).Collection(collection),
-			ringBuffers:   make([]*RingBuffer, config.NumBuffers),
-			numBuffers:    config.NumBuffers,
-			logger:        logger,
-			writerCount:   config.WriterCount,
-			batchInterval: config.BatchInterval,
-			maxBatchSize:  config.MaxBatchSize,
-			minBatchSize:  config.MinBatchSize,
-		}
+	store := &MongoLogStore{
+		mongo:         client,
+		mongoDB:       database,
+		collection:    client.Database(database).Collection(collection),
+		ringBuffers:   make([]*RingBuffer, config.NumBuffers),
+		numBuffers:    config.NumBuffers,
+		logger:        logger,
+		writerCount:   config.WriterCount,
+		batchInterval: config.BatchInterval,
+		maxBatchSize:  config.MaxBatchSize,
+		minBatchSize:  config.MinBatchSize,
+	}
 
-		// 初始化环形缓冲区
-		bufferSizePerRing := config.BufferSize / config.NumBuffers
-		for i := 0; i < config.NumBuffers; i++ {
-			store.ringBuffers[i] = NewRingBuffer(bufferSizePerRing)
+	// 初始化环形缓冲区
+	bufferSizePerRing := config.BufferSize / config.NumBuffers
+	for i := 0; i < config.NumBuffers; i++ {
+		store.ringBuffers[i] = NewRingBuffer(bufferSizePerRing)
+	}
+
+	// 设置初始批大小
+	store.batchSize.Store(int32(config.MinBatchSize))
+
+	if config.Spill.Enabled {
+		spillConfig := config.Spill
+		spillConfig.Dir = filepath.Join(config.Spill.Dir, collection)
+		spill, err := acquireSpillQueue(spillConfig)
+		if err != nil {
+			logger.Error().Err(err).Str("dir", spillConfig.Dir).Msg("打开日志溢出队列失败，MongoDB 不可用时将丢弃日志")
+		} else {
+			store.spill = spill
+			if bytes, segments := spill.Size(); segments > 0 {
+				logger.Info().Int64("bytes", bytes).Int("segments", segments).Msg("日志溢出队列中有待回放的日志")
+			}
 		}
+	}
 
-		// 设置初始批大小
-		store.batchSize.Store(int32(config.MinBatchSize))
+	if config.Aggregation.Enabled {
+		store.aggregator = newLogAggregator(config.Aggregation, store.push)
+	}
 
-		mongoLogStoreInstance = store
-		logger.Info().
-			Int("num_buffers", config.NumBuffers).
-			Int("writer_count", config.WriterCount).
-			Int("buffer_size", config.BufferSize).
-			Msg("创建新的高性能MongoLogStore实例")
-	})
+	logger.Debug().
+		Str("collection", collection).
+		Int("num_buffers", config.NumBuffers).
+		Int("writer_count", config.WriterCount).
+		Int("buffer_size", config.BufferSize).
+		Msg("创建MongoLogStore")
 
-	return mongoLogStoreInstance
+	return store
 }
 
 // Store 高性能非阻塞存储
@@ -217,6 +262,16 @@ func (s *MongoLogStore) Store(log model.WAFLog) error {
 		return nil // 未运行状态，直接丢弃
 	}
 
+	if s.aggregator != nil {
+		s.aggregator.Add(log)
+		return nil
+	}
+	s.push(log)
+	return nil
+}
+
+// push 将日志推送到环形缓冲区，缓冲区满时丢弃
+func (s *MongoLogStore) push(log model.WAFLog) {
 	// 选择buffer（轮询方式分散负载）
 	idx := s.bufferSelector.Add(1) % uint64(s.numBuffers)
 	buffer := s.ringBuffers[idx]
@@ -224,10 +279,8 @@ func (s *MongoLogStore) Store(log model.WAFLog) error {
 	// 尝试推送到环形缓冲区
 	if !buffer.Push(log) {
 		// 缓冲区满，直接丢弃（按要求可以接受日志丢失）
-		return nil
+		s.dropped.Add(1)
 	}
-
-	return nil
 }
 
 // Start 启动日志存储处理
@@ -248,6 +301,34 @@ func (s *MongoLogStore) Start() {
 	// 启动动态调整协程
 	s.wg.Add(1)
 	go s.dynamicAdjuster()
+
+	// 启动溢出队列回放协程
+	if s.spill != nil {
+		s.wg.Add(1)
+		go s.replayer()
+	}
+
+	// 启动聚合记录写出协程
+	if s.aggregator != nil {
+		s.wg.Add(1)
+		go s.aggregateFlusher()
+	}
+}
+
+// aggregateFlusher 定期写出窗口已结束的聚合记录
+func (s *MongoLogStore) aggregateFlusher() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(aggregateFlushInterval)
+	defer ticker.Stop()
+
+	for {
+		<-ticker.C
+		if s.state.Load() == 2 {
+			return
+		}
+		s.aggregator.Flush(time.Now())
+	}
 }
 
 // writer 写入协程
@@ -309,17 +390,165 @@ func (s *MongoLogStore) processBatches(startIdx, endIdx int) {
 }
 
 // batchInsert 批量插入（无重试，追求性能）
+// 写入失败或超时时写入磁盘溢出队列，MongoDB 恢复前后续批次直接写入溢出队列；未启用溢出队列时丢弃
 func (s *MongoLogStore) batchInsert(batch *LogBatch) {
 	if batch.size == 0 {
 		return
 	}
+	logs := batch.logs[:batch.size]
+	defer s.fanout(logs)
 
-	// 使用较短的超时，失败就丢弃
+	if s.spill != nil && s.degraded.Load() {
+		s.spillLogs(logs)
+		return
+	}
+
+	// 使用较短的超时
 	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
 	defer cancel()
 
-	// 批量插入，忽略错误（可接受丢失）
-	_, _ = s.collection.InsertMany(ctx, batch.logs[:batch.size])
+	_, err := s.collection.InsertMany(ctx, logs, options.InsertMany().SetOrdered(false))
+	if err == nil {
+		if s.degraded.CompareAndSwap(true, false) {
+			s.logger.Info().Msg("MongoDB 写入恢复")
+		}
+		return
+	}
+	if rejected := rejectedDocuments(err); rejected > 0 {
+		// 无序写入时其余文档已写入，被拒绝的文档重试也不会成功
+		s.dropped.Add(uint64(rejected))
+		s.logger.Error().Err(err).Int("count", rejected).Msg("MongoDB 拒绝写入日志")
+		return
+	}
+	if s.degraded.CompareAndSwap(false, true) {
+		s.logger.Warn().Err(err).Bool("spill", s.spill != nil).Msg("写入 MongoDB 失败")
+	}
+	if s.spill != nil {
+		s.spillLogs(logs)
+		return
+	}
+	s.dropped.Add(uint64(len(logs)))
+}
+
+// spillLogs 将日志写入磁盘溢出队列，失败时丢弃
+func (s *MongoLogStore) spillLogs(logs []interface{}) {
+	if err := s.spill.Append(logs); err != nil {
+		s.dropped.Add(uint64(len(logs)))
+		if !errors.Is(err, ErrSpillFull) {
+			s.logger.Error().Err(err).Int("count", len(logs)).Msg("写入日志溢出队列失败")
+		}
+		return
+	}
+	s.spilled.Add(uint64(len(logs)))
+}
+
+// rejectedDocuments 返回 MongoDB 可用但拒绝写入的文档数，其他错误返回 0
+// 超时等错误时部分文档可能已写入，写入溢出队列后回放可能产生重复的日志
+func rejectedDocuments(err error) int {
+	var bulkErr mongo.BulkWriteException
+	if errors.As(err, &bulkErr) && bulkErr.WriteConcernError == nil {
+		return len(bulkErr.WriteErrors)
+	}
+	return 0
+}
+
+// replayer 回放协程，定期按写入顺序将溢出队列中的日志写入 MongoDB
+func (s *MongoLogStore) replayer() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(spillReplayInterval)
+	defer ticker.Stop()
+
+	for {
+		<-ticker.C
+		if s.state.Load() == 2 {
+			return
+		}
+		s.replaySpill()
+	}
+}
+
+// replaySpill 回放溢出队列直到队列为空、写入失败或存储关闭
+// 回放成功或队列为空时恢复写入协程直接写入 MongoDB，回放期间新的日志可能先于溢出的日志写入
+func (s *MongoLogStore) replaySpill() {
+	// 共用队列的其他日志存储正在回放
+	if !s.spill.replaying.TryLock() {
+		return
+	}
+	defer s.spill.replaying.Unlock()
+
+	for s.state.Load() == 1 {
+		logs, err := s.spill.Read(s.maxBatchSize)
+		if err != nil {
+			s.logger.Error().Err(err).Msg("读取日志溢出队列失败")
+			return
+		}
+		if len(logs) == 0 {
+			s.degraded.Store(false)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), spillReplayTimeout)
+		_, err = s.collection.InsertMany(ctx, logs, options.InsertMany().SetOrdered(false))
+		cancel()
+		rejected := rejectedDocuments(err)
+		if err != nil && rejected == 0 {
+			s.degraded.Store(true)
+			return
+		}
+
+		s.spill.Ack()
+		if rejected > 0 {
+			s.dropped.Add(uint64(rejected))
+			s.logger.Error().Err(err).Int("count", rejected).Msg("MongoDB 拒绝写入回放的日志")
+		}
+		s.replayed.Add(uint64(len(logs) - rejected))
+		if s.degraded.CompareAndSwap(true, false) {
+			s.logger.Info().Msg("MongoDB 写入恢复，继续回放日志溢出队列")
+		}
+	}
+}
+
+// Stats 获取日志存储计数
+func (s *MongoLogStore) Stats() LogStoreStats {
+	stats := LogStoreStats{
+		Dropped:  s.dropped.Load(),
+		Spilled:  s.spilled.Load(),
+		Replayed: s.replayed.Load(),
+	}
+	if s.spill != nil {
+		stats.SpillBytes, stats.SpillSegments = s.spill.Size()
+	}
+	if s.aggregator != nil {
+		stats.Collapsed = s.aggregator.collapsed.Load()
+		stats.SampledOut = s.aggregator.sampledOut.Load()
+	}
+	return stats
+}
+
+// AttachSinks 挂载应用的日志输出，日志存储关闭后由应用关闭日志输出
+func (s *MongoLogStore) AttachSinks(group *LogSinkGroup) {
+	s.sinks.Store(group)
+}
+
+// HandOff 设置关闭时接收缓冲区中剩余日志的日志存储，next 未在运行时照常写入 MongoDB
+func (s *MongoLogStore) HandOff(next *MongoLogStore) {
+	s.successor.Store(next)
+}
+
+// fanout 将一批日志分发到应用的日志输出
+func (s *MongoLogStore) fanout(logs []interface{}) {
+	group := s.sinks.Load()
+	if group == nil {
+		return
+	}
+	wafLogs := make([]model.WAFLog, 0, len(logs))
+	for _, item := range logs {
+		if log, ok := item.(model.WAFLog); ok {
+			wafLogs = append(wafLogs, log)
+		}
+	}
+	group.Dispatch(wafLogs)
 }
 
 // dynamicAdjuster 动态调整批大小
@@ -377,6 +606,13 @@ func (s *MongoLogStore) flushAll(startIdx, endIdx int) {
 		batchPool.Put(batch)
 	}()
 
+	// 热更新时移交给新的日志存储，由其写入新的集合和日志输出
+	next := s.successor.Load()
+	if next != nil && next.state.Load() != 1 {
+		next = nil
+	}
+	handedOff := 0
+
 	// 尽可能多地收集日志
 	for i := startIdx; i < endIdx; i++ {
 		buffer := s.ringBuffers[i]
@@ -385,29 +621,49 @@ func (s *MongoLogStore) flushAll(startIdx, endIdx int) {
 			if count == 0 {
 				break
 			}
-			if batch.size > 0 {
+			if next != nil {
+				// 已聚合的记录直接推送，不再次聚合
+				for _, log := range batch.logs[:batch.size] {
+					next.push(log.(model.WAFLog))
+				}
+				handedOff += batch.size
+			} else {
 				s.batchInsert(batch)
-				batch.logs = batch.logs[:0]
-				batch.size = 0
 			}
+			batch.logs = batch.logs[:0]
+			batch.size = 0
 		}
 	}
+	if handedOff > 0 {
+		s.logger.Debug().Int("count", handedOff).Msg("缓冲区中的日志已移交给新的日志存储")
+	}
 }
 
-// Close 关闭日志存储器
+// Close 关闭日志存储器，写入或移交缓冲区中剩余的日志，可重复调用
 func (s *MongoLogStore) Close() {
-	// 设置关闭状态
+	// 聚合中的记录先推送到缓冲区，由写入协程随剩余的日志一起写入或移交
+	if s.aggregator != nil && s.state.Load() == 1 {
+		s.aggregator.Close()
+	}
+
+	// 设置关闭状态，未启动时直接关闭
 	if !s.state.CompareAndSwap(1, 2) {
+		if s.state.CompareAndSwap(0, 3) && s.spill != nil {
+			releaseSpillQueue(s.spill)
+		}
 		return
 	}
 
-	s.logger.Info().Msg("关闭高性能日志处理")
+	s.logger.Debug().Msg("关闭日志存储")
 
 	// 等待所有writer完成
 	s.wg.Wait()
 
-	// 重置状态
-	s.state.Store(0)
+	// 未回放的日志保留在溢出队列中，由共用队列的其他日志存储或重新启动后继续回放
+	if s.spill != nil {
+		releaseSpillQueue(s.spill)
+	}
+	s.state.Store(3)
 }
 
 // 辅助函数
@@ -14,16 +14,27 @@ import (
 	"github.com/rs/zerolog"
 	"go.mongodb.org/mongo-driver/v2/bson"
 	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
 
 	cfg "github.com/HUAHUAI23/simple-waf/coraza-spoa/config"
 	"github.com/HUAHUAI23/simple-waf/coraza-spoa/internal"
 	mongodb "github.com/HUAHUAI23/simple-waf/pkg/database/mongo"
 	"github.com/HUAHUAI23/simple-waf/pkg/model"
 	"github.com/HUAHUAI23/simple-waf/pkg/utils/network"
+	"github.com/HUAHUAI23/simple-waf/pkg/utils/secrule"
 )
 
 var globalLogger = zerolog.New(os.Stderr).With().Timestamp().Logger()
 
+// ErrInvalidAppConfig 应用的 CRS 配置或最终组装的指令无法加载
+var ErrInvalidAppConfig = errors.New("应用配置无效")
+
+// AgentStats SPOE Agent 错误计数
+type AgentStats = internal.AgentStats
+
+// LogStoreStats WAF日志存储的丢弃、溢出和回放计数
+type LogStoreStats = internal.LogStoreStats
+
 // ServerState 表示服务器的运行状态
 type ServerState int
 
@@ -42,6 +53,8 @@ type AgentServer interface {
 	UpdateLogger(logger zerolog.Logger)
 	GetState() ServerState
 	GetLastError() error
+	GetAgentStats() AgentStats
+	GetLogStoreStats() LogStoreStats
 	GetLatestConfig() (*model.Config, error)
 }
 
@@ -59,6 +72,10 @@ type AgentServerImpl struct {
 	state        ServerState
 	lastError    error
 	mongoURI     string
+
+	// loadConfig 获取最新配置，build 按配置创建所有应用，默认读写 MongoDB
+	loadConfig func() (*model.Config, error)
+	build      func(ctx context.Context, globalConfig *model.Config) (map[string]*internal.Application, error)
 }
 
 func NewAgentServer(logger zerolog.Logger, mongoURI string) (AgentServer, error) {
@@ -66,11 +83,14 @@ func NewAgentServer(logger zerolog.Logger, mongoURI string) (AgentServer, error)
 		return nil, errors.New("mongoURI is required")
 	}
 
-	return &AgentServerImpl{
+	s := &AgentServerImpl{
 		logger:   logger,
 		state:    ServerStopped,
 		mongoURI: mongoURI,
-	}, nil
+	}
+	s.loadConfig = s.GetLatestConfig
+	s.build = s.buildApplications
+	return s, nil
 }
 
 // Start 启动服务
@@ -86,86 +106,30 @@ func (s *AgentServerImpl) Start() error {
 	s.ctx = ctx
 	s.cancelFunc = cancel
 
-	globalConfig, err := s.GetLatestConfig()
-	if err != nil {
-		s.logger.Fatal().Err(err).Msg("Failed getting latest config")
+	// 启动失败时取消上下文、关闭已创建的应用并记录错误，由调用方决定是否重试，不退出进程
+	fail := func(err error) error {
+		cancel()
+		for _, app := range s.applications {
+			app.Close()
+		}
+		s.applications = nil
+		s.ctx = nil
+		s.cancelFunc = nil
+		s.state = ServerError
+		s.lastError = err
 		return err
 	}
 
-	mongoClient, err := mongodb.Connect(s.mongoURI)
+	globalConfig, err := s.loadConfig()
 	if err != nil {
-		s.logger.Fatal().Err(err).Msg("Failed creating MongoDB client")
-		return err
-	}
-
-	var wafLog model.WAFLog
-	mongoConfig := &internal.MongoConfig{
-		Client:     mongoClient,
-		Database:   "waf",
-		Collection: wafLog.GetCollectionName(),
-	}
-
-	var microRule model.MicroRule
-	var ipGroup model.IPGroup
-
-	ruleEngineMongoConfig := &internal.MongoDBConfig{
-		MongoClient:       mongoClient,
-		Database:          "waf",
-		RuleCollection:    microRule.GetCollectionName(),
-		IPGroupCollection: ipGroup.GetCollectionName(),
+		s.logger.Error().Err(err).Msg("获取最新配置失败")
+		return fail(err)
 	}
 
-	flowControllerConfig := internal.FlowControllerConfig{
-		Client:   mongoClient,
-		Database: "waf",
-	}
-
-	geoIPConfig := internal.GeoIP2Options{
-		ASNDBPath:  globalConfig.Engine.ASNDBPath,
-		CityDBPath: globalConfig.Engine.CityDBPath,
-	}
-
-	appConfigs := globalConfig.Engine.AppConfig
-
-	// Convert model.AppConfig to internal.AppConfig and create applications
-	allApps := make(map[string]*internal.Application)
-	for _, appConfig := range appConfigs {
-		// 创建日志配置
-		logConfig := cfg.LogConfig{
-			Level:  appConfig.LogLevel,
-			File:   appConfig.LogFile,
-			Format: appConfig.LogFormat,
-		}
-
-		// 创建日志记录器
-		appLogger, err := logConfig.NewLogger()
-		if err != nil {
-			s.logger.Warn().Err(err).Str("app", appConfig.Name).Msg("使用默认日志记录器")
-			appLogger = globalLogger
-		}
-
-		// 创建内部 AppConfig
-		internalAppConfig := internal.AppConfig{
-			Directives:     appConfig.Directives,
-			ResponseCheck:  globalConfig.IsResponseCheck, // 使用全局响应检查设置
-			Logger:         appLogger,
-			TransactionTTL: appConfig.TransactionTTL,
-		}
-
-		// 创建应用
-		application, err := internalAppConfig.NewApplicationWithContext(ctx, internal.ApplicationOptions{
-			MongoConfig:          mongoConfig,
-			GeoIPConfig:          &geoIPConfig,
-			RuleEngineDbConfig:   ruleEngineMongoConfig,
-			FlowControllerConfig: &flowControllerConfig,
-		}, globalConfig.IsDebug)
-		if err != nil {
-			s.logger.Fatal().Err(err).Msg("Failed creating application: " + appConfig.Name)
-
-			return err
-		}
-
-		allApps[appConfig.Name] = application
+	allApps, err := s.build(ctx, globalConfig)
+	if err != nil {
+		s.logger.Error().Err(err).Msg("创建应用失败")
+		return fail(err)
 	}
 
 	s.applications = allApps
@@ -175,9 +139,7 @@ func (s *AgentServerImpl) Start() error {
 	l, err := (&net.ListenConfig{}).Listen(s.ctx, s.network, s.address)
 	if err != nil {
 		s.logger.Error().Err(err).Msg("创建套接字失败")
-		s.state = ServerError
-		s.lastError = err
-		return err
+		return fail(err)
 	}
 	s.listener = l
 
@@ -186,6 +148,8 @@ func (s *AgentServerImpl) Start() error {
 		Context:      s.ctx,
 		Applications: s.applications,
 		Logger:       s.logger,
+		DefaultApp:   globalConfig.Engine.DefaultApp,
+		FailOpen:     globalConfig.Engine.UnknownAppPolicy == model.UnknownAppPolicyFailOpen,
 	}
 
 	// 在后台goroutine中启动服务
@@ -207,6 +171,7 @@ func (s *AgentServerImpl) Start() error {
 	}()
 
 	s.state = ServerRunning
+	s.lastError = nil
 	return nil
 }
 
@@ -234,6 +199,10 @@ func (s *AgentServerImpl) Stop() error {
 		s.listener = nil
 	}
 
+	// 关闭所有应用，释放日志存储、GeoIP 数据库和IP记录器
+	if s.agent != nil {
+		s.agent.Close()
+	}
 	s.agent = nil
 	s.applications = nil
 	s.ctx = nil
@@ -251,30 +220,60 @@ func (s *AgentServerImpl) Restart() error {
 	return s.Start()
 }
 
-// UpdateApplications 更新应用配置 support hot reload
+// UpdateApplications 更新应用配置，支持热更新
+// 任一应用创建失败时保留正在运行的应用，错误通过 GetLastError 获取
 func (s *AgentServerImpl) UpdateApplications() error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	globalConfig, err := s.GetLatestConfig()
+	globalConfig, err := s.loadConfig()
 	if err != nil {
-		s.logger.Fatal().Err(err).Msg("Failed getting latest config")
-		return err
+		s.logger.Error().Err(err).Msg("获取最新配置失败，继续使用之前的应用")
+		s.lastError = fmt.Errorf("重新加载应用失败，继续使用之前的配置: %w", err)
+		return s.lastError
+	}
+
+	allApps, err := s.build(s.ctx, globalConfig)
+	if err != nil {
+		s.logger.Error().Err(err).Msg("创建应用失败，继续使用之前的应用")
+		s.lastError = fmt.Errorf("重新加载应用失败，继续使用之前的配置: %w", err)
+		return s.lastError
+	}
+
+	oldApps := s.applications
+	s.applications = allApps
+	s.lastError = nil
+
+	// 如果服务正在运行，热更新Agent的应用，旧应用排空后由Agent关闭
+	if s.state == ServerRunning && s.agent != nil && s.ctx != nil {
+		s.agent.ReplaceApplications(allApps)
+		s.agent.SetFallback(globalConfig.Engine.DefaultApp, globalConfig.Engine.UnknownAppPolicy == model.UnknownAppPolicyFailOpen)
+		s.logger.Info().Msg("应用配置已更新")
+	} else {
+		for _, app := range oldApps {
+			app.Close()
+		}
 	}
 
+	return nil
+}
+
+// buildApplications 按配置创建所有应用
+// 创建前先编译所有应用的指令，任一应用的指令无效时不创建任何应用，避免启动无用的后台任务
+func (s *AgentServerImpl) buildApplications(ctx context.Context, globalConfig *model.Config) (map[string]*internal.Application, error) {
 	mongoClient, err := mongodb.Connect(s.mongoURI)
+	if err != nil {
+		return nil, fmt.Errorf("连接数据库失败: %w", err)
+	}
+	db := mongoClient.Database("waf")
 
+	directives, err := assembleDirectives(globalConfig, db)
 	if err != nil {
-		s.logger.Fatal().Err(err).Msg("Failed creating MongoDB client")
-		return err
+		return nil, err
 	}
 
 	var wafLog model.WAFLog
-	mongoConfig := &internal.MongoConfig{
-		Client:     mongoClient,
-		Database:   "waf",
-		Collection: wafLog.GetCollectionName(),
-	}
+	defaultLogCollection := wafLog.GetCollectionName()
 
 	var microRule model.MicroRule
 	var ipGroup model.IPGroup
@@ -296,12 +295,33 @@ func (s *AgentServerImpl) UpdateApplications() error {
 		CityDBPath: globalConfig.Engine.CityDBPath,
 	}
 
-	// 从 Config 中提取 AppConfig 列表
-	appConfigs := globalConfig.Engine.AppConfig
+	// 所有应用共用同一个日志脱敏器
+	redactor, err := internal.NewLogRedactor(globalConfig.Engine.LogRedaction)
+	if err != nil {
+		return nil, fmt.Errorf("%w: 日志脱敏配置无效: %v", ErrInvalidAppConfig, err)
+	}
+
+	var decisionLogConfig *internal.DecisionLogConfig
+	if globalConfig.Engine.DecisionLog.Enabled {
+		decisionLogConfig = &internal.DecisionLogConfig{SampleRate: globalConfig.Engine.DecisionLog.SampleRate}
+	}
+
+	if err := internal.ValidateAuditLogConfig(globalConfig.Engine.AuditLog); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidAppConfig, err)
+	}
+	if err := internal.ValidateLogSpillConfig(globalConfig.Engine.LogSpill); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidAppConfig, err)
+	}
+	if err := internal.ValidateLogAggregationConfig(globalConfig.Engine.LogAggregation); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidAppConfig, err)
+	}
+	if err := validateLogSinks(globalConfig.Engine.AppConfig); err != nil {
+		return nil, err
+	}
 
 	// Convert model.AppConfig to internal.AppConfig and create applications
 	allApps := make(map[string]*internal.Application)
-	for _, appConfig := range appConfigs {
+	for _, appConfig := range globalConfig.Engine.AppConfig {
 		// 创建日志配置
 		logConfig := cfg.LogConfig{
 			Level:  appConfig.LogLevel,
@@ -318,37 +338,65 @@ func (s *AgentServerImpl) UpdateApplications() error {
 
 		// 创建内部 AppConfig
 		internalAppConfig := internal.AppConfig{
-			Directives:     appConfig.Directives,
+			Name:           appConfig.Name,
+			Directives:     directives[appConfig.Name],
 			ResponseCheck:  globalConfig.IsResponseCheck, // 使用全局响应检查设置
 			Logger:         appLogger,
 			TransactionTTL: appConfig.TransactionTTL,
+			// 告警分数与异常分数阈值同属 CRS 结构化配置
+			WarningAnomalyScore: appConfig.CRS.WarningAnomalyScore,
+		}
+
+		// 每个应用使用独立的日志存储，可写入自己的集合
+		mongoConfig := &internal.MongoConfig{
+			Client:      mongoClient,
+			Database:    "waf",
+			Collection:  defaultLogCollection,
+			Spill:       globalConfig.Engine.LogSpill,
+			Aggregation: globalConfig.Engine.LogAggregation,
+		}
+		if appConfig.LogCollection != "" {
+			mongoConfig.Collection = appConfig.LogCollection
+		}
+
+		// 每个应用使用独立的限流命名空间
+		appFlowControllerConfig := flowControllerConfig
+		appFlowControllerConfig.Namespace = appConfig.Name
+
+		var auditLogConfig *internal.AuditLogConfig
+		if globalConfig.Engine.AuditLog.Enabled {
+			auditLogConfig = &internal.AuditLogConfig{
+				Client:   mongoClient,
+				Database: "waf",
+				AppName:  appConfig.Name,
+				Config:   globalConfig.Engine.AuditLog,
+			}
 		}
 
 		// 创建应用
-		application, err := internalAppConfig.NewApplicationWithContext(s.ctx, internal.ApplicationOptions{
+		application, err := internalAppConfig.NewApplicationWithContext(ctx, internal.ApplicationOptions{
 			MongoConfig:          mongoConfig,
 			GeoIPConfig:          &geoIPConfig,
 			RuleEngineDbConfig:   ruleEngineMongoConfig,
-			FlowControllerConfig: &flowControllerConfig,
+			FlowControllerConfig: &appFlowControllerConfig,
+			LogRedactor:          redactor,
+			DecisionLogConfig:    decisionLogConfig,
+			AuditLogConfig:       auditLogConfig,
+			LogSinks:             appConfig.LogSinks,
 		}, globalConfig.IsDebug)
-
 		if err != nil {
-			s.logger.Fatal().Err(err).Msg("Failed creating application: " + appConfig.Name)
-			return err
+			// 已创建的应用启动了日志存储、流量控制器等后台任务，全部关闭后再返回
+			// 关闭应用只释放共用的IP记录器的引用，不影响正在运行的应用
+			for _, app := range allApps {
+				app.Close()
+			}
+			return nil, fmt.Errorf("创建应用 %s 失败: %w", appConfig.Name, err)
 		}
 
 		allApps[appConfig.Name] = application
 	}
 
-	s.applications = allApps
-
-	// 如果服务正在运行，热更新Agent的应用
-	if s.state == ServerRunning && s.agent != nil && s.ctx != nil {
-		s.agent.ReplaceApplications(allApps)
-		s.logger.Info().Msg("应用配置已更新")
-	}
-
-	return nil
+	return allApps, nil
 }
 
 // UpdateNetworkAddress 更新网络地址 not support hot reload
@@ -385,6 +433,26 @@ func (s *AgentServerImpl) GetLastError() error {
 	return s.lastError
 }
 
+// GetAgentStats 获取 SPOE Agent 错误计数，服务未运行时返回零值
+func (s *AgentServerImpl) GetAgentStats() AgentStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.agent == nil {
+		return AgentStats{}
+	}
+	return s.agent.Stats()
+}
+
+// GetLogStoreStats 获取 WAF 日志存储计数，服务未运行时返回零值
+func (s *AgentServerImpl) GetLogStoreStats() LogStoreStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.agent == nil {
+		return LogStoreStats{}
+	}
+	return s.agent.LogStoreStats()
+}
+
 func (s *AgentServerImpl) GetLatestConfig() (*model.Config, error) {
 	if s.mongoURI == "" {
 		return nil, errors.New("mongoURI is required")
@@ -417,3 +485,167 @@ func (s *AgentServerImpl) GetLatestConfig() (*model.Config, error) {
 	}
 	return &cfg, nil
 }
+
+// ValidateConfig 预检配置，编译每个应用最终加载的指令但不创建应用
+// 用于保存配置前的校验，db 为存放自定义规则和规则排除的数据库
+func ValidateConfig(config *model.Config, db *mongo.Database) error {
+	if err := validateFallback(&config.Engine); err != nil {
+		return err
+	}
+	if _, err := internal.NewLogRedactor(config.Engine.LogRedaction); err != nil {
+		return fmt.Errorf("%w: 日志脱敏配置无效: %v", ErrInvalidAppConfig, err)
+	}
+	if err := internal.ValidateAuditLogConfig(config.Engine.AuditLog); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidAppConfig, err)
+	}
+	if err := internal.ValidateLogSpillConfig(config.Engine.LogSpill); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidAppConfig, err)
+	}
+	if err := internal.ValidateLogAggregationConfig(config.Engine.LogAggregation); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidAppConfig, err)
+	}
+	if err := validateLogSinks(config.Engine.AppConfig); err != nil {
+		return err
+	}
+	_, err := assembleDirectives(config, db)
+	return err
+}
+
+// ValidateRuleExclusions 预检规则排除，使用传入的规则排除代替已保存的规则排除组装并编译每个应用的指令
+// 用于保存规则排除前的校验，exclusions 为保存后将会加载的规则排除，需按创建时间排序
+func ValidateRuleExclusions(config *model.Config, db *mongo.Database, exclusions []model.RuleExclusion) error {
+	customRules, err := loadCustomRules(db)
+	if err != nil {
+		return err
+	}
+	_, err = renderDirectives(config, customRules, exclusions)
+	return err
+}
+
+// validateLogSinks 校验各应用的日志集合和日志输出配置
+func validateLogSinks(apps []model.AppConfig) error {
+	for _, appConfig := range apps {
+		if err := validateLogCollection(appConfig.LogCollection); err != nil {
+			return fmt.Errorf("%w: 应用 %s 的%v", ErrInvalidAppConfig, appConfig.Name, err)
+		}
+		for _, sink := range appConfig.LogSinks {
+			if err := internal.ValidateLogSinkConfig(sink); err != nil {
+				return fmt.Errorf("%w: 应用 %s 的%v", ErrInvalidAppConfig, appConfig.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// validateLogCollection 校验日志集合名称，为空时使用默认集合
+func validateLogCollection(name string) error {
+	if name == "" {
+		return nil
+	}
+	if len(name) > 120 || strings.ContainsAny(name, "$\x00") || strings.HasPrefix(name, "system.") {
+		return fmt.Errorf("日志集合名称无效: %q", name)
+	}
+	return nil
+}
+
+// validateFallback 校验默认应用和未知应用处理策略
+func validateFallback(engine *model.EngineConfig) error {
+	switch engine.UnknownAppPolicy {
+	case "", model.UnknownAppPolicyFailOpen, model.UnknownAppPolicyFailClosed:
+	default:
+		return fmt.Errorf("%w: 无效的未知应用处理策略: %s", ErrInvalidAppConfig, engine.UnknownAppPolicy)
+	}
+	if engine.DefaultApp == "" {
+		return nil
+	}
+	for _, appConfig := range engine.AppConfig {
+		if appConfig.Name == engine.DefaultApp {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: 默认应用 %s 不存在", ErrInvalidAppConfig, engine.DefaultApp)
+}
+
+// assembleDirectives 组装并编译每个应用最终加载的指令，返回应用名称到指令的映射
+// 指令依次由应用指令、CRS 结构化配置、自定义规则和规则排除组成，全局规则排除对自定义规则同样生效
+func assembleDirectives(config *model.Config, db *mongo.Database) (map[string]string, error) {
+	customRules, err := loadCustomRules(db)
+	if err != nil {
+		return nil, err
+	}
+	exclusions, err := loadRuleExclusions(db)
+	if err != nil {
+		return nil, err
+	}
+	return renderDirectives(config, customRules, exclusions)
+}
+
+// renderDirectives 使用给定的自定义规则和规则排除组装并编译每个应用的指令
+func renderDirectives(config *model.Config, customRules []model.CustomRule, exclusions []model.RuleExclusion) (map[string]string, error) {
+	result := make(map[string]string, len(config.Engine.AppConfig))
+	for _, appConfig := range config.Engine.AppConfig {
+		directives, err := secrule.ApplyCRSSettings(appConfig.Directives, appConfig.CRS, config.Engine.CRSPluginDir)
+		if err != nil {
+			return nil, fmt.Errorf("%w: 应用 %s 的CRS配置无效: %v", ErrInvalidAppConfig, appConfig.Name, err)
+		}
+		directives = secrule.ApplyCustomRules(directives, customRules, appConfig.Name)
+		directives = secrule.ApplyExclusions(directives, exclusions)
+
+		if err := (internal.AppConfig{Directives: directives}).Validate(); err != nil {
+			return nil, fmt.Errorf("%w: 应用 %s 的指令无效: %v", ErrInvalidAppConfig, appConfig.Name, err)
+		}
+		result[appConfig.Name] = directives
+	}
+	return result, nil
+}
+
+// loadCustomRules 加载已启用的自定义规则，按优先级和创建时间排序，即组装到应用中的顺序
+func loadCustomRules(db *mongo.Database) ([]model.CustomRule, error) {
+	var rule model.CustomRule
+	collection := db.Collection(rule.GetCollectionName())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cursor, err := collection.Find(
+		ctx,
+		bson.D{{Key: "enabled", Value: true}},
+		options.Find().SetSort(bson.D{{Key: "priority", Value: 1}, {Key: "createdAt", Value: 1}, {Key: "_id", Value: 1}}),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("查询自定义规则失败: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var rules []model.CustomRule
+	if err := cursor.All(ctx, &rules); err != nil {
+		return nil, fmt.Errorf("解码自定义规则失败: %w", err)
+	}
+	return rules, nil
+}
+
+// loadRuleExclusions 加载已启用的规则排除，按创建时间排序以保证生成的规则ID稳定
+// 无效的规则排除在渲染时跳过
+func loadRuleExclusions(db *mongo.Database) ([]model.RuleExclusion, error) {
+	var exclusion model.RuleExclusion
+	collection := db.Collection(exclusion.GetCollectionName())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cursor, err := collection.Find(
+		ctx,
+		bson.D{{Key: "enabled", Value: true}},
+		options.Find().SetSort(bson.D{{Key: "createdAt", Value: 1}, {Key: "_id", Value: 1}}),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("查询规则排除失败: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var exclusions []model.RuleExclusion
+	if err := cursor.All(ctx, &exclusions); err != nil {
+		return nil, fmt.Errorf("解码规则排除失败: %w", err)
+	}
+	return exclusions, nil
+}
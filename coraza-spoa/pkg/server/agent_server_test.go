@@ -0,0 +1,299 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+
+	"github.com/HUAHUAI23/simple-waf/coraza-spoa/internal"
+	"github.com/HUAHUAI23/simple-waf/pkg/model"
+)
+
+// syncBuffer 可并发写入的日志缓冲区
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// testApp 测试用的应用，日志存储关闭时写入的日志用于判断应用是否已关闭
+type testApp struct {
+	app *internal.Application
+	log *syncBuffer
+}
+
+func (a testApp) closed() bool {
+	return strings.Contains(a.log.String(), "关闭日志存储")
+}
+
+// newTestApps 创建使用 MongoDB 日志存储的应用，不连接数据库
+// 日志存储关闭需等待后台协程的下一个调整周期，测试结束时不关闭应用
+func newTestApps(t *testing.T, names ...string) (map[string]*internal.Application, map[string]testApp) {
+	t.Helper()
+	client, err := mongo.Connect()
+	if err != nil {
+		t.Fatalf("创建客户端失败: %v", err)
+	}
+
+	apps := make(map[string]*internal.Application, len(names))
+	tracked := make(map[string]testApp, len(names))
+	for _, name := range names {
+		log := &syncBuffer{}
+		app, err := internal.AppConfig{
+			Name:       name,
+			Directives: "SecRuleEngine On",
+			Logger:     zerolog.New(log),
+		}.NewApplicationWithContext(context.Background(), internal.ApplicationOptions{
+			MongoConfig: &internal.MongoConfig{Client: client, Database: "waf", Collection: "test"},
+		}, false)
+		if err != nil {
+			t.Fatalf("创建应用 %s 失败: %v", name, err)
+		}
+		apps[name] = app
+		tracked[name] = testApp{app: app, log: log}
+	}
+	return apps, tracked
+}
+
+// newTestServer 创建使用给定配置和应用创建函数的服务
+func newTestServer(config *model.Config, build func(context.Context, *model.Config) (map[string]*internal.Application, error)) *AgentServerImpl {
+	return &AgentServerImpl{
+		logger:     zerolog.Nop(),
+		state:      ServerStopped,
+		loadConfig: func() (*model.Config, error) { return config, nil },
+		build:      build,
+	}
+}
+
+// TestUpdateApplicationsRollback 测试重新加载失败时保留正在运行的应用，不关闭任何应用
+func TestUpdateApplicationsRollback(t *testing.T) {
+	running, tracked := newTestApps(t, "a", "b")
+	buildErr := errors.New("创建应用 b 失败")
+
+	tests := []struct {
+		name   string
+		server *AgentServerImpl
+	}{
+		{
+			name: "获取配置失败",
+			server: &AgentServerImpl{
+				logger:     zerolog.Nop(),
+				loadConfig: func() (*model.Config, error) { return nil, buildErr },
+			},
+		},
+		{
+			name: "创建应用失败",
+			server: newTestServer(&model.Config{}, func(context.Context, *model.Config) (map[string]*internal.Application, error) {
+				return nil, buildErr
+			}),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := tt.server
+			s.state = ServerRunning
+			s.ctx = context.Background()
+			s.applications = running
+			s.agent = &internal.Agent{Context: s.ctx, Applications: running, Logger: zerolog.Nop()}
+
+			err := s.UpdateApplications()
+			if !errors.Is(err, buildErr) || !errors.Is(s.GetLastError(), buildErr) {
+				t.Fatalf("UpdateApplications() = %v，期望返回并记录创建失败的错误", err)
+			}
+			if len(s.applications) != 2 || s.applications["a"] != running["a"] || s.agent.Applications["b"] != running["b"] {
+				t.Error("重新加载失败时应保留正在运行的应用")
+			}
+			for name, app := range tracked {
+				if app.closed() {
+					t.Errorf("重新加载失败时关闭了正在运行的应用 %s", name)
+				}
+			}
+		})
+	}
+}
+
+// TestUpdateApplicationsReload 测试运行中热更新时旧应用交给 Agent 排空，未运行时直接关闭旧应用
+func TestUpdateApplicationsReload(t *testing.T) {
+	config := &model.Config{}
+	config.Engine.DefaultApp = "b"
+	config.Engine.UnknownAppPolicy = model.UnknownAppPolicyFailOpen
+
+	t.Run("运行中", func(t *testing.T) {
+		old, oldTracked := newTestApps(t, "a")
+		next, _ := newTestApps(t, "a", "b")
+		s := newTestServer(config, func(context.Context, *model.Config) (map[string]*internal.Application, error) {
+			return next, nil
+		})
+		s.state = ServerRunning
+		s.ctx = context.Background()
+		s.applications = old
+		s.agent = &internal.Agent{Context: s.ctx, Applications: old, Logger: zerolog.Nop()}
+
+		if err := s.UpdateApplications(); err != nil {
+			t.Fatalf("重新加载失败: %v", err)
+		}
+		if s.applications["b"] != next["b"] || s.agent.Applications["a"] != next["a"] {
+			t.Error("重新加载后应使用新应用")
+		}
+		if s.agent.DefaultApp != "b" || !s.agent.FailOpen {
+			t.Errorf("默认应用和未知应用处理策略未更新: %q, %v", s.agent.DefaultApp, s.agent.FailOpen)
+		}
+		if oldTracked["a"].closed() {
+			t.Error("旧应用应在排空后关闭，不应立即关闭")
+		}
+	})
+
+	t.Run("未运行", func(t *testing.T) {
+		old, oldTracked := newTestApps(t, "a")
+		next, nextTracked := newTestApps(t, "a")
+		s := newTestServer(config, func(context.Context, *model.Config) (map[string]*internal.Application, error) {
+			return next, nil
+		})
+		s.applications = old
+
+		if err := s.UpdateApplications(); err != nil {
+			t.Fatalf("重新加载失败: %v", err)
+		}
+		if s.applications["a"] != next["a"] {
+			t.Error("重新加载后应使用新应用")
+		}
+		if !oldTracked["a"].closed() || nextTracked["a"].closed() {
+			t.Error("未运行时应关闭旧应用并保留新应用")
+		}
+	})
+}
+
+// TestValidateFallback 测试默认应用和未知应用处理策略的校验
+func TestValidateFallback(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  string
+		app     string
+		wantErr bool
+	}{
+		{"未配置", "", "", false},
+		{"放行未知应用", model.UnknownAppPolicyFailOpen, "", false},
+		{"默认应用存在", model.UnknownAppPolicyFailClosed, "a", false},
+		{"无效的处理策略", "drop", "", true},
+		{"默认应用不存在", "", "c", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			engine := &model.EngineConfig{
+				UnknownAppPolicy: tt.policy,
+				DefaultApp:       tt.app,
+				AppConfig:        []model.AppConfig{{Name: "a"}, {Name: "b"}},
+			}
+			err := validateFallback(engine)
+			if (err != nil) != tt.wantErr || (err != nil && !errors.Is(err, ErrInvalidAppConfig)) {
+				t.Errorf("validateFallback() = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// TestValidateLogSinks 测试日志集合名称和日志输出配置的校验
+func TestValidateLogSinks(t *testing.T) {
+	tests := []struct {
+		name    string
+		app     model.AppConfig
+		wantErr bool
+	}{
+		{"使用默认集合", model.AppConfig{Name: "a"}, false},
+		{"自定义集合", model.AppConfig{Name: "a", LogCollection: "waf_logs_a"}, false},
+		{"集合名称包含 $", model.AppConfig{Name: "a", LogCollection: "waf$logs"}, true},
+		{"系统集合", model.AppConfig{Name: "a", LogCollection: "system.users"}, true},
+		{"集合名称过长", model.AppConfig{Name: "a", LogCollection: strings.Repeat("a", 121)}, true},
+		{"未启用的日志输出不校验", model.AppConfig{Name: "a", LogSinks: []model.LogSinkConfig{{Name: "file", Type: model.LogSinkFile}}}, false},
+		{"日志输出缺少文件路径", model.AppConfig{Name: "a", LogSinks: []model.LogSinkConfig{{Name: "file", Type: model.LogSinkFile, Enabled: true}}}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateLogSinks([]model.AppConfig{{Name: "ok"}, tt.app})
+			if (err != nil) != tt.wantErr || (err != nil && !errors.Is(err, ErrInvalidAppConfig)) {
+				t.Errorf("validateLogSinks() = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// TestRenderDirectives 测试自定义规则按应用追加，全局规则排除位于自定义规则之后，无效指令返回 ErrInvalidAppConfig
+func TestRenderDirectives(t *testing.T) {
+	config := &model.Config{}
+	config.Engine.AppConfig = []model.AppConfig{
+		{Name: "a", Directives: "SecRuleEngine On"},
+		{Name: "b", Directives: "SecRuleEngine On"},
+	}
+	customRules := []model.CustomRule{
+		{Name: "所有应用", Enabled: true, Directives: `SecRule ARGS "@contains attack" "id:10001,phase:2,deny,status:403"`},
+		{Name: "只对 a 生效", Enabled: true, Apps: []string{"a"}, Directives: `SecRule ARGS "@contains probe" "id:10002,phase:2,deny,status:403"`},
+	}
+	exclusions := []model.RuleExclusion{
+		{Name: "排除自定义规则", Enabled: true, Type: model.ExclusionRemoveTargetID, RuleIDs: []string{"10001"}, Targets: []string{"ARGS:q"}},
+	}
+
+	directives, err := renderDirectives(config, customRules, exclusions)
+	if err != nil {
+		t.Fatalf("组装指令失败: %v", err)
+	}
+	rule := strings.Index(directives["a"], "id:10001")
+	exclusion := strings.Index(directives["a"], "SecRuleUpdateTargetById 10001 !ARGS:q")
+	if rule < 0 || exclusion < rule {
+		t.Errorf("应用 a 的规则排除应位于自定义规则之后:\n%s", directives["a"])
+	}
+	if strings.Contains(directives["b"], "id:10002") {
+		t.Errorf("自定义规则不应对应用 b 生效:\n%s", directives["b"])
+	}
+
+	// 排除的目标规则不存在时编译失败
+	if _, err := renderDirectives(config, customRules[1:], exclusions); !errors.Is(err, ErrInvalidAppConfig) {
+		t.Errorf("排除不存在的规则应返回 ErrInvalidAppConfig，实际为 %v", err)
+	}
+}
+
+// TestStartListenFailure 测试创建应用后监听失败时关闭已创建的应用
+func TestStartListenFailure(t *testing.T) {
+	occupied, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("创建监听器失败: %v", err)
+	}
+	defer occupied.Close()
+
+	config := &model.Config{}
+	config.Engine.Bind = occupied.Addr().String()
+	apps, tracked := newTestApps(t, "a")
+	s := newTestServer(config, func(context.Context, *model.Config) (map[string]*internal.Application, error) {
+		return apps, nil
+	})
+
+	if err := s.Start(); err == nil {
+		t.Fatal("地址已被占用时启动应失败")
+	}
+	if s.GetState() != ServerError || s.GetLastError() == nil || s.ctx != nil {
+		t.Errorf("启动失败后状态为 %v，错误为 %v", s.GetState(), s.GetLastError())
+	}
+	if s.applications != nil || !tracked["a"].closed() {
+		t.Error("启动失败时应关闭已创建的应用")
+	}
+}
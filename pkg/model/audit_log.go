@@ -0,0 +1,74 @@
+package model
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// AuditLog 表示 Coraza 审计日志
+// @Description 单个事务的完整审计记录，包含请求、响应、匹配规则和异常评分，用于取证回放。记录在 expireAt 之后由 TTL 索引自动删除
+type AuditLog struct {
+	ID              bson.ObjectID     `bson:"_id,omitempty" json:"id,omitempty"`                         // 记录唯一标识符
+	RequestID       string            `json:"requestId" bson:"requestId" example:"a1b2c3d4e5f6"`         // 请求唯一标识，与 WAF 日志的 requestId 一致
+	AppName         string            `json:"appName" bson:"appName" example:"coraza"`                   // 处理该请求的应用
+	Parts           string            `json:"parts" bson:"parts" example:"ABCFHKZ"`                      // 记录的审计日志部分
+	ClientIP        string            `json:"clientIp" bson:"clientIp" example:"192.168.1.1"`            // 客户端IP
+	ClientPort      int               `json:"clientPort" bson:"clientPort" example:"52134"`              // 客户端端口
+	HostIP          string            `json:"hostIp" bson:"hostIp" example:"10.0.0.1"`                   // 服务端IP
+	HostPort        int               `json:"hostPort" bson:"hostPort" example:"443"`                    // 服务端端口
+	Interrupted     bool              `json:"interrupted" bson:"interrupted" example:"true"`             // 事务是否被中断
+	HighestSeverity string            `json:"highestSeverity" bson:"highestSeverity" example:"critical"` // 匹配规则的最高严重级别
+	Request         *AuditLogRequest  `json:"request,omitempty" bson:"request,omitempty"`                // 请求信息
+	Response        *AuditLogResponse `json:"response,omitempty" bson:"response,omitempty"`              // 响应信息
+	Messages        []AuditLogMessage `json:"messages" bson:"messages"`                                  // 匹配规则
+	AnomalyScores   map[string]int    `json:"anomalyScores,omitempty" bson:"anomalyScores,omitempty"`    // CRS 异常评分，键为 TX 变量名称
+	CreatedAt       time.Time         `json:"createdAt" bson:"createdAt" example:"2024-03-18T08:12:33Z"` // 事务时间
+	ExpireAt        time.Time         `json:"expireAt" bson:"expireAt" example:"2024-03-25T08:12:33Z"`   // 过期时间
+}
+
+// AuditLogRequest 审计日志中的请求信息
+// @Description 请求行、请求头和请求体，请求体超过长度限制时截断
+type AuditLogRequest struct {
+	Method        string              `json:"method" bson:"method" example:"POST"`                    // 请求方法
+	URI           string              `json:"uri" bson:"uri" example:"/login?next=/"`                 // 请求URI
+	Protocol      string              `json:"protocol" bson:"protocol" example:"HTTP/1.1"`            // 协议
+	Headers       map[string][]string `json:"headers,omitempty" bson:"headers,omitempty"`             // 请求头（B 部分）
+	Body          string              `json:"body,omitempty" bson:"body,omitempty"`                   // 请求体（C 部分）
+	BodyTruncated bool                `json:"bodyTruncated,omitempty" bson:"bodyTruncated,omitempty"` // 请求体是否被截断
+	Length        int32               `json:"length" bson:"length" example:"512"`                     // 请求总长度
+	Files         []AuditLogFile      `json:"files,omitempty" bson:"files,omitempty"`                 // 上传文件（J 部分）
+}
+
+// AuditLogFile 审计日志中的上传文件
+type AuditLogFile struct {
+	Name string `json:"name" bson:"name" example:"avatar.png"` // 文件名
+	Size int64  `json:"size" bson:"size" example:"1024"`       // 文件大小
+	Mime string `json:"mime" bson:"mime" example:"image/png"`  // 文件类型
+}
+
+// AuditLogResponse 审计日志中的响应信息
+// @Description 响应状态、响应头和响应体，响应体超过长度限制时截断
+type AuditLogResponse struct {
+	Protocol      string              `json:"protocol" bson:"protocol" example:"HTTP/1.1"`            // 协议
+	Status        int                 `json:"status" bson:"status" example:"403"`                     // 状态码
+	Headers       map[string][]string `json:"headers,omitempty" bson:"headers,omitempty"`             // 响应头（F 部分）
+	Body          string              `json:"body,omitempty" bson:"body,omitempty"`                   // 响应体（E 部分）
+	BodyTruncated bool                `json:"bodyTruncated,omitempty" bson:"bodyTruncated,omitempty"` // 响应体是否被截断
+}
+
+// AuditLogMessage 审计日志中的规则匹配记录
+type AuditLogMessage struct {
+	RuleID   int      `json:"ruleId" bson:"ruleId" example:"942100"`                                 // 规则ID
+	Message  string   `json:"message" bson:"message" example:"SQL Injection Attack Detected"`        // 规则消息
+	Data     string   `json:"data" bson:"data" example:"Matched Data: ' or 1=1 found within ARGS:q"` // 匹配数据
+	Severity int      `json:"severity" bson:"severity" example:"2"`                                  // 严重级别(0-7)
+	Tags     []string `json:"tags,omitempty" bson:"tags,omitempty"`                                  // 规则标签
+	File     string   `json:"file,omitempty" bson:"file,omitempty"`                                  // 规则文件
+	Line     int      `json:"line,omitempty" bson:"line,omitempty"`                                  // 规则所在行
+}
+
+// GetCollectionName 返回AuditLog对应的MongoDB集合名称
+func (auditLog *AuditLog) GetCollectionName() string {
+	return "waf_audit_log"
+}
@@ -2,14 +2,25 @@ package model
 
 import "time"
 
+// 封禁记录类型
+const (
+	BlockTypeIP     = "ip"     // 单个IP
+	BlockTypePrefix = "prefix" // 网段升级封禁
+	BlockTypeASN    = "asn"    // 按ASN升级封禁
+)
+
 // BlockedIPRecord IP封禁记录
 // @Description 被封禁的IP记录信息
 type BlockedIPRecord struct {
-	IP           string    `bson:"ip" json:"ip" example:"192.168.1.1" description:"被封禁的IP地址"`
+	IP           string    `bson:"ip" json:"ip" example:"192.168.1.1" description:"被封禁的IP地址，网段封禁时为CIDR"`
+	Type         string    `bson:"type" json:"type" example:"ip" description:"封禁类型：ip 单个IP，prefix 网段升级，asn 按ASN升级"`
+	ASN          uint      `bson:"asn,omitempty" json:"asn,omitempty" example:"13335" description:"按ASN升级封禁时的ASN编号"`
+	IPCount      int       `bson:"ip_count,omitempty" json:"ipCount,omitempty" example:"12" description:"触发网段升级时窗口内被封禁的不同IP数"`
 	Reason       string    `bson:"reason" json:"reason" example:"high_frequency_attack" description:"封禁原因"`
 	RequestUri   string    `bson:"request_uri" json:"requestUri" example:"/api/v1/login" description:"请求URI"`
 	BlockedAt    time.Time `bson:"blocked_at" json:"blockedAt" description:"封禁开始时间"`
 	BlockedUntil time.Time `bson:"blocked_until" json:"blockedUntil" description:"封禁结束时间"`
+	Simulated    bool      `bson:"simulated" json:"simulated" example:"false" description:"是否为监控模式下的模拟封禁，模拟封禁不会拦截请求"`
 }
 
 func (b *BlockedIPRecord) GetCollectionName() string {
@@ -1,6 +1,7 @@
 package model
 
 import (
+	"strings"
 	"time"
 )
 
@@ -20,23 +21,184 @@ type Config struct {
 // EngineConfig 引擎配置
 //	@Description	WAF引擎配置信息
 type EngineConfig struct {
-	Bind            string            `bson:"bind" json:"bind" example:"0.0.0.0:9000" description:"绑定地址"`
-	UseBuiltinRules bool              `bson:"useBuiltinRules" json:"useBuiltinRules" description:"是否使用内置规则"`
-	ASNDBPath       string            `bson:"asnDBPath" json:"asnDBPath" example:"/opt/geoip/GeoLite2-ASN.mmdb" description:"ASN数据库路径"`
-	CityDBPath      string            `bson:"cityDBPath" json:"cityDBPath" example:"/opt/geoip/GeoLite2-City.mmdb" description:"城市数据库路径"`
-	AppConfig       []AppConfig       `bson:"appConfig" json:"appConfig" description:"应用配置列表"`
-	FlowController  FlowControlConfig `bson:"flowController" json:"flowController" description:"流量控制配置"`
+	Bind             string               `bson:"bind" json:"bind" example:"0.0.0.0:9000" description:"绑定地址"`
+	UseBuiltinRules  bool                 `bson:"useBuiltinRules" json:"useBuiltinRules" description:"是否使用内置规则"`
+	ASNDBPath        string               `bson:"asnDBPath" json:"asnDBPath" example:"/opt/geoip/GeoLite2-ASN.mmdb" description:"ASN数据库路径"`
+	CityDBPath       string               `bson:"cityDBPath" json:"cityDBPath" example:"/opt/geoip/GeoLite2-City.mmdb" description:"城市数据库路径"`
+	CRSPluginDir     string               `bson:"crsPluginDir" json:"crsPluginDir" example:"/opt/crs-plugins" description:"CRS插件目录"`
+	DefaultApp       string               `bson:"defaultApp" json:"defaultApp" example:"coraza" description:"默认应用，SPOE消息缺少或使用未知应用名称时使用"`
+	UnknownAppPolicy string               `bson:"unknownAppPolicy" json:"unknownAppPolicy" example:"fail_closed" description:"未配置默认应用时对未知应用请求的处理策略"`
+	AppConfig        []AppConfig          `bson:"appConfig" json:"appConfig" description:"应用配置列表"`
+	FlowController   FlowControlConfig    `bson:"flowController" json:"flowController" description:"流量控制配置"`
+	LogRedaction     LogRedactionConfig   `bson:"logRedaction" json:"logRedaction" description:"WAF日志脱敏配置"`
+	DecisionLog      DecisionLogConfig    `bson:"decisionLog" json:"decisionLog" description:"流控与封禁IP决策记录配置"`
+	AuditLog         AuditLogConfig       `bson:"auditLog" json:"auditLog" description:"Coraza审计日志配置"`
+	LogSpill         LogSpillConfig       `bson:"logSpill" json:"logSpill" description:"WAF日志磁盘溢出队列配置"`
+	LogAggregation   LogAggregationConfig `bson:"logAggregation" json:"logAggregation" description:"WAF日志聚合与采样配置"`
+}
+
+// LogAggregationConfig WAF日志聚合与采样配置
+//	@Description	窗口内来源IP、规则ID、URI、引擎、域名、目标端口、决策模式和处置动作相同的日志合并为一条记录，记录事件数和首次、最后一次事件时间。每秒新建的记录超过上限后按概率采样，保留的记录按采样率放大事件数
+type LogAggregationConfig struct {
+	Enabled      bool `bson:"enabled" json:"enabled" example:"true" description:"是否启用日志聚合"`
+	Window       int  `bson:"window" json:"window" example:"10" description:"聚合窗口（秒），为 0 时使用 10"`
+	MaxPerSecond int  `bson:"maxPerSecond" json:"maxPerSecond" example:"200" description:"每秒新建记录数上限，超过后按概率采样，为 0 时不采样"`
+	MaxKeys      int  `bson:"maxKeys" json:"maxKeys" example:"10000" description:"同时聚合的最大记录数，超过后新的日志不聚合直接写入，为 0 时使用 10000"`
+}
+
+// LogSpillConfig WAF日志磁盘溢出队列配置
+//	@Description	MongoDB 写入失败或超时时，WAF 日志写入磁盘上的分段文件，恢复后按写入顺序回放。队列达到最大大小后丢弃新的日志
+type LogSpillConfig struct {
+	Enabled     bool   `bson:"enabled" json:"enabled" example:"true" description:"是否启用磁盘溢出队列"`
+	Dir         string `bson:"dir" json:"dir" example:"/var/lib/simple-waf/log-spill" description:"分段文件目录"`
+	MaxSize     int    `bson:"maxSize" json:"maxSize" example:"1024" description:"队列的最大大小（MB），为 0 时使用 1024"`
+	SegmentSize int    `bson:"segmentSize" json:"segmentSize" example:"16" description:"单个分段文件的最大大小（MB），为 0 时使用 16"`
+}
+
+// AuditLogConfig Coraza审计日志配置
+//	@Description	以 SecAuditEngine RelevantOnly 方式记录相关事务的完整审计日志，写入独立集合并按保留天数自动过期
+type AuditLogConfig struct {
+	Enabled       bool   `bson:"enabled" json:"enabled" example:"true" description:"是否记录审计日志"`
+	Parts         string `bson:"parts" json:"parts" example:"ABCFHKZ" description:"记录的审计日志部分，以 A 开头、Z 结尾"`
+	BodyLimit     int    `bson:"bodyLimit" json:"bodyLimit" example:"65536" description:"请求体和响应体的最大记录长度（字节），为 0 时不限制"`
+	RetentionDays int    `bson:"retentionDays" json:"retentionDays" example:"7" description:"保留天数"`
+}
+
+// GetDefaultAuditLogConfig 返回默认的审计日志配置
+func GetDefaultAuditLogConfig() AuditLogConfig {
+	return AuditLogConfig{
+		Enabled:       true,
+		Parts:         "ABCFHKZ",
+		BodyLimit:     64 * 1024,
+		RetentionDays: 7,
+	}
+}
+
+// DecisionLogConfig 流控与封禁IP决策记录配置
+//	@Description	流量控制和封禁IP拒绝的请求写入 WAF 日志，泛洪时按采样率记录。Coraza 和微引擎的拦截始终全部记录
+type DecisionLogConfig struct {
+	Enabled    bool    `bson:"enabled" json:"enabled" example:"true" description:"是否记录流控与封禁IP决策"`
+	SampleRate float64 `bson:"sampleRate" json:"sampleRate" example:"0.1" description:"采样率(0-1]，为 0 时全部记录"`
+}
+
+// 日志脱敏方式，为空时按 mask 处理
+const (
+	RedactionModeMask = "mask" // 替换为固定掩码
+	RedactionModeHash = "hash" // 替换为 SHA-256 摘要前缀，相同的值得到相同的结果，便于关联
+)
+
+// LogRedactionConfig WAF日志脱敏配置
+//	@Description	攻击日志写入存储前按请求头名称、JSON/表单字段名称和正则表达式脱敏
+type LogRedactionConfig struct {
+	Enabled  bool               `bson:"enabled" json:"enabled" example:"true" description:"是否启用脱敏"`
+	Mode     string             `bson:"mode" json:"mode" example:"mask" description:"脱敏方式：mask 掩码，hash 摘要"`
+	HashKey  string             `bson:"hashKey" json:"hashKey" description:"hash 方式的 HMAC 密钥，为空时使用 SHA-256"`
+	Headers  []string           `bson:"headers" json:"headers" example:"Authorization,Cookie" description:"脱敏的请求头名称，不区分大小写"`
+	Fields   []string           `bson:"fields" json:"fields" example:"password,token" description:"脱敏的 JSON/表单/查询参数字段名称，不区分大小写"`
+	Patterns []RedactionPattern `bson:"patterns" json:"patterns" description:"脱敏的正则表达式，匹配的内容整体替换"`
+}
+
+// RedactionPattern 正则脱敏规则
+//	@Description	按正则表达式脱敏，如银行卡号、身份证号
+type RedactionPattern struct {
+	Name    string `bson:"name" json:"name" example:"card_number" description:"规则名称"`
+	Pattern string `bson:"pattern" json:"pattern" example:"\\b[3-6]\\d{3}(?:[ -]?\\d{4}){3}\\b" description:"正则表达式（RE2 语法）"`
 }
 
 // AppConfig 应用配置
 //	@Description	WAF应用配置
 type AppConfig struct {
-	Name           string        `bson:"name" json:"name" example:"default" description:"应用名称"`
-	Directives     string        `bson:"directives" json:"directives" description:"Coraza指令"`
-	TransactionTTL time.Duration `bson:"transactionTTL" json:"transactionTTL" example:"10s" description:"事务超时时间"`
-	LogLevel       string        `bson:"logLevel" json:"logLevel" example:"info" description:"日志级别"`
-	LogFile        string        `bson:"logFile" json:"logFile" example:"/var/log/waf.log" description:"日志文件路径"`
-	LogFormat      string        `bson:"logFormat" json:"logFormat" example:"json" description:"日志格式"`
+	Name           string          `bson:"name" json:"name" example:"default" description:"应用名称"`
+	Directives     string          `bson:"directives" json:"directives" description:"Coraza指令"`
+	TransactionTTL time.Duration   `bson:"transactionTTL" json:"transactionTTL" example:"10s" description:"事务超时时间"`
+	LogLevel       string          `bson:"logLevel" json:"logLevel" example:"info" description:"日志级别"`
+	LogFile        string          `bson:"logFile" json:"logFile" example:"/var/log/waf.log" description:"日志文件路径"`
+	LogFormat      string          `bson:"logFormat" json:"logFormat" example:"json" description:"日志格式"`
+	CRS            CRSSettings     `bson:"crs" json:"crs" description:"CRS结构化配置"`
+	LogSinks       []LogSinkConfig `bson:"logSinks" json:"logSinks" description:"WAF日志的额外输出"`
+	LogCollection  string          `bson:"logCollection" json:"logCollection" example:"waf_log_tenant_a" description:"WAF日志写入的集合，为空时使用默认集合 waf_log"`
+}
+
+// 日志输出类型
+const (
+	LogSinkSyslog  = "syslog"  // RFC 5424 syslog
+	LogSinkFile    = "file"    // 按行写入 JSON 的本地文件
+	LogSinkWebhook = "webhook" // HTTP webhook
+)
+
+// syslog 消息内容格式
+const (
+	SyslogFormatJSON = "json" // WAF 日志的 JSON
+	SyslogFormatCEF  = "cef"  // ArcSight Common Event Format
+	SyslogFormatLEEF = "leef" // QRadar Log Event Extended Format
+)
+
+// LogSinkConfig WAF日志输出配置
+//	@Description	WAF日志写入 MongoDB 的同时转发到 SIEM 等外部系统，与 MongoDB 共用日志缓冲。按 type 使用对应的子配置
+type LogSinkConfig struct {
+	Name    string            `bson:"name" json:"name" example:"soc-syslog" description:"输出名称"`
+	Type    string            `bson:"type" json:"type" example:"syslog" description:"输出类型：syslog、file 或 webhook"`
+	Enabled bool              `bson:"enabled" json:"enabled" example:"true" description:"是否启用"`
+	Syslog  SyslogSinkConfig  `bson:"syslog" json:"syslog" description:"syslog 输出配置"`
+	File    FileSinkConfig    `bson:"file" json:"file" description:"文件输出配置"`
+	Webhook WebhookSinkConfig `bson:"webhook" json:"webhook" description:"webhook 输出配置"`
+}
+
+// SyslogSinkConfig syslog 输出配置
+//	@Description	按 RFC 5424 发送 syslog 消息，TCP 和 TLS 使用八位组计数分帧
+type SyslogSinkConfig struct {
+	Network            string `bson:"network" json:"network" example:"tcp" description:"传输协议：udp、tcp 或 tls"`
+	Address            string `bson:"address" json:"address" example:"siem.example.com:514" description:"syslog 服务器地址"`
+	Format             string `bson:"format" json:"format" example:"cef" description:"消息内容格式：json、cef 或 leef，为空时使用 json"`
+	Facility           int    `bson:"facility" json:"facility" example:"16" description:"syslog facility(0-23)，为 0 时使用 local0(16)"`
+	InsecureSkipVerify bool   `bson:"insecureSkipVerify" json:"insecureSkipVerify" example:"false" description:"tls 传输时是否跳过服务器证书校验"`
+}
+
+// FileSinkConfig 文件输出配置
+//	@Description	每行写入一条 JSON 格式的 WAF 日志，文件超过最大大小时轮转为 <path>.1，已有的备份依次后移
+type FileSinkConfig struct {
+	Path       string `bson:"path" json:"path" example:"/var/log/waf/events.ndjson" description:"文件路径"`
+	MaxSize    int    `bson:"maxSize" json:"maxSize" example:"100" description:"单个文件的最大大小（MB），为 0 时使用 100"`
+	MaxBackups int    `bson:"maxBackups" json:"maxBackups" example:"5" description:"保留的轮转文件数，为 0 时使用 5"`
+}
+
+// WebhookSinkConfig webhook 输出配置
+//	@Description	以 JSON 数组批量 POST WAF 日志，网络错误、429 和 5xx 响应按指数退避重试
+type WebhookSinkConfig struct {
+	URL        string            `bson:"url" json:"url" example:"https://siem.example.com/ingest" description:"接收地址"`
+	Headers    map[string]string `bson:"headers" json:"headers" description:"附加的请求头，如认证令牌"`
+	BatchSize  int               `bson:"batchSize" json:"batchSize" example:"100" description:"单次请求的最大日志数，为 0 时使用 100"`
+	Timeout    int64             `bson:"timeout" json:"timeout" example:"5000" description:"单次请求超时时间（毫秒），为 0 时使用 5000"`
+	MaxRetries int               `bson:"maxRetries" json:"maxRetries" example:"3" description:"失败后的最大重试次数"`
+}
+
+// CRSSettings OWASP CRS 结构化配置
+//	@Description	OWASP CRS 结构化配置，渲染为 SecAction setvar 指令并插入到 CRS 规则之前，优先于指令中的同名变量。零值表示使用 CRS 默认值
+type CRSSettings struct {
+	BlockingParanoiaLevel    int      `bson:"blockingParanoiaLevel" json:"blockingParanoiaLevel" example:"1" description:"拦截偏执等级(1-4)"`
+	DetectionParanoiaLevel   int      `bson:"detectionParanoiaLevel" json:"detectionParanoiaLevel" example:"2" description:"检测偏执等级(1-4)，不低于拦截偏执等级，高出的等级只记录不计分"`
+	InboundAnomalyThreshold  int      `bson:"inboundAnomalyThreshold" json:"inboundAnomalyThreshold" example:"5" description:"请求异常分数阈值"`
+	OutboundAnomalyThreshold int      `bson:"outboundAnomalyThreshold" json:"outboundAnomalyThreshold" example:"4" description:"响应异常分数阈值"`
+	WarningAnomalyScore      int      `bson:"warningAnomalyScore" json:"warningAnomalyScore" example:"3" description:"告警分数，未被拦截的请求或响应异常分数达到该值时记录为 near_miss，为 0 时不记录"`
+	AllowedMethods           []string `bson:"allowedMethods" json:"allowedMethods" example:"GET,HEAD,POST" description:"允许的请求方法"`
+	AllowedContentTypes      []string `bson:"allowedContentTypes" json:"allowedContentTypes" example:"application/json" description:"允许的请求内容类型"`
+	RestrictedExtensions     []string `bson:"restrictedExtensions" json:"restrictedExtensions" example:".bak,.sql" description:"禁止访问的文件扩展名，CRS 以禁止列表的形式限制扩展名"`
+	DisabledRuleFamilies     []string `bson:"disabledRuleFamilies" json:"disabledRuleFamilies" example:"scanner-detection,java" description:"禁用的CRS规则族"`
+	Plugins                  []string `bson:"plugins" json:"plugins" example:"wordpress-rule-exclusions" description:"启用的CRS插件，从CRS插件目录加载"`
+}
+
+// GetDefaultLogRedactionConfig 返回默认的日志脱敏配置
+func GetDefaultLogRedactionConfig() LogRedactionConfig {
+	return LogRedactionConfig{
+		Enabled: true,
+		Mode:    RedactionModeMask,
+		Headers: []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie", "X-Api-Key"},
+		Fields:  []string{"password", "passwd", "pwd", "secret", "token", "access_token", "refresh_token", "api_key"},
+		Patterns: []RedactionPattern{
+			{Name: "card_number", Pattern: `\b[3-6]\d{3}(?:[ -]?\d{4}){3}\b`},
+			{Name: "cn_national_id", Pattern: `\b[1-9]\d{5}(?:19|20)\d{2}(?:0[1-9]|1[0-2])(?:0[1-9]|[12]\d|3[01])\d{3}[\dXx]\b`},
+		},
+	}
 }
 
 // HaproxyConfig HAProxy配置
@@ -48,6 +210,63 @@ type HaproxyConfig struct {
 	SpoeAgentAddr string `bson:"spoeAgentAddr" json:"spoeAgentAddr" example:"127.0.0.1" description:"SPOE代理地址"`
 	SpoeAgentPort int    `bson:"spoeAgentPort" json:"spoeAgentPort" example:"9000" description:"SPOE代理端口"`
 	Thread        int    `bson:"thread" json:"thread" example:"4" description:"线程数"`
+	TarpitTimeout int    `bson:"tarpitTimeout" json:"tarpitTimeout" example:"10" description:"tarpit 处置的响应延迟（秒）"`
+}
+
+// 流控规则运行模式
+const (
+	FlowControlModeEnforce = "enforce" // 超过阈值时封禁IP
+	FlowControlModeMonitor = "monitor" // 只记录模拟封禁，不拦截请求
+)
+
+// 流控限流算法，为空时按令牌桶处理
+const (
+	FlowLimitAlgorithmTokenBucket   = "token_bucket"   // 令牌桶
+	FlowLimitAlgorithmSlidingWindow = "sliding_window" // 滑动窗口
+	FlowLimitAlgorithmFixedWindow   = "fixed_window"   // 固定窗口
+)
+
+// 未知应用处理策略，为空时按 fail_closed 处理
+const (
+	UnknownAppPolicyFailOpen   = "fail_open"   // 放行请求
+	UnknownAppPolicyFailClosed = "fail_closed" // 设置 txn.coraza.error，由 HAProxy 拒绝请求
+)
+
+// 流控拒绝请求时的处置动作
+const (
+	FlowControlActionDeny     = "deny"     // 返回 403
+	FlowControlActionThrottle = "throttle" // 返回 429 并携带 Retry-After
+	FlowControlActionTarpit   = "tarpit"   // 由 HAProxy 延迟后返回 429
+	FlowControlActionDrop     = "drop"     // 不响应直接断开连接
+	FlowControlActionRedirect = "redirect" // 302 跳转到等待页
+)
+
+// 流控封禁原因，命名错误策略的封禁原因为 FlowControlReasonError:<策略名称>
+const (
+	FlowControlReasonVisit  = "high_frequency_visit"  // 高频访问
+	FlowControlReasonAttack = "high_frequency_attack" // 高频攻击
+	FlowControlReasonError  = "high_frequency_error"  // 高频错误
+
+	FlowControlReasonSubnetEscalation = "subnet_escalation" // 网段升级封禁
+	FlowControlReasonASNEscalation    = "asn_escalation"    // ASN 升级封禁
+)
+
+// ResolveFlowControlAction 修正限制的处置动作
+// 未配置或无效时使用默认动作：访问限制返回 429，其余限制直接拒绝；redirect 缺少跳转地址时退化为 deny
+func ResolveFlowControlAction(reason, action, redirectURL string) string {
+	switch action {
+	case FlowControlActionDeny, FlowControlActionThrottle, FlowControlActionTarpit, FlowControlActionDrop:
+		return action
+	case FlowControlActionRedirect:
+		if redirectURL == "" {
+			return FlowControlActionDeny
+		}
+		return action
+	}
+	if reason == FlowControlReasonVisit {
+		return FlowControlActionThrottle
+	}
+	return FlowControlActionDeny
 }
 
 // FlowControlConfig 定义流控配置，用于存储在数据库中
@@ -55,33 +274,127 @@ type HaproxyConfig struct {
 type FlowControlConfig struct {
 	// 高频访问限制配置
 	VisitLimit struct {
-		Enabled        bool  `bson:"enabled" json:"enabled" example:"true" description:"是否启用访问限制"`
-		Threshold      int64 `bson:"threshold" json:"threshold" example:"100" description:"访问阈值，每分钟最大请求数"`
-		StatDuration   int64 `bson:"statDuration" json:"statDuration" example:"60" description:"统计时间窗口（秒）"`
-		BlockDuration  int64 `bson:"blockDuration" json:"blockDuration" example:"600" description:"封禁时长（秒）"`
-		BurstCount     int64 `bson:"burstCount" json:"burstCount" example:"10" description:"允许的突发请求数"`
-		ParamsCapacity int64 `bson:"paramsCapacity" json:"paramsCapacity" example:"10000" description:"缓存容量，最多缓存IP数"`
+		Enabled        bool   `bson:"enabled" json:"enabled" example:"true" description:"是否启用访问限制"`
+		Mode           string `bson:"mode" json:"mode" example:"enforce" description:"运行模式：enforce 拦截，monitor 仅记录不拦截"`
+		Algorithm      string `bson:"algorithm" json:"algorithm" example:"token_bucket" description:"限流算法：token_bucket 令牌桶，sliding_window 滑动窗口，fixed_window 固定窗口"`
+		Action         string `bson:"action" json:"action" example:"throttle" description:"拒绝请求时的处置动作：deny、throttle、tarpit、drop 或 redirect，默认 throttle"`
+		RedirectURL    string `bson:"redirectUrl" json:"redirectUrl" example:"https://example.com/wait" description:"redirect 动作的跳转地址"`
+		Threshold      int64  `bson:"threshold" json:"threshold" example:"100" description:"访问阈值，每分钟最大请求数"`
+		StatDuration   int64  `bson:"statDuration" json:"statDuration" example:"60" description:"统计时间窗口（秒）"`
+		BlockDuration  int64  `bson:"blockDuration" json:"blockDuration" example:"600" description:"封禁时长（秒）"`
+		BurstCount     int64  `bson:"burstCount" json:"burstCount" example:"10" description:"允许的突发请求数"`
+		ParamsCapacity int64  `bson:"paramsCapacity" json:"paramsCapacity" example:"10000" description:"缓存容量，最多缓存IP数"`
 	} `bson:"visitLimit" json:"visitLimit" description:"访问频率限制配置"`
 
 	// 高频攻击限制配置
 	AttackLimit struct {
-		Enabled        bool  `bson:"enabled" json:"enabled" example:"true" description:"是否启用攻击限制"`
-		Threshold      int64 `bson:"threshold" json:"threshold" example:"5" description:"攻击阈值，每分钟最大攻击次数"`
-		StatDuration   int64 `bson:"statDuration" json:"statDuration" example:"60" description:"统计时间窗口（秒）"`
-		BlockDuration  int64 `bson:"blockDuration" json:"blockDuration" example:"3600" description:"封禁时长（秒）"`
-		BurstCount     int64 `bson:"burstCount" json:"burstCount" example:"2" description:"允许的突发攻击次数"`
-		ParamsCapacity int64 `bson:"paramsCapacity" json:"paramsCapacity" example:"10000" description:"缓存容量，最多缓存IP数"`
+		Enabled        bool   `bson:"enabled" json:"enabled" example:"true" description:"是否启用攻击限制"`
+		Mode           string `bson:"mode" json:"mode" example:"enforce" description:"运行模式：enforce 拦截，monitor 仅记录不拦截"`
+		Algorithm      string `bson:"algorithm" json:"algorithm" example:"token_bucket" description:"限流算法：token_bucket 令牌桶，sliding_window 滑动窗口，fixed_window 固定窗口"`
+		Action         string `bson:"action" json:"action" example:"deny" description:"拒绝请求时的处置动作：deny、throttle、tarpit、drop 或 redirect，默认 deny"`
+		RedirectURL    string `bson:"redirectUrl" json:"redirectUrl" example:"https://example.com/wait" description:"redirect 动作的跳转地址"`
+		Threshold      int64  `bson:"threshold" json:"threshold" example:"5" description:"攻击阈值，每分钟最大攻击次数"`
+		StatDuration   int64  `bson:"statDuration" json:"statDuration" example:"60" description:"统计时间窗口（秒）"`
+		BlockDuration  int64  `bson:"blockDuration" json:"blockDuration" example:"3600" description:"封禁时长（秒）"`
+		BurstCount     int64  `bson:"burstCount" json:"burstCount" example:"2" description:"允许的突发攻击次数"`
+		ParamsCapacity int64  `bson:"paramsCapacity" json:"paramsCapacity" example:"10000" description:"缓存容量，最多缓存IP数"`
 	} `bson:"attackLimit" json:"attackLimit" description:"攻击频率限制配置"`
 
 	// 高频错误限制配置
 	ErrorLimit struct {
-		Enabled        bool  `bson:"enabled" json:"enabled" example:"true" description:"是否启用错误限制"`
-		Threshold      int64 `bson:"threshold" json:"threshold" example:"20" description:"错误阈值，每分钟最大错误次数"`
-		StatDuration   int64 `bson:"statDuration" json:"statDuration" example:"60" description:"统计时间窗口（秒）"`
-		BlockDuration  int64 `bson:"blockDuration" json:"blockDuration" example:"1800" description:"封禁时长（秒）"`
-		BurstCount     int64 `bson:"burstCount" json:"burstCount" example:"5" description:"允许的突发错误次数"`
-		ParamsCapacity int64 `bson:"paramsCapacity" json:"paramsCapacity" example:"10000" description:"缓存容量，最多缓存IP数"`
+		Enabled        bool     `bson:"enabled" json:"enabled" example:"true" description:"是否启用错误限制"`
+		Mode           string   `bson:"mode" json:"mode" example:"enforce" description:"运行模式：enforce 拦截，monitor 仅记录不拦截"`
+		Algorithm      string   `bson:"algorithm" json:"algorithm" example:"token_bucket" description:"限流算法：token_bucket 令牌桶，sliding_window 滑动窗口，fixed_window 固定窗口"`
+		Action         string   `bson:"action" json:"action" example:"deny" description:"拒绝请求时的处置动作：deny、throttle、tarpit、drop 或 redirect，默认 deny"`
+		RedirectURL    string   `bson:"redirectUrl" json:"redirectUrl" example:"https://example.com/wait" description:"redirect 动作的跳转地址"`
+		Threshold      int64    `bson:"threshold" json:"threshold" example:"20" description:"错误阈值，每分钟最大错误次数"`
+		StatDuration   int64    `bson:"statDuration" json:"statDuration" example:"60" description:"统计时间窗口（秒）"`
+		BlockDuration  int64    `bson:"blockDuration" json:"blockDuration" example:"1800" description:"封禁时长（秒）"`
+		BurstCount     int64    `bson:"burstCount" json:"burstCount" example:"5" description:"允许的突发错误次数"`
+		ParamsCapacity int64    `bson:"paramsCapacity" json:"paramsCapacity" example:"10000" description:"缓存容量，最多缓存IP数"`
+		StatusCodes    []string `bson:"statusCodes" json:"statusCodes" example:"401,403,5xx" description:"计入的状态码或状态码类别，为空时计入所有 4xx/5xx 响应"`
+		Paths          []string `bson:"paths" json:"paths" example:"/login" description:"计入的请求路径，支持前缀和通配符，为空时不限路径"`
 	} `bson:"errorLimit" json:"errorLimit" description:"错误频率限制配置"`
+
+	// 命名错误策略，按状态码和路径分别计数，各自使用独立的封禁原因
+	ErrorPolicies []ErrorPolicyConfig `bson:"errorPolicies" json:"errorPolicies" description:"命名错误策略列表"`
+
+	// 网段升级封禁配置
+	SubnetEscalation SubnetEscalationConfig `bson:"subnetEscalation" json:"subnetEscalation" description:"网段升级封禁配置"`
+
+	// 限流计数后端配置
+	CounterBackend CounterBackendConfig `bson:"counterBackend" json:"counterBackend" description:"限流计数后端配置"`
+}
+
+// EnforcementAction 返回封禁原因对应的已启用限制的处置动作和跳转地址，与引擎拒绝被封禁IP的方式一致
+// 找不到已启用的限制（如网段升级封禁、手动封禁、限制已关闭或策略已删除）时直接拒绝
+func (c FlowControlConfig) EnforcementAction(reason string) (string, string) {
+	var action, redirectURL string
+	switch {
+	case reason == FlowControlReasonVisit && c.VisitLimit.Enabled:
+		action, redirectURL = c.VisitLimit.Action, c.VisitLimit.RedirectURL
+	case reason == FlowControlReasonAttack && c.AttackLimit.Enabled:
+		action, redirectURL = c.AttackLimit.Action, c.AttackLimit.RedirectURL
+	case reason == FlowControlReasonError && c.ErrorLimit.Enabled:
+		action, redirectURL = c.ErrorLimit.Action, c.ErrorLimit.RedirectURL
+	default:
+		name, ok := strings.CutPrefix(reason, FlowControlReasonError+":")
+		if !ok {
+			return FlowControlActionDeny, ""
+		}
+		found := false
+		for _, policy := range c.ErrorPolicies {
+			if policy.Enabled && policy.Name != "" && policy.Name == name {
+				action, redirectURL, found = policy.Action, policy.RedirectURL, true
+				break
+			}
+		}
+		if !found {
+			return FlowControlActionDeny, ""
+		}
+	}
+	return ResolveFlowControlAction(reason, action, redirectURL), redirectURL
+}
+
+// SubnetEscalationConfig 网段升级封禁配置
+//	@Description	窗口内同一网段（或同一ASN）被封禁的不同IP数超过阈值时，封禁整个网段
+type SubnetEscalationConfig struct {
+	Enabled       bool  `bson:"enabled" json:"enabled" example:"false" description:"是否启用"`
+	IPv4PrefixLen int   `bson:"ipv4PrefixLen" json:"ipv4PrefixLen" example:"24" description:"IPv4 聚合前缀长度"`
+	IPv6PrefixLen int   `bson:"ipv6PrefixLen" json:"ipv6PrefixLen" example:"48" description:"IPv6 聚合前缀长度"`
+	ByASN         bool  `bson:"byAsn" json:"byAsn" example:"false" description:"是否同时按ASN聚合，需要配置ASN数据库"`
+	Threshold     int   `bson:"threshold" json:"threshold" example:"10" description:"窗口内被封禁的不同IP数超过该值时升级封禁"`
+	Window        int64 `bson:"window" json:"window" example:"600" description:"统计窗口（秒）"`
+	BlockDuration int64 `bson:"blockDuration" json:"blockDuration" example:"3600" description:"网段封禁时长（秒）"`
+}
+
+// ErrorPolicyConfig 命名错误策略
+//	@Description	按状态码和路径筛选错误响应并单独限流，封禁原因为 high_frequency_error:<name>
+type ErrorPolicyConfig struct {
+	Name           string   `bson:"name" json:"name" example:"login_auth_failure" description:"策略名称，用于封禁原因"`
+	Enabled        bool     `bson:"enabled" json:"enabled" example:"true" description:"是否启用"`
+	Mode           string   `bson:"mode" json:"mode" example:"enforce" description:"运行模式：enforce 拦截，monitor 仅记录不拦截"`
+	Algorithm      string   `bson:"algorithm" json:"algorithm" example:"token_bucket" description:"限流算法：token_bucket 令牌桶，sliding_window 滑动窗口，fixed_window 固定窗口"`
+	Action         string   `bson:"action" json:"action" example:"deny" description:"拒绝请求时的处置动作：deny、throttle、tarpit、drop 或 redirect，默认 deny"`
+	RedirectURL    string   `bson:"redirectUrl" json:"redirectUrl" example:"https://example.com/wait" description:"redirect 动作的跳转地址"`
+	StatusCodes    []string `bson:"statusCodes" json:"statusCodes" example:"401,403" description:"计入的状态码或状态码类别，如 404、4xx，为空时计入所有 4xx/5xx 响应"`
+	Paths          []string `bson:"paths" json:"paths" example:"/login" description:"计入的请求路径，支持前缀和通配符，为空时不限路径"`
+	Threshold      int64    `bson:"threshold" json:"threshold" example:"5" description:"错误阈值"`
+	StatDuration   int64    `bson:"statDuration" json:"statDuration" example:"60" description:"统计时间窗口（秒）"`
+	BlockDuration  int64    `bson:"blockDuration" json:"blockDuration" example:"1800" description:"封禁时长（秒）"`
+	BurstCount     int64    `bson:"burstCount" json:"burstCount" example:"0" description:"允许的突发错误次数"`
+	ParamsCapacity int64    `bson:"paramsCapacity" json:"paramsCapacity" example:"10000" description:"缓存容量，最多缓存IP数"`
+}
+
+// CounterBackendConfig 限流计数后端配置
+//	@Description	多个引擎实例共享限流计数时使用 redis 后端，后端不可用时自动回退到本地计数
+type CounterBackendConfig struct {
+	Type      string `bson:"type" json:"type" example:"local" description:"计数后端类型：local 或 redis"`
+	Addr      string `bson:"addr" json:"addr" example:"127.0.0.1:6379" description:"Redis地址"`
+	Password  string `bson:"password" json:"password" description:"Redis密码"`
+	DB        int    `bson:"db" json:"db" example:"0" description:"Redis数据库编号"`
+	KeyPrefix string `bson:"keyPrefix" json:"keyPrefix" example:"ruiqi:flow" description:"计数键前缀"`
+	Timeout   int64  `bson:"timeout" json:"timeout" example:"50" description:"单次计数请求超时时间（毫秒）"`
 }
 
 // GetDefaultFlowControlConfig 返回默认的流控配置
@@ -91,14 +404,21 @@ type FlowControlConfig struct {
 func GetDefaultFlowControlConfig() FlowControlConfig {
 	return FlowControlConfig{
 		VisitLimit: struct {
-			Enabled        bool  `bson:"enabled" json:"enabled" example:"true" description:"是否启用访问限制"`
-			Threshold      int64 `bson:"threshold" json:"threshold" example:"100" description:"访问阈值，每分钟最大请求数"`
-			StatDuration   int64 `bson:"statDuration" json:"statDuration" example:"60" description:"统计时间窗口（秒）"`
-			BlockDuration  int64 `bson:"blockDuration" json:"blockDuration" example:"600" description:"封禁时长（秒）"`
-			BurstCount     int64 `bson:"burstCount" json:"burstCount" example:"10" description:"允许的突发请求数"`
-			ParamsCapacity int64 `bson:"paramsCapacity" json:"paramsCapacity" example:"10000" description:"缓存容量，最多缓存IP数"`
+			Enabled        bool   `bson:"enabled" json:"enabled" example:"true" description:"是否启用访问限制"`
+			Mode           string `bson:"mode" json:"mode" example:"enforce" description:"运行模式：enforce 拦截，monitor 仅记录不拦截"`
+			Algorithm      string `bson:"algorithm" json:"algorithm" example:"token_bucket" description:"限流算法：token_bucket 令牌桶，sliding_window 滑动窗口，fixed_window 固定窗口"`
+			Action         string `bson:"action" json:"action" example:"throttle" description:"拒绝请求时的处置动作：deny、throttle、tarpit、drop 或 redirect，默认 throttle"`
+			RedirectURL    string `bson:"redirectUrl" json:"redirectUrl" example:"https://example.com/wait" description:"redirect 动作的跳转地址"`
+			Threshold      int64  `bson:"threshold" json:"threshold" example:"100" description:"访问阈值，每分钟最大请求数"`
+			StatDuration   int64  `bson:"statDuration" json:"statDuration" example:"60" description:"统计时间窗口（秒）"`
+			BlockDuration  int64  `bson:"blockDuration" json:"blockDuration" example:"600" description:"封禁时长（秒）"`
+			BurstCount     int64  `bson:"burstCount" json:"burstCount" example:"10" description:"允许的突发请求数"`
+			ParamsCapacity int64  `bson:"paramsCapacity" json:"paramsCapacity" example:"10000" description:"缓存容量，最多缓存IP数"`
 		}{
 			Enabled:        false,
+			Mode:           FlowControlModeEnforce,
+			Algorithm:      FlowLimitAlgorithmTokenBucket,
+			Action:         FlowControlActionThrottle,
 			Threshold:      100,   // 每分钟100次请求
 			StatDuration:   60,    // 统计时间窗口1分钟
 			BlockDuration:  600,   // 封禁10分钟
@@ -106,14 +426,21 @@ func GetDefaultFlowControlConfig() FlowControlConfig {
 			ParamsCapacity: 10000, // 缓存1万个IP
 		},
 		AttackLimit: struct {
-			Enabled        bool  `bson:"enabled" json:"enabled" example:"true" description:"是否启用攻击限制"`
-			Threshold      int64 `bson:"threshold" json:"threshold" example:"5" description:"攻击阈值，每分钟最大攻击次数"`
-			StatDuration   int64 `bson:"statDuration" json:"statDuration" example:"60" description:"统计时间窗口（秒）"`
-			BlockDuration  int64 `bson:"blockDuration" json:"blockDuration" example:"3600" description:"封禁时长（秒）"`
-			BurstCount     int64 `bson:"burstCount" json:"burstCount" example:"2" description:"允许的突发攻击次数"`
-			ParamsCapacity int64 `bson:"paramsCapacity" json:"paramsCapacity" example:"10000" description:"缓存容量，最多缓存IP数"`
+			Enabled        bool   `bson:"enabled" json:"enabled" example:"true" description:"是否启用攻击限制"`
+			Mode           string `bson:"mode" json:"mode" example:"enforce" description:"运行模式：enforce 拦截，monitor 仅记录不拦截"`
+			Algorithm      string `bson:"algorithm" json:"algorithm" example:"token_bucket" description:"限流算法：token_bucket 令牌桶，sliding_window 滑动窗口，fixed_window 固定窗口"`
+			Action         string `bson:"action" json:"action" example:"deny" description:"拒绝请求时的处置动作：deny、throttle、tarpit、drop 或 redirect，默认 deny"`
+			RedirectURL    string `bson:"redirectUrl" json:"redirectUrl" example:"https://example.com/wait" description:"redirect 动作的跳转地址"`
+			Threshold      int64  `bson:"threshold" json:"threshold" example:"5" description:"攻击阈值，每分钟最大攻击次数"`
+			StatDuration   int64  `bson:"statDuration" json:"statDuration" example:"60" description:"统计时间窗口（秒）"`
+			BlockDuration  int64  `bson:"blockDuration" json:"blockDuration" example:"3600" description:"封禁时长（秒）"`
+			BurstCount     int64  `bson:"burstCount" json:"burstCount" example:"2" description:"允许的突发攻击次数"`
+			ParamsCapacity int64  `bson:"paramsCapacity" json:"paramsCapacity" example:"10000" description:"缓存容量，最多缓存IP数"`
 		}{
 			Enabled:        false,
+			Mode:           FlowControlModeEnforce,
+			Algorithm:      FlowLimitAlgorithmTokenBucket,
+			Action:         FlowControlActionDeny,
 			Threshold:      5,     // 每分钟5次攻击
 			StatDuration:   60,    // 统计时间窗口1分钟
 			BlockDuration:  3600,  // 封禁1小时
@@ -121,20 +448,43 @@ func GetDefaultFlowControlConfig() FlowControlConfig {
 			ParamsCapacity: 10000, // 缓存1万个IP
 		},
 		ErrorLimit: struct {
-			Enabled        bool  `bson:"enabled" json:"enabled" example:"true" description:"是否启用错误限制"`
-			Threshold      int64 `bson:"threshold" json:"threshold" example:"20" description:"错误阈值，每分钟最大错误次数"`
-			StatDuration   int64 `bson:"statDuration" json:"statDuration" example:"60" description:"统计时间窗口（秒）"`
-			BlockDuration  int64 `bson:"blockDuration" json:"blockDuration" example:"1800" description:"封禁时长（秒）"`
-			BurstCount     int64 `bson:"burstCount" json:"burstCount" example:"5" description:"允许的突发错误次数"`
-			ParamsCapacity int64 `bson:"paramsCapacity" json:"paramsCapacity" example:"10000" description:"缓存容量，最多缓存IP数"`
+			Enabled        bool     `bson:"enabled" json:"enabled" example:"true" description:"是否启用错误限制"`
+			Mode           string   `bson:"mode" json:"mode" example:"enforce" description:"运行模式：enforce 拦截，monitor 仅记录不拦截"`
+			Algorithm      string   `bson:"algorithm" json:"algorithm" example:"token_bucket" description:"限流算法：token_bucket 令牌桶，sliding_window 滑动窗口，fixed_window 固定窗口"`
+			Action         string   `bson:"action" json:"action" example:"deny" description:"拒绝请求时的处置动作：deny、throttle、tarpit、drop 或 redirect，默认 deny"`
+			RedirectURL    string   `bson:"redirectUrl" json:"redirectUrl" example:"https://example.com/wait" description:"redirect 动作的跳转地址"`
+			Threshold      int64    `bson:"threshold" json:"threshold" example:"20" description:"错误阈值，每分钟最大错误次数"`
+			StatDuration   int64    `bson:"statDuration" json:"statDuration" example:"60" description:"统计时间窗口（秒）"`
+			BlockDuration  int64    `bson:"blockDuration" json:"blockDuration" example:"1800" description:"封禁时长（秒）"`
+			BurstCount     int64    `bson:"burstCount" json:"burstCount" example:"5" description:"允许的突发错误次数"`
+			ParamsCapacity int64    `bson:"paramsCapacity" json:"paramsCapacity" example:"10000" description:"缓存容量，最多缓存IP数"`
+			StatusCodes    []string `bson:"statusCodes" json:"statusCodes" example:"401,403,5xx" description:"计入的状态码或状态码类别，为空时计入所有 4xx/5xx 响应"`
+			Paths          []string `bson:"paths" json:"paths" example:"/login" description:"计入的请求路径，支持前缀和通配符，为空时不限路径"`
 		}{
 			Enabled:        false,
+			Mode:           FlowControlModeEnforce,
+			Algorithm:      FlowLimitAlgorithmTokenBucket,
+			Action:         FlowControlActionDeny,
 			Threshold:      20,    // 每分钟20次错误
 			StatDuration:   60,    // 统计时间窗口1分钟
 			BlockDuration:  1800,  // 封禁30分钟
 			BurstCount:     5,     // 允许突发5次
 			ParamsCapacity: 10000, // 缓存1万个IP
 		},
+		SubnetEscalation: SubnetEscalationConfig{
+			Enabled:       false,
+			IPv4PrefixLen: 24,
+			IPv6PrefixLen: 48,
+			ByASN:         false,
+			Threshold:     10,   // 超过10个IP
+			Window:        600,  // 统计窗口10分钟
+			BlockDuration: 3600, // 封禁1小时
+		},
+		CounterBackend: CounterBackendConfig{
+			Type:      "local",
+			KeyPrefix: "ruiqi:flow",
+			Timeout:   50,
+		},
 	}
 }
 
@@ -0,0 +1,69 @@
+package model
+
+import "testing"
+
+// TestResolveFlowControlAction 测试处置动作的默认值和无效配置的修正
+func TestResolveFlowControlAction(t *testing.T) {
+	tests := []struct {
+		name        string
+		reason      string
+		action      string
+		redirectURL string
+		want        string
+	}{
+		{"访问限制默认返回 429", FlowControlReasonVisit, "", "", FlowControlActionThrottle},
+		{"攻击限制默认直接拒绝", FlowControlReasonAttack, "", "", FlowControlActionDeny},
+		{"命名错误策略默认直接拒绝", FlowControlReasonError + ":login", "", "", FlowControlActionDeny},
+		{"无效动作使用默认值", FlowControlReasonVisit, "block", "", FlowControlActionThrottle},
+		{"有效动作保持不变", FlowControlReasonVisit, FlowControlActionDrop, "", FlowControlActionDrop},
+		{"tarpit 保持不变", FlowControlReasonAttack, FlowControlActionTarpit, "", FlowControlActionTarpit},
+		{"redirect 缺少跳转地址时直接拒绝", FlowControlReasonVisit, FlowControlActionRedirect, "", FlowControlActionDeny},
+		{"redirect 有跳转地址", FlowControlReasonVisit, FlowControlActionRedirect, "https://example.com/wait", FlowControlActionRedirect},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ResolveFlowControlAction(tt.reason, tt.action, tt.redirectURL); got != tt.want {
+				t.Errorf("ResolveFlowControlAction() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestFlowControlEnforcementAction 测试按封禁原因查找已启用限制的处置动作
+func TestFlowControlEnforcementAction(t *testing.T) {
+	var config FlowControlConfig
+	config.VisitLimit.Action = FlowControlActionThrottle
+	config.AttackLimit.Enabled = true
+	config.AttackLimit.Action = FlowControlActionRedirect
+	config.AttackLimit.RedirectURL = "https://example.com/wait"
+	config.ErrorLimit.Enabled = true
+	config.ErrorPolicies = []ErrorPolicyConfig{
+		{Name: "login", Enabled: true, Action: FlowControlActionTarpit},
+		{Name: "api", Action: FlowControlActionThrottle},
+	}
+
+	tests := []struct {
+		name        string
+		reason      string
+		action      string
+		redirectURL string
+	}{
+		{"关闭访问限制后遗留的封禁直接拒绝", FlowControlReasonVisit, FlowControlActionDeny, ""},
+		{"攻击限制使用配置的跳转", FlowControlReasonAttack, FlowControlActionRedirect, "https://example.com/wait"},
+		{"错误限制默认直接拒绝", FlowControlReasonError, FlowControlActionDeny, ""},
+		{"命名错误策略使用策略的动作", FlowControlReasonError + ":login", FlowControlActionTarpit, ""},
+		{"未启用的策略直接拒绝", FlowControlReasonError + ":api", FlowControlActionDeny, ""},
+		{"已删除的策略直接拒绝", FlowControlReasonError + ":admin", FlowControlActionDeny, ""},
+		{"网段升级封禁直接拒绝", FlowControlReasonSubnetEscalation, FlowControlActionDeny, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			action, redirectURL := config.EnforcementAction(tt.reason)
+			if action != tt.action || redirectURL != tt.redirectURL {
+				t.Errorf("EnforcementAction() = %q, %q, want %q, %q", action, redirectURL, tt.action, tt.redirectURL)
+			}
+		})
+	}
+}
@@ -0,0 +1,39 @@
+package model
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// CustomRule 表示自定义 SecLang 规则
+// @Description 自定义 SecLang 规则，如虚拟补丁。保存前会先编译校验，启用的规则按优先级追加到应用的指令之后
+type CustomRule struct {
+	ID          bson.ObjectID `bson:"_id,omitempty" json:"id,omitempty" example:"60d21b4367d0d8992e89e964"`                                           // 规则唯一标识符
+	Name        string        `bson:"name" json:"name" example:"CVE-2021-44228 虚拟补丁"`                                                                 // 规则名称
+	Description string        `bson:"description" json:"description" example:"拦截 Log4Shell JNDI 注入"`                                                  // 描述
+	Enabled     bool          `bson:"enabled" json:"enabled" example:"true"`                                                                          // 是否启用
+	Priority    int           `bson:"priority" json:"priority" example:"100"`                                                                         // 优先级，数值越小越靠前
+	Apps        []string      `bson:"apps" json:"apps" example:"coraza"`                                                                              // 生效的应用名称，为空时对所有应用生效
+	Directives  string        `bson:"directives" json:"directives" example:"SecRule ARGS \"@contains ${jndi:\" \"id:10001,phase:2,deny,status:403\""` // SecLang 指令，只允许 SecRule、SecAction、SecMarker
+	RuleIDs     []int         `bson:"ruleIds" json:"ruleIds" example:"10001"`                                                                         // 指令中定义的规则ID，保存时解析
+	CreatedAt   time.Time     `bson:"createdAt" json:"createdAt"`                                                                                     // 创建时间
+	UpdatedAt   time.Time     `bson:"updatedAt" json:"updatedAt"`                                                                                     // 更新时间
+}
+
+func (r *CustomRule) GetCollectionName() string {
+	return "custom_rules"
+}
+
+// AppliesTo 是否对指定应用生效
+func (r *CustomRule) AppliesTo(app string) bool {
+	if len(r.Apps) == 0 {
+		return true
+	}
+	for _, name := range r.Apps {
+		if name == app {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,44 @@
+package model
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// ExclusionType 规则排除类型
+//
+//	@Description	规则排除类型，禁用规则ID、禁用规则标签或从规则中排除参数
+type ExclusionType string
+
+const (
+	ExclusionRemoveByID     ExclusionType = "remove_by_id"        // 禁用规则ID或ID范围
+	ExclusionRemoveByTag    ExclusionType = "remove_by_tag"       // 禁用带指定标签的规则
+	ExclusionRemoveTargetID ExclusionType = "remove_target_by_id" // 从规则中排除参数、请求头或Cookie
+)
+
+// RuleExclusion 表示CRS规则排除
+// @Description CRS规则排除，用于处理误报。Host 与 Path 均为空时全局生效，否则只对匹配的站点或路径生效
+type RuleExclusion struct {
+	ID          bson.ObjectID `bson:"_id,omitempty" json:"id,omitempty" example:"60d21b4367d0d8992e89e964"`      // 排除唯一标识符
+	Name        string        `bson:"name" json:"name" example:"登录密码误报"`                                         // 排除名称
+	Description string        `bson:"description" json:"description" example:"密码字段触发SQL注入规则"`                    // 描述
+	Enabled     bool          `bson:"enabled" json:"enabled" example:"true"`                                     // 是否启用
+	Type        ExclusionType `bson:"type" json:"type" example:"remove_target_by_id"`                            // 排除类型
+	RuleIDs     []string      `bson:"ruleIds" json:"ruleIds" example:"942100,942200-942299"`                     // 规则ID或ID范围
+	Tags        []string      `bson:"tags" json:"tags" example:"attack-sqli"`                                    // 规则标签
+	Targets     []string      `bson:"targets" json:"targets" example:"ARGS:password,REQUEST_HEADERS:User-Agent"` // 排除的变量
+	Host        string        `bson:"host" json:"host" example:"a.com"`                                          // 生效的站点域名，为空时不限站点
+	Path        string        `bson:"path" json:"path" example:"/login"`                                         // 生效的路径前缀，为空时不限路径
+	CreatedAt   time.Time     `bson:"createdAt" json:"createdAt"`                                                // 创建时间
+	UpdatedAt   time.Time     `bson:"updatedAt" json:"updatedAt"`                                                // 更新时间
+}
+
+func (r *RuleExclusion) GetCollectionName() string {
+	return "rule_exclusion"
+}
+
+// IsGlobal 是否全局生效
+func (r *RuleExclusion) IsGlobal() bool {
+	return r.Host == "" && r.Path == ""
+}
@@ -6,11 +6,27 @@ import (
 	"go.mongodb.org/mongo-driver/v2/bson"
 )
 
+// 决策记录的引擎，为空的历史记录均来自 coraza 或 micro
+const (
+	DecisionEngineCoraza = "coraza" // Coraza 规则拦截
+	DecisionEngineMicro  = "micro"  // 微引擎规则拦截
+	DecisionEngineFlow   = "flow"   // 流量控制拒绝
+	DecisionEngineIPBan  = "ipban"  // 已封禁IP拒绝
+)
+
+// 决策模式
+const (
+	DecisionModeEnforce  = "enforce"   // 已拦截
+	DecisionModeObserve  = "observe"   // 监控模式下仅记录，未拦截
+	DecisionModeNearMiss = "near_miss" // 未拦截，但异常分数达到应用的告警分数
+)
+
 // WAFLog 表示安全事件日志
-// @Description Web应用防火墙安全事件完整记录，包含详细的攻击检测和防护信息
+// @Description Web应用防火墙安全事件完整记录，包含详细的攻击检测和防护信息。流量控制和封禁IP的拒绝同样记录为安全事件，通过 engine 区分
 type WAFLog struct {
 	ID           bson.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`                                                                                                     // 日志唯一标识符
 	RequestID    string        `json:"requestId" bson:"requestId" example:"a1b2c3d4e5f6"`                                                                                     // 请求唯一标识
+	AppName      string        `json:"appName,omitempty" bson:"appName,omitempty" example:"coraza"`                                                                           // 做出决策的应用
 	RuleID       int           `json:"ruleId" bson:"ruleId" example:"10086"`                                                                                                  // 触发的规则ID
 	SecLangRaw   string        `json:"secLangRaw" bson:"secLangRaw" example:"SecRule REQUEST_HEADERS:User-Agent \"@rx (?:scanner)\" \"id:1008,phase:1,severity:'CRITICAL'\""` // 安全规则原始定义
 	Severity     int           `json:"severity" bson:"severity" example:"2"`                                                                                                  // 事件严重级别(0-5)
@@ -27,6 +43,10 @@ type WAFLog struct {
 	SrcPort      int           `json:"srcPort" bson:"srcPort" example:"52134"`                                                                                                // 来源端口
 	DstPort      int           `json:"dstPort" bson:"dstPort" example:"443"`                                                                                                  // 目标端口
 	Domain       string        `json:"domain" bson:"domain" example:"api.example.com"`                                                                                        // 目标域名
+	Engine       string        `json:"engine" bson:"engine" example:"coraza"`                                                                                                 // 做出决策的引擎：coraza、micro、flow、ipban
+	Action       string        `json:"action" bson:"action" example:"deny"`                                                                                                   // 采取的处置动作
+	Mode         string        `json:"mode" bson:"mode" example:"enforce"`                                                                                                    // 决策模式：enforce 已拦截，observe 仅记录未拦截，near_miss 接近拦截阈值
+	AnomalyScore *AnomalyScore `json:"anomalyScore,omitempty" bson:"anomalyScore,omitempty"`                                                                                  // CRS 异常评分，仅 Coraza 记录
 	Logs         []Log         `json:"logs" bson:"logs"`                                                                                                                      // 关联的日志条目
 	Message      string        `json:"message" bson:"message" example:"恶意扫描器检测"`                                                                                              // 事件描述消息
 	Request      string        `json:"request" bson:"request" example:"GET /api/v1/users HTTP/1.1\nHost: api.example.com\nUser-Agent: Scanner/1.0"`                           // 原始HTTP请求
@@ -36,6 +56,20 @@ type WAFLog struct {
 	HourGroupSix int           `json:"hourGroupSix" bson:"hourGroupSix" example:"0"`
 	Minute       int           `json:"minute" bson:"minute"`
 	CreatedAt    time.Time     `json:"createdAt" bson:"createdAt" example:"2024-03-18T08:12:33Z"` // 事件发生时间戳
+	Count        int           `json:"count,omitempty" bson:"count,omitempty" example:"1"`        // 记录代表的事件数，聚合或采样时大于 1，为空时代表 1 次
+	FirstSeenAt  *time.Time    `json:"firstSeenAt,omitempty" bson:"firstSeenAt,omitempty"`        // 聚合窗口内首次事件的时间
+	LastSeenAt   *time.Time    `json:"lastSeenAt,omitempty" bson:"lastSeenAt,omitempty"`          // 聚合窗口内最后一次事件的时间
+}
+
+// AnomalyScore 表示事务的 CRS 异常评分
+// @Description 事务关闭时从 TX 变量读取的累计异常分数，用于判断请求距离拦截阈值的远近
+type AnomalyScore struct {
+	Inbound           int   `json:"inbound" bson:"inbound" example:"3"`                     // 请求拦截异常分数 TX:blocking_inbound_anomaly_score
+	Outbound          int   `json:"outbound" bson:"outbound" example:"0"`                   // 响应拦截异常分数 TX:blocking_outbound_anomaly_score
+	InboundThreshold  int   `json:"inboundThreshold" bson:"inboundThreshold" example:"5"`   // 请求异常分数阈值
+	OutboundThreshold int   `json:"outboundThreshold" bson:"outboundThreshold" example:"4"` // 响应异常分数阈值
+	InboundByPL       []int `json:"inboundByPl" bson:"inboundByPl" example:"3,0,0,0"`       // 各偏执等级的请求异常分数，依次为 PL1 至 PL4
+	OutboundByPL      []int `json:"outboundByPl" bson:"outboundByPl" example:"0,0,0,0"`     // 各偏执等级的响应异常分数，依次为 PL1 至 PL4
 }
 
 // Log 表示单个日志条目
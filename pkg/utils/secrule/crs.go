@@ -0,0 +1,193 @@
+package secrule
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/HUAHUAI23/simple-waf/pkg/model"
+)
+
+// CRS 结构化配置生成的 SecAction 使用的保留ID范围，自定义规则不能使用该范围
+const (
+	CRSSettingsRuleIDBase = 9099000
+	CRSSettingsRuleIDMax  = 9099099
+)
+
+// CRSRuleFamilies CRS 规则族名称与规则ID范围，对应 @owasp_crs 下的规则文件
+var CRSRuleFamilies = map[string]string{
+	"method-enforcement":   "911000-911999",
+	"scanner-detection":    "913000-913999",
+	"protocol-enforcement": "920000-920999",
+	"protocol-attack":      "921000-921999",
+	"multipart-attack":     "922000-922999",
+	"lfi":                  "930000-930999",
+	"rfi":                  "931000-931999",
+	"rce":                  "932000-932999",
+	"php":                  "933000-933999",
+	"generic":              "934000-934999",
+	"xss":                  "941000-941999",
+	"sqli":                 "942000-942999",
+	"session-fixation":     "943000-943999",
+	"java":                 "944000-944999",
+	"data-leakages":        "950000-950999",
+	"data-leakages-sql":    "951000-951999",
+	"data-leakages-java":   "952000-952999",
+	"data-leakages-php":    "953000-953999",
+	"data-leakages-iis":    "954000-954999",
+	"web-shells":           "955000-955999",
+}
+
+var (
+	crsIncludePattern  = regexp.MustCompile(`(?mi)^[ \t]*Include[ \t]+"?@owasp_crs/`)
+	methodPattern      = regexp.MustCompile(`^[A-Z]+$`)
+	contentTypePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9!#$&^_.+\-]*/[a-z0-9!#$&^_.+\-*]+$`)
+	extensionPattern   = regexp.MustCompile(`^\.[A-Za-z0-9_\-.]+$`)
+	pluginPattern      = regexp.MustCompile(`^[a-z0-9][a-z0-9_\-]*$`)
+)
+
+// ValidateCRSSettings 校验 CRS 结构化配置
+func ValidateCRSSettings(settings *model.CRSSettings, pluginDir string) error {
+	if settings.BlockingParanoiaLevel < 0 || settings.BlockingParanoiaLevel > 4 {
+		return fmt.Errorf("拦截偏执等级必须在1到4之间: %d", settings.BlockingParanoiaLevel)
+	}
+	if settings.DetectionParanoiaLevel < 0 || settings.DetectionParanoiaLevel > 4 {
+		return fmt.Errorf("检测偏执等级必须在1到4之间: %d", settings.DetectionParanoiaLevel)
+	}
+	if settings.DetectionParanoiaLevel > 0 && settings.DetectionParanoiaLevel < max(settings.BlockingParanoiaLevel, 1) {
+		return errors.New("检测偏执等级不能低于拦截偏执等级")
+	}
+	if settings.InboundAnomalyThreshold < 0 || settings.OutboundAnomalyThreshold < 0 {
+		return errors.New("异常分数阈值不能为负数")
+	}
+	if settings.WarningAnomalyScore < 0 {
+		return errors.New("告警分数不能为负数")
+	}
+
+	for _, method := range settings.AllowedMethods {
+		if !methodPattern.MatchString(method) {
+			return fmt.Errorf("无效的请求方法: %s", method)
+		}
+	}
+	for _, contentType := range settings.AllowedContentTypes {
+		if !contentTypePattern.MatchString(contentType) {
+			return fmt.Errorf("无效的内容类型: %s", contentType)
+		}
+	}
+	for _, extension := range settings.RestrictedExtensions {
+		if !extensionPattern.MatchString(extension) {
+			return fmt.Errorf("无效的文件扩展名: %s", extension)
+		}
+	}
+	for _, family := range settings.DisabledRuleFamilies {
+		if _, ok := CRSRuleFamilies[family]; !ok {
+			return fmt.Errorf("未知的CRS规则族: %s", family)
+		}
+	}
+	for _, plugin := range settings.Plugins {
+		if !pluginPattern.MatchString(plugin) {
+			return fmt.Errorf("无效的CRS插件名称: %s", plugin)
+		}
+	}
+	if len(settings.Plugins) > 0 && pluginDir == "" {
+		return errors.New("启用CRS插件前必须配置CRS插件目录")
+	}
+	return nil
+}
+
+// RenderCRSSettings 将 CRS 结构化配置渲染为 SecLang 指令
+// before 为 setvar 指令和插件的 config、before 文件，必须位于 CRS 规则之前；
+// after 为禁用规则族的 SecRuleRemoveById 指令和插件的 after 文件，必须位于 CRS 规则之后
+func RenderCRSSettings(settings model.CRSSettings, pluginDir string) (before, after string, err error) {
+	if err := ValidateCRSSettings(&settings, pluginDir); err != nil {
+		return "", "", err
+	}
+
+	var setvars []string
+	if settings.BlockingParanoiaLevel > 0 {
+		setvars = append(setvars, fmt.Sprintf("setvar:tx.blocking_paranoia_level=%d", settings.BlockingParanoiaLevel))
+	}
+	if settings.DetectionParanoiaLevel > 0 {
+		setvars = append(setvars, fmt.Sprintf("setvar:tx.detection_paranoia_level=%d", settings.DetectionParanoiaLevel))
+	}
+	if settings.InboundAnomalyThreshold > 0 {
+		setvars = append(setvars, fmt.Sprintf("setvar:tx.inbound_anomaly_score_threshold=%d", settings.InboundAnomalyThreshold))
+	}
+	if settings.OutboundAnomalyThreshold > 0 {
+		setvars = append(setvars, fmt.Sprintf("setvar:tx.outbound_anomaly_score_threshold=%d", settings.OutboundAnomalyThreshold))
+	}
+	if len(settings.AllowedMethods) > 0 {
+		setvars = append(setvars, fmt.Sprintf("setvar:'tx.allowed_methods=%s'", strings.Join(settings.AllowedMethods, " ")))
+	}
+	if len(settings.AllowedContentTypes) > 0 {
+		types := make([]string, len(settings.AllowedContentTypes))
+		for i, contentType := range settings.AllowedContentTypes {
+			types[i] = "|" + contentType + "|"
+		}
+		setvars = append(setvars, fmt.Sprintf("setvar:'tx.allowed_request_content_type=%s'", strings.Join(types, " ")))
+	}
+	if len(settings.RestrictedExtensions) > 0 {
+		extensions := make([]string, len(settings.RestrictedExtensions))
+		for i, extension := range settings.RestrictedExtensions {
+			extensions[i] = strings.ToLower(extension) + "/"
+		}
+		setvars = append(setvars, fmt.Sprintf("setvar:'tx.restricted_extensions=%s'", strings.Join(extensions, " ")))
+	}
+
+	var beforeLines, afterLines []string
+	if len(setvars) > 0 {
+		beforeLines = append(beforeLines, "# CRS 结构化配置")
+		// 每个变量使用独立的 SecAction，避免单条规则过长
+		for i, setvar := range setvars {
+			beforeLines = append(beforeLines, fmt.Sprintf(`SecAction "id:%d,phase:1,pass,nolog,t:none,%s"`, CRSSettingsRuleIDBase+i, setvar))
+		}
+	}
+
+	// CRS 插件约定: config 与 before 文件在 CRS 规则之前加载，after 文件在之后加载
+	for _, plugin := range settings.Plugins {
+		beforeLines = append(beforeLines,
+			"Include "+path.Join(pluginDir, plugin+"-config.conf"),
+			"Include "+path.Join(pluginDir, plugin+"-before.conf"),
+		)
+		afterLines = append(afterLines, "Include "+path.Join(pluginDir, plugin+"-after.conf"))
+	}
+
+	if len(settings.DisabledRuleFamilies) > 0 {
+		ranges := make([]string, len(settings.DisabledRuleFamilies))
+		for i, family := range settings.DisabledRuleFamilies {
+			ranges[i] = CRSRuleFamilies[family]
+		}
+		afterLines = append(afterLines, "# 禁用的CRS规则族", "SecRuleRemoveById "+strings.Join(ranges, " "))
+	}
+
+	return strings.Join(beforeLines, "\n"), strings.Join(afterLines, "\n"), nil
+}
+
+// ApplyCRSSettings 将 CRS 结构化配置合并到应用的指令中
+// 配置插入到第一条 Include @owasp_crs 指令之前，使其覆盖指令中先前设置的同名变量；
+// 指令中没有引入 CRS 时插入到开头
+func ApplyCRSSettings(directives string, settings model.CRSSettings, pluginDir string) (string, error) {
+	before, after, err := RenderCRSSettings(settings, pluginDir)
+	if err != nil {
+		return "", err
+	}
+
+	if before != "" {
+		if loc := crsIncludePattern.FindStringIndex(directives); loc != nil {
+			directives = directives[:loc[0]] + before + "\n" + directives[loc[0]:]
+		} else if directives != "" {
+			directives = before + "\n" + directives
+		} else {
+			directives = before
+		}
+	}
+	if after != "" {
+		if directives != "" {
+			directives += "\n"
+		}
+		directives += after
+	}
+	return directives, nil
+}
@@ -0,0 +1,112 @@
+package secrule
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/HUAHUAI23/simple-waf/pkg/model"
+)
+
+// 自定义规则允许使用的指令，引擎级指令（如 SecRuleEngine、Include）只能写在应用的指令中
+var customRuleDirectives = map[string]bool{
+	"secrule":   true,
+	"secaction": true,
+	"secmarker": true,
+}
+
+var ruleIDActionPattern = regexp.MustCompile(`(?i)(?:^|[",\s])id\s*:\s*'?(\d+)'?`)
+
+// IsReservedRuleID 是否为系统生成规则使用的保留ID
+func IsReservedRuleID(id int) bool {
+	return (id >= CRSSettingsRuleIDBase && id <= CRSSettingsRuleIDMax) ||
+		(id >= ExclusionRuleIDBase && id <= ExclusionRuleIDMax)
+}
+
+// LogicalLines 将指令按续行符合并为逻辑行，并跳过空行和注释
+func LogicalLines(directives string) []string {
+	var lines []string
+	var current strings.Builder
+	for _, line := range strings.Split(strings.ReplaceAll(directives, "\r\n", "\n"), "\n") {
+		trimmed := strings.TrimSpace(line)
+		if current.Len() == 0 && (trimmed == "" || strings.HasPrefix(trimmed, "#")) {
+			continue
+		}
+		if body, ok := strings.CutSuffix(trimmed, `\`); ok {
+			current.WriteString(body)
+			current.WriteString(" ")
+			continue
+		}
+		current.WriteString(trimmed)
+		lines = append(lines, current.String())
+		current.Reset()
+	}
+	if current.Len() > 0 {
+		lines = append(lines, strings.TrimSpace(current.String()))
+	}
+	return lines
+}
+
+// ParseRuleIDs 解析指令中定义的规则ID
+func ParseRuleIDs(directives string) []int {
+	var ids []int
+	for _, line := range LogicalLines(directives) {
+		for _, match := range ruleIDActionPattern.FindAllStringSubmatch(line, -1) {
+			if id, err := strconv.Atoi(match[1]); err == nil {
+				ids = append(ids, id)
+			}
+		}
+	}
+	return ids
+}
+
+// ParseCustomRuleDirectives 校验自定义规则只包含允许的指令，并返回其中定义的规则ID
+// 重复或使用保留范围的规则ID会返回错误，SecLang 语法由调用方编译校验
+func ParseCustomRuleDirectives(directives string) ([]int, error) {
+	lines := LogicalLines(directives)
+	if len(lines) == 0 {
+		return nil, errors.New("规则指令不能为空")
+	}
+	// 末尾的续行符会在组装时与下一条规则拼接
+	if strings.HasSuffix(strings.TrimSpace(directives), `\`) {
+		return nil, errors.New("规则指令不能以续行符结尾")
+	}
+	for _, line := range lines {
+		name, _, _ := strings.Cut(line, " ")
+		if !customRuleDirectives[strings.ToLower(name)] {
+			return nil, fmt.Errorf("自定义规则不允许使用 %s 指令，只允许 SecRule、SecAction、SecMarker", name)
+		}
+	}
+
+	ids := ParseRuleIDs(directives)
+	seen := make(map[int]bool, len(ids))
+	for _, id := range ids {
+		if seen[id] {
+			return nil, fmt.Errorf("规则ID %d 重复定义", id)
+		}
+		if IsReservedRuleID(id) {
+			return nil, fmt.Errorf("规则ID %d 属于系统保留范围", id)
+		}
+		seen[id] = true
+	}
+	return ids, nil
+}
+
+// ApplyCustomRules 将对指定应用生效的自定义规则按传入顺序追加到指令之后
+// 调用方负责过滤未启用的规则并按优先级排序
+func ApplyCustomRules(directives string, rules []model.CustomRule, app string) string {
+	parts := make([]string, 0, len(rules)+1)
+	if directives != "" {
+		parts = append(parts, directives)
+	}
+	for i := range rules {
+		rule := &rules[i]
+		if !rule.Enabled || !rule.AppliesTo(app) {
+			continue
+		}
+		parts = append(parts, "# 自定义规则: "+strings.ReplaceAll(rule.Name, "\n", " "), strings.TrimSpace(rule.Directives))
+	}
+	return strings.Join(parts, "\n")
+}
@@ -0,0 +1,242 @@
+package secrule
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/HUAHUAI23/simple-waf/pkg/model"
+)
+
+// 站点或路径级排除生成的运行时规则使用的保留ID范围，自定义规则不能使用该范围
+const (
+	ExclusionRuleIDBase = 9100000
+	ExclusionRuleIDMax  = 9199999
+)
+
+var (
+	ruleIDPattern  = regexp.MustCompile(`^\d+(-\d+)?$`)
+	tagPattern     = regexp.MustCompile(`^[A-Za-z0-9_\-./]+$`)
+	hostPattern    = regexp.MustCompile(`^(\*\.)?[A-Za-z0-9]([A-Za-z0-9\-.]*[A-Za-z0-9])?$`)
+	pathPattern    = regexp.MustCompile(`^/[^\s"'\\]*$`)
+	targetPattern  = regexp.MustCompile(`^([A-Za-z_]+)(:[^\s"'|,!\\]+)?$`)
+	targetCollects = map[string]bool{
+		"ARGS":                  true,
+		"ARGS_GET":              true,
+		"ARGS_POST":             true,
+		"ARGS_NAMES":            true,
+		"ARGS_GET_NAMES":        true,
+		"ARGS_POST_NAMES":       true,
+		"REQUEST_HEADERS":       true,
+		"REQUEST_HEADERS_NAMES": true,
+		"REQUEST_COOKIES":       true,
+		"REQUEST_COOKIES_NAMES": true,
+		"FILES":                 true,
+		"FILES_NAMES":           true,
+		"XML":                   true,
+		"REQUEST_BODY":          true,
+		"REQUEST_URI":           true,
+		"REQUEST_FILENAME":      true,
+		"QUERY_STRING":          true,
+	}
+)
+
+// ValidateExclusion 校验规则排除配置，确保渲染出的指令可以被 Coraza 解析
+func ValidateExclusion(exclusion *model.RuleExclusion) error {
+	switch exclusion.Type {
+	case model.ExclusionRemoveByID:
+		if len(exclusion.RuleIDs) == 0 {
+			return errors.New("禁用规则ID时必须指定规则ID")
+		}
+	case model.ExclusionRemoveByTag:
+		if len(exclusion.Tags) == 0 {
+			return errors.New("禁用规则标签时必须指定标签")
+		}
+	case model.ExclusionRemoveTargetID:
+		if len(exclusion.RuleIDs) == 0 || len(exclusion.Targets) == 0 {
+			return errors.New("排除参数时必须同时指定规则ID和排除的变量")
+		}
+	default:
+		return fmt.Errorf("无效的排除类型: %s", exclusion.Type)
+	}
+
+	for _, id := range exclusion.RuleIDs {
+		if err := validateRuleID(id); err != nil {
+			return err
+		}
+	}
+	for _, tag := range exclusion.Tags {
+		if !tagPattern.MatchString(tag) {
+			return fmt.Errorf("无效的规则标签: %s", tag)
+		}
+	}
+	for _, target := range exclusion.Targets {
+		if err := validateTarget(target); err != nil {
+			return err
+		}
+	}
+	if exclusion.Host != "" && !hostPattern.MatchString(exclusion.Host) {
+		return fmt.Errorf("无效的站点域名: %s", exclusion.Host)
+	}
+	if exclusion.Path != "" && !pathPattern.MatchString(exclusion.Path) {
+		return fmt.Errorf("无效的路径前缀: %s", exclusion.Path)
+	}
+	return nil
+}
+
+func validateRuleID(id string) error {
+	if !ruleIDPattern.MatchString(id) {
+		return fmt.Errorf("无效的规则ID: %s", id)
+	}
+	if start, end, ok := strings.Cut(id, "-"); ok {
+		startID, _ := strconv.Atoi(start)
+		endID, _ := strconv.Atoi(end)
+		if startID > endID {
+			return fmt.Errorf("无效的规则ID范围: %s", id)
+		}
+	}
+	return nil
+}
+
+func validateTarget(target string) error {
+	matches := targetPattern.FindStringSubmatch(target)
+	if matches == nil || !targetCollects[strings.ToUpper(matches[1])] {
+		return fmt.Errorf("无效的排除变量: %s", target)
+	}
+	return nil
+}
+
+// RenderExclusions 将规则排除渲染为 SecLang 指令
+// before 为站点或路径级排除生成的运行时 ctl 规则，必须位于被排除的规则之前；
+// after 为全局排除生成的 SecRuleRemoveById、SecRuleRemoveByTag、SecRuleUpdateTargetById 指令，必须位于被排除的规则之后。
+// 未启用或校验失败的排除会被跳过
+func RenderExclusions(exclusions []model.RuleExclusion) (before, after string) {
+	var beforeLines, afterLines []string
+	ruleID := ExclusionRuleIDBase
+
+	for i := range exclusions {
+		exclusion := &exclusions[i]
+		if !exclusion.Enabled || ValidateExclusion(exclusion) != nil {
+			continue
+		}
+
+		comment := "# 规则排除: " + strings.ReplaceAll(exclusion.Name, "\n", " ")
+		if exclusion.IsGlobal() {
+			afterLines = append(afterLines, comment)
+			afterLines = append(afterLines, renderGlobal(exclusion)...)
+			continue
+		}
+
+		if ruleID > ExclusionRuleIDMax {
+			continue
+		}
+		beforeLines = append(beforeLines, comment)
+		beforeLines = append(beforeLines, renderScoped(exclusion, ruleID)...)
+		ruleID++
+	}
+
+	return strings.Join(beforeLines, "\n"), strings.Join(afterLines, "\n")
+}
+
+// ApplyExclusions 将规则排除合并到应用的指令中
+func ApplyExclusions(directives string, exclusions []model.RuleExclusion) string {
+	before, after := RenderExclusions(exclusions)
+	parts := make([]string, 0, 3)
+	for _, part := range []string{before, directives, after} {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return strings.Join(parts, "\n")
+}
+
+// renderGlobal 渲染全局排除，在加载规则时直接修改规则集
+func renderGlobal(exclusion *model.RuleExclusion) []string {
+	var lines []string
+	switch exclusion.Type {
+	case model.ExclusionRemoveByID:
+		lines = append(lines, "SecRuleRemoveById "+strings.Join(exclusion.RuleIDs, " "))
+	case model.ExclusionRemoveByTag:
+		for _, tag := range exclusion.Tags {
+			lines = append(lines, "SecRuleRemoveByTag "+tag)
+		}
+	case model.ExclusionRemoveTargetID:
+		// SecRuleUpdateTargetById 每行只处理第一个ID，因此按规则ID和变量逐行渲染
+		for _, id := range exclusion.RuleIDs {
+			for _, target := range exclusion.Targets {
+				lines = append(lines, fmt.Sprintf("SecRuleUpdateTargetById %s !%s", id, target))
+			}
+		}
+	}
+	return lines
+}
+
+// renderScoped 渲染站点或路径级排除，在请求头阶段匹配站点和路径后通过 ctl 动作对当前事务生效
+func renderScoped(exclusion *model.RuleExclusion, ruleID int) []string {
+	var ctls []string
+	switch exclusion.Type {
+	case model.ExclusionRemoveByID:
+		for _, id := range exclusion.RuleIDs {
+			ctls = append(ctls, "ctl:ruleRemoveById="+id)
+		}
+	case model.ExclusionRemoveByTag:
+		for _, tag := range exclusion.Tags {
+			ctls = append(ctls, "ctl:ruleRemoveByTag="+tag)
+		}
+	case model.ExclusionRemoveTargetID:
+		for _, id := range exclusion.RuleIDs {
+			for _, target := range exclusion.Targets {
+				ctls = append(ctls, fmt.Sprintf("ctl:ruleRemoveTargetById=%s;%s", id, target))
+			}
+		}
+	}
+
+	type condition struct {
+		variable  string
+		operator  string
+		transform string
+	}
+	var conditions []condition
+	if exclusion.Host != "" {
+		conditions = append(conditions, condition{
+			variable:  "REQUEST_HEADERS:Host",
+			operator:  fmt.Sprintf(`@rx ^%s(:\d+)?$`, hostRegexp(exclusion.Host)),
+			transform: "t:none,t:lowercase",
+		})
+	}
+	if exclusion.Path != "" {
+		conditions = append(conditions, condition{
+			variable:  "REQUEST_FILENAME",
+			operator:  "@beginsWith " + exclusion.Path,
+			transform: "t:none",
+		})
+	}
+
+	// 非中断动作在链式规则的首条规则匹配时即会执行，因此 ctl 动作放在链的最后一条规则上
+	lines := make([]string, 0, len(conditions))
+	for i, cond := range conditions {
+		var actions []string
+		if i == 0 {
+			actions = append(actions, fmt.Sprintf("id:%d", ruleID), "phase:1", "pass", "nolog")
+		}
+		actions = append(actions, cond.transform)
+		if i < len(conditions)-1 {
+			actions = append(actions, "chain")
+		} else {
+			actions = append(actions, ctls...)
+		}
+		lines = append(lines, fmt.Sprintf(`SecRule %s "%s" "%s"`, cond.variable, cond.operator, strings.Join(actions, ",")))
+	}
+	return lines
+}
+
+// hostRegexp 将站点域名转换为正则，支持 *.a.com 形式的通配
+func hostRegexp(host string) string {
+	host = strings.ToLower(host)
+	if suffix, ok := strings.CutPrefix(host, "*."); ok {
+		return `[a-z0-9\-.]+\.` + regexp.QuoteMeta(suffix)
+	}
+	return regexp.QuoteMeta(host)
+}
@@ -0,0 +1,171 @@
+package secrule
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/HUAHUAI23/simple-waf/pkg/model"
+)
+
+// TestRenderExclusions 测试全局排除渲染到规则之后，站点或路径级排除渲染为规则之前的运行时规则
+func TestRenderExclusions(t *testing.T) {
+	tests := []struct {
+		name       string
+		exclusions []model.RuleExclusion
+		before     []string
+		after      []string
+	}{
+		{
+			name: "全局禁用规则ID",
+			exclusions: []model.RuleExclusion{
+				{Name: "禁用规则", Enabled: true, Type: model.ExclusionRemoveByID, RuleIDs: []string{"942100", "942200-942299"}},
+			},
+			after: []string{
+				"# 规则排除: 禁用规则",
+				"SecRuleRemoveById 942100 942200-942299",
+			},
+		},
+		{
+			name: "全局禁用标签逐行渲染",
+			exclusions: []model.RuleExclusion{
+				{Name: "禁用标签", Enabled: true, Type: model.ExclusionRemoveByTag, Tags: []string{"attack-sqli", "attack-xss"}},
+			},
+			after: []string{
+				"# 规则排除: 禁用标签",
+				"SecRuleRemoveByTag attack-sqli",
+				"SecRuleRemoveByTag attack-xss",
+			},
+		},
+		{
+			name: "全局排除参数按规则ID和变量逐行渲染",
+			exclusions: []model.RuleExclusion{
+				{Name: "密码误报", Enabled: true, Type: model.ExclusionRemoveTargetID, RuleIDs: []string{"942100", "942200"}, Targets: []string{"ARGS:password", "REQUEST_COOKIES"}},
+			},
+			after: []string{
+				"# 规则排除: 密码误报",
+				"SecRuleUpdateTargetById 942100 !ARGS:password",
+				"SecRuleUpdateTargetById 942100 !REQUEST_COOKIES",
+				"SecRuleUpdateTargetById 942200 !ARGS:password",
+				"SecRuleUpdateTargetById 942200 !REQUEST_COOKIES",
+			},
+		},
+		{
+			name: "站点级排除匹配域名和端口",
+			exclusions: []model.RuleExclusion{
+				{Name: "站点", Enabled: true, Type: model.ExclusionRemoveByID, RuleIDs: []string{"942100"}, Host: "*.a.com"},
+			},
+			before: []string{
+				"# 规则排除: 站点",
+				`SecRule REQUEST_HEADERS:Host "@rx ^[a-z0-9\-.]+\.a\.com(:\d+)?$" "id:9100000,phase:1,pass,nolog,t:none,t:lowercase,ctl:ruleRemoveById=942100"`,
+			},
+		},
+		{
+			name: "站点和路径级排除的 ctl 动作位于链的最后一条规则",
+			exclusions: []model.RuleExclusion{
+				{Name: "登录", Enabled: true, Type: model.ExclusionRemoveTargetID, RuleIDs: []string{"942100"}, Targets: []string{"ARGS:password"}, Host: "a.com", Path: "/login"},
+			},
+			before: []string{
+				"# 规则排除: 登录",
+				`SecRule REQUEST_HEADERS:Host "@rx ^a\.com(:\d+)?$" "id:9100000,phase:1,pass,nolog,t:none,t:lowercase,chain"`,
+				`SecRule REQUEST_FILENAME "@beginsWith /login" "t:none,ctl:ruleRemoveTargetById=942100;ARGS:password"`,
+			},
+		},
+		{
+			name: "全局和站点级排除分别渲染，运行时规则ID依次递增",
+			exclusions: []model.RuleExclusion{
+				{Name: "路径", Enabled: true, Type: model.ExclusionRemoveByTag, Tags: []string{"attack-sqli"}, Path: "/api"},
+				{Name: "全局", Enabled: true, Type: model.ExclusionRemoveByID, RuleIDs: []string{"920350"}},
+				{Name: "未启用", Type: model.ExclusionRemoveByID, RuleIDs: []string{"941100"}, Path: "/admin"},
+				{Name: "无效", Enabled: true, Type: model.ExclusionRemoveByID, RuleIDs: []string{"abc"}, Path: "/admin"},
+				{Name: "站点", Enabled: true, Type: model.ExclusionRemoveByID, RuleIDs: []string{"941100"}, Host: "b.com"},
+			},
+			before: []string{
+				"# 规则排除: 路径",
+				`SecRule REQUEST_FILENAME "@beginsWith /api" "id:9100000,phase:1,pass,nolog,t:none,ctl:ruleRemoveByTag=attack-sqli"`,
+				"# 规则排除: 站点",
+				`SecRule REQUEST_HEADERS:Host "@rx ^b\.com(:\d+)?$" "id:9100001,phase:1,pass,nolog,t:none,t:lowercase,ctl:ruleRemoveById=941100"`,
+			},
+			after: []string{
+				"# 规则排除: 全局",
+				"SecRuleRemoveById 920350",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before, after := RenderExclusions(tt.exclusions)
+			if want := strings.Join(tt.before, "\n"); before != want {
+				t.Errorf("before =\n%s\nwant\n%s", before, want)
+			}
+			if want := strings.Join(tt.after, "\n"); after != want {
+				t.Errorf("after =\n%s\nwant\n%s", after, want)
+			}
+		})
+	}
+}
+
+// TestRenderExclusionsIDExhausted 测试运行时规则ID用尽后跳过站点或路径级排除，全局排除不受影响
+func TestRenderExclusionsIDExhausted(t *testing.T) {
+	count := ExclusionRuleIDMax - ExclusionRuleIDBase + 1
+	exclusions := make([]model.RuleExclusion, 0, count+2)
+	for i := 0; i < count+1; i++ {
+		exclusions = append(exclusions, model.RuleExclusion{
+			Name:    "路径" + strconv.Itoa(i),
+			Enabled: true,
+			Type:    model.ExclusionRemoveByID,
+			RuleIDs: []string{"942100"},
+			Path:    "/p" + strconv.Itoa(i),
+		})
+	}
+	exclusions = append(exclusions, model.RuleExclusion{Name: "全局", Enabled: true, Type: model.ExclusionRemoveByID, RuleIDs: []string{"920350"}})
+
+	before, after := RenderExclusions(exclusions)
+	if got := strings.Count(before, "SecRule "); got != count {
+		t.Errorf("渲染了 %d 条运行时规则，期望 %d 条", got, count)
+	}
+	if !strings.Contains(before, "id:"+strconv.Itoa(ExclusionRuleIDMax)+",") {
+		t.Error("应使用保留范围内的最后一个ID")
+	}
+	if strings.Contains(before, "id:"+strconv.Itoa(ExclusionRuleIDMax+1)+",") || strings.Contains(before, "/p"+strconv.Itoa(count)+`"`) {
+		t.Error("ID用尽后的站点或路径级排除应被跳过")
+	}
+	if after != "# 规则排除: 全局\nSecRuleRemoveById 920350" {
+		t.Errorf("全局排除不应受ID用尽影响: %s", after)
+	}
+}
+
+// TestRenderScoped 测试站点和路径条件的链式规则顺序
+func TestRenderScoped(t *testing.T) {
+	tests := []struct {
+		name      string
+		exclusion model.RuleExclusion
+		want      []string
+	}{
+		{
+			name:      "只有路径",
+			exclusion: model.RuleExclusion{Type: model.ExclusionRemoveByID, RuleIDs: []string{"942100", "942200-942299"}, Path: "/upload"},
+			want: []string{
+				`SecRule REQUEST_FILENAME "@beginsWith /upload" "id:9100005,phase:1,pass,nolog,t:none,ctl:ruleRemoveById=942100,ctl:ruleRemoveById=942200-942299"`,
+			},
+		},
+		{
+			name:      "站点在前路径在后，只有首条规则带ID和阶段",
+			exclusion: model.RuleExclusion{Type: model.ExclusionRemoveByTag, Tags: []string{"attack-xss"}, Host: "a.com", Path: "/editor"},
+			want: []string{
+				`SecRule REQUEST_HEADERS:Host "@rx ^a\.com(:\d+)?$" "id:9100005,phase:1,pass,nolog,t:none,t:lowercase,chain"`,
+				`SecRule REQUEST_FILENAME "@beginsWith /editor" "t:none,ctl:ruleRemoveByTag=attack-xss"`,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := renderScoped(&tt.exclusion, ExclusionRuleIDBase+5)
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("renderScoped() =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+			}
+		})
+	}
+}
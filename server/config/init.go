@@ -12,6 +12,7 @@ import (
 	"github.com/HUAHUAI23/simple-waf/server/constant"
 	"go.mongodb.org/mongo-driver/v2/bson"
 	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
 )
 
 func InitDB(db *mongo.Database) error {
@@ -23,6 +24,10 @@ func InitDB(db *mongo.Database) error {
 		return err
 	}
 
+	if err := initAuditLog(db); err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -66,23 +71,36 @@ func createDefaultConfig() model.Config {
 	return model.Config{
 		Name: constant.GetString("APP_CONFIG_NAME", "AppConfig"),
 		Engine: model.EngineConfig{
-			Bind:            "127.0.0.1:2342",
-			UseBuiltinRules: true,
-			ASNDBPath:       filepath.Join(homeDir, "simple-waf", "geo-ip", "GeoLite2-ASN.mmdb"),
-			CityDBPath:      filepath.Join(homeDir, "simple-waf", "geo-ip", "GeoLite2-City.mmdb"),
-			FlowController:  model.GetDefaultFlowControlConfig(),
+			Bind:             "127.0.0.1:2342",
+			UseBuiltinRules:  true,
+			ASNDBPath:        filepath.Join(homeDir, "simple-waf", "geo-ip", "GeoLite2-ASN.mmdb"),
+			CityDBPath:       filepath.Join(homeDir, "simple-waf", "geo-ip", "GeoLite2-City.mmdb"),
+			CRSPluginDir:     filepath.Join(homeDir, "simple-waf", "crs-plugins"),
+			DefaultApp:       constant.GetString("Default_ENGINE_NAME", "coraza"),
+			UnknownAppPolicy: model.UnknownAppPolicyFailClosed,
+			FlowController:   model.GetDefaultFlowControlConfig(),
+			LogRedaction:     model.GetDefaultLogRedactionConfig(),
+			DecisionLog: model.DecisionLogConfig{
+				Enabled:    true,
+				SampleRate: 1,
+			},
+			AuditLog: model.GetDefaultAuditLogConfig(),
+			LogSpill: model.LogSpillConfig{
+				Enabled:     true,
+				Dir:         filepath.Join(homeDir, "simple-waf", "log-spill"),
+				MaxSize:     1024,
+				SegmentSize: 16,
+			},
+			LogAggregation: model.LogAggregationConfig{
+				Enabled:      true,
+				Window:       10,
+				MaxPerSecond: 200,
+				MaxKeys:      10000,
+			},
 			AppConfig: []model.AppConfig{
 				{
 					Name: constant.GetString("Default_ENGINE_NAME", "coraza"),
-					Directives: `SecAction \
-    "id:20001,\
-    phase:1,\
-    nolog,\
-    pass,\
-    t:none,\
-    setvar:'tx.allowed_methods=GET HEAD POST OPTIONS PUT DELETE PATCH'"
-
-Include @coraza.conf-recommended
+					Directives: `Include @coraza.conf-recommended
 Include @crs-setup.conf.example
 Include @owasp_crs/*.conf
 SecRuleEngine On
@@ -93,6 +111,12 @@ SecRuleUpdateTargetById 933120 !ARGS:json.engine.appConfig.0.directives`,
 					LogLevel:       "info",
 					LogFile:        "/dev/stdout",
 					LogFormat:      "console",
+					CRS: model.CRSSettings{
+						BlockingParanoiaLevel:    1,
+						InboundAnomalyThreshold:  5,
+						OutboundAnomalyThreshold: 4,
+						AllowedMethods:           []string{"GET", "HEAD", "POST", "OPTIONS", "PUT", "DELETE", "PATCH"},
+					},
 				},
 			},
 		},
@@ -103,6 +127,7 @@ SecRuleUpdateTargetById 933120 !ARGS:json.engine.appConfig.0.directives`,
 			SpoeAgentAddr: "127.0.0.1",
 			SpoeAgentPort: 2342,
 			Thread:        0,
+			TarpitTimeout: 10,
 		},
 		CreatedAt:       now,
 		UpdatedAt:       now,
@@ -171,6 +196,10 @@ func initWAFLog(db *mongo.Database) error {
 				{Key: "createdAt", Value: 1},
 			},
 		},
+		{
+			// 请求ID索引，按客户端上报的 X-Request-ID 查询日志
+			Keys: bson.D{{Key: "requestId", Value: 1}},
+		},
 	}
 
 	// 创建索引
@@ -181,3 +210,45 @@ func initWAFLog(db *mongo.Database) error {
 
 	return nil
 }
+
+func initAuditLog(db *mongo.Database) error {
+	var auditLog model.AuditLog
+	collectionName := auditLog.GetCollectionName()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	collections, err := db.ListCollectionNames(ctx, bson.D{})
+	if err != nil {
+		return fmt.Errorf("failed to list collections: %w", err)
+	}
+
+	if slices.Contains(collections, collectionName) {
+		return nil
+	}
+
+	indexCtx, indexCancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer indexCancel()
+
+	indexModels := []mongo.IndexModel{
+		{
+			// 请求ID索引
+			Keys: bson.D{
+				{Key: "requestId", Value: 1},
+				{Key: "createdAt", Value: -1},
+			},
+		},
+		{
+			// TTL 索引，记录在 expireAt 时间后删除，保留天数修改后新记录按新的过期时间删除
+			Keys:    bson.D{{Key: "expireAt", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		},
+	}
+
+	_, err = db.Collection(collectionName).Indexes().CreateMany(indexCtx, indexModels)
+	if err != nil {
+		return fmt.Errorf("failed to create indexes for %s collection: %w", collectionName, err)
+	}
+
+	return nil
+}
@@ -44,6 +44,8 @@ func NewBlockedIPController(blockedIPService service.BlockedIPService) BlockedIP
 //	@Param			ip		query	string	false	"IP地址过滤，支持模糊匹配"							example(192.168.1.1)
 //	@Param			reason	query	string	false	"封禁原因过滤"								example(high_frequency_attack)
 //	@Param			status	query	string	false	"状态过滤：active-生效中，expired-已过期，all-全部"	default(all)		Enums(active, expired, all)
+//	@Param			mode	query	string	false	"模式过滤：enforce-实际封禁，monitor-模拟封禁，all-全部"	default(all)		Enums(enforce, monitor, all)
+//	@Param			type	query	string	false	"类型过滤：ip-单个IP，prefix-网段升级，asn-按ASN升级"	Enums(ip, prefix, asn)
 //	@Param			sortBy	query	string	false	"排序字段"									default(blocked_at)	Enums(blocked_at, blocked_until, ip)
 //	@Param			sortDir	query	string	false	"排序方向：asc-升序，desc-降序"					default(desc)		Enums(asc, desc)
 //	@Security		BearerAuth
@@ -67,6 +69,8 @@ func (c *BlockedIPControllerImpl) GetBlockedIPs(ctx *gin.Context) {
 		Str("ip", req.IP).
 		Str("reason", req.Reason).
 		Str("status", req.Status).
+		Str("mode", req.Mode).
+		Str("type", req.Type).
 		Str("sortBy", req.SortBy).
 		Str("sortDir", req.SortDir).
 		Msg("获取封禁IP列表请求")
@@ -95,7 +99,7 @@ func (c *BlockedIPControllerImpl) GetBlockedIPs(ctx *gin.Context) {
 // GetBlockedIPStats 获取封禁IP统计信息
 //
 //	@Summary		获取封禁IP统计信息
-//	@Description	获取封禁IP的统计信息，包括总数、生效数、过期数、按原因统计和按小时统计
+//	@Description	获取封禁IP的统计信息，包括总数、生效数、过期数、按原因统计和按小时统计；监控模式下的模拟封禁单独统计，便于与实际封禁对比
 //	@Tags			封禁IP管理
 //	@Produce		json
 //	@Security		BearerAuth
@@ -118,6 +122,7 @@ func (c *BlockedIPControllerImpl) GetBlockedIPStats(ctx *gin.Context) {
 		Int64("total_blocked", stats.TotalBlocked).
 		Int64("active_blocked", stats.ActiveBlocked).
 		Int64("expired_blocked", stats.ExpiredBlocked).
+		Int64("simulated_blocked", stats.SimulatedBlocked).
 		Int("reason_types", len(stats.ReasonStats)).
 		Int("hourly_stats", len(stats.Last24HourStats)).
 		Msg("获取封禁IP统计信息成功")
@@ -3,6 +3,7 @@ package controller
 
 import (
 	"errors"
+	"sort"
 
 	"github.com/HUAHUAI23/simple-waf/pkg/model"
 	"github.com/HUAHUAI23/simple-waf/server/config"
@@ -94,6 +95,9 @@ func (c *ConfigControllerImpl) PatchConfig(ctx *gin.Context) {
 		if errors.Is(err, service.ErrConfigNotFound) {
 			response.NotFound(ctx, err)
 			return
+		} else if errors.Is(err, service.ErrInvalidConfig) {
+			response.BadRequest(ctx, err, true)
+			return
 		}
 		c.logger.Error().Err(err).Msg("更新配置失败")
 		response.InternalServerError(ctx, err, false)
@@ -110,14 +114,21 @@ func (c *ConfigControllerImpl) PatchConfig(ctx *gin.Context) {
 func mapConfigToDTO(cfg *model.Config) dto.ConfigResponse {
 	// 将配置模型转换为响应DTO
 	engineDTO := dto.EngineDTO{
-		Bind:            cfg.Engine.Bind,
-		UseBuiltinRules: cfg.Engine.UseBuiltinRules,
-		ASNDBPath:       cfg.Engine.ASNDBPath,
-		CityDBPath:      cfg.Engine.CityDBPath,
-		AppConfig:       make([]dto.AppConfigDTO, len(cfg.Engine.AppConfig)),
+		Bind:             cfg.Engine.Bind,
+		UseBuiltinRules:  cfg.Engine.UseBuiltinRules,
+		ASNDBPath:        cfg.Engine.ASNDBPath,
+		CityDBPath:       cfg.Engine.CityDBPath,
+		CRSPluginDir:     cfg.Engine.CRSPluginDir,
+		DefaultApp:       cfg.Engine.DefaultApp,
+		UnknownAppPolicy: cfg.Engine.UnknownAppPolicy,
+		AppConfig:        make([]dto.AppConfigDTO, len(cfg.Engine.AppConfig)),
 		FlowController: dto.FlowControllerDTO{
 			VisitLimit: dto.LimitConfigDTO{
 				Enabled:        cfg.Engine.FlowController.VisitLimit.Enabled,
+				Mode:           cfg.Engine.FlowController.VisitLimit.Mode,
+				Algorithm:      cfg.Engine.FlowController.VisitLimit.Algorithm,
+				Action:         cfg.Engine.FlowController.VisitLimit.Action,
+				RedirectURL:    cfg.Engine.FlowController.VisitLimit.RedirectURL,
 				Threshold:      cfg.Engine.FlowController.VisitLimit.Threshold,
 				StatDuration:   cfg.Engine.FlowController.VisitLimit.StatDuration,
 				BlockDuration:  cfg.Engine.FlowController.VisitLimit.BlockDuration,
@@ -126,21 +137,89 @@ func mapConfigToDTO(cfg *model.Config) dto.ConfigResponse {
 			},
 			AttackLimit: dto.LimitConfigDTO{
 				Enabled:        cfg.Engine.FlowController.AttackLimit.Enabled,
+				Mode:           cfg.Engine.FlowController.AttackLimit.Mode,
+				Algorithm:      cfg.Engine.FlowController.AttackLimit.Algorithm,
+				Action:         cfg.Engine.FlowController.AttackLimit.Action,
+				RedirectURL:    cfg.Engine.FlowController.AttackLimit.RedirectURL,
 				Threshold:      cfg.Engine.FlowController.AttackLimit.Threshold,
 				StatDuration:   cfg.Engine.FlowController.AttackLimit.StatDuration,
 				BlockDuration:  cfg.Engine.FlowController.AttackLimit.BlockDuration,
 				BurstCount:     cfg.Engine.FlowController.AttackLimit.BurstCount,
 				ParamsCapacity: cfg.Engine.FlowController.AttackLimit.ParamsCapacity,
 			},
-			ErrorLimit: dto.LimitConfigDTO{
-				Enabled:        cfg.Engine.FlowController.ErrorLimit.Enabled,
-				Threshold:      cfg.Engine.FlowController.ErrorLimit.Threshold,
-				StatDuration:   cfg.Engine.FlowController.ErrorLimit.StatDuration,
-				BlockDuration:  cfg.Engine.FlowController.ErrorLimit.BlockDuration,
-				BurstCount:     cfg.Engine.FlowController.ErrorLimit.BurstCount,
-				ParamsCapacity: cfg.Engine.FlowController.ErrorLimit.ParamsCapacity,
+			ErrorLimit: dto.ErrorLimitDTO{
+				LimitConfigDTO: dto.LimitConfigDTO{
+					Enabled:        cfg.Engine.FlowController.ErrorLimit.Enabled,
+					Mode:           cfg.Engine.FlowController.ErrorLimit.Mode,
+					Algorithm:      cfg.Engine.FlowController.ErrorLimit.Algorithm,
+					Action:         cfg.Engine.FlowController.ErrorLimit.Action,
+					RedirectURL:    cfg.Engine.FlowController.ErrorLimit.RedirectURL,
+					Threshold:      cfg.Engine.FlowController.ErrorLimit.Threshold,
+					StatDuration:   cfg.Engine.FlowController.ErrorLimit.StatDuration,
+					BlockDuration:  cfg.Engine.FlowController.ErrorLimit.BlockDuration,
+					BurstCount:     cfg.Engine.FlowController.ErrorLimit.BurstCount,
+					ParamsCapacity: cfg.Engine.FlowController.ErrorLimit.ParamsCapacity,
+				},
+				StatusCodes: cfg.Engine.FlowController.ErrorLimit.StatusCodes,
+				Paths:       cfg.Engine.FlowController.ErrorLimit.Paths,
+			},
+			ErrorPolicies: make([]dto.ErrorPolicyDTO, len(cfg.Engine.FlowController.ErrorPolicies)),
+			SubnetEscalation: dto.SubnetEscalationDTO{
+				Enabled:       cfg.Engine.FlowController.SubnetEscalation.Enabled,
+				IPv4PrefixLen: cfg.Engine.FlowController.SubnetEscalation.IPv4PrefixLen,
+				IPv6PrefixLen: cfg.Engine.FlowController.SubnetEscalation.IPv6PrefixLen,
+				ByASN:         cfg.Engine.FlowController.SubnetEscalation.ByASN,
+				Threshold:     cfg.Engine.FlowController.SubnetEscalation.Threshold,
+				Window:        cfg.Engine.FlowController.SubnetEscalation.Window,
+				BlockDuration: cfg.Engine.FlowController.SubnetEscalation.BlockDuration,
+			},
+			CounterBackend: dto.CounterBackendDTO{
+				Type:        cfg.Engine.FlowController.CounterBackend.Type,
+				Addr:        cfg.Engine.FlowController.CounterBackend.Addr,
+				HasPassword: cfg.Engine.FlowController.CounterBackend.Password != "",
+				DB:          cfg.Engine.FlowController.CounterBackend.DB,
+				KeyPrefix:   cfg.Engine.FlowController.CounterBackend.KeyPrefix,
+				Timeout:     cfg.Engine.FlowController.CounterBackend.Timeout,
 			},
 		},
+		DecisionLog: dto.DecisionLogDTO{
+			Enabled:    cfg.Engine.DecisionLog.Enabled,
+			SampleRate: cfg.Engine.DecisionLog.SampleRate,
+		},
+		AuditLog: dto.AuditLogDTO{
+			Enabled:       cfg.Engine.AuditLog.Enabled,
+			Parts:         cfg.Engine.AuditLog.Parts,
+			BodyLimit:     cfg.Engine.AuditLog.BodyLimit,
+			RetentionDays: cfg.Engine.AuditLog.RetentionDays,
+		},
+		LogSpill: dto.LogSpillDTO{
+			Enabled:     cfg.Engine.LogSpill.Enabled,
+			Dir:         cfg.Engine.LogSpill.Dir,
+			MaxSize:     cfg.Engine.LogSpill.MaxSize,
+			SegmentSize: cfg.Engine.LogSpill.SegmentSize,
+		},
+		LogAggregation: dto.LogAggregationDTO{
+			Enabled:      cfg.Engine.LogAggregation.Enabled,
+			Window:       cfg.Engine.LogAggregation.Window,
+			MaxPerSecond: cfg.Engine.LogAggregation.MaxPerSecond,
+			MaxKeys:      cfg.Engine.LogAggregation.MaxKeys,
+		},
+		LogRedaction: dto.LogRedactionDTO{
+			Enabled:    cfg.Engine.LogRedaction.Enabled,
+			Mode:       cfg.Engine.LogRedaction.Mode,
+			HasHashKey: cfg.Engine.LogRedaction.HashKey != "",
+			Headers:    cfg.Engine.LogRedaction.Headers,
+			Fields:     cfg.Engine.LogRedaction.Fields,
+			Patterns:   make([]dto.RedactionPatternDTO, len(cfg.Engine.LogRedaction.Patterns)),
+		},
+	}
+
+	// 转换日志脱敏规则
+	for i, pattern := range cfg.Engine.LogRedaction.Patterns {
+		engineDTO.LogRedaction.Patterns[i] = dto.RedactionPatternDTO{
+			Name:    pattern.Name,
+			Pattern: pattern.Pattern,
+		}
 	}
 
 	// 转换应用配置
@@ -152,6 +231,39 @@ func mapConfigToDTO(cfg *model.Config) dto.ConfigResponse {
 			LogLevel:       app.LogLevel,
 			LogFile:        app.LogFile,
 			LogFormat:      app.LogFormat,
+			CRS: dto.CRSSettingsDTO{
+				BlockingParanoiaLevel:    app.CRS.BlockingParanoiaLevel,
+				DetectionParanoiaLevel:   app.CRS.DetectionParanoiaLevel,
+				InboundAnomalyThreshold:  app.CRS.InboundAnomalyThreshold,
+				OutboundAnomalyThreshold: app.CRS.OutboundAnomalyThreshold,
+				WarningAnomalyScore:      app.CRS.WarningAnomalyScore,
+				AllowedMethods:           app.CRS.AllowedMethods,
+				AllowedContentTypes:      app.CRS.AllowedContentTypes,
+				RestrictedExtensions:     app.CRS.RestrictedExtensions,
+				DisabledRuleFamilies:     app.CRS.DisabledRuleFamilies,
+				Plugins:                  app.CRS.Plugins,
+			},
+			LogSinks:      mapLogSinksToDTO(app.LogSinks),
+			LogCollection: app.LogCollection,
+		}
+	}
+
+	// 转换命名错误策略
+	for i, policy := range cfg.Engine.FlowController.ErrorPolicies {
+		engineDTO.FlowController.ErrorPolicies[i] = dto.ErrorPolicyDTO{
+			Name:           policy.Name,
+			Enabled:        policy.Enabled,
+			Mode:           policy.Mode,
+			Algorithm:      policy.Algorithm,
+			Action:         policy.Action,
+			RedirectURL:    policy.RedirectURL,
+			StatusCodes:    policy.StatusCodes,
+			Paths:          policy.Paths,
+			Threshold:      policy.Threshold,
+			StatDuration:   policy.StatDuration,
+			BlockDuration:  policy.BlockDuration,
+			BurstCount:     policy.BurstCount,
+			ParamsCapacity: policy.ParamsCapacity,
 		}
 	}
 
@@ -163,6 +275,7 @@ func mapConfigToDTO(cfg *model.Config) dto.ConfigResponse {
 		SpoeAgentAddr: cfg.Haproxy.SpoeAgentAddr,
 		SpoeAgentPort: cfg.Haproxy.SpoeAgentPort,
 		Thread:        cfg.Haproxy.Thread,
+		TarpitTimeout: cfg.Haproxy.TarpitTimeout,
 	}
 
 	return dto.ConfigResponse{
@@ -176,3 +289,45 @@ func mapConfigToDTO(cfg *model.Config) dto.ConfigResponse {
 		IsK8s:           cfg.IsK8s,
 	}
 }
+
+// mapLogSinksToDTO 转换日志输出配置，webhook 只返回请求头名称
+func mapLogSinksToDTO(sinks []model.LogSinkConfig) []dto.LogSinkDTO {
+	result := make([]dto.LogSinkDTO, len(sinks))
+	for i, sink := range sinks {
+		result[i] = dto.LogSinkDTO{
+			Name:    sink.Name,
+			Type:    sink.Type,
+			Enabled: sink.Enabled,
+		}
+		switch sink.Type {
+		case model.LogSinkSyslog:
+			result[i].Syslog = &dto.SyslogSinkDTO{
+				Network:            sink.Syslog.Network,
+				Address:            sink.Syslog.Address,
+				Format:             sink.Syslog.Format,
+				Facility:           sink.Syslog.Facility,
+				InsecureSkipVerify: sink.Syslog.InsecureSkipVerify,
+			}
+		case model.LogSinkFile:
+			result[i].File = &dto.FileSinkDTO{
+				Path:       sink.File.Path,
+				MaxSize:    sink.File.MaxSize,
+				MaxBackups: sink.File.MaxBackups,
+			}
+		case model.LogSinkWebhook:
+			headerNames := make([]string, 0, len(sink.Webhook.Headers))
+			for name := range sink.Webhook.Headers {
+				headerNames = append(headerNames, name)
+			}
+			sort.Strings(headerNames)
+			result[i].Webhook = &dto.WebhookSinkDTO{
+				URL:         sink.Webhook.URL,
+				HeaderNames: headerNames,
+				BatchSize:   sink.Webhook.BatchSize,
+				Timeout:     sink.Webhook.Timeout,
+				MaxRetries:  sink.Webhook.MaxRetries,
+			}
+		}
+	}
+	return result
+}
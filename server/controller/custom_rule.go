@@ -0,0 +1,251 @@
+// server/controller/custom_rule.go
+package controller
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/HUAHUAI23/simple-waf/server/config"
+	"github.com/HUAHUAI23/simple-waf/server/dto"
+	"github.com/HUAHUAI23/simple-waf/server/model"
+	"github.com/HUAHUAI23/simple-waf/server/service"
+	"github.com/HUAHUAI23/simple-waf/server/utils/response"
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// CustomRuleController 自定义规则控制器接口
+type CustomRuleController interface {
+	CreateCustomRule(ctx *gin.Context)
+	GetCustomRules(ctx *gin.Context)
+	GetCustomRuleByID(ctx *gin.Context)
+	UpdateCustomRule(ctx *gin.Context)
+	DeleteCustomRule(ctx *gin.Context)
+}
+
+// CustomRuleControllerImpl 自定义规则控制器实现
+type CustomRuleControllerImpl struct {
+	ruleService service.CustomRuleService
+	logger      zerolog.Logger
+}
+
+// NewCustomRuleController 创建自定义规则控制器
+func NewCustomRuleController(ruleService service.CustomRuleService) CustomRuleController {
+	logger := config.GetControllerLogger("customrule")
+	return &CustomRuleControllerImpl{
+		ruleService: ruleService,
+		logger:      logger,
+	}
+}
+
+// CreateCustomRule 创建自定义规则
+//
+//	@Summary		创建自定义规则
+//	@Description	创建自定义 SecLang 规则，保存前使用 Coraza 编译校验并检测与 CRS、其他自定义规则的规则ID冲突，引擎重新加载后生效
+//	@Tags			自定义规则管理
+//	@Accept			json
+//	@Produce		json
+//	@Param			rule	body	dto.CustomRuleCreateRequest	true	"自定义规则信息"
+//	@Security		BearerAuth
+//	@Success		200	{object}	model.SuccessResponse{data=model.CustomRule}	"自定义规则创建成功"
+//	@Failure		400	{object}	model.ErrResponse								"请求参数错误"
+//	@Failure		401	{object}	model.ErrResponseDontShowError					"未授权访问"
+//	@Failure		403	{object}	model.ErrResponseDontShowError					"禁止访问"
+//	@Failure		409	{object}	model.ErrResponseDontShowError					"自定义规则名称已存在或规则ID冲突"
+//	@Failure		500	{object}	model.ErrResponseDontShowError					"服务器内部错误"
+//	@Router			/api/v1/custom-rules [post]
+func (c *CustomRuleControllerImpl) CreateCustomRule(ctx *gin.Context) {
+	var req dto.CustomRuleCreateRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		c.logger.Warn().Err(err).Msg("请求参数绑定失败")
+		response.BadRequest(ctx, err, true)
+		return
+	}
+
+	c.logger.Info().Str("name", req.Name).Msg("创建自定义规则请求")
+	rule, err := c.ruleService.CreateCustomRule(ctx, &req)
+	if err != nil {
+		if errors.Is(err, service.ErrCustomRuleNameExists) {
+			response.Error(ctx, model.NewAPIError(http.StatusConflict, "自定义规则名称已存在", err), false)
+			return
+		} else if errors.Is(err, service.ErrCustomRuleIDConflict) {
+			response.Error(ctx, model.NewAPIError(http.StatusConflict, err.Error(), err), false)
+			return
+		} else if errors.Is(err, service.ErrInvalidCustomRule) {
+			response.BadRequest(ctx, err, true)
+			return
+		}
+		c.logger.Error().Err(err).Msg("创建自定义规则失败")
+		response.InternalServerError(ctx, err, false)
+		return
+	}
+
+	c.logger.Info().Str("id", rule.ID.Hex()).Str("name", rule.Name).Msg("自定义规则创建成功")
+	response.Success(ctx, "自定义规则创建成功", rule)
+}
+
+// GetCustomRules 获取自定义规则列表
+//
+//	@Summary		获取自定义规则列表
+//	@Description	获取所有自定义规则，按优先级和创建时间排序即组装到应用中的顺序，支持分页
+//	@Tags			自定义规则管理
+//	@Produce		json
+//	@Param			page	query	int	false	"页码"	default(1)
+//	@Param			size	query	int	false	"每页数量"	default(10)
+//	@Security		BearerAuth
+//	@Success		200	{object}	model.SuccessResponse{data=dto.CustomRuleListResponse}	"获取自定义规则列表成功"
+//	@Failure		401	{object}	model.ErrResponseDontShowError								"未授权访问"
+//	@Failure		500	{object}	model.ErrResponseDontShowError								"服务器内部错误"
+//	@Router			/api/v1/custom-rules [get]
+func (c *CustomRuleControllerImpl) GetCustomRules(ctx *gin.Context) {
+	page := ctx.DefaultQuery("page", "1")
+	size := ctx.DefaultQuery("size", "10")
+
+	c.logger.Info().Str("page", page).Str("size", size).Msg("获取自定义规则列表请求")
+	rules, total, err := c.ruleService.GetCustomRules(ctx, page, size)
+	if err != nil {
+		c.logger.Error().Err(err).Msg("获取自定义规则列表失败")
+		response.InternalServerError(ctx, err, false)
+		return
+	}
+
+	c.logger.Info().Int64("total", total).Msg("获取自定义规则列表成功")
+	response.Success(ctx, "获取自定义规则列表成功", gin.H{
+		"total": total,
+		"items": rules,
+	})
+}
+
+// GetCustomRuleByID 获取单个自定义规则
+//
+//	@Summary		获取单个自定义规则
+//	@Description	根据ID获取自定义规则详情
+//	@Tags			自定义规则管理
+//	@Produce		json
+//	@Param			id	path	string	true	"自定义规则ID"
+//	@Security		BearerAuth
+//	@Success		200	{object}	model.SuccessResponse{data=model.CustomRule}	"获取自定义规则详情成功"
+//	@Failure		400	{object}	model.ErrResponse								"无效的ID格式"
+//	@Failure		401	{object}	model.ErrResponseDontShowError					"未授权访问"
+//	@Failure		404	{object}	model.ErrResponseDontShowError					"自定义规则不存在"
+//	@Failure		500	{object}	model.ErrResponseDontShowError					"服务器内部错误"
+//	@Router			/api/v1/custom-rules/{id} [get]
+func (c *CustomRuleControllerImpl) GetCustomRuleByID(ctx *gin.Context) {
+	id := ctx.Param("id")
+
+	c.logger.Info().Str("id", id).Msg("获取自定义规则详情请求")
+	objectID, err := bson.ObjectIDFromHex(id)
+	if err != nil {
+		c.logger.Error().Err(err).Str("id", id).Msg("无效的ID格式")
+		response.BadRequest(ctx, err, true)
+		return
+	}
+	rule, err := c.ruleService.GetCustomRuleByID(ctx, objectID)
+	if err != nil {
+		if errors.Is(err, service.ErrCustomRuleNotFound) {
+			response.NotFound(ctx, err)
+			return
+		}
+		c.logger.Error().Err(err).Str("id", id).Msg("获取自定义规则详情失败")
+		response.InternalServerError(ctx, err, false)
+		return
+	}
+
+	response.Success(ctx, "获取自定义规则详情成功", rule)
+}
+
+// UpdateCustomRule 更新自定义规则
+//
+//	@Summary		更新自定义规则
+//	@Description	更新指定自定义规则的信息，未传的字段保持不变，保存前重新编译校验，引擎重新加载后生效
+//	@Tags			自定义规则管理
+//	@Accept			json
+//	@Produce		json
+//	@Param			id		path	string						true	"自定义规则ID"
+//	@Param			rule	body	dto.CustomRuleUpdateRequest	true	"自定义规则更新信息"
+//	@Security		BearerAuth
+//	@Success		200	{object}	model.SuccessResponse{data=model.CustomRule}	"自定义规则更新成功"
+//	@Failure		400	{object}	model.ErrResponse								"请求参数错误"
+//	@Failure		401	{object}	model.ErrResponseDontShowError					"未授权访问"
+//	@Failure		404	{object}	model.ErrResponseDontShowError					"自定义规则不存在"
+//	@Failure		409	{object}	model.ErrResponseDontShowError					"自定义规则名称已存在或规则ID冲突"
+//	@Failure		500	{object}	model.ErrResponseDontShowError					"服务器内部错误"
+//	@Router			/api/v1/custom-rules/{id} [put]
+func (c *CustomRuleControllerImpl) UpdateCustomRule(ctx *gin.Context) {
+	id := ctx.Param("id")
+	var req dto.CustomRuleUpdateRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		c.logger.Warn().Err(err).Str("id", id).Msg("请求参数绑定失败")
+		response.BadRequest(ctx, err, true)
+		return
+	}
+
+	c.logger.Info().Str("id", id).Msg("更新自定义规则请求")
+	objectID, err := bson.ObjectIDFromHex(id)
+	if err != nil {
+		c.logger.Error().Err(err).Str("id", id).Msg("无效的ID格式")
+		response.BadRequest(ctx, err, true)
+		return
+	}
+	rule, err := c.ruleService.UpdateCustomRule(ctx, objectID, &req)
+	if err != nil {
+		if errors.Is(err, service.ErrCustomRuleNotFound) {
+			response.NotFound(ctx, err)
+			return
+		} else if errors.Is(err, service.ErrCustomRuleNameExists) {
+			response.Error(ctx, model.NewAPIError(http.StatusConflict, "自定义规则名称已存在", err), false)
+			return
+		} else if errors.Is(err, service.ErrCustomRuleIDConflict) {
+			response.Error(ctx, model.NewAPIError(http.StatusConflict, err.Error(), err), false)
+			return
+		} else if errors.Is(err, service.ErrInvalidCustomRule) {
+			response.BadRequest(ctx, err, true)
+			return
+		}
+		c.logger.Error().Err(err).Str("id", id).Msg("更新自定义规则失败")
+		response.InternalServerError(ctx, err, false)
+		return
+	}
+
+	c.logger.Info().Str("id", id).Str("name", rule.Name).Msg("自定义规则更新成功")
+	response.Success(ctx, "自定义规则更新成功", rule)
+}
+
+// DeleteCustomRule 删除自定义规则
+//
+//	@Summary		删除自定义规则
+//	@Description	删除指定的自定义规则，引擎重新加载后生效
+//	@Tags			自定义规则管理
+//	@Produce		json
+//	@Param			id	path	string	true	"自定义规则ID"
+//	@Security		BearerAuth
+//	@Success		200	{object}	model.SuccessResponseNoData		"自定义规则删除成功"
+//	@Failure		400	{object}	model.ErrResponse				"无效的ID格式"
+//	@Failure		401	{object}	model.ErrResponseDontShowError	"未授权访问"
+//	@Failure		404	{object}	model.ErrResponseDontShowError	"自定义规则不存在"
+//	@Failure		500	{object}	model.ErrResponseDontShowError	"服务器内部错误"
+//	@Router			/api/v1/custom-rules/{id} [delete]
+func (c *CustomRuleControllerImpl) DeleteCustomRule(ctx *gin.Context) {
+	id := ctx.Param("id")
+
+	c.logger.Info().Str("id", id).Msg("删除自定义规则请求")
+	objectID, err := bson.ObjectIDFromHex(id)
+	if err != nil {
+		c.logger.Error().Err(err).Str("id", id).Msg("无效的ID格式")
+		response.BadRequest(ctx, err, true)
+		return
+	}
+	if err := c.ruleService.DeleteCustomRule(ctx, objectID); err != nil {
+		if errors.Is(err, service.ErrCustomRuleNotFound) {
+			response.NotFound(ctx, err)
+			return
+		}
+		c.logger.Error().Err(err).Str("id", id).Msg("删除自定义规则失败")
+		response.InternalServerError(ctx, err, false)
+		return
+	}
+
+	c.logger.Info().Str("id", id).Msg("自定义规则删除成功")
+	response.Success(ctx, "自定义规则删除成功", nil)
+}
@@ -0,0 +1,245 @@
+// server/controller/rule_exclusion.go
+package controller
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/HUAHUAI23/simple-waf/server/config"
+	"github.com/HUAHUAI23/simple-waf/server/dto"
+	"github.com/HUAHUAI23/simple-waf/server/model"
+	"github.com/HUAHUAI23/simple-waf/server/service"
+	"github.com/HUAHUAI23/simple-waf/server/utils/response"
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// RuleExclusionController 规则排除控制器接口
+type RuleExclusionController interface {
+	CreateRuleExclusion(ctx *gin.Context)
+	GetRuleExclusions(ctx *gin.Context)
+	GetRuleExclusionByID(ctx *gin.Context)
+	UpdateRuleExclusion(ctx *gin.Context)
+	DeleteRuleExclusion(ctx *gin.Context)
+}
+
+// RuleExclusionControllerImpl 规则排除控制器实现
+type RuleExclusionControllerImpl struct {
+	exclusionService service.RuleExclusionService
+	logger           zerolog.Logger
+}
+
+// NewRuleExclusionController 创建规则排除控制器
+func NewRuleExclusionController(exclusionService service.RuleExclusionService) RuleExclusionController {
+	logger := config.GetControllerLogger("ruleexclusion")
+	return &RuleExclusionControllerImpl{
+		exclusionService: exclusionService,
+		logger:           logger,
+	}
+}
+
+// CreateRuleExclusion 创建规则排除
+//
+//	@Summary		创建规则排除
+//	@Description	创建CRS规则排除，用于全局、按站点或按路径禁用规则ID、规则标签，或从规则中排除参数、请求头，引擎重新加载后生效
+//	@Tags			规则排除管理
+//	@Accept			json
+//	@Produce		json
+//	@Param			exclusion	body	dto.RuleExclusionCreateRequest	true	"规则排除信息"
+//	@Security		BearerAuth
+//	@Success		200	{object}	model.SuccessResponse{data=model.RuleExclusion}	"规则排除创建成功"
+//	@Failure		400	{object}	model.ErrResponse								"请求参数错误"
+//	@Failure		401	{object}	model.ErrResponseDontShowError					"未授权访问"
+//	@Failure		403	{object}	model.ErrResponseDontShowError					"禁止访问"
+//	@Failure		409	{object}	model.ErrResponseDontShowError					"规则排除名称已存在"
+//	@Failure		500	{object}	model.ErrResponseDontShowError					"服务器内部错误"
+//	@Router			/api/v1/rule-exclusions [post]
+func (c *RuleExclusionControllerImpl) CreateRuleExclusion(ctx *gin.Context) {
+	var req dto.RuleExclusionCreateRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		c.logger.Warn().Err(err).Msg("请求参数绑定失败")
+		response.BadRequest(ctx, err, true)
+		return
+	}
+
+	c.logger.Info().Str("name", req.Name).Msg("创建规则排除请求")
+	exclusion, err := c.exclusionService.CreateRuleExclusion(ctx, &req)
+	if err != nil {
+		if errors.Is(err, service.ErrRuleExclusionNameExists) {
+			response.Error(ctx, model.NewAPIError(http.StatusConflict, "规则排除名称已存在", err), false)
+			return
+		} else if errors.Is(err, service.ErrInvalidRuleExclusion) {
+			response.BadRequest(ctx, err, true)
+			return
+		}
+		c.logger.Error().Err(err).Msg("创建规则排除失败")
+		response.InternalServerError(ctx, err, false)
+		return
+	}
+
+	c.logger.Info().Str("id", exclusion.ID.Hex()).Str("name", exclusion.Name).Msg("规则排除创建成功")
+	response.Success(ctx, "规则排除创建成功", exclusion)
+}
+
+// GetRuleExclusions 获取规则排除列表
+//
+//	@Summary		获取规则排除列表
+//	@Description	获取所有规则排除，按创建时间排序，支持分页
+//	@Tags			规则排除管理
+//	@Produce		json
+//	@Param			page	query	int	false	"页码"	default(1)
+//	@Param			size	query	int	false	"每页数量"	default(10)
+//	@Security		BearerAuth
+//	@Success		200	{object}	model.SuccessResponse{data=dto.RuleExclusionListResponse}	"获取规则排除列表成功"
+//	@Failure		401	{object}	model.ErrResponseDontShowError								"未授权访问"
+//	@Failure		500	{object}	model.ErrResponseDontShowError								"服务器内部错误"
+//	@Router			/api/v1/rule-exclusions [get]
+func (c *RuleExclusionControllerImpl) GetRuleExclusions(ctx *gin.Context) {
+	page := ctx.DefaultQuery("page", "1")
+	size := ctx.DefaultQuery("size", "10")
+
+	c.logger.Info().Str("page", page).Str("size", size).Msg("获取规则排除列表请求")
+	exclusions, total, err := c.exclusionService.GetRuleExclusions(ctx, page, size)
+	if err != nil {
+		c.logger.Error().Err(err).Msg("获取规则排除列表失败")
+		response.InternalServerError(ctx, err, false)
+		return
+	}
+
+	c.logger.Info().Int64("total", total).Msg("获取规则排除列表成功")
+	response.Success(ctx, "获取规则排除列表成功", gin.H{
+		"total": total,
+		"items": exclusions,
+	})
+}
+
+// GetRuleExclusionByID 获取单个规则排除
+//
+//	@Summary		获取单个规则排除
+//	@Description	根据ID获取规则排除详情
+//	@Tags			规则排除管理
+//	@Produce		json
+//	@Param			id	path	string	true	"规则排除ID"
+//	@Security		BearerAuth
+//	@Success		200	{object}	model.SuccessResponse{data=model.RuleExclusion}	"获取规则排除详情成功"
+//	@Failure		400	{object}	model.ErrResponse								"无效的ID格式"
+//	@Failure		401	{object}	model.ErrResponseDontShowError					"未授权访问"
+//	@Failure		404	{object}	model.ErrResponseDontShowError					"规则排除不存在"
+//	@Failure		500	{object}	model.ErrResponseDontShowError					"服务器内部错误"
+//	@Router			/api/v1/rule-exclusions/{id} [get]
+func (c *RuleExclusionControllerImpl) GetRuleExclusionByID(ctx *gin.Context) {
+	id := ctx.Param("id")
+
+	c.logger.Info().Str("id", id).Msg("获取规则排除详情请求")
+	objectID, err := bson.ObjectIDFromHex(id)
+	if err != nil {
+		c.logger.Error().Err(err).Str("id", id).Msg("无效的ID格式")
+		response.BadRequest(ctx, err, true)
+		return
+	}
+	exclusion, err := c.exclusionService.GetRuleExclusionByID(ctx, objectID)
+	if err != nil {
+		if errors.Is(err, service.ErrRuleExclusionNotFound) {
+			response.NotFound(ctx, err)
+			return
+		}
+		c.logger.Error().Err(err).Str("id", id).Msg("获取规则排除详情失败")
+		response.InternalServerError(ctx, err, false)
+		return
+	}
+
+	response.Success(ctx, "获取规则排除详情成功", exclusion)
+}
+
+// UpdateRuleExclusion 更新规则排除
+//
+//	@Summary		更新规则排除
+//	@Description	更新指定规则排除的信息，未传的字段保持不变，引擎重新加载后生效
+//	@Tags			规则排除管理
+//	@Accept			json
+//	@Produce		json
+//	@Param			id			path	string							true	"规则排除ID"
+//	@Param			exclusion	body	dto.RuleExclusionUpdateRequest	true	"规则排除更新信息"
+//	@Security		BearerAuth
+//	@Success		200	{object}	model.SuccessResponse{data=model.RuleExclusion}	"规则排除更新成功"
+//	@Failure		400	{object}	model.ErrResponse								"请求参数错误"
+//	@Failure		401	{object}	model.ErrResponseDontShowError					"未授权访问"
+//	@Failure		404	{object}	model.ErrResponseDontShowError					"规则排除不存在"
+//	@Failure		409	{object}	model.ErrResponseDontShowError					"规则排除名称已存在"
+//	@Failure		500	{object}	model.ErrResponseDontShowError					"服务器内部错误"
+//	@Router			/api/v1/rule-exclusions/{id} [put]
+func (c *RuleExclusionControllerImpl) UpdateRuleExclusion(ctx *gin.Context) {
+	id := ctx.Param("id")
+	var req dto.RuleExclusionUpdateRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		c.logger.Warn().Err(err).Str("id", id).Msg("请求参数绑定失败")
+		response.BadRequest(ctx, err, true)
+		return
+	}
+
+	c.logger.Info().Str("id", id).Msg("更新规则排除请求")
+	objectID, err := bson.ObjectIDFromHex(id)
+	if err != nil {
+		c.logger.Error().Err(err).Str("id", id).Msg("无效的ID格式")
+		response.BadRequest(ctx, err, true)
+		return
+	}
+	exclusion, err := c.exclusionService.UpdateRuleExclusion(ctx, objectID, &req)
+	if err != nil {
+		if errors.Is(err, service.ErrRuleExclusionNotFound) {
+			response.NotFound(ctx, err)
+			return
+		} else if errors.Is(err, service.ErrRuleExclusionNameExists) {
+			response.Error(ctx, model.NewAPIError(http.StatusConflict, "规则排除名称已存在", err), false)
+			return
+		} else if errors.Is(err, service.ErrInvalidRuleExclusion) {
+			response.BadRequest(ctx, err, true)
+			return
+		}
+		c.logger.Error().Err(err).Str("id", id).Msg("更新规则排除失败")
+		response.InternalServerError(ctx, err, false)
+		return
+	}
+
+	c.logger.Info().Str("id", id).Str("name", exclusion.Name).Msg("规则排除更新成功")
+	response.Success(ctx, "规则排除更新成功", exclusion)
+}
+
+// DeleteRuleExclusion 删除规则排除
+//
+//	@Summary		删除规则排除
+//	@Description	删除指定的规则排除，引擎重新加载后生效
+//	@Tags			规则排除管理
+//	@Produce		json
+//	@Param			id	path	string	true	"规则排除ID"
+//	@Security		BearerAuth
+//	@Success		200	{object}	model.SuccessResponseNoData		"规则排除删除成功"
+//	@Failure		400	{object}	model.ErrResponse				"无效的ID格式"
+//	@Failure		401	{object}	model.ErrResponseDontShowError	"未授权访问"
+//	@Failure		404	{object}	model.ErrResponseDontShowError	"规则排除不存在"
+//	@Failure		500	{object}	model.ErrResponseDontShowError	"服务器内部错误"
+//	@Router			/api/v1/rule-exclusions/{id} [delete]
+func (c *RuleExclusionControllerImpl) DeleteRuleExclusion(ctx *gin.Context) {
+	id := ctx.Param("id")
+
+	c.logger.Info().Str("id", id).Msg("删除规则排除请求")
+	objectID, err := bson.ObjectIDFromHex(id)
+	if err != nil {
+		c.logger.Error().Err(err).Str("id", id).Msg("无效的ID格式")
+		response.BadRequest(ctx, err, true)
+		return
+	}
+	if err := c.exclusionService.DeleteRuleExclusion(ctx, objectID); err != nil {
+		if errors.Is(err, service.ErrRuleExclusionNotFound) {
+			response.NotFound(ctx, err)
+			return
+		}
+		c.logger.Error().Err(err).Str("id", id).Msg("删除规则排除失败")
+		response.InternalServerError(ctx, err, false)
+		return
+	}
+
+	c.logger.Info().Str("id", id).Msg("规则排除删除成功")
+	response.Success(ctx, "规则排除删除成功", nil)
+}
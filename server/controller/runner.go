@@ -71,11 +71,15 @@ func getSuccessMessage(action string) string {
 }
 
 // toRunnerStatusResponse 将状态转换为响应对象
-func toRunnerStatusResponse(state daemon.ServiceState) dto.RunnerStatusResponse {
-	return dto.RunnerStatusResponse{
+func toRunnerStatusResponse(state daemon.ServiceState, lastErr error) dto.RunnerStatusResponse {
+	resp := dto.RunnerStatusResponse{
 		State:     getStateString(state),
 		IsRunning: isStateRunning(state),
 	}
+	if lastErr != nil {
+		resp.LastError = lastErr.Error()
+	}
+	return resp
 }
 
 // buildControlResponse 构建控制响应
@@ -107,7 +111,24 @@ func (c *RunnerControllerImpl) GetStatus(ctx *gin.Context) {
 	}
 
 	// 构建响应
-	resp := toRunnerStatusResponse(state)
+	resp := toRunnerStatusResponse(state, c.runnerService.GetLastError(ctx))
+	stats := c.runnerService.GetEngineStats(ctx)
+	resp.EngineErrors = dto.EngineErrorStats{
+		MalformedMessages:   stats.MalformedMessages,
+		UnknownApps:         stats.UnknownApps,
+		DefaultAppFallbacks: stats.DefaultAppFallbacks,
+		HandlerErrors:       stats.HandlerErrors,
+	}
+	logStats := c.runnerService.GetLogStoreStats(ctx)
+	resp.LogStore = dto.LogStoreStats{
+		Dropped:       logStats.Dropped,
+		Spilled:       logStats.Spilled,
+		Replayed:      logStats.Replayed,
+		SpillBytes:    logStats.SpillBytes,
+		SpillSegments: logStats.SpillSegments,
+		Collapsed:     logStats.Collapsed,
+		SampledOut:    logStats.SampledOut,
+	}
 
 	response.Success(ctx, "获取运行器状态成功", resp)
 }
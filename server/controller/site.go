@@ -71,6 +71,10 @@ func (c *SiteControllerImpl) CreateSite(ctx *gin.Context) {
 			response.Error(ctx, model.NewAPIError(http.StatusConflict, "域名和端口组合已存在", err), false)
 			return
 		}
+		if errors.Is(err, model.ErrInvalidBlockPage) {
+			response.Error(ctx, model.NewAPIError(http.StatusBadRequest, "拦截页面模板无效", err), true)
+			return
+		}
 		c.logger.Error().Err(err).Msg("创建站点失败")
 		response.InternalServerError(ctx, err, false)
 		return
@@ -196,6 +200,9 @@ func (c *SiteControllerImpl) UpdateSite(ctx *gin.Context) {
 		} else if errors.Is(err, repository.ErrDomainPortConflict) {
 			response.Error(ctx, model.NewAPIError(http.StatusConflict, "域名和端口组合已被其他站点使用", err), false)
 			return
+		} else if errors.Is(err, model.ErrInvalidBlockPage) {
+			response.Error(ctx, model.NewAPIError(http.StatusBadRequest, "拦截页面模板无效", err), true)
+			return
 		}
 		c.logger.Error().Err(err).Str("id", id).Msg("更新站点失败")
 		response.InternalServerError(ctx, err, false)
@@ -1,9 +1,14 @@
 package controller
 
 import (
+	"errors"
+	"net/http"
+	"strings"
 	"time"
 
 	"github.com/HUAHUAI23/simple-waf/server/dto"
+	"github.com/HUAHUAI23/simple-waf/server/model"
+	"github.com/HUAHUAI23/simple-waf/server/repository"
 	"github.com/HUAHUAI23/simple-waf/server/service"
 	"github.com/HUAHUAI23/simple-waf/server/utils/response"
 	"github.com/gin-gonic/gin"
@@ -12,6 +17,7 @@ import (
 type WAFLogController interface {
 	GetAttackEvents(ctx *gin.Context)
 	GetAttackLogs(ctx *gin.Context)
+	GetAuditLog(ctx *gin.Context)
 }
 
 type WAFLogControllerImpl struct {
@@ -100,7 +106,10 @@ func (c *WAFLogControllerImpl) GetAttackEvents(ctx *gin.Context) {
 //	@Param			domain		query		string												false	"域名，被攻击的站点域名"
 //	@Param			srcPort		query		integer												false	"来源端口号，发起攻击的端口"
 //	@Param			dstPort		query		integer												false	"目标端口号，被攻击的服务端口"
-//	@Param			requestId	query		string												false	"请求ID，唯一标识HTTP请求的ID"
+//	@Param			requestId	query		string												false	"请求ID，即响应头 X-Request-ID 的值，指定后不使用默认的24小时时间范围"
+//	@Param			engine		query		string												false	"做出决策的引擎"	Enums(coraza, micro, flow, ipban)
+//	@Param			action		query		string												false	"处置动作，如 deny、throttle、tarpit、drop、redirect"
+//	@Param			mode		query		string												false	"决策模式，observe 为监控模式下未拦截的记录，near_miss 为异常分数达到告警分数但未拦截的记录"	Enums(enforce, observe, near_miss)
 //	@Param			startTime	query		string												false	"查询起始时间 (ISO8601格式，如: 2024-03-17T00:00:00Z)"
 //	@Param			endTime		query		string												false	"查询结束时间 (ISO8601格式，如: 2024-03-18T23:59:59Z)"
 //	@Param			page		query		integer												false	"当前页码，从1开始计数 (默认: 1)"
@@ -118,14 +127,18 @@ func (c *WAFLogControllerImpl) GetAttackLogs(ctx *gin.Context) {
 		return
 	}
 
-	// 设置默认值时使用UTC时区
-	if req.StartTime.IsZero() {
-		// 默认: 24小时前，使用UTC时区
-		req.StartTime = time.Now().UTC().Add(-24 * time.Hour)
-	}
-	if req.EndTime.IsZero() {
-		// 默认: 当前时间，使用UTC时区
-		req.EndTime = time.Now().UTC()
+	// 按请求ID查询时不设置默认时间范围，客户端上报的请求可能早于24小时
+	req.RequestID = strings.TrimSpace(req.RequestID)
+	if req.RequestID == "" {
+		// 设置默认值时使用UTC时区
+		if req.StartTime.IsZero() {
+			// 默认: 24小时前，使用UTC时区
+			req.StartTime = time.Now().UTC().Add(-24 * time.Hour)
+		}
+		if req.EndTime.IsZero() {
+			// 默认: 当前时间，使用UTC时区
+			req.EndTime = time.Now().UTC()
+		}
 	}
 
 	// 设置默认分页参数
@@ -150,3 +163,30 @@ func (c *WAFLogControllerImpl) GetAttackLogs(ctx *gin.Context) {
 
 	response.Success(ctx, "获取攻击日志成功", result)
 }
+
+// GetAuditLog godoc
+//
+//	@Summary		获取请求的审计日志
+//	@Description	按请求ID查询 Coraza 审计日志，包含请求与响应的头和体、匹配规则及异常评分，用于取证回放。审计日志超过保留天数后自动删除
+//	@Tags			WAF安全日志
+//	@Produce		json
+//	@Param			requestId	path		string											true	"请求ID，与攻击日志的 requestId 一致"
+//	@Success		200			{object}	model.SuccessResponse{data=model.AuditLog}		"成功"
+//	@Failure		404			{object}	model.ErrResponse								"审计日志不存在"
+//	@Failure		500			{object}	model.ErrResponseDontShowError					"服务器内部错误"
+//	@Router			/api/v1/log/audit/{requestId} [get]
+func (c *WAFLogControllerImpl) GetAuditLog(ctx *gin.Context) {
+	requestID := ctx.Param("requestId")
+
+	auditLog, err := c.wafLogService.GetAuditLog(ctx, requestID)
+	if err != nil {
+		if errors.Is(err, repository.ErrAuditLogNotFound) {
+			response.Error(ctx, model.NewAPIError(http.StatusNotFound, "审计日志不存在", err), false)
+			return
+		}
+		response.InternalServerError(ctx, err, false)
+		return
+	}
+
+	response.Success(ctx, "获取审计日志成功", auditLog)
+}
@@ -14,6 +14,8 @@ type BlockedIPListRequest struct {
 	IP      string `form:"ip" binding:"omitempty" example:"192.168.1.1"`                                      // IP地址过滤
 	Reason  string `form:"reason" binding:"omitempty" example:"high_frequency_attack"`                        // 封禁原因过滤
 	Status  string `form:"status" binding:"omitempty,oneof=active expired all" example:"active"`              // 状态过滤：active-生效中，expired-已过期，all-全部
+	Mode    string `form:"mode" binding:"omitempty,oneof=enforce monitor all" example:"all"`                  // 模式过滤：enforce-实际封禁，monitor-模拟封禁，all-全部
+	Type    string `form:"type" binding:"omitempty,oneof=ip prefix asn" example:"prefix"`                     // 类型过滤：ip-单个IP，prefix-网段升级，asn-按ASN升级
 	SortBy  string `form:"sortBy" binding:"omitempty,oneof=blocked_at blocked_until ip" example:"blocked_at"` // 排序字段
 	SortDir string `form:"sortDir" binding:"omitempty,oneof=asc desc" example:"desc"`                         // 排序方向
 }
@@ -21,13 +23,17 @@ type BlockedIPListRequest struct {
 // BlockedIPResponse 封禁IP响应
 // @Description 封禁IP详细信息
 type BlockedIPResponse struct {
-	IP           string    `json:"ip" example:"192.168.1.1"`                    // 被封禁的IP地址
+	IP           string    `json:"ip" example:"192.168.1.1"`                    // 被封禁的IP地址，网段封禁时为CIDR
+	Type         string    `json:"type" example:"ip"`                           // 封禁类型：ip 单个IP，prefix 网段升级，asn 按ASN升级
+	ASN          uint      `json:"asn,omitempty" example:"13335"`               // 按ASN升级封禁时的ASN编号
+	IPCount      int       `json:"ipCount,omitempty" example:"12"`              // 触发网段升级时窗口内被封禁的不同IP数
 	Reason       string    `json:"reason" example:"high_frequency_attack"`      // 封禁原因
 	RequestUri   string    `json:"requestUri" example:"/api/v1/login"`          // 请求URI
 	BlockedAt    time.Time `json:"blockedAt" example:"2023-12-01T10:00:00Z"`    // 封禁开始时间
 	BlockedUntil time.Time `json:"blockedUntil" example:"2023-12-01T11:00:00Z"` // 封禁结束时间
 	IsActive     bool      `json:"isActive" example:"true"`                     // 是否仍在封禁中
 	RemainingTTL int64     `json:"remainingTTL" example:"3600"`                 // 剩余封禁时间（秒）
+	Simulated    bool      `json:"simulated" example:"false"`                   // 是否为监控模式下的模拟封禁
 }
 
 // BlockedIPListResponse 封禁IP列表响应
@@ -41,29 +47,41 @@ type BlockedIPListResponse struct {
 }
 
 // BlockedIPStatsResponse 封禁IP统计响应
-// @Description 封禁IP统计信息
+// @Description 封禁IP统计信息，实际封禁与监控模式下的模拟封禁分开统计，便于上线前评估误封影响
 type BlockedIPStatsResponse struct {
-	TotalBlocked    int64                  `json:"totalBlocked" example:"1000"`  // 总封禁数量
-	ActiveBlocked   int64                  `json:"activeBlocked" example:"50"`   // 当前生效的封禁数量
-	ExpiredBlocked  int64                  `json:"expiredBlocked" example:"950"` // 已过期的封禁数量
-	ReasonStats     map[string]int64       `json:"reasonStats"`                  // 按原因统计
-	Last24HourStats []BlockedIPHourlyStats `json:"last24HourStats"`              // 最近24小时统计
+	TotalBlocked         int64                  `json:"totalBlocked" example:"1000"`    // 总封禁数量（不含模拟封禁）
+	ActiveBlocked        int64                  `json:"activeBlocked" example:"50"`     // 当前生效的封禁数量
+	ExpiredBlocked       int64                  `json:"expiredBlocked" example:"950"`   // 已过期的封禁数量
+	ReasonStats          map[string]int64       `json:"reasonStats"`                    // 按原因统计
+	TypeStats            map[string]int64       `json:"typeStats"`                      // 按封禁类型统计：ip、prefix、asn
+	SimulatedBlocked     int64                  `json:"simulatedBlocked" example:"300"` // 模拟封禁总数量
+	ActiveSimulated      int64                  `json:"activeSimulated" example:"20"`   // 模拟封禁期内的数量
+	SimulatedReasonStats map[string]int64       `json:"simulatedReasonStats"`           // 模拟封禁按原因统计
+	Last24HourStats      []BlockedIPHourlyStats `json:"last24HourStats"`                // 最近24小时统计
 }
 
 // BlockedIPHourlyStats 按小时统计
 // @Description 按小时的封禁统计
 type BlockedIPHourlyStats struct {
-	Hour  string `json:"hour" example:"2023-12-01T10:00:00Z"` // 小时时间点
-	Count int64  `json:"count" example:"10"`                  // 该小时的封禁数量
+	Hour           string `json:"hour" example:"2023-12-01T10:00:00Z"` // 小时时间点
+	Count          int64  `json:"count" example:"10"`                  // 该小时的封禁数量
+	SimulatedCount int64  `json:"simulatedCount" example:"3"`          // 该小时的模拟封禁数量
 }
 
 // MapToResponse 将模型转换为响应DTO
 func (r *BlockedIPResponse) MapFromModel(record *model.BlockedIPRecord) {
 	r.IP = record.IP
+	r.Type = record.Type
+	if r.Type == "" {
+		r.Type = model.BlockTypeIP
+	}
+	r.ASN = record.ASN
+	r.IPCount = record.IPCount
 	r.Reason = record.Reason
 	r.RequestUri = record.RequestUri
 	r.BlockedAt = record.BlockedAt
 	r.BlockedUntil = record.BlockedUntil
+	r.Simulated = record.Simulated
 
 	// 计算是否仍在封禁中
 	now := time.Now()
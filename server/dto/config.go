@@ -17,49 +17,256 @@ type ConfigPatchRequest struct {
 
 // EnginePatchDTO 引擎配置补丁DTO
 type EnginePatchDTO struct {
-	Bind            *string                 `json:"bind,omitempty" binding:"omitempty" example:"127.0.0.1:2342"`                      // 引擎绑定地址
-	UseBuiltinRules *bool                   `json:"useBuiltinRules,omitempty" binding:"omitempty" example:"true"`                     // 是否使用内置规则
-	ASNDBPath       *string                 `json:"asnDBPath,omitempty" binding:"omitempty" example:"/opt/geoip/GeoLite2-ASN.mmdb"`   // ASN数据库路径
-	CityDBPath      *string                 `json:"cityDBPath,omitempty" binding:"omitempty" example:"/opt/geoip/GeoLite2-City.mmdb"` // 城市数据库路径
-	AppConfig       []AppConfigPatchDTO     `json:"appConfig,omitempty" binding:"omitempty,dive"`                                     // 应用配置列表
-	FlowController  *FlowControllerPatchDTO `json:"flowController,omitempty" binding:"omitempty"`                                     // 流量控制配置
+	Bind             *string                 `json:"bind,omitempty" binding:"omitempty" example:"127.0.0.1:2342"`                                      // 引擎绑定地址
+	UseBuiltinRules  *bool                   `json:"useBuiltinRules,omitempty" binding:"omitempty" example:"true"`                                     // 是否使用内置规则
+	ASNDBPath        *string                 `json:"asnDBPath,omitempty" binding:"omitempty" example:"/opt/geoip/GeoLite2-ASN.mmdb"`                   // ASN数据库路径
+	CityDBPath       *string                 `json:"cityDBPath,omitempty" binding:"omitempty" example:"/opt/geoip/GeoLite2-City.mmdb"`                 // 城市数据库路径
+	CRSPluginDir     *string                 `json:"crsPluginDir,omitempty" binding:"omitempty" example:"/opt/crs-plugins"`                            // CRS插件目录
+	DefaultApp       *string                 `json:"defaultApp,omitempty" binding:"omitempty" example:"coraza"`                                        // 默认应用，为空字符串时不使用默认应用
+	UnknownAppPolicy *string                 `json:"unknownAppPolicy,omitempty" binding:"omitempty,oneof=fail_open fail_closed" example:"fail_closed"` // 未知应用处理策略
+	AppConfig        []AppConfigPatchDTO     `json:"appConfig,omitempty" binding:"omitempty,dive"`                                                     // 应用配置列表
+	FlowController   *FlowControllerPatchDTO `json:"flowController,omitempty" binding:"omitempty"`                                                     // 流量控制配置
+	LogRedaction     *LogRedactionPatchDTO   `json:"logRedaction,omitempty" binding:"omitempty"`                                                       // WAF日志脱敏配置
+	DecisionLog      *DecisionLogPatchDTO    `json:"decisionLog,omitempty" binding:"omitempty"`                                                        // 流控与封禁IP决策记录配置
+	AuditLog         *AuditLogPatchDTO       `json:"auditLog,omitempty" binding:"omitempty"`                                                           // Coraza审计日志配置
+	LogSpill         *LogSpillPatchDTO       `json:"logSpill,omitempty" binding:"omitempty"`                                                           // WAF日志磁盘溢出队列配置
+	LogAggregation   *LogAggregationPatchDTO `json:"logAggregation,omitempty" binding:"omitempty"`                                                     // WAF日志聚合与采样配置
+}
+
+// LogAggregationPatchDTO WAF日志聚合与采样配置补丁DTO
+//
+// 窗口内来源IP、规则ID、URI、引擎、域名、目标端口、决策模式和处置动作相同的日志合并为一条记录，count 为事件数，firstSeenAt 和 lastSeenAt 为首次和最后一次事件时间，
+// 记录保留第一个请求的请求ID和原始请求。每秒新建的记录超过 maxPerSecond 后按概率采样，保留的记录按采样率放大事件数。
+// 攻击事件和拦截统计按 count 计数，修改后在应用重新加载时生效
+type LogAggregationPatchDTO struct {
+	Enabled      *bool `json:"enabled,omitempty" binding:"omitempty" example:"true"`                    // 是否启用日志聚合
+	Window       *int  `json:"window,omitempty" binding:"omitempty,min=1,max=300" example:"10"`         // 聚合窗口（秒）
+	MaxPerSecond *int  `json:"maxPerSecond,omitempty" binding:"omitempty,min=0" example:"200"`          // 每秒新建记录数上限，为 0 时不采样
+	MaxKeys      *int  `json:"maxKeys,omitempty" binding:"omitempty,min=1,max=1000000" example:"10000"` // 同时聚合的最大记录数
+}
+
+// LogSpillPatchDTO WAF日志磁盘溢出队列配置补丁DTO
+//
+// MongoDB 写入失败或超时时，WAF 日志写入 dir 下的分段文件，MongoDB 恢复后按写入顺序回放，
+// 队列达到 maxSize 后丢弃新的日志。丢弃、溢出和回放计数在运行器状态中返回。
+// 每个集合使用 dir 下的同名子目录，修改后在应用重新加载时生效
+type LogSpillPatchDTO struct {
+	Enabled     *bool   `json:"enabled,omitempty" binding:"omitempty" example:"true"`                                   // 是否启用磁盘溢出队列
+	Dir         *string `json:"dir,omitempty" binding:"omitempty,startswith=/" example:"/var/lib/simple-waf/log-spill"` // 分段文件目录
+	MaxSize     *int    `json:"maxSize,omitempty" binding:"omitempty,min=1" example:"1024"`                             // 队列的最大大小（MB）
+	SegmentSize *int    `json:"segmentSize,omitempty" binding:"omitempty,min=1,max=1024" example:"16"`                  // 单个分段文件的最大大小（MB）
+}
+
+// AuditLogPatchDTO Coraza审计日志配置补丁DTO
+//
+// 以 SecAuditEngine RelevantOnly 方式记录相关事务的完整审计日志，写入独立集合，可通过请求ID查询。
+// 审计日志配置会覆盖应用指令中的 SecAuditEngine、SecAuditLogParts 和 SecAuditLog 设置
+type AuditLogPatchDTO struct {
+	Enabled       *bool   `json:"enabled,omitempty" binding:"omitempty" example:"true"`                  // 是否记录审计日志
+	Parts         *string `json:"parts,omitempty" binding:"omitempty" example:"ABCFHKZ"`                 // 记录的审计日志部分，以 A 开头、Z 结尾
+	BodyLimit     *int    `json:"bodyLimit,omitempty" binding:"omitempty,min=0" example:"65536"`         // 请求体和响应体的最大记录长度（字节），为 0 时不限制
+	RetentionDays *int    `json:"retentionDays,omitempty" binding:"omitempty,min=1,max=365" example:"7"` // 保留天数
+}
+
+// DecisionLogPatchDTO 流控与封禁IP决策记录配置补丁DTO
+//
+// 流量控制（engine=flow）和封禁IP（engine=ipban）拒绝的请求写入 WAF 日志，监控模式下的模拟拦截记录为 mode=observe，
+// 不计入拦截统计。泛洪时按 sampleRate 随机采样记录，Coraza 和微引擎的拦截始终全部记录
+type DecisionLogPatchDTO struct {
+	Enabled    *bool    `json:"enabled,omitempty" binding:"omitempty" example:"true"`              // 是否记录流控与封禁IP决策
+	SampleRate *float64 `json:"sampleRate,omitempty" binding:"omitempty,gt=0,max=1" example:"0.1"` // 采样率(0-1]
+}
+
+// LogRedactionPatchDTO WAF日志脱敏配置补丁DTO
+//
+// 攻击日志写入存储前脱敏，请求头按名称替换整个值，字段名称同时匹配 JSON 字段、表单与查询参数，
+// 以及 Coraza 匹配数据中的 ARGS:<名称> 变量，正则表达式匹配的内容整体替换
+type LogRedactionPatchDTO struct {
+	Enabled  *bool                  `json:"enabled,omitempty" binding:"omitempty" example:"true"`                  // 是否启用脱敏
+	Mode     *string                `json:"mode,omitempty" binding:"omitempty,oneof=mask hash" example:"mask"`     // 脱敏方式：mask 替换为掩码，hash 替换为摘要前缀
+	HashKey  *string                `json:"hashKey,omitempty" binding:"omitempty"`                                 // hash 方式的 HMAC 密钥
+	Headers  *[]string              `json:"headers,omitempty" binding:"omitempty,dive,required" example:"Cookie"`  // 脱敏的请求头名称，整体替换
+	Fields   *[]string              `json:"fields,omitempty" binding:"omitempty,dive,required" example:"password"` // 脱敏的字段名称，整体替换
+	Patterns *[]RedactionPatternDTO `json:"patterns,omitempty" binding:"omitempty,dive"`                           // 脱敏的正则表达式，整体替换
+}
+
+// RedactionPatternDTO 正则脱敏规则DTO
+type RedactionPatternDTO struct {
+	Name    string `json:"name" binding:"required" example:"card_number"`                            // 规则名称
+	Pattern string `json:"pattern" binding:"required" example:"\\b[3-6]\\d{3}(?:[ -]?\\d{4}){3}\\b"` // 正则表达式（RE2 语法）
 }
 
 // AppConfigPatchDTO 应用配置补丁DTO
 type AppConfigPatchDTO struct {
-	Name           *string `json:"name,omitempty" binding:"omitempty" example:"coraza"`          // 应用名称
-	Directives     *string `json:"directives,omitempty" binding:"omitempty"`                     // 指令配置
-	TransactionTTL *int64  `json:"transactionTTL,omitempty" binding:"omitempty" example:"60000"` // 事务超时时间(毫秒)
-	LogLevel       *string `json:"logLevel,omitempty" binding:"omitempty" example:"info"`        // 日志级别
-	LogFile        *string `json:"logFile,omitempty" binding:"omitempty" example:"/dev/stdout"`  // 日志文件
-	LogFormat      *string `json:"logFormat,omitempty" binding:"omitempty" example:"console"`    // 日志格式
+	Name           *string         `json:"name,omitempty" binding:"omitempty" example:"coraza"`                                       // 应用名称
+	Directives     *string         `json:"directives,omitempty" binding:"omitempty"`                                                  // 指令配置
+	TransactionTTL *int64          `json:"transactionTTL,omitempty" binding:"omitempty" example:"60000"`                              // 事务超时时间(毫秒)
+	LogLevel       *string         `json:"logLevel,omitempty" binding:"omitempty" example:"info"`                                     // 日志级别
+	LogFile        *string         `json:"logFile,omitempty" binding:"omitempty" example:"/dev/stdout"`                               // 日志文件
+	LogFormat      *string         `json:"logFormat,omitempty" binding:"omitempty" example:"console"`                                 // 日志格式
+	CRS            *CRSSettingsDTO `json:"crs,omitempty" binding:"omitempty"`                                                         // CRS结构化配置，整体替换
+	LogSinks       *[]LogSinkDTO   `json:"logSinks,omitempty" binding:"omitempty,unique=Name,dive"`                                   // WAF日志的额外输出，整体替换
+	LogCollection  *string         `json:"logCollection,omitempty" binding:"omitempty,max=120,excludes=$" example:"waf_log_tenant_a"` // WAF日志写入的集合，空字符串表示默认集合 waf_log；控制台的攻击日志和统计只查询默认集合
+}
+
+// LogSinkDTO WAF日志输出DTO
+//
+// WAF日志写入 MongoDB 的同时按 type 转发到对应的输出，各输出使用独立的队列，不可用的输出不影响日志存储：
+//   - syslog：按 RFC 5424 发送，消息内容为 json、cef（ArcSight）或 leef（QRadar）格式
+//   - file：每行写入一条 JSON，超过 maxSize 后轮转
+//   - webhook：以 JSON 数组批量 POST，网络错误、429 和 5xx 响应按指数退避重试
+type LogSinkDTO struct {
+	Name    string          `json:"name" binding:"required,policyname" example:"soc-syslog"`            // 输出名称，只允许字母、数字、下划线和连字符
+	Type    string          `json:"type" binding:"required,oneof=syslog file webhook" example:"syslog"` // 输出类型
+	Enabled bool            `json:"enabled" example:"true"`                                             // 是否启用
+	Syslog  *SyslogSinkDTO  `json:"syslog,omitempty" binding:"required_if=Type syslog,omitempty"`       // syslog 输出配置
+	File    *FileSinkDTO    `json:"file,omitempty" binding:"required_if=Type file,omitempty"`           // 文件输出配置
+	Webhook *WebhookSinkDTO `json:"webhook,omitempty" binding:"required_if=Type webhook,omitempty"`     // webhook 输出配置
+}
+
+// SyslogSinkDTO syslog 输出配置DTO
+type SyslogSinkDTO struct {
+	Network            string `json:"network" binding:"required,oneof=udp tcp tls" example:"tcp"`              // 传输协议
+	Address            string `json:"address" binding:"required,hostname_port" example:"siem.example.com:514"` // syslog 服务器地址
+	Format             string `json:"format" binding:"omitempty,oneof=json cef leef" example:"cef"`            // 消息内容格式，默认 json
+	Facility           int    `json:"facility" binding:"omitempty,min=0,max=23" example:"16"`                  // syslog facility，为 0 时使用 local0(16)
+	InsecureSkipVerify bool   `json:"insecureSkipVerify" example:"false"`                                      // tls 传输时是否跳过服务器证书校验
+}
+
+// FileSinkDTO 文件输出配置DTO
+type FileSinkDTO struct {
+	Path       string `json:"path" binding:"required,startswith=/" example:"/var/log/waf/events.ndjson"` // 文件路径
+	MaxSize    int    `json:"maxSize" binding:"omitempty,min=1" example:"100"`                           // 单个文件的最大大小（MB），默认 100
+	MaxBackups int    `json:"maxBackups" binding:"omitempty,min=1" example:"5"`                          // 保留的轮转文件数，默认 5
+}
+
+// WebhookSinkDTO webhook 输出配置DTO，响应中不返回请求头的值
+type WebhookSinkDTO struct {
+	URL         string            `json:"url" binding:"required,url" example:"https://siem.example.com/ingest"` // 接收地址
+	Headers     map[string]string `json:"headers,omitempty"`                                                    // 附加的请求头，如认证令牌；不传时保留同名输出已有的请求头
+	HeaderNames []string          `json:"headerNames,omitempty"`                                                // 已设置的请求头名称，只在响应中返回
+	BatchSize   int               `json:"batchSize" binding:"omitempty,min=1,max=10000" example:"100"`          // 单次请求的最大日志数，默认 100
+	Timeout     int64             `json:"timeout" binding:"omitempty,min=1,max=60000" example:"5000"`           // 单次请求超时时间（毫秒），默认 5000
+	MaxRetries  int               `json:"maxRetries" binding:"omitempty,min=0,max=10" example:"3"`              // 失败后的最大重试次数
+}
+
+// CRSSettingsDTO CRS结构化配置DTO，零值表示使用 CRS 默认值
+//
+// 引擎加载应用时按以下方式渲染：
+//   - 偏执等级、异常分数阈值、允许的方法与内容类型、禁止的扩展名渲染为 SecAction setvar，
+//     插入到第一条 Include @owasp_crs 之前，优先于指令中设置的同名变量
+//   - disabledRuleFamilies 渲染为 SecRuleRemoveById，可选值：method-enforcement、scanner-detection、
+//     protocol-enforcement、protocol-attack、multipart-attack、lfi、rfi、rce、php、generic、xss、sqli、
+//     session-fixation、java、data-leakages、data-leakages-sql、data-leakages-java、data-leakages-php、
+//     data-leakages-iis、web-shells
+//   - plugins 从引擎的 crsPluginDir 加载 <插件名>-config.conf、<插件名>-before.conf 与 <插件名>-after.conf
+type CRSSettingsDTO struct {
+	BlockingParanoiaLevel    int      `json:"blockingParanoiaLevel" binding:"omitempty,min=1,max=4" example:"1"`                        // 拦截偏执等级
+	DetectionParanoiaLevel   int      `json:"detectionParanoiaLevel" binding:"omitempty,min=1,max=4" example:"2"`                       // 检测偏执等级，不低于拦截偏执等级
+	InboundAnomalyThreshold  int      `json:"inboundAnomalyThreshold" binding:"omitempty,min=1,max=10000" example:"5"`                  // 请求异常分数阈值
+	OutboundAnomalyThreshold int      `json:"outboundAnomalyThreshold" binding:"omitempty,min=1,max=10000" example:"4"`                 // 响应异常分数阈值
+	WarningAnomalyScore      int      `json:"warningAnomalyScore" binding:"omitempty,min=1,max=10000" example:"3"`                      // 告警分数，未被拦截的请求或响应异常分数达到该值时记录为 near_miss
+	AllowedMethods           []string `json:"allowedMethods" binding:"omitempty,unique,dive,uppercase" example:"GET,HEAD,POST"`         // 允许的请求方法
+	AllowedContentTypes      []string `json:"allowedContentTypes" binding:"omitempty,unique,dive,lowercase" example:"application/json"` // 允许的请求内容类型
+	RestrictedExtensions     []string `json:"restrictedExtensions" binding:"omitempty,unique,dive,startswith=." example:".bak,.sql"`    // 禁止访问的文件扩展名
+	DisabledRuleFamilies     []string `json:"disabledRuleFamilies" binding:"omitempty,unique" example:"scanner-detection,java"`         // 禁用的CRS规则族
+	Plugins                  []string `json:"plugins" binding:"omitempty,unique" example:"wordpress-rule-exclusions"`                   // 启用的CRS插件
 }
 
 // HaproxyPatchDTO HAProxy配置补丁DTO
 type HaproxyPatchDTO struct {
-	ConfigBaseDir *string `json:"configBaseDir,omitempty" binding:"omitempty" example:"/simple-waf"` // 配置文件根目录
-	HaproxyBin    *string `json:"haproxyBin,omitempty" binding:"omitempty" example:"haproxy"`        // HAProxy二进制文件路径
-	BackupsNumber *int    `json:"backupsNumber,omitempty" binding:"omitempty" example:"5"`           // 备份数量
-	SpoeAgentAddr *string `json:"spoeAgentAddr,omitempty" binding:"omitempty" example:"127.0.0.1"`   // SPOE代理地址
-	SpoeAgentPort *int    `json:"spoeAgentPort,omitempty" binding:"omitempty" example:"2342"`        // SPOE代理端口
-	Thread        *int    `json:"thread,omitempty" binding:"omitempty,min=0,max=256" example:"4"`    // 线程数
+	ConfigBaseDir *string `json:"configBaseDir,omitempty" binding:"omitempty" example:"/simple-waf"`      // 配置文件根目录
+	HaproxyBin    *string `json:"haproxyBin,omitempty" binding:"omitempty" example:"haproxy"`             // HAProxy二进制文件路径
+	BackupsNumber *int    `json:"backupsNumber,omitempty" binding:"omitempty" example:"5"`                // 备份数量
+	SpoeAgentAddr *string `json:"spoeAgentAddr,omitempty" binding:"omitempty" example:"127.0.0.1"`        // SPOE代理地址
+	SpoeAgentPort *int    `json:"spoeAgentPort,omitempty" binding:"omitempty" example:"2342"`             // SPOE代理端口
+	Thread        *int    `json:"thread,omitempty" binding:"omitempty,min=0,max=256" example:"4"`         // 线程数
+	TarpitTimeout *int    `json:"tarpitTimeout,omitempty" binding:"omitempty,min=1,max=300" example:"10"` // tarpit 处置的响应延迟（秒）
 }
 
 // FlowControllerPatchDTO 流量控制器配置补丁DTO
 type FlowControllerPatchDTO struct {
-	VisitLimit  *LimitConfigPatchDTO `json:"visitLimit,omitempty" binding:"omitempty"`  // 访问频率限制配置
-	AttackLimit *LimitConfigPatchDTO `json:"attackLimit,omitempty" binding:"omitempty"` // 攻击频率限制配置
-	ErrorLimit  *LimitConfigPatchDTO `json:"errorLimit,omitempty" binding:"omitempty"`  // 错误频率限制配置
+	VisitLimit       *LimitConfigPatchDTO      `json:"visitLimit,omitempty" binding:"omitempty"`                     // 访问频率限制配置
+	AttackLimit      *LimitConfigPatchDTO      `json:"attackLimit,omitempty" binding:"omitempty"`                    // 攻击频率限制配置
+	ErrorLimit       *ErrorLimitPatchDTO       `json:"errorLimit,omitempty" binding:"omitempty"`                     // 错误频率限制配置
+	ErrorPolicies    *[]ErrorPolicyDTO         `json:"errorPolicies,omitempty" binding:"omitempty,unique=Name,dive"` // 命名错误策略，整体替换
+	SubnetEscalation *SubnetEscalationPatchDTO `json:"subnetEscalation,omitempty" binding:"omitempty"`               // 网段升级封禁配置
+	CounterBackend   *CounterBackendPatchDTO   `json:"counterBackend,omitempty" binding:"omitempty"`                 // 限流计数后端配置
+}
+
+// SubnetEscalationPatchDTO 网段升级封禁配置补丁DTO
+type SubnetEscalationPatchDTO struct {
+	Enabled       *bool  `json:"enabled,omitempty" binding:"omitempty" example:"true"`                    // 是否启用
+	IPv4PrefixLen *int   `json:"ipv4PrefixLen,omitempty" binding:"omitempty,min=8,max=32" example:"24"`   // IPv4 聚合前缀长度
+	IPv6PrefixLen *int   `json:"ipv6PrefixLen,omitempty" binding:"omitempty,min=16,max=128" example:"48"` // IPv6 聚合前缀长度
+	ByASN         *bool  `json:"byAsn,omitempty" binding:"omitempty" example:"false"`                     // 是否同时按ASN聚合，需要配置ASN数据库
+	Threshold     *int   `json:"threshold,omitempty" binding:"omitempty,min=1" example:"10"`              // 窗口内被封禁的不同IP数超过该值时升级封禁
+	Window        *int64 `json:"window,omitempty" binding:"omitempty,min=1" example:"600"`                // 统计窗口（秒）
+	BlockDuration *int64 `json:"blockDuration,omitempty" binding:"omitempty,min=1" example:"3600"`        // 网段封禁时长（秒）
+}
+
+// CounterBackendPatchDTO 限流计数后端配置补丁DTO
+type CounterBackendPatchDTO struct {
+	Type      *string `json:"type,omitempty" binding:"omitempty,oneof=local redis" example:"redis"` // 计数后端类型：local 或 redis
+	Addr      *string `json:"addr,omitempty" binding:"omitempty" example:"127.0.0.1:6379"`          // Redis地址
+	Password  *string `json:"password,omitempty" binding:"omitempty"`                               // Redis密码
+	DB        *int    `json:"db,omitempty" binding:"omitempty,min=0" example:"0"`                   // Redis数据库编号
+	KeyPrefix *string `json:"keyPrefix,omitempty" binding:"omitempty" example:"ruiqi:flow"`         // 计数键前缀
+	Timeout   *int64  `json:"timeout,omitempty" binding:"omitempty,min=1,max=1000" example:"50"`    // 单次计数请求超时时间（毫秒）
 }
 
 // LimitConfigPatchDTO 限制配置补丁DTO
+//
+// 限流算法（algorithm）决定统计窗口内计数何时恢复，三种算法的上限均为 threshold+burstCount：
+//   - token_bucket（默认）：桶容量为 threshold+burstCount，每个 statDuration 匀速补充 threshold 个令牌，
+//     耗尽后每隔 statDuration/threshold 恢复一次请求，适合限制持续速率
+//   - sliding_window：以上一窗口计数乘以其在最近 statDuration 内的剩余占比，加上当前窗口计数作为估算值，
+//     估算值小于上限时放行，窗口交界处不会出现双倍突发；Redis 计数后端按事件日志精确统计
+//   - fixed_window：窗口按 Unix 时间对齐（如 statDuration=60 即每个整分钟），窗口内最多放行上限次，
+//     到达下一窗口起点时清零，交界处前后各一个窗口的请求可能连续放行
+//
+// 处置动作（action）决定超限及封禁期内的请求如何被拒绝：
+//   - deny：返回 403（攻击与错误限制的默认动作）
+//   - throttle：返回 429，Retry-After 为封禁剩余秒数（访问限制的默认动作）
+//   - tarpit：HAProxy 保持连接，延迟 tarpitTimeout 秒后返回 429，拖慢重试
+//   - drop：不响应直接断开连接
+//   - redirect：302 跳转到 redirectUrl，未设置跳转地址时按 deny 处理
 type LimitConfigPatchDTO struct {
-	Enabled        *bool  `json:"enabled,omitempty" binding:"omitempty" example:"true"`         // 是否启用
-	Threshold      *int64 `json:"threshold,omitempty" binding:"omitempty" example:"100"`        // 阈值
-	StatDuration   *int64 `json:"statDuration,omitempty" binding:"omitempty" example:"60"`      // 统计时间窗口（秒）
-	BlockDuration  *int64 `json:"blockDuration,omitempty" binding:"omitempty" example:"600"`    // 封禁时长（秒）
-	BurstCount     *int64 `json:"burstCount,omitempty" binding:"omitempty" example:"10"`        // 允许的突发请求数
-	ParamsCapacity *int64 `json:"paramsCapacity,omitempty" binding:"omitempty" example:"10000"` // 缓存容量
+	Enabled        *bool   `json:"enabled,omitempty" binding:"omitempty" example:"true"`                                                            // 是否启用
+	Mode           *string `json:"mode,omitempty" binding:"omitempty,oneof=enforce monitor" example:"monitor"`                                      // 运行模式：enforce 超限封禁，monitor 只记录模拟封禁不拦截
+	Algorithm      *string `json:"algorithm,omitempty" binding:"omitempty,oneof=token_bucket sliding_window fixed_window" example:"sliding_window"` // 限流算法：token_bucket、sliding_window 或 fixed_window
+	Action         *string `json:"action,omitempty" binding:"omitempty,oneof=deny throttle tarpit drop redirect" example:"throttle"`                // 处置动作：deny、throttle、tarpit、drop 或 redirect
+	RedirectURL    *string `json:"redirectUrl,omitempty" binding:"omitempty,url" example:"https://example.com/wait"`                                // redirect 动作的跳转地址
+	Threshold      *int64  `json:"threshold,omitempty" binding:"omitempty" example:"100"`                                                           // 阈值
+	StatDuration   *int64  `json:"statDuration,omitempty" binding:"omitempty" example:"60"`                                                         // 统计时间窗口（秒）
+	BlockDuration  *int64  `json:"blockDuration,omitempty" binding:"omitempty" example:"600"`                                                       // 封禁时长（秒）
+	BurstCount     *int64  `json:"burstCount,omitempty" binding:"omitempty" example:"10"`                                                           // 允许的突发请求数
+	ParamsCapacity *int64  `json:"paramsCapacity,omitempty" binding:"omitempty" example:"10000"`                                                    // 缓存容量
+}
+
+// ErrorLimitPatchDTO 错误限制配置补丁DTO
+type ErrorLimitPatchDTO struct {
+	LimitConfigPatchDTO
+	StatusCodes *[]string `json:"statusCodes,omitempty" binding:"omitempty,dive,httpstatus" example:"401,403,5xx"` // 计入的状态码或类别，空列表表示所有 4xx/5xx
+	Paths       *[]string `json:"paths,omitempty" binding:"omitempty,dive,startswith=/" example:"/login"`          // 计入的请求路径，支持前缀和通配符，空列表表示不限路径
+}
+
+// ErrorPolicyDTO 命名错误策略DTO
+// @Description 按状态码和路径筛选错误响应并单独限流，封禁原因为 high_frequency_error:<name>
+type ErrorPolicyDTO struct {
+	Name           string   `json:"name" binding:"required,policyname" example:"login_auth_failure"`                                     // 策略名称，只允许字母、数字、下划线和连字符
+	Enabled        bool     `json:"enabled" example:"true"`                                                                              // 是否启用
+	Mode           string   `json:"mode" binding:"omitempty,oneof=enforce monitor" example:"enforce"`                                    // 运行模式：enforce 超限封禁，monitor 只记录模拟封禁不拦截
+	Algorithm      string   `json:"algorithm" binding:"omitempty,oneof=token_bucket sliding_window fixed_window" example:"token_bucket"` // 限流算法，语义同 LimitConfigPatchDTO，默认 token_bucket
+	Action         string   `json:"action" binding:"omitempty,oneof=deny throttle tarpit drop redirect" example:"deny"`                  // 处置动作，语义同 LimitConfigPatchDTO，默认 deny
+	RedirectURL    string   `json:"redirectUrl" binding:"required_if=Action redirect,omitempty,url" example:"https://example.com/wait"`  // redirect 动作的跳转地址
+	StatusCodes    []string `json:"statusCodes" binding:"omitempty,dive,httpstatus" example:"401,403"`                                   // 计入的状态码或类别，为空时计入所有 4xx/5xx
+	Paths          []string `json:"paths" binding:"omitempty,dive,startswith=/" example:"/login"`                                        // 计入的请求路径，支持前缀和通配符，为空时不限路径
+	Threshold      int64    `json:"threshold" binding:"required,min=1" example:"5"`                                                      // 阈值
+	StatDuration   int64    `json:"statDuration" binding:"required,min=1" example:"60"`                                                  // 统计时间窗口（秒）
+	BlockDuration  int64    `json:"blockDuration" binding:"required,min=1" example:"1800"`                                               // 封禁时长（秒）
+	BurstCount     int64    `json:"burstCount" binding:"min=0" example:"0"`                                                              // 允许的突发次数
+	ParamsCapacity int64    `json:"paramsCapacity" binding:"omitempty,min=1" example:"10000"`                                            // 缓存容量
 }
 
 // ConfigResponse 配置响应
@@ -78,22 +285,73 @@ type ConfigResponse struct {
 
 // EngineDTO 引擎配置DTO
 type EngineDTO struct {
-	Bind            string            `json:"bind"`            // 引擎绑定地址
-	UseBuiltinRules bool              `json:"useBuiltinRules"` // 是否使用内置规则
-	ASNDBPath       string            `json:"asnDBPath"`       // ASN数据库路径
-	CityDBPath      string            `json:"cityDBPath"`      // 城市数据库路径
-	AppConfig       []AppConfigDTO    `json:"appConfig"`       // 应用配置列表
-	FlowController  FlowControllerDTO `json:"flowController"`  // 流量控制配置
+	Bind             string            `json:"bind"`             // 引擎绑定地址
+	UseBuiltinRules  bool              `json:"useBuiltinRules"`  // 是否使用内置规则
+	ASNDBPath        string            `json:"asnDBPath"`        // ASN数据库路径
+	CityDBPath       string            `json:"cityDBPath"`       // 城市数据库路径
+	CRSPluginDir     string            `json:"crsPluginDir"`     // CRS插件目录
+	DefaultApp       string            `json:"defaultApp"`       // 默认应用
+	UnknownAppPolicy string            `json:"unknownAppPolicy"` // 未知应用处理策略：fail_open, fail_closed
+	AppConfig        []AppConfigDTO    `json:"appConfig"`        // 应用配置列表
+	FlowController   FlowControllerDTO `json:"flowController"`   // 流量控制配置
+	LogRedaction     LogRedactionDTO   `json:"logRedaction"`     // WAF日志脱敏配置
+	DecisionLog      DecisionLogDTO    `json:"decisionLog"`      // 流控与封禁IP决策记录配置
+	AuditLog         AuditLogDTO       `json:"auditLog"`         // Coraza审计日志配置
+	LogSpill         LogSpillDTO       `json:"logSpill"`         // WAF日志磁盘溢出队列配置
+	LogAggregation   LogAggregationDTO `json:"logAggregation"`   // WAF日志聚合与采样配置
+}
+
+// LogAggregationDTO WAF日志聚合与采样配置DTO
+type LogAggregationDTO struct {
+	Enabled      bool `json:"enabled"`      // 是否启用日志聚合
+	Window       int  `json:"window"`       // 聚合窗口（秒）
+	MaxPerSecond int  `json:"maxPerSecond"` // 每秒新建记录数上限
+	MaxKeys      int  `json:"maxKeys"`      // 同时聚合的最大记录数
+}
+
+// LogSpillDTO WAF日志磁盘溢出队列配置DTO
+type LogSpillDTO struct {
+	Enabled     bool   `json:"enabled"`     // 是否启用磁盘溢出队列
+	Dir         string `json:"dir"`         // 分段文件目录
+	MaxSize     int    `json:"maxSize"`     // 队列的最大大小（MB）
+	SegmentSize int    `json:"segmentSize"` // 单个分段文件的最大大小（MB）
+}
+
+// AuditLogDTO Coraza审计日志配置DTO
+type AuditLogDTO struct {
+	Enabled       bool   `json:"enabled"`       // 是否记录审计日志
+	Parts         string `json:"parts"`         // 记录的审计日志部分
+	BodyLimit     int    `json:"bodyLimit"`     // 请求体和响应体的最大记录长度（字节）
+	RetentionDays int    `json:"retentionDays"` // 保留天数
+}
+
+// DecisionLogDTO 流控与封禁IP决策记录配置DTO
+type DecisionLogDTO struct {
+	Enabled    bool    `json:"enabled"`    // 是否记录流控与封禁IP决策
+	SampleRate float64 `json:"sampleRate"` // 采样率
+}
+
+// LogRedactionDTO WAF日志脱敏配置DTO，不返回 HMAC 密钥
+type LogRedactionDTO struct {
+	Enabled    bool                  `json:"enabled"`    // 是否启用脱敏
+	Mode       string                `json:"mode"`       // 脱敏方式
+	HasHashKey bool                  `json:"hasHashKey"` // 是否已设置 HMAC 密钥
+	Headers    []string              `json:"headers"`    // 脱敏的请求头名称
+	Fields     []string              `json:"fields"`     // 脱敏的字段名称
+	Patterns   []RedactionPatternDTO `json:"patterns"`   // 脱敏的正则表达式
 }
 
 // AppConfigDTO 应用配置DTO
 type AppConfigDTO struct {
-	Name           string `json:"name"`                           // 应用名称
-	Directives     string `json:"directives"`                     // 指令配置
-	TransactionTTL int64  `json:"transactionTTL" example:"60000"` // 事务超时时间(毫秒)
-	LogLevel       string `json:"logLevel"`                       // 日志级别
-	LogFile        string `json:"logFile"`                        // 日志文件
-	LogFormat      string `json:"logFormat"`                      // 日志格式
+	Name           string         `json:"name"`                           // 应用名称
+	Directives     string         `json:"directives"`                     // 指令配置
+	TransactionTTL int64          `json:"transactionTTL" example:"60000"` // 事务超时时间(毫秒)
+	LogLevel       string         `json:"logLevel"`                       // 日志级别
+	LogFile        string         `json:"logFile"`                        // 日志文件
+	LogFormat      string         `json:"logFormat"`                      // 日志格式
+	CRS            CRSSettingsDTO `json:"crs"`                            // CRS结构化配置
+	LogSinks       []LogSinkDTO   `json:"logSinks"`                       // WAF日志的额外输出
+	LogCollection  string         `json:"logCollection"`                  // WAF日志写入的集合，为空时使用默认集合
 }
 
 // HaproxyDTO HAProxy配置DTO
@@ -104,23 +362,59 @@ type HaproxyDTO struct {
 	SpoeAgentAddr string `json:"spoeAgentAddr"` // SPOE代理地址
 	SpoeAgentPort int    `json:"spoeAgentPort"` // SPOE代理端口
 	Thread        int    `json:"thread"`        // 线程数
+	TarpitTimeout int    `json:"tarpitTimeout"` // tarpit 处置的响应延迟（秒）
 }
 
 // FlowControllerDTO 流量控制器配置DTO
 type FlowControllerDTO struct {
-	VisitLimit  LimitConfigDTO `json:"visitLimit"`  // 访问频率限制配置
-	AttackLimit LimitConfigDTO `json:"attackLimit"` // 攻击频率限制配置
-	ErrorLimit  LimitConfigDTO `json:"errorLimit"`  // 错误频率限制配置
+	VisitLimit       LimitConfigDTO      `json:"visitLimit"`       // 访问频率限制配置
+	AttackLimit      LimitConfigDTO      `json:"attackLimit"`      // 攻击频率限制配置
+	ErrorLimit       ErrorLimitDTO       `json:"errorLimit"`       // 错误频率限制配置
+	ErrorPolicies    []ErrorPolicyDTO    `json:"errorPolicies"`    // 命名错误策略
+	SubnetEscalation SubnetEscalationDTO `json:"subnetEscalation"` // 网段升级封禁配置
+	CounterBackend   CounterBackendDTO   `json:"counterBackend"`   // 限流计数后端配置
+}
+
+// SubnetEscalationDTO 网段升级封禁配置DTO
+type SubnetEscalationDTO struct {
+	Enabled       bool  `json:"enabled"`       // 是否启用
+	IPv4PrefixLen int   `json:"ipv4PrefixLen"` // IPv4 聚合前缀长度
+	IPv6PrefixLen int   `json:"ipv6PrefixLen"` // IPv6 聚合前缀长度
+	ByASN         bool  `json:"byAsn"`         // 是否同时按ASN聚合
+	Threshold     int   `json:"threshold"`     // 升级阈值
+	Window        int64 `json:"window"`        // 统计窗口（秒）
+	BlockDuration int64 `json:"blockDuration"` // 网段封禁时长（秒）
+}
+
+// CounterBackendDTO 限流计数后端配置DTO，不返回密码
+type CounterBackendDTO struct {
+	Type        string `json:"type"`        // 计数后端类型
+	Addr        string `json:"addr"`        // Redis地址
+	HasPassword bool   `json:"hasPassword"` // 是否已设置密码
+	DB          int    `json:"db"`          // Redis数据库编号
+	KeyPrefix   string `json:"keyPrefix"`   // 计数键前缀
+	Timeout     int64  `json:"timeout"`     // 单次计数请求超时时间（毫秒）
 }
 
 // LimitConfigDTO 限制配置DTO
 type LimitConfigDTO struct {
-	Enabled        bool  `json:"enabled"`        // 是否启用
-	Threshold      int64 `json:"threshold"`      // 阈值
-	StatDuration   int64 `json:"statDuration"`   // 统计时间窗口（秒）
-	BlockDuration  int64 `json:"blockDuration"`  // 封禁时长（秒）
-	BurstCount     int64 `json:"burstCount"`     // 允许的突发请求数
-	ParamsCapacity int64 `json:"paramsCapacity"` // 缓存容量
+	Enabled        bool   `json:"enabled"`        // 是否启用
+	Mode           string `json:"mode"`           // 运行模式：enforce 超限封禁，monitor 只记录模拟封禁不拦截
+	Algorithm      string `json:"algorithm"`      // 限流算法：token_bucket、sliding_window 或 fixed_window
+	Action         string `json:"action"`         // 处置动作：deny、throttle、tarpit、drop 或 redirect
+	RedirectURL    string `json:"redirectUrl"`    // redirect 动作的跳转地址
+	Threshold      int64  `json:"threshold"`      // 阈值
+	StatDuration   int64  `json:"statDuration"`   // 统计时间窗口（秒）
+	BlockDuration  int64  `json:"blockDuration"`  // 封禁时长（秒）
+	BurstCount     int64  `json:"burstCount"`     // 允许的突发请求数
+	ParamsCapacity int64  `json:"paramsCapacity"` // 缓存容量
+}
+
+// ErrorLimitDTO 错误限制配置DTO
+type ErrorLimitDTO struct {
+	LimitConfigDTO
+	StatusCodes []string `json:"statusCodes"` // 计入的状态码或类别
+	Paths       []string `json:"paths"`       // 计入的请求路径
 }
 
 // 将 time.Duration 转换为毫秒表示的 int64
@@ -0,0 +1,35 @@
+// server/dto/custom_rule.go
+package dto
+
+import (
+	"github.com/HUAHUAI23/simple-waf/pkg/model"
+)
+
+// CustomRuleCreateRequest 自定义规则创建请求
+// @Description 创建自定义 SecLang 规则的请求参数，保存前会编译校验并检测规则ID冲突
+type CustomRuleCreateRequest struct {
+	Name        string   `json:"name" binding:"required" example:"CVE-2021-44228 虚拟补丁"`                                                           // 规则名称
+	Description string   `json:"description,omitempty" example:"拦截 Log4Shell JNDI 注入"`                                                            // 描述
+	Enabled     *bool    `json:"enabled,omitempty" example:"true"`                                                                                // 是否启用，默认启用
+	Priority    int      `json:"priority" example:"100"`                                                                                          // 优先级，数值越小越靠前
+	Apps        []string `json:"apps,omitempty" example:"coraza"`                                                                                 // 生效的应用名称，为空时对所有应用生效
+	Directives  string   `json:"directives" binding:"required" example:"SecRule ARGS \"@contains ${jndi:\" \"id:10001,phase:2,deny,status:403\""` // SecLang 指令
+}
+
+// CustomRuleUpdateRequest 自定义规则更新请求
+// @Description 更新自定义规则的请求参数，未传的字段保持不变，修改指令时会重新编译校验
+type CustomRuleUpdateRequest struct {
+	Name        *string  `json:"name,omitempty" example:"CVE-2021-44228 虚拟补丁"`                                                           // 规则名称
+	Description *string  `json:"description,omitempty" example:"拦截 Log4Shell JNDI 注入"`                                                   // 描述
+	Enabled     *bool    `json:"enabled,omitempty" example:"true"`                                                                       // 是否启用
+	Priority    *int     `json:"priority,omitempty" example:"100"`                                                                       // 优先级，数值越小越靠前
+	Apps        []string `json:"apps,omitempty" example:"coraza"`                                                                        // 生效的应用名称，传空数组表示对所有应用生效
+	Directives  *string  `json:"directives,omitempty" example:"SecRule ARGS \"@contains ${jndi:\" \"id:10001,phase:2,deny,status:403\""` // SecLang 指令
+}
+
+// CustomRuleListResponse 自定义规则列表响应
+// @Description 自定义规则列表响应，按组装顺序排列
+type CustomRuleListResponse struct {
+	Total int64              `json:"total"` // 总数
+	Items []model.CustomRule `json:"items"` // 自定义规则列表
+}
@@ -0,0 +1,41 @@
+// server/dto/rule_exclusion.go
+package dto
+
+import (
+	"github.com/HUAHUAI23/simple-waf/pkg/model"
+)
+
+// RuleExclusionCreateRequest 规则排除创建请求
+// @Description 创建规则排除的请求参数。Host 与 Path 均为空时全局生效，否则只对匹配的站点或路径生效
+type RuleExclusionCreateRequest struct {
+	Name        string              `json:"name" binding:"required" example:"登录密码误报"`                                                                   // 排除名称
+	Description string              `json:"description,omitempty" example:"密码字段触发SQL注入规则"`                                                              // 描述
+	Enabled     *bool               `json:"enabled,omitempty" example:"true"`                                                                           // 是否启用，默认启用
+	Type        model.ExclusionType `json:"type" binding:"required,oneof=remove_by_id remove_by_tag remove_target_by_id" example:"remove_target_by_id"` // 排除类型
+	RuleIDs     []string            `json:"ruleIds,omitempty" example:"942100,942200-942299"`                                                           // 规则ID或ID范围
+	Tags        []string            `json:"tags,omitempty" example:"attack-sqli"`                                                                       // 规则标签
+	Targets     []string            `json:"targets,omitempty" example:"ARGS:password"`                                                                  // 排除的变量
+	Host        string              `json:"host,omitempty" example:"a.com"`                                                                             // 生效的站点域名，支持 *.a.com
+	Path        string              `json:"path,omitempty" example:"/login"`                                                                            // 生效的路径前缀
+}
+
+// RuleExclusionUpdateRequest 规则排除更新请求
+// @Description 更新规则排除的请求参数，未传的字段保持不变
+type RuleExclusionUpdateRequest struct {
+	Name        *string              `json:"name,omitempty" example:"登录密码误报"`                                                                                // 排除名称
+	Description *string              `json:"description,omitempty" example:"密码字段触发SQL注入规则"`                                                                  // 描述
+	Enabled     *bool                `json:"enabled,omitempty" example:"true"`                                                                               // 是否启用
+	Type        *model.ExclusionType `json:"type,omitempty" binding:"omitempty,oneof=remove_by_id remove_by_tag remove_target_by_id" example:"remove_by_id"` // 排除类型
+	RuleIDs     []string             `json:"ruleIds,omitempty" example:"942100"`                                                                             // 规则ID或ID范围
+	Tags        []string             `json:"tags,omitempty" example:"attack-sqli"`                                                                           // 规则标签
+	Targets     []string             `json:"targets,omitempty" example:"ARGS:password"`                                                                      // 排除的变量
+	Host        *string              `json:"host,omitempty" example:"a.com"`                                                                                 // 生效的站点域名，传空字符串表示不限站点
+	Path        *string              `json:"path,omitempty" example:"/login"`                                                                                // 生效的路径前缀，传空字符串表示不限路径
+}
+
+// RuleExclusionListResponse 规则排除列表响应
+// @Description 规则排除列表响应
+type RuleExclusionListResponse struct {
+	Total int64                 `json:"total"` // 总数
+	Items []model.RuleExclusion `json:"items"` // 规则排除列表
+}
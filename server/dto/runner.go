@@ -13,8 +13,32 @@ type RunnerControlResponse struct {
 	State   string `json:"state" example:"running"`    // 操作后的状态
 }
 
+// EngineErrorStats 引擎 SPOE Agent 错误计数
+type EngineErrorStats struct {
+	MalformedMessages   uint64 `json:"malformedMessages" example:"0"`   // 格式错误的消息数
+	UnknownApps         uint64 `json:"unknownApps" example:"0"`         // 找不到应用且没有可用默认应用的消息数
+	DefaultAppFallbacks uint64 `json:"defaultAppFallbacks" example:"0"` // 回退到默认应用的消息数
+	HandlerErrors       uint64 `json:"handlerErrors" example:"0"`       // 处理请求或响应出错的消息数
+}
+
+// LogStoreStats 引擎 WAF 日志存储计数
+//
+// MongoDB 写入失败或超时时日志写入磁盘溢出队列，恢复后按写入顺序回放
+type LogStoreStats struct {
+	Dropped       uint64 `json:"dropped" example:"0"`       // 丢弃的日志数：缓冲区已满、MongoDB 拒绝或溢出队列已满
+	Spilled       uint64 `json:"spilled" example:"0"`       // 写入磁盘溢出队列的日志数
+	Replayed      uint64 `json:"replayed" example:"0"`      // 从溢出队列回放到 MongoDB 的日志数
+	SpillBytes    int64  `json:"spillBytes" example:"0"`    // 溢出队列当前占用的磁盘空间（字节）
+	SpillSegments int    `json:"spillSegments" example:"0"` // 溢出队列当前的分段文件数
+	Collapsed     uint64 `json:"collapsed" example:"0"`     // 聚合时合并到已有记录的日志数
+	SampledOut    uint64 `json:"sampledOut" example:"0"`    // 超过每秒记录数上限后采样丢弃的日志数
+}
+
 // RunnerStatusResponse 运行器状态响应
 type RunnerStatusResponse struct {
-	State     string `json:"state" example:"running"`  // 状态：running, stopped, error
-	IsRunning bool   `json:"isRunning" example:"true"` // 是否正在运行
+	State        string           `json:"state" example:"running"`                                            // 状态：running, stopped, error
+	IsRunning    bool             `json:"isRunning" example:"true"`                                           // 是否正在运行
+	EngineErrors EngineErrorStats `json:"engineErrors"`                                                       // 引擎错误计数
+	LogStore     LogStoreStats    `json:"logStore"`                                                           // WAF日志存储计数
+	LastError    string           `json:"lastError,omitempty" example:"重新加载应用失败，继续使用之前的配置: 应用 default 的指令无效"` // 最后一次启动或重新加载失败的错误
 }
@@ -17,6 +17,8 @@ type CreateSiteRequest struct {
 	Backend      BackendDTO      `json:"backend" binding:"required"`                                                     // 后端服务器配置
 	WAFEnabled   bool            `json:"wafEnabled" example:"false"`                                                     // 是否启用WAF
 	WAFMode      string          `json:"wafMode" binding:"omitempty,oneof=protection observation" example:"observation"` // WAF模式
+	Spoe         *SpoeDTO        `json:"spoe,omitempty" binding:"omitempty"`                                             // SPOE 检测设置
+	BlockPage    *BlockPageDTO   `json:"blockPage,omitempty" binding:"omitempty"`                                        // 拦截页面设置
 	ActiveStatus bool            `json:"activeStatus" example:"true"`                                                    // 站点状态
 }
 
@@ -31,9 +33,25 @@ type UpdateSiteRequest struct {
 	Backend      *BackendDTO     `json:"backend,omitempty" binding:"omitempty"`                                          // 后端服务器配置
 	WAFEnabled   bool            `json:"wafEnabled" example:"false"`                                                     // 是否启用WAF
 	WAFMode      string          `json:"wafMode" binding:"omitempty,oneof=protection observation" example:"observation"` // WAF模式
+	Spoe         *SpoeDTO        `json:"spoe,omitempty" binding:"omitempty"`                                             // SPOE 检测设置
+	BlockPage    *BlockPageDTO   `json:"blockPage,omitempty" binding:"omitempty"`                                        // 拦截页面设置
 	ActiveStatus bool            `json:"activeStatus" example:"true"`                                                    // 站点状态
 }
 
+// SpoeDTO 站点 SPOE 检测设置DTO
+type SpoeDTO struct {
+	ProcessingTimeout int    `json:"processingTimeout" binding:"min=0,max=60000" example:"500"`                        // 处理超时（毫秒），0 使用默认值
+	MaxBodySize       int    `json:"maxBodySize" binding:"min=0" example:"65536"`                                      // 发送给代理的最大消息体字节数，0 表示不截断
+	FailPolicy        string `json:"failPolicy" binding:"omitempty,oneof=fail_open fail_closed" example:"fail_closed"` // 代理出错或超时时的处理策略
+}
+
+// BlockPageDTO 站点拦截页面设置DTO
+// 模板支持占位符 {{requestId}}、{{reason}}、{{ruleId}}、{{clientIp}}、{{timestamp}}
+type BlockPageDTO struct {
+	HTML string `json:"html" binding:"omitempty" example:"<h1>请求已被拦截</h1><p>请求ID: {{requestId}}</p>"` // HTML 模板，为空时不使用
+	JSON string `json:"json" binding:"omitempty" example:"{\"requestId\":\"{{requestId}}\"}"`         // JSON 模板，替换占位符后需为合法的 JSON
+}
+
 // CertificateDTO 证书DTO
 type CertificateDTO struct {
 	CertName    string    `json:"certName" binding:"required" example:"my-cert"`         // 证书名称
@@ -30,6 +30,9 @@ type AttackLogRequest struct {
 	SrcIP     string    `json:"srcIp" form:"srcIp" binding:"omitempty" example:"192.168.1.100"`                                                   // 来源IP地址，用于追踪攻击源
 	DstIP     string    `json:"dstIp" form:"dstIp" binding:"omitempty" example:"10.0.0.5"`                                                        // 目标IP地址，被攻击的服务器地址
 	RequestID string    `json:"requestId" form:"requestId" binding:"omitempty" example:"1234567890"`                                              // 请求ID，唯一标识HTTP请求的ID
+	Engine    string    `json:"engine" form:"engine" binding:"omitempty,oneof=coraza micro flow ipban" example:"flow"`                            // 做出决策的引擎：coraza、micro、flow、ipban
+	Action    string    `json:"action" form:"action" binding:"omitempty" example:"throttle"`                                                      // 处置动作，如 deny、throttle、tarpit、drop、redirect
+	Mode      string    `json:"mode" form:"mode" binding:"omitempty,oneof=enforce observe near_miss" example:"enforce"`                           // 决策模式：enforce 已拦截，observe 仅记录未拦截，near_miss 接近拦截阈值
 	StartTime time.Time `json:"startTime" form:"startTime" binding:"omitempty" time_format:"2006-01-02T15:04:05Z" example:"2024-03-17T00:00:00Z"` // 查询起始时间，ISO8601格式
 	EndTime   time.Time `json:"endTime" form:"endTime" binding:"omitempty" time_format:"2006-01-02T15:04:05Z" example:"2024-03-18T23:59:59Z"`     // 查询结束时间，ISO8601格式
 	Page      int       `json:"page" form:"page" binding:"omitempty,min=1" default:"1" example:"1"`                                               // 当前页码，从1开始
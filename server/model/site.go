@@ -1,6 +1,10 @@
 package model
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
 	"time"
 
 	"go.mongodb.org/mongo-driver/v2/bson"
@@ -14,20 +18,45 @@ const (
 	WAFModeObservation WAFMode = "observation" // 观察模式
 )
 
+// SpoeFailPolicy 定义 SPOE 代理出错或超时时的处理策略
+type SpoeFailPolicy string
+
+const (
+	SpoeFailOpen   SpoeFailPolicy = "fail_open"   // 放行请求
+	SpoeFailClosed SpoeFailPolicy = "fail_closed" // 返回 500
+)
+
+// 拦截页面模板支持的占位符，生成 HAProxy 配置时替换为对应的样本表达式
+const (
+	BlockPageRequestID = "{{requestId}}" // 请求ID，与响应头 X-Request-ID 一致
+	BlockPageReason    = "{{reason}}"    // 拦截原因，即触发拦截的规则消息、微引擎规则名称或流控原因
+	BlockPageRuleID    = "{{ruleId}}"    // 触发拦截的规则ID
+	BlockPageClientIP  = "{{clientIp}}"  // 客户端IP
+	BlockPageTimestamp = "{{timestamp}}" // 拦截时间，UTC ISO8601 格式
+)
+
+// MaxBlockPageSize 拦截页面模板的最大字节数，HAProxy 生成的响应需要放入单个缓冲区
+const MaxBlockPageSize = 8 * 1024
+
+// ErrInvalidBlockPage 拦截页面模板无效
+var ErrInvalidBlockPage = errors.New("无效的拦截页面模板")
+
 // Site 代表一个站点配置
 type Site struct {
-	ID           bson.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`                  // 站点ID
-	Name         string        `bson:"name" json:"name"`                                   // 站点名称
-	Domain       string        `bson:"domain" json:"domain"`                               // 域名，如 a.com
-	ListenPort   int           `bson:"listenPort" json:"listenPort"`                       // 监听端口，如 9000
-	EnableHTTPS  bool          `bson:"enableHTTPS" json:"enableHTTPS"`                     // 是否启用HTTPS
-	Certificate  Certificate   `bson:"certificate,omitempty" json:"certificate,omitempty"` // 证书信息
-	Backend      Backend       `bson:"backend" json:"backend"`                             // 后端服务器配置
-	WAFEnabled   bool          `bson:"wafEnabled" json:"wafEnabled"`                       // 是否启用WAF
-	WAFMode      WAFMode       `bson:"wafMode" json:"wafMode"`                             // WAF防护模式
-	CreatedAt    time.Time     `bson:"createdAt" json:"createdAt"`
-	UpdatedAt    time.Time     `bson:"updatedAt" json:"updatedAt"`
-	ActiveStatus bool          `bson:"activeStatus" json:"activeStatus"` // 站点是否激活
+	ID           bson.ObjectID     `bson:"_id,omitempty" json:"id,omitempty"`                  // 站点ID
+	Name         string            `bson:"name" json:"name"`                                   // 站点名称
+	Domain       string            `bson:"domain" json:"domain"`                               // 域名，如 a.com
+	ListenPort   int               `bson:"listenPort" json:"listenPort"`                       // 监听端口，如 9000
+	EnableHTTPS  bool              `bson:"enableHTTPS" json:"enableHTTPS"`                     // 是否启用HTTPS
+	Certificate  Certificate       `bson:"certificate,omitempty" json:"certificate,omitempty"` // 证书信息
+	Backend      Backend           `bson:"backend" json:"backend"`                             // 后端服务器配置
+	WAFEnabled   bool              `bson:"wafEnabled" json:"wafEnabled"`                       // 是否启用WAF
+	WAFMode      WAFMode           `bson:"wafMode" json:"wafMode"`                             // WAF防护模式
+	Spoe         SpoeSettings      `bson:"spoe" json:"spoe"`                                   // SPOE 检测设置
+	BlockPage    BlockPageSettings `bson:"blockPage" json:"blockPage"`                         // 拦截页面设置
+	CreatedAt    time.Time         `bson:"createdAt" json:"createdAt"`
+	UpdatedAt    time.Time         `bson:"updatedAt" json:"updatedAt"`
+	ActiveStatus bool              `bson:"activeStatus" json:"activeStatus"` // 站点是否激活
 }
 
 // Certificate 代表证书信息
@@ -40,6 +69,67 @@ type Certificate struct {
 	FingerPrint string    `bson:"fingerPrint" json:"fingerPrint"` // 证书指纹
 }
 
+// SpoeSettings 代表站点级的 SPOE 检测设置
+// ProcessingTimeout 和 MaxBodySize 为 0 时使用全局默认的 SPOE 引擎
+type SpoeSettings struct {
+	ProcessingTimeout int            `bson:"processingTimeout" json:"processingTimeout"` // SPOE 处理超时（毫秒）
+	MaxBodySize       int            `bson:"maxBodySize" json:"maxBodySize"`             // 发送给 SPOE 代理的最大消息体字节数
+	FailPolicy        SpoeFailPolicy `bson:"failPolicy" json:"failPolicy"`               // 代理出错或超时时的处理策略
+}
+
+// HasDedicatedEngine 判断站点是否需要独立的 SPOE 引擎
+func (s SpoeSettings) HasDedicatedEngine() bool {
+	return s.ProcessingTimeout > 0 || s.MaxBodySize > 0
+}
+
+// FailOpen 判断代理出错或超时时是否放行请求
+func (s SpoeSettings) FailOpen() bool {
+	return s.FailPolicy == SpoeFailOpen
+}
+
+// IsValidSpoeFailPolicy 检查 SPOE 失败策略是否有效
+func IsValidSpoeFailPolicy(policy SpoeFailPolicy) bool {
+	return policy == SpoeFailOpen || policy == SpoeFailClosed
+}
+
+// BlockPageSettings 代表站点级的拦截页面模板
+// 请求的 Accept 包含 application/json 时使用 JSON 模板，否则使用 HTML 模板；只配置一种模板时所有请求都使用该模板
+// 两种模板都为空时使用 HAProxy 默认的拦截响应
+// 只有引擎返回 deny 或 throttle 的请求使用拦截页面；tarpit、drop 和 redirect 处置，
+// 以及 HAProxy 按封禁IP map 直接拒绝、限速、tarpit、断开或跳转的请求不使用拦截页面
+type BlockPageSettings struct {
+	HTML string `bson:"html" json:"html"` // HTML 模板
+	JSON string `bson:"json" json:"json"` // JSON 模板
+}
+
+// Enabled 判断站点是否配置了拦截页面
+func (b BlockPageSettings) Enabled() bool {
+	return b.HTML != "" || b.JSON != ""
+}
+
+// ValidateBlockPage 校验拦截页面模板的长度，JSON 模板替换占位符后需为合法的 JSON
+func ValidateBlockPage(b BlockPageSettings) error {
+	if len(b.HTML) > MaxBlockPageSize {
+		return fmt.Errorf("%w: HTML 模板超过 %d 字节", ErrInvalidBlockPage, MaxBlockPageSize)
+	}
+	if len(b.JSON) > MaxBlockPageSize {
+		return fmt.Errorf("%w: JSON 模板超过 %d 字节", ErrInvalidBlockPage, MaxBlockPageSize)
+	}
+	if b.JSON != "" {
+		sample := strings.NewReplacer(
+			BlockPageRequestID, "id",
+			BlockPageReason, "reason",
+			BlockPageRuleID, "0",
+			BlockPageClientIP, "127.0.0.1",
+			BlockPageTimestamp, "1970-01-01T00:00:00Z",
+		).Replace(b.JSON)
+		if !json.Valid([]byte(sample)) {
+			return fmt.Errorf("%w: JSON 模板不是合法的 JSON", ErrInvalidBlockPage)
+		}
+	}
+	return nil
+}
+
 // Backend 代表后端服务器配置
 type Backend struct {
 	Servers []Server `bson:"servers" json:"servers"` // 服务器列表
@@ -80,6 +170,9 @@ func NewSite() *Site {
 		Backend: Backend{
 			Servers: make([]Server, 0),
 		},
+		Spoe: SpoeSettings{
+			FailPolicy: SpoeFailClosed,
+		},
 	}
 }
 
@@ -88,6 +181,18 @@ func ValidateSite(site *Site) error {
 	if !IsValidWAFMode(site.WAFMode) {
 		site.WAFMode = DefaultWAFMode()
 	}
+	if !IsValidSpoeFailPolicy(site.Spoe.FailPolicy) {
+		site.Spoe.FailPolicy = SpoeFailClosed
+	}
+	if site.Spoe.ProcessingTimeout < 0 {
+		site.Spoe.ProcessingTimeout = 0
+	}
+	if site.Spoe.MaxBodySize < 0 {
+		site.Spoe.MaxBodySize = 0
+	}
+	if err := ValidateBlockPage(site.BlockPage); err != nil {
+		return err
+	}
 	return nil
 }
 
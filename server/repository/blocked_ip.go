@@ -18,12 +18,23 @@ var (
 	ErrBlockedIPNotFound = errors.New("封禁IP记录不存在")
 )
 
+// 实际封禁与模拟封禁的过滤条件，旧记录没有 simulated 字段，视为实际封禁
+var (
+	enforcedCond    = bson.E{Key: "simulated", Value: bson.D{{Key: "$ne", Value: true}}}
+	simulatedCond   = bson.E{Key: "simulated", Value: true}
+	isSimulatedExpr = bson.D{{Key: "$eq", Value: bson.A{"$simulated", true}}}
+)
+
+// 网段升级封禁的记录类型，旧记录没有 type 字段，视为单个IP
+var prefixBlockTypes = bson.A{model.BlockTypePrefix, model.BlockTypeASN}
+
 // BlockedIPRepository 封禁IP仓库接口
 type BlockedIPRepository interface {
 	GetBlockedIPs(ctx context.Context, req *dto.BlockedIPListRequest) ([]model.BlockedIPRecord, int64, error)
 	GetBlockedIPStats(ctx context.Context) (*dto.BlockedIPStatsResponse, error)
 	CreateBlockedIP(ctx context.Context, record *model.BlockedIPRecord) error
 	DeleteExpiredBlockedIPs(ctx context.Context) (int64, error)
+	GetActiveBlockedIPs(ctx context.Context) ([]model.BlockedIPRecord, error)
 }
 
 // MongoBlockedIPRepository MongoDB实现的封禁IP仓库
@@ -128,15 +139,19 @@ func (r *MongoBlockedIPRepository) GetBlockedIPs(ctx context.Context, req *dto.B
 }
 
 // GetBlockedIPStats 获取封禁IP统计信息
+// 实际封禁与模拟封禁分开统计
 func (r *MongoBlockedIPRepository) GetBlockedIPStats(ctx context.Context) (*dto.BlockedIPStatsResponse, error) {
 	now := time.Now()
 
 	stats := &dto.BlockedIPStatsResponse{
-		ReasonStats: make(map[string]int64),
+		ReasonStats:          make(map[string]int64),
+		TypeStats:            make(map[string]int64),
+		SimulatedReasonStats: make(map[string]int64),
 	}
+	activeCond := bson.E{Key: "blocked_until", Value: bson.D{{Key: "$gt", Value: now}}}
 
 	// 获取总封禁数量
-	total, err := r.collection.CountDocuments(ctx, bson.D{})
+	total, err := r.collection.CountDocuments(ctx, bson.D{enforcedCond})
 	if err != nil {
 		r.logger.Error().Err(err).Msg("获取总封禁数量失败")
 		return nil, err
@@ -144,8 +159,7 @@ func (r *MongoBlockedIPRepository) GetBlockedIPStats(ctx context.Context) (*dto.
 	stats.TotalBlocked = total
 
 	// 获取当前生效的封禁数量
-	activeFilter := bson.D{{Key: "blocked_until", Value: bson.D{{Key: "$gt", Value: now}}}}
-	active, err := r.collection.CountDocuments(ctx, activeFilter)
+	active, err := r.collection.CountDocuments(ctx, bson.D{enforcedCond, activeCond})
 	if err != nil {
 		r.logger.Error().Err(err).Msg("获取生效封禁数量失败")
 		return nil, err
@@ -153,10 +167,28 @@ func (r *MongoBlockedIPRepository) GetBlockedIPStats(ctx context.Context) (*dto.
 	stats.ActiveBlocked = active
 	stats.ExpiredBlocked = total - active
 
-	// 按原因统计
+	// 获取模拟封禁数量
+	simulated, err := r.collection.CountDocuments(ctx, bson.D{simulatedCond})
+	if err != nil {
+		r.logger.Error().Err(err).Msg("获取模拟封禁数量失败")
+		return nil, err
+	}
+	stats.SimulatedBlocked = simulated
+
+	activeSimulated, err := r.collection.CountDocuments(ctx, bson.D{simulatedCond, activeCond})
+	if err != nil {
+		r.logger.Error().Err(err).Msg("获取模拟封禁期内数量失败")
+		return nil, err
+	}
+	stats.ActiveSimulated = activeSimulated
+
+	// 按原因和模式统计
 	reasonPipeline := mongo.Pipeline{
 		{{Key: "$group", Value: bson.D{
-			{Key: "_id", Value: "$reason"},
+			{Key: "_id", Value: bson.D{
+				{Key: "reason", Value: "$reason"},
+				{Key: "simulated", Value: isSimulatedExpr},
+			}},
 			{Key: "count", Value: bson.D{{Key: "$sum", Value: 1}}},
 		}}},
 	}
@@ -170,14 +202,49 @@ func (r *MongoBlockedIPRepository) GetBlockedIPStats(ctx context.Context) (*dto.
 
 	for cursor.Next(ctx) {
 		var result struct {
-			ID    string `bson:"_id"`
-			Count int64  `bson:"count"`
+			ID struct {
+				Reason    string `bson:"reason"`
+				Simulated bool   `bson:"simulated"`
+			} `bson:"_id"`
+			Count int64 `bson:"count"`
 		}
 		if err := cursor.Decode(&result); err != nil {
 			r.logger.Error().Err(err).Msg("解析原因统计结果失败")
 			continue
 		}
-		stats.ReasonStats[result.ID] = result.Count
+		if result.ID.Simulated {
+			stats.SimulatedReasonStats[result.ID.Reason] = result.Count
+		} else {
+			stats.ReasonStats[result.ID.Reason] = result.Count
+		}
+	}
+
+	// 按封禁类型统计实际封禁
+	typePipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.D{enforcedCond}}},
+		{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: bson.D{{Key: "$ifNull", Value: bson.A{"$type", model.BlockTypeIP}}}},
+			{Key: "count", Value: bson.D{{Key: "$sum", Value: 1}}},
+		}}},
+	}
+
+	typeCursor, err := r.collection.Aggregate(ctx, typePipeline)
+	if err != nil {
+		r.logger.Error().Err(err).Msg("按封禁类型统计失败")
+		return nil, err
+	}
+	defer typeCursor.Close(ctx)
+
+	for typeCursor.Next(ctx) {
+		var result struct {
+			ID    string `bson:"_id"`
+			Count int64  `bson:"count"`
+		}
+		if err := typeCursor.Decode(&result); err != nil {
+			r.logger.Error().Err(err).Msg("解析封禁类型统计结果失败")
+			continue
+		}
+		stats.TypeStats[result.ID] += result.Count
 	}
 
 	// 最近24小时按小时统计
@@ -218,6 +285,32 @@ func (r *MongoBlockedIPRepository) DeleteExpiredBlockedIPs(ctx context.Context)
 	return result.DeletedCount, nil
 }
 
+// GetActiveBlockedIPs 获取所有仍在封禁期内的IP记录，不含模拟封禁
+func (r *MongoBlockedIPRepository) GetActiveBlockedIPs(ctx context.Context) ([]model.BlockedIPRecord, error) {
+	filter := bson.D{
+		{Key: "blocked_until", Value: bson.D{{Key: "$gt", Value: time.Now()}}},
+		enforcedCond,
+	}
+	opts := options.Find().SetProjection(bson.D{
+		{Key: "ip", Value: 1},
+		{Key: "blocked_until", Value: 1},
+	})
+
+	cursor, err := r.collection.Find(ctx, filter, opts)
+	if err != nil {
+		r.logger.Error().Err(err).Msg("查询生效中的封禁IP记录时出错")
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var records []model.BlockedIPRecord
+	if err := cursor.All(ctx, &records); err != nil {
+		r.logger.Error().Err(err).Msg("解析生效中的封禁IP记录时出错")
+		return nil, err
+	}
+	return records, nil
+}
+
 // buildFilter 构建查询过滤器
 func (r *MongoBlockedIPRepository) buildFilter(req *dto.BlockedIPListRequest) bson.D {
 	filter := bson.D{}
@@ -243,6 +336,24 @@ func (r *MongoBlockedIPRepository) buildFilter(req *dto.BlockedIPListRequest) bs
 		// 不添加时间过滤
 	}
 
+	// 类型过滤
+	switch req.Type {
+	case model.BlockTypeIP:
+		filter = append(filter, bson.E{Key: "type", Value: bson.D{{Key: "$nin", Value: prefixBlockTypes}}})
+	case model.BlockTypePrefix, model.BlockTypeASN:
+		filter = append(filter, bson.E{Key: "type", Value: req.Type})
+	}
+
+	// 模式过滤
+	switch req.Mode {
+	case "enforce":
+		filter = append(filter, enforcedCond)
+	case "monitor":
+		filter = append(filter, simulatedCond)
+	case "all", "":
+		// 不区分实际封禁与模拟封禁
+	}
+
 	return filter
 }
 
@@ -279,7 +390,12 @@ func (r *MongoBlockedIPRepository) getHourlyStats(ctx context.Context, start, en
 					{Key: "date", Value: "$blocked_at"},
 				}},
 			}},
-			{Key: "count", Value: bson.D{{Key: "$sum", Value: 1}}},
+			{Key: "count", Value: bson.D{{Key: "$sum", Value: bson.D{
+				{Key: "$cond", Value: bson.A{isSimulatedExpr, 0, 1}},
+			}}}},
+			{Key: "simulatedCount", Value: bson.D{{Key: "$sum", Value: bson.D{
+				{Key: "$cond", Value: bson.A{isSimulatedExpr, 1, 0}},
+			}}}},
 		}}},
 		// 排序
 		{{Key: "$sort", Value: bson.D{{Key: "_id", Value: 1}}}},
@@ -294,8 +410,9 @@ func (r *MongoBlockedIPRepository) getHourlyStats(ctx context.Context, start, en
 	var stats []dto.BlockedIPHourlyStats
 	for cursor.Next(ctx) {
 		var result struct {
-			ID    string `bson:"_id"`
-			Count int64  `bson:"count"`
+			ID             string `bson:"_id"`
+			Count          int64  `bson:"count"`
+			SimulatedCount int64  `bson:"simulatedCount"`
 		}
 		if err := cursor.Decode(&result); err != nil {
 			r.logger.Error().Err(err).Msg("解析小时统计结果失败")
@@ -303,8 +420,9 @@ func (r *MongoBlockedIPRepository) getHourlyStats(ctx context.Context, start, en
 		}
 
 		stats = append(stats, dto.BlockedIPHourlyStats{
-			Hour:  result.ID,
-			Count: result.Count,
+			Hour:           result.ID,
+			Count:          result.Count,
+			SimulatedCount: result.SimulatedCount,
 		})
 	}
 
@@ -0,0 +1,202 @@
+// server/repository/custom_rule.go
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/HUAHUAI23/simple-waf/pkg/model"
+	"github.com/HUAHUAI23/simple-waf/server/config"
+	"github.com/rs/zerolog"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+var (
+	ErrCustomRuleNotFound = errors.New("自定义规则不存在")
+)
+
+// CustomRuleRepository 自定义规则仓库接口
+type CustomRuleRepository interface {
+	CreateCustomRule(ctx context.Context, rule *model.CustomRule) error
+	GetCustomRules(ctx context.Context, page, size int64) ([]model.CustomRule, int64, error)
+	GetCustomRuleByID(ctx context.Context, id bson.ObjectID) (*model.CustomRule, error)
+	UpdateCustomRule(ctx context.Context, rule *model.CustomRule) error
+	DeleteCustomRule(ctx context.Context, id bson.ObjectID) error
+	CheckCustomRuleNameExists(ctx context.Context, name string, excludeID bson.ObjectID) (bool, error)
+	FindRuleIDConflicts(ctx context.Context, ruleIDs []int, excludeID bson.ObjectID) ([]model.CustomRule, error)
+}
+
+// MongoCustomRuleRepository MongoDB实现的自定义规则仓库
+type MongoCustomRuleRepository struct {
+	collection *mongo.Collection
+	logger     zerolog.Logger
+}
+
+// NewCustomRuleRepository 创建自定义规则仓库
+func NewCustomRuleRepository(db *mongo.Database) CustomRuleRepository {
+	var rule model.CustomRule
+	collection := db.Collection(rule.GetCollectionName())
+	logger := config.GetRepositoryLogger("customrule")
+
+	// 创建索引
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		// 规则名称唯一索引
+		{
+			Keys:    bson.D{{Key: "name", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		// 规则ID索引，用于检测ID冲突
+		{
+			Keys: bson.D{{Key: "ruleIds", Value: 1}},
+		},
+	})
+	if err != nil {
+		logger.Error().Err(err).Msg("创建自定义规则索引失败")
+	}
+
+	return &MongoCustomRuleRepository{
+		collection: collection,
+		logger:     logger,
+	}
+}
+
+// CreateCustomRule 创建自定义规则
+func (r *MongoCustomRuleRepository) CreateCustomRule(ctx context.Context, rule *model.CustomRule) error {
+	result, err := r.collection.InsertOne(ctx, rule)
+	if err != nil {
+		r.logger.Error().Err(err).Str("name", rule.Name).Msg("插入自定义规则时出错")
+		return err
+	}
+
+	rule.ID = result.InsertedID.(bson.ObjectID)
+	return nil
+}
+
+// GetCustomRules 获取自定义规则列表
+func (r *MongoCustomRuleRepository) GetCustomRules(ctx context.Context, page, size int64) ([]model.CustomRule, int64, error) {
+	// 计算分页
+	skip := (page - 1) * size
+
+	// 按组装顺序排序
+	findOptions := options.Find().
+		SetSkip(skip).
+		SetLimit(size).
+		SetSort(bson.D{{Key: "priority", Value: 1}, {Key: "createdAt", Value: 1}, {Key: "_id", Value: 1}})
+
+	cursor, err := r.collection.Find(ctx, bson.D{}, findOptions)
+	if err != nil {
+		r.logger.Error().Err(err).Msg("查询自定义规则列表时出错")
+		return nil, 0, err
+	}
+	defer cursor.Close(ctx)
+
+	var rules []model.CustomRule
+	if err = cursor.All(ctx, &rules); err != nil {
+		r.logger.Error().Err(err).Msg("解析自定义规则列表时出错")
+		return nil, 0, err
+	}
+
+	total, err := r.collection.CountDocuments(ctx, bson.D{})
+	if err != nil {
+		r.logger.Error().Err(err).Msg("获取自定义规则总数时出错")
+		return nil, 0, err
+	}
+
+	return rules, total, nil
+}
+
+// GetCustomRuleByID 根据ID获取自定义规则
+func (r *MongoCustomRuleRepository) GetCustomRuleByID(ctx context.Context, id bson.ObjectID) (*model.CustomRule, error) {
+	var rule model.CustomRule
+	err := r.collection.FindOne(ctx, bson.D{{Key: "_id", Value: id}}).Decode(&rule)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrCustomRuleNotFound
+		}
+		r.logger.Error().Err(err).Str("id", id.Hex()).Msg("查询自定义规则时出错")
+		return nil, err
+	}
+
+	return &rule, nil
+}
+
+// UpdateCustomRule 更新自定义规则
+func (r *MongoCustomRuleRepository) UpdateCustomRule(ctx context.Context, rule *model.CustomRule) error {
+	_, err := r.collection.ReplaceOne(
+		ctx,
+		bson.D{{Key: "_id", Value: rule.ID}},
+		rule,
+	)
+	if err != nil {
+		r.logger.Error().Err(err).Str("id", rule.ID.Hex()).Msg("更新自定义规则时出错")
+		return err
+	}
+
+	return nil
+}
+
+// DeleteCustomRule 删除自定义规则
+func (r *MongoCustomRuleRepository) DeleteCustomRule(ctx context.Context, id bson.ObjectID) error {
+	result, err := r.collection.DeleteOne(ctx, bson.D{{Key: "_id", Value: id}})
+	if err != nil {
+		r.logger.Error().Err(err).Str("id", id.Hex()).Msg("删除自定义规则时出错")
+		return err
+	}
+
+	if result.DeletedCount == 0 {
+		return ErrCustomRuleNotFound
+	}
+
+	return nil
+}
+
+// CheckCustomRuleNameExists 检查自定义规则名称是否已存在
+func (r *MongoCustomRuleRepository) CheckCustomRuleNameExists(ctx context.Context, name string, excludeID bson.ObjectID) (bool, error) {
+	filter := bson.D{{Key: "name", Value: name}}
+
+	// 如果是更新操作，需要排除当前规则ID
+	if excludeID != bson.NilObjectID {
+		filter = append(filter, bson.E{Key: "_id", Value: bson.D{{Key: "$ne", Value: excludeID}}})
+	}
+
+	count, err := r.collection.CountDocuments(ctx, filter)
+	if err != nil {
+		r.logger.Error().Err(err).Str("name", name).Msg("检查自定义规则名称是否存在时出错")
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
+// FindRuleIDConflicts 查找定义了相同规则ID的其他自定义规则，包括未启用的规则
+func (r *MongoCustomRuleRepository) FindRuleIDConflicts(ctx context.Context, ruleIDs []int, excludeID bson.ObjectID) ([]model.CustomRule, error) {
+	if len(ruleIDs) == 0 {
+		return nil, nil
+	}
+
+	filter := bson.D{{Key: "ruleIds", Value: bson.D{{Key: "$in", Value: ruleIDs}}}}
+	if excludeID != bson.NilObjectID {
+		filter = append(filter, bson.E{Key: "_id", Value: bson.D{{Key: "$ne", Value: excludeID}}})
+	}
+
+	cursor, err := r.collection.Find(ctx, filter)
+	if err != nil {
+		r.logger.Error().Err(err).Msg("查询规则ID冲突时出错")
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var rules []model.CustomRule
+	if err = cursor.All(ctx, &rules); err != nil {
+		r.logger.Error().Err(err).Msg("解析规则ID冲突结果时出错")
+		return nil, err
+	}
+
+	return rules, nil
+}
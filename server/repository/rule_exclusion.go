@@ -0,0 +1,190 @@
+// server/repository/rule_exclusion.go
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/HUAHUAI23/simple-waf/pkg/model"
+	"github.com/HUAHUAI23/simple-waf/server/config"
+	"github.com/rs/zerolog"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+var (
+	ErrRuleExclusionNotFound = errors.New("规则排除不存在")
+)
+
+// RuleExclusionRepository 规则排除仓库接口
+type RuleExclusionRepository interface {
+	CreateRuleExclusion(ctx context.Context, exclusion *model.RuleExclusion) error
+	GetRuleExclusions(ctx context.Context, page, size int64) ([]model.RuleExclusion, int64, error)
+	GetRuleExclusionByID(ctx context.Context, id bson.ObjectID) (*model.RuleExclusion, error)
+	UpdateRuleExclusion(ctx context.Context, exclusion *model.RuleExclusion) error
+	DeleteRuleExclusion(ctx context.Context, id bson.ObjectID) error
+	CheckRuleExclusionNameExists(ctx context.Context, name string, excludeID bson.ObjectID) (bool, error)
+	GetEnabledRuleExclusions(ctx context.Context) ([]model.RuleExclusion, error)
+}
+
+// MongoRuleExclusionRepository MongoDB实现的规则排除仓库
+type MongoRuleExclusionRepository struct {
+	collection *mongo.Collection
+	logger     zerolog.Logger
+}
+
+// NewRuleExclusionRepository 创建规则排除仓库
+func NewRuleExclusionRepository(db *mongo.Database) RuleExclusionRepository {
+	var exclusion model.RuleExclusion
+	collection := db.Collection(exclusion.GetCollectionName())
+	logger := config.GetRepositoryLogger("ruleexclusion")
+
+	// 创建索引
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// 规则排除名称唯一索引
+	_, err := collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "name", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		logger.Error().Err(err).Msg("创建规则排除名称索引失败")
+	}
+
+	return &MongoRuleExclusionRepository{
+		collection: collection,
+		logger:     logger,
+	}
+}
+
+// CreateRuleExclusion 创建规则排除
+func (r *MongoRuleExclusionRepository) CreateRuleExclusion(ctx context.Context, exclusion *model.RuleExclusion) error {
+	result, err := r.collection.InsertOne(ctx, exclusion)
+	if err != nil {
+		r.logger.Error().Err(err).Str("name", exclusion.Name).Msg("插入规则排除时出错")
+		return err
+	}
+
+	exclusion.ID = result.InsertedID.(bson.ObjectID)
+	return nil
+}
+
+// GetRuleExclusions 获取规则排除列表
+func (r *MongoRuleExclusionRepository) GetRuleExclusions(ctx context.Context, page, size int64) ([]model.RuleExclusion, int64, error) {
+	// 计算分页
+	skip := (page - 1) * size
+
+	// 按创建时间排序，与运行时生成规则的顺序一致
+	findOptions := options.Find().
+		SetSkip(skip).
+		SetLimit(size).
+		SetSort(bson.D{{Key: "createdAt", Value: 1}, {Key: "_id", Value: 1}})
+
+	cursor, err := r.collection.Find(ctx, bson.D{}, findOptions)
+	if err != nil {
+		r.logger.Error().Err(err).Msg("查询规则排除列表时出错")
+		return nil, 0, err
+	}
+	defer cursor.Close(ctx)
+
+	var exclusions []model.RuleExclusion
+	if err = cursor.All(ctx, &exclusions); err != nil {
+		r.logger.Error().Err(err).Msg("解析规则排除列表时出错")
+		return nil, 0, err
+	}
+
+	total, err := r.collection.CountDocuments(ctx, bson.D{})
+	if err != nil {
+		r.logger.Error().Err(err).Msg("获取规则排除总数时出错")
+		return nil, 0, err
+	}
+
+	return exclusions, total, nil
+}
+
+// GetRuleExclusionByID 根据ID获取规则排除
+func (r *MongoRuleExclusionRepository) GetRuleExclusionByID(ctx context.Context, id bson.ObjectID) (*model.RuleExclusion, error) {
+	var exclusion model.RuleExclusion
+	err := r.collection.FindOne(ctx, bson.D{{Key: "_id", Value: id}}).Decode(&exclusion)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrRuleExclusionNotFound
+		}
+		r.logger.Error().Err(err).Str("id", id.Hex()).Msg("查询规则排除时出错")
+		return nil, err
+	}
+
+	return &exclusion, nil
+}
+
+// UpdateRuleExclusion 更新规则排除
+func (r *MongoRuleExclusionRepository) UpdateRuleExclusion(ctx context.Context, exclusion *model.RuleExclusion) error {
+	_, err := r.collection.ReplaceOne(
+		ctx,
+		bson.D{{Key: "_id", Value: exclusion.ID}},
+		exclusion,
+	)
+	if err != nil {
+		r.logger.Error().Err(err).Str("id", exclusion.ID.Hex()).Msg("更新规则排除时出错")
+		return err
+	}
+
+	return nil
+}
+
+// DeleteRuleExclusion 删除规则排除
+func (r *MongoRuleExclusionRepository) DeleteRuleExclusion(ctx context.Context, id bson.ObjectID) error {
+	result, err := r.collection.DeleteOne(ctx, bson.D{{Key: "_id", Value: id}})
+	if err != nil {
+		r.logger.Error().Err(err).Str("id", id.Hex()).Msg("删除规则排除时出错")
+		return err
+	}
+
+	if result.DeletedCount == 0 {
+		return ErrRuleExclusionNotFound
+	}
+
+	return nil
+}
+
+// CheckRuleExclusionNameExists 检查规则排除名称是否已存在
+func (r *MongoRuleExclusionRepository) CheckRuleExclusionNameExists(ctx context.Context, name string, excludeID bson.ObjectID) (bool, error) {
+	filter := bson.D{{Key: "name", Value: name}}
+
+	// 如果是更新操作，需要排除当前规则排除ID
+	if excludeID != bson.NilObjectID {
+		filter = append(filter, bson.E{Key: "_id", Value: bson.D{{Key: "$ne", Value: excludeID}}})
+	}
+
+	count, err := r.collection.CountDocuments(ctx, filter)
+	if err != nil {
+		r.logger.Error().Err(err).Str("name", name).Msg("检查规则排除名称是否存在时出错")
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
+// GetEnabledRuleExclusions 获取已启用的规则排除，按创建时间排序，与引擎加载规则排除的顺序一致
+func (r *MongoRuleExclusionRepository) GetEnabledRuleExclusions(ctx context.Context) ([]model.RuleExclusion, error) {
+	cursor, err := r.collection.Find(
+		ctx,
+		bson.D{{Key: "enabled", Value: true}},
+		options.Find().SetSort(bson.D{{Key: "createdAt", Value: 1}, {Key: "_id", Value: 1}}),
+	)
+	if err != nil {
+		r.logger.Error().Err(err).Msg("查询已启用的规则排除时出错")
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var exclusions []model.RuleExclusion
+	if err := cursor.All(ctx, &exclusions); err != nil {
+		r.logger.Error().Err(err).Msg("解码规则排除时出错")
+		return nil, err
+	}
+	return exclusions, nil
+}
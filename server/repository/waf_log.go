@@ -2,6 +2,7 @@ package repository
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"math"
 	"sort"
@@ -16,27 +17,36 @@ import (
 	"go.mongodb.org/mongo-driver/v2/mongo/options"
 )
 
+var (
+	ErrAuditLogNotFound = errors.New("审计日志不存在")
+)
+
 type WAFLogRepository interface {
 	AggregateAttackEvents(ctx context.Context, pipeline mongo.Pipeline) ([]dto.AttackEventAggregateResult, error)
 	CountAggregateAttackEvents(ctx context.Context, pipeline mongo.Pipeline) (int64, error)
 	FindAttackLogs(ctx context.Context, filter bson.D, skip int64, limit int64) ([]model.WAFLog, error)
 	CountAttackLogs(ctx context.Context, filter bson.D) (int64, error)
+	SumAttackLogEvents(ctx context.Context, filter bson.D) (int64, error)
+	FindAuditLogByRequestID(ctx context.Context, requestID string) (*model.AuditLog, error)
 }
 
 type MongoWAFLogRepository struct {
-	collection *mongo.Collection
-	logger     zerolog.Logger
+	collection      *mongo.Collection
+	auditCollection *mongo.Collection
+	logger          zerolog.Logger
 }
 
 // NewWAFLogRepository creates a new WAFLogRepository instance
 func NewWAFLogRepository(db *mongo.Database) WAFLogRepository {
 	var wafLog model.WAFLog
+	var auditLog model.AuditLog
 	collection := db.Collection(wafLog.GetCollectionName())
 	logger := config.GetRepositoryLogger("waf_log")
 
 	return &MongoWAFLogRepository{
-		collection: collection,
-		logger:     logger,
+		collection:      collection,
+		auditCollection: db.Collection(auditLog.GetCollectionName()),
+		logger:          logger,
 	}
 }
 
@@ -172,6 +182,49 @@ func (r *MongoWAFLogRepository) CountAttackLogs(ctx context.Context, filter bson
 	return total, nil
 }
 
+// SumAttackLogEvents sums the number of events represented by the attack logs matching the filter,
+// aggregated records count as their count field and records without it count as one
+func (r *MongoWAFLogRepository) SumAttackLogEvents(ctx context.Context, filter bson.D) (int64, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: filter}},
+		{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: nil},
+			{Key: "total", Value: bson.D{{Key: "$sum", Value: bson.D{{Key: "$ifNull", Value: bson.A{"$count", 1}}}}}},
+		}}},
+	}
+
+	cursor, err := r.collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return 0, fmt.Errorf("error executing sum aggregation: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var result struct {
+		Total int64 `bson:"total"`
+	}
+	if cursor.Next(ctx) {
+		if err := cursor.Decode(&result); err != nil {
+			return 0, fmt.Errorf("error decoding sum result: %w", err)
+		}
+	}
+	return result.Total, cursor.Err()
+}
+
+// FindAuditLogByRequestID finds the latest audit log of the given request
+func (r *MongoWAFLogRepository) FindAuditLogByRequestID(ctx context.Context, requestID string) (*model.AuditLog, error) {
+	findOptions := options.FindOne().SetSort(bson.D{{Key: "createdAt", Value: -1}})
+
+	var auditLog model.AuditLog
+	err := r.auditCollection.FindOne(ctx, bson.D{{Key: "requestId", Value: requestID}}, findOptions).Decode(&auditLog)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrAuditLogNotFound
+		}
+		return nil, fmt.Errorf("error finding audit log: %w", err)
+	}
+	return &auditLog, nil
+}
+
 // calculateAttackDuration calculates the duration of a continuous attack
 // by finding the longest sequence of attacks with gaps no larger than 5 minutes
 func (r *MongoWAFLogRepository) calculateAttackDuration(attackTimes []time.Time) float64 {
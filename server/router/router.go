@@ -33,6 +33,8 @@ func Setup(route *gin.Engine, db *mongo.Database) {
 	ipGroupRepo := repository.NewIPGroupRepository(db)
 	ruleRepo := repository.NewMicroRuleRepository(db)
 	blockedIPRepo := repository.NewBlockedIPRepository(db)
+	ruleExclusionRepo := repository.NewRuleExclusionRepository(db)
+	customRuleRepo := repository.NewCustomRuleRepository(db)
 
 	// 创建服务
 	authService := service.NewAuthService(userRepo, roleRepo)
@@ -45,6 +47,8 @@ func Setup(route *gin.Engine, db *mongo.Database) {
 	ruleService := service.NewMicroRuleService(ruleRepo)
 	statsService := service.NewStatsService(wafLogRepo)
 	blockedIPService := service.NewBlockedIPService(blockedIPRepo)
+	ruleExclusionService := service.NewRuleExclusionService(ruleExclusionRepo, configRepo)
+	customRuleService := service.NewCustomRuleService(customRuleRepo)
 	// 创建控制器
 	authController := controller.NewAuthController(authService)
 	siteController := controller.NewSiteController(siteService)
@@ -56,6 +60,8 @@ func Setup(route *gin.Engine, db *mongo.Database) {
 	ruleController := controller.NewMicroRuleController(ruleService)
 	statsController := controller.NewStatsController(runnerService, statsService)
 	blockedIPController := controller.NewBlockedIPController(blockedIPService)
+	ruleExclusionController := controller.NewRuleExclusionController(ruleExclusionService)
+	customRuleController := controller.NewCustomRuleController(customRuleService)
 	// 将仓库添加到上下文中，供中间件使用
 	route.Use(func(c *gin.Context) {
 		c.Set("userRepo", userRepo)
@@ -158,6 +164,26 @@ func Setup(route *gin.Engine, db *mongo.Database) {
 		ruleRoutes.DELETE("/:id", middleware.HasPermission(model.PermConfigUpdate), ruleController.DeleteMicroRule)
 	}
 
+	// CRS 规则排除管理路由
+	ruleExclusionRoutes := authenticated.Group("/rule-exclusions")
+	{
+		ruleExclusionRoutes.POST("", middleware.HasPermission(model.PermConfigUpdate), ruleExclusionController.CreateRuleExclusion)
+		ruleExclusionRoutes.GET("", middleware.HasPermission(model.PermConfigRead), ruleExclusionController.GetRuleExclusions)
+		ruleExclusionRoutes.GET("/:id", middleware.HasPermission(model.PermConfigRead), ruleExclusionController.GetRuleExclusionByID)
+		ruleExclusionRoutes.PUT("/:id", middleware.HasPermission(model.PermConfigUpdate), ruleExclusionController.UpdateRuleExclusion)
+		ruleExclusionRoutes.DELETE("/:id", middleware.HasPermission(model.PermConfigUpdate), ruleExclusionController.DeleteRuleExclusion)
+	}
+
+	// 自定义 SecLang 规则管理路由
+	customRuleRoutes := authenticated.Group("/custom-rules")
+	{
+		customRuleRoutes.POST("", middleware.HasPermission(model.PermConfigUpdate), customRuleController.CreateCustomRule)
+		customRuleRoutes.GET("", middleware.HasPermission(model.PermConfigRead), customRuleController.GetCustomRules)
+		customRuleRoutes.GET("/:id", middleware.HasPermission(model.PermConfigRead), customRuleController.GetCustomRuleByID)
+		customRuleRoutes.PUT("/:id", middleware.HasPermission(model.PermConfigUpdate), customRuleController.UpdateCustomRule)
+		customRuleRoutes.DELETE("/:id", middleware.HasPermission(model.PermConfigUpdate), customRuleController.DeleteCustomRule)
+	}
+
 	// 日志
 	wafLogRoutes := authenticated.Group("/log")
 	{
@@ -165,6 +191,8 @@ func Setup(route *gin.Engine, db *mongo.Database) {
 		wafLogRoutes.GET("/event", middleware.HasPermission(model.PermWAFLogRead), wafLogController.GetAttackEvents)
 		// 获取攻击日志 - 需要logs:read权限
 		wafLogRoutes.GET("", middleware.HasPermission(model.PermWAFLogRead), wafLogController.GetAttackLogs)
+		// 获取请求的审计日志 - 需要logs:read权限
+		wafLogRoutes.GET("/audit/:requestId", middleware.HasPermission(model.PermWAFLogRead), wafLogController.GetAuditLog)
 	}
 
 	// 统计信息路由
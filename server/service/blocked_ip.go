@@ -56,6 +56,7 @@ func (s *BlockedIPServiceImpl) GetBlockedIPs(ctx context.Context, req *dto.Block
 		Str("ip", req.IP).
 		Str("reason", req.Reason).
 		Str("status", req.Status).
+		Str("mode", req.Mode).
 		Msg("获取封禁IP列表请求")
 
 	// 调用仓库层
@@ -105,6 +106,7 @@ func (s *BlockedIPServiceImpl) GetBlockedIPStats(ctx context.Context) (*dto.Bloc
 		Int64("total_blocked", stats.TotalBlocked).
 		Int64("active_blocked", stats.ActiveBlocked).
 		Int64("expired_blocked", stats.ExpiredBlocked).
+		Int64("simulated_blocked", stats.SimulatedBlocked).
 		Int("reason_types", len(stats.ReasonStats)).
 		Int("hourly_stats", len(stats.Last24HourStats)).
 		Msg("获取封禁IP统计信息成功")
@@ -176,6 +178,9 @@ func (s *BlockedIPServiceImpl) setDefaultParams(req *dto.BlockedIPListRequest) {
 	if req.Status == "" {
 		req.Status = "all"
 	}
+	if req.Mode == "" {
+		req.Mode = "all"
+	}
 	if req.SortBy == "" {
 		req.SortBy = "blocked_at"
 	}
@@ -4,7 +4,10 @@ package service
 import (
 	"context"
 	"errors"
+	"fmt"
 
+	"github.com/HUAHUAI23/simple-waf/coraza-spoa/pkg/server"
+	mongodb "github.com/HUAHUAI23/simple-waf/pkg/database/mongo"
 	"github.com/HUAHUAI23/simple-waf/pkg/model"
 	"github.com/HUAHUAI23/simple-waf/server/config"
 	"github.com/HUAHUAI23/simple-waf/server/dto"
@@ -14,6 +17,7 @@ import (
 
 var (
 	ErrConfigNotFound = errors.New("配置不存在")
+	ErrInvalidConfig  = errors.New("无效的配置")
 )
 
 // ConfigService 配置服务接口
@@ -93,6 +97,106 @@ func (s *ConfigServiceImpl) PatchConfig(ctx context.Context, req *dto.ConfigPatc
 			cfg.Engine.CityDBPath = *req.Engine.CityDBPath
 		}
 
+		if req.Engine.CRSPluginDir != nil {
+			cfg.Engine.CRSPluginDir = *req.Engine.CRSPluginDir
+		}
+
+		if req.Engine.DefaultApp != nil {
+			cfg.Engine.DefaultApp = *req.Engine.DefaultApp
+		}
+
+		if req.Engine.UnknownAppPolicy != nil {
+			cfg.Engine.UnknownAppPolicy = *req.Engine.UnknownAppPolicy
+		}
+
+		// 更新决策记录配置
+		if req.Engine.DecisionLog != nil {
+			if req.Engine.DecisionLog.Enabled != nil {
+				cfg.Engine.DecisionLog.Enabled = *req.Engine.DecisionLog.Enabled
+			}
+			if req.Engine.DecisionLog.SampleRate != nil {
+				cfg.Engine.DecisionLog.SampleRate = *req.Engine.DecisionLog.SampleRate
+			}
+		}
+
+		// 更新审计日志配置
+		if req.Engine.AuditLog != nil {
+			if req.Engine.AuditLog.Enabled != nil {
+				cfg.Engine.AuditLog.Enabled = *req.Engine.AuditLog.Enabled
+			}
+			if req.Engine.AuditLog.Parts != nil {
+				cfg.Engine.AuditLog.Parts = *req.Engine.AuditLog.Parts
+			}
+			if req.Engine.AuditLog.BodyLimit != nil {
+				cfg.Engine.AuditLog.BodyLimit = *req.Engine.AuditLog.BodyLimit
+			}
+			if req.Engine.AuditLog.RetentionDays != nil {
+				cfg.Engine.AuditLog.RetentionDays = *req.Engine.AuditLog.RetentionDays
+			}
+		}
+
+		// 更新日志溢出队列配置
+		if req.Engine.LogSpill != nil {
+			if req.Engine.LogSpill.Enabled != nil {
+				cfg.Engine.LogSpill.Enabled = *req.Engine.LogSpill.Enabled
+			}
+			if req.Engine.LogSpill.Dir != nil {
+				cfg.Engine.LogSpill.Dir = *req.Engine.LogSpill.Dir
+			}
+			if req.Engine.LogSpill.MaxSize != nil {
+				cfg.Engine.LogSpill.MaxSize = *req.Engine.LogSpill.MaxSize
+			}
+			if req.Engine.LogSpill.SegmentSize != nil {
+				cfg.Engine.LogSpill.SegmentSize = *req.Engine.LogSpill.SegmentSize
+			}
+		}
+
+		// 更新日志聚合配置
+		if req.Engine.LogAggregation != nil {
+			if req.Engine.LogAggregation.Enabled != nil {
+				cfg.Engine.LogAggregation.Enabled = *req.Engine.LogAggregation.Enabled
+			}
+			if req.Engine.LogAggregation.Window != nil {
+				cfg.Engine.LogAggregation.Window = *req.Engine.LogAggregation.Window
+			}
+			if req.Engine.LogAggregation.MaxPerSecond != nil {
+				cfg.Engine.LogAggregation.MaxPerSecond = *req.Engine.LogAggregation.MaxPerSecond
+			}
+			if req.Engine.LogAggregation.MaxKeys != nil {
+				cfg.Engine.LogAggregation.MaxKeys = *req.Engine.LogAggregation.MaxKeys
+			}
+		}
+
+		// 更新日志脱敏配置
+		if req.Engine.LogRedaction != nil {
+			redaction := req.Engine.LogRedaction
+			if redaction.Enabled != nil {
+				cfg.Engine.LogRedaction.Enabled = *redaction.Enabled
+			}
+			if redaction.Mode != nil {
+				cfg.Engine.LogRedaction.Mode = *redaction.Mode
+			}
+			if redaction.HashKey != nil {
+				cfg.Engine.LogRedaction.HashKey = *redaction.HashKey
+			}
+			if redaction.Headers != nil {
+				cfg.Engine.LogRedaction.Headers = *redaction.Headers
+			}
+			if redaction.Fields != nil {
+				cfg.Engine.LogRedaction.Fields = *redaction.Fields
+			}
+			if redaction.Patterns != nil {
+				patterns := make([]model.RedactionPattern, len(*redaction.Patterns))
+				for i, pattern := range *redaction.Patterns {
+					patterns[i] = model.RedactionPattern{
+						Name:    pattern.Name,
+						Pattern: pattern.Pattern,
+					}
+				}
+				cfg.Engine.LogRedaction.Patterns = patterns
+			}
+		}
+
 		// 更新AppConfig
 		if len(req.Engine.AppConfig) > 0 {
 			for _, reqApp := range req.Engine.AppConfig {
@@ -115,6 +219,26 @@ func (s *ConfigServiceImpl) PatchConfig(ctx context.Context, req *dto.ConfigPatc
 						if reqApp.LogFormat != nil {
 							cfg.Engine.AppConfig[i].LogFormat = *reqApp.LogFormat
 						}
+						if reqApp.CRS != nil {
+							cfg.Engine.AppConfig[i].CRS = model.CRSSettings{
+								BlockingParanoiaLevel:    reqApp.CRS.BlockingParanoiaLevel,
+								DetectionParanoiaLevel:   reqApp.CRS.DetectionParanoiaLevel,
+								InboundAnomalyThreshold:  reqApp.CRS.InboundAnomalyThreshold,
+								OutboundAnomalyThreshold: reqApp.CRS.OutboundAnomalyThreshold,
+								WarningAnomalyScore:      reqApp.CRS.WarningAnomalyScore,
+								AllowedMethods:           reqApp.CRS.AllowedMethods,
+								AllowedContentTypes:      reqApp.CRS.AllowedContentTypes,
+								RestrictedExtensions:     reqApp.CRS.RestrictedExtensions,
+								DisabledRuleFamilies:     reqApp.CRS.DisabledRuleFamilies,
+								Plugins:                  reqApp.CRS.Plugins,
+							}
+						}
+						if reqApp.LogCollection != nil {
+							cfg.Engine.AppConfig[i].LogCollection = *reqApp.LogCollection
+						}
+						if reqApp.LogSinks != nil {
+							cfg.Engine.AppConfig[i].LogSinks = toLogSinkConfigs(*reqApp.LogSinks, app.LogSinks)
+						}
 						break
 					}
 				}
@@ -129,6 +253,18 @@ func (s *ConfigServiceImpl) PatchConfig(ctx context.Context, req *dto.ConfigPatc
 				if visitLimit.Enabled != nil {
 					cfg.Engine.FlowController.VisitLimit.Enabled = *visitLimit.Enabled
 				}
+				if visitLimit.Mode != nil {
+					cfg.Engine.FlowController.VisitLimit.Mode = *visitLimit.Mode
+				}
+				if visitLimit.Algorithm != nil {
+					cfg.Engine.FlowController.VisitLimit.Algorithm = *visitLimit.Algorithm
+				}
+				if visitLimit.Action != nil {
+					cfg.Engine.FlowController.VisitLimit.Action = *visitLimit.Action
+				}
+				if visitLimit.RedirectURL != nil {
+					cfg.Engine.FlowController.VisitLimit.RedirectURL = *visitLimit.RedirectURL
+				}
 				if visitLimit.Threshold != nil {
 					cfg.Engine.FlowController.VisitLimit.Threshold = *visitLimit.Threshold
 				}
@@ -152,6 +288,18 @@ func (s *ConfigServiceImpl) PatchConfig(ctx context.Context, req *dto.ConfigPatc
 				if attackLimit.Enabled != nil {
 					cfg.Engine.FlowController.AttackLimit.Enabled = *attackLimit.Enabled
 				}
+				if attackLimit.Mode != nil {
+					cfg.Engine.FlowController.AttackLimit.Mode = *attackLimit.Mode
+				}
+				if attackLimit.Algorithm != nil {
+					cfg.Engine.FlowController.AttackLimit.Algorithm = *attackLimit.Algorithm
+				}
+				if attackLimit.Action != nil {
+					cfg.Engine.FlowController.AttackLimit.Action = *attackLimit.Action
+				}
+				if attackLimit.RedirectURL != nil {
+					cfg.Engine.FlowController.AttackLimit.RedirectURL = *attackLimit.RedirectURL
+				}
 				if attackLimit.Threshold != nil {
 					cfg.Engine.FlowController.AttackLimit.Threshold = *attackLimit.Threshold
 				}
@@ -175,6 +323,18 @@ func (s *ConfigServiceImpl) PatchConfig(ctx context.Context, req *dto.ConfigPatc
 				if errorLimit.Enabled != nil {
 					cfg.Engine.FlowController.ErrorLimit.Enabled = *errorLimit.Enabled
 				}
+				if errorLimit.Mode != nil {
+					cfg.Engine.FlowController.ErrorLimit.Mode = *errorLimit.Mode
+				}
+				if errorLimit.Algorithm != nil {
+					cfg.Engine.FlowController.ErrorLimit.Algorithm = *errorLimit.Algorithm
+				}
+				if errorLimit.Action != nil {
+					cfg.Engine.FlowController.ErrorLimit.Action = *errorLimit.Action
+				}
+				if errorLimit.RedirectURL != nil {
+					cfg.Engine.FlowController.ErrorLimit.RedirectURL = *errorLimit.RedirectURL
+				}
 				if errorLimit.Threshold != nil {
 					cfg.Engine.FlowController.ErrorLimit.Threshold = *errorLimit.Threshold
 				}
@@ -190,6 +350,100 @@ func (s *ConfigServiceImpl) PatchConfig(ctx context.Context, req *dto.ConfigPatc
 				if errorLimit.ParamsCapacity != nil {
 					cfg.Engine.FlowController.ErrorLimit.ParamsCapacity = *errorLimit.ParamsCapacity
 				}
+				if errorLimit.StatusCodes != nil {
+					cfg.Engine.FlowController.ErrorLimit.StatusCodes = *errorLimit.StatusCodes
+				}
+				if errorLimit.Paths != nil {
+					cfg.Engine.FlowController.ErrorLimit.Paths = *errorLimit.Paths
+				}
+			}
+
+			// 更新命名错误策略，整体替换
+			if req.Engine.FlowController.ErrorPolicies != nil {
+				policies := make([]model.ErrorPolicyConfig, len(*req.Engine.FlowController.ErrorPolicies))
+				for i, policy := range *req.Engine.FlowController.ErrorPolicies {
+					mode := policy.Mode
+					if mode == "" {
+						mode = model.FlowControlModeEnforce
+					}
+					algorithm := policy.Algorithm
+					if algorithm == "" {
+						algorithm = model.FlowLimitAlgorithmTokenBucket
+					}
+					action := policy.Action
+					if action == "" {
+						action = model.FlowControlActionDeny
+					}
+					paramsCapacity := policy.ParamsCapacity
+					if paramsCapacity == 0 {
+						paramsCapacity = 10000
+					}
+					policies[i] = model.ErrorPolicyConfig{
+						Name:           policy.Name,
+						Enabled:        policy.Enabled,
+						Mode:           mode,
+						Algorithm:      algorithm,
+						Action:         action,
+						RedirectURL:    policy.RedirectURL,
+						StatusCodes:    policy.StatusCodes,
+						Paths:          policy.Paths,
+						Threshold:      policy.Threshold,
+						StatDuration:   policy.StatDuration,
+						BlockDuration:  policy.BlockDuration,
+						BurstCount:     policy.BurstCount,
+						ParamsCapacity: paramsCapacity,
+					}
+				}
+				cfg.Engine.FlowController.ErrorPolicies = policies
+			}
+
+			// 更新SubnetEscalation配置
+			if req.Engine.FlowController.SubnetEscalation != nil {
+				escalation := req.Engine.FlowController.SubnetEscalation
+				if escalation.Enabled != nil {
+					cfg.Engine.FlowController.SubnetEscalation.Enabled = *escalation.Enabled
+				}
+				if escalation.IPv4PrefixLen != nil {
+					cfg.Engine.FlowController.SubnetEscalation.IPv4PrefixLen = *escalation.IPv4PrefixLen
+				}
+				if escalation.IPv6PrefixLen != nil {
+					cfg.Engine.FlowController.SubnetEscalation.IPv6PrefixLen = *escalation.IPv6PrefixLen
+				}
+				if escalation.ByASN != nil {
+					cfg.Engine.FlowController.SubnetEscalation.ByASN = *escalation.ByASN
+				}
+				if escalation.Threshold != nil {
+					cfg.Engine.FlowController.SubnetEscalation.Threshold = *escalation.Threshold
+				}
+				if escalation.Window != nil {
+					cfg.Engine.FlowController.SubnetEscalation.Window = *escalation.Window
+				}
+				if escalation.BlockDuration != nil {
+					cfg.Engine.FlowController.SubnetEscalation.BlockDuration = *escalation.BlockDuration
+				}
+			}
+
+			// 更新CounterBackend配置
+			if req.Engine.FlowController.CounterBackend != nil {
+				counterBackend := req.Engine.FlowController.CounterBackend
+				if counterBackend.Type != nil {
+					cfg.Engine.FlowController.CounterBackend.Type = *counterBackend.Type
+				}
+				if counterBackend.Addr != nil {
+					cfg.Engine.FlowController.CounterBackend.Addr = *counterBackend.Addr
+				}
+				if counterBackend.Password != nil {
+					cfg.Engine.FlowController.CounterBackend.Password = *counterBackend.Password
+				}
+				if counterBackend.DB != nil {
+					cfg.Engine.FlowController.CounterBackend.DB = *counterBackend.DB
+				}
+				if counterBackend.KeyPrefix != nil {
+					cfg.Engine.FlowController.CounterBackend.KeyPrefix = *counterBackend.KeyPrefix
+				}
+				if counterBackend.Timeout != nil {
+					cfg.Engine.FlowController.CounterBackend.Timeout = *counterBackend.Timeout
+				}
 			}
 		}
 	}
@@ -214,6 +468,14 @@ func (s *ConfigServiceImpl) PatchConfig(ctx context.Context, req *dto.ConfigPatc
 		if req.Haproxy.Thread != nil {
 			cfg.Haproxy.Thread = *req.Haproxy.Thread
 		}
+		if req.Haproxy.TarpitTimeout != nil {
+			cfg.Haproxy.TarpitTimeout = *req.Haproxy.TarpitTimeout
+		}
+	}
+
+	// 预检每个应用最终加载的指令，避免引擎重新加载时失败
+	if err := s.validateApplications(cfg); err != nil {
+		return nil, err
 	}
 
 	// 保存更新
@@ -226,3 +488,68 @@ func (s *ConfigServiceImpl) PatchConfig(ctx context.Context, req *dto.ConfigPatc
 	s.logger.Info().Str("name", cfg.Name).Msg("配置更新成功")
 	return cfg, nil
 }
+
+// validateApplications 按引擎加载应用的方式组装并编译每个应用的指令，包括CRS结构化配置、自定义规则和规则排除
+func (s *ConfigServiceImpl) validateApplications(cfg *model.Config) error {
+	client, err := mongodb.Connect(config.Global.DBConfig.URI)
+	if err != nil {
+		s.logger.Error().Err(err).Msg("连接数据库失败")
+		return err
+	}
+
+	if err := server.ValidateConfig(cfg, client.Database(config.Global.DBConfig.Database)); err != nil {
+		if errors.Is(err, server.ErrInvalidAppConfig) {
+			return fmt.Errorf("%w: %v", ErrInvalidConfig, err)
+		}
+		s.logger.Error().Err(err).Msg("预检应用配置失败")
+		return err
+	}
+	return nil
+}
+
+// toLogSinkConfigs 转换日志输出配置，未传入请求头的 webhook 输出保留同名输出已有的请求头
+func toLogSinkConfigs(sinks []dto.LogSinkDTO, existing []model.LogSinkConfig) []model.LogSinkConfig {
+	headers := make(map[string]map[string]string, len(existing))
+	for _, sink := range existing {
+		headers[sink.Name] = sink.Webhook.Headers
+	}
+
+	configs := make([]model.LogSinkConfig, len(sinks))
+	for i, sink := range sinks {
+		configs[i] = model.LogSinkConfig{
+			Name:    sink.Name,
+			Type:    sink.Type,
+			Enabled: sink.Enabled,
+		}
+		if sink.Syslog != nil {
+			configs[i].Syslog = model.SyslogSinkConfig{
+				Network:            sink.Syslog.Network,
+				Address:            sink.Syslog.Address,
+				Format:             sink.Syslog.Format,
+				Facility:           sink.Syslog.Facility,
+				InsecureSkipVerify: sink.Syslog.InsecureSkipVerify,
+			}
+		}
+		if sink.File != nil {
+			configs[i].File = model.FileSinkConfig{
+				Path:       sink.File.Path,
+				MaxSize:    sink.File.MaxSize,
+				MaxBackups: sink.File.MaxBackups,
+			}
+		}
+		if sink.Webhook != nil {
+			webhookHeaders := sink.Webhook.Headers
+			if webhookHeaders == nil {
+				webhookHeaders = headers[sink.Name]
+			}
+			configs[i].Webhook = model.WebhookSinkConfig{
+				URL:        sink.Webhook.URL,
+				Headers:    webhookHeaders,
+				BatchSize:  sink.Webhook.BatchSize,
+				Timeout:    sink.Webhook.Timeout,
+				MaxRetries: sink.Webhook.MaxRetries,
+			}
+		}
+	}
+	return configs
+}
@@ -0,0 +1,139 @@
+package cornjob
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	mongodb "github.com/HUAHUAI23/simple-waf/pkg/database/mongo"
+	"github.com/HUAHUAI23/simple-waf/pkg/model"
+	"github.com/HUAHUAI23/simple-waf/server/config"
+	"github.com/HUAHUAI23/simple-waf/server/repository"
+	"github.com/HUAHUAI23/simple-waf/server/service/daemon"
+	"github.com/HUAHUAI23/simple-waf/server/service/daemon/haproxy"
+	"github.com/go-co-op/gocron/v2"
+	"github.com/rs/zerolog"
+)
+
+// 封禁IP同步间隔，与引擎端封禁记录的批量落库间隔保持一致
+const blockedIPSyncInterval = 5 * time.Second
+
+// BlockedIPSyncJob 将数据库中生效的封禁IP同步到HAProxy map的定时任务
+type BlockedIPSyncJob struct {
+	scheduler     gocron.Scheduler
+	runner        daemon.ServiceRunner
+	blockedIPRepo repository.BlockedIPRepository
+	logger        zerolog.Logger
+	isRunning     bool // 是否正在运行
+}
+
+// NewBlockedIPSyncJob 创建封禁IP同步定时任务
+func NewBlockedIPSyncJob(runner daemon.ServiceRunner) (*BlockedIPSyncJob, error) {
+	logger := config.GetLogger().With().Str("component", "cronjob-haproxy-blocked-ip-sync-job").Logger()
+
+	client, err := mongodb.Connect(config.Global.DBConfig.URI)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	db := client.Database(config.Global.DBConfig.Database)
+
+	scheduler, err := gocron.NewScheduler(
+		gocron.WithLocation(time.Local),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create scheduler: %w", err)
+	}
+
+	return &BlockedIPSyncJob{
+		scheduler:     scheduler,
+		runner:        runner,
+		blockedIPRepo: repository.NewBlockedIPRepository(db),
+		logger:        logger,
+		isRunning:     false,
+	}, nil
+}
+
+// Start 启动定时任务
+func (j *BlockedIPSyncJob) Start(ctx context.Context) error {
+	if j.isRunning {
+		return errors.New("job is already running")
+	}
+
+	_, err := j.scheduler.NewJob(
+		gocron.DurationJob(blockedIPSyncInterval),
+		gocron.NewTask(
+			func(ctx context.Context) {
+				if err := j.Sync(ctx); err != nil {
+					j.logger.Error().Err(err).Msg("Failed to sync blocked ips to HAProxy")
+				}
+			},
+			ctx,
+		),
+		// 同步耗时超过间隔时不叠加执行
+		gocron.WithSingletonMode(gocron.LimitModeReschedule),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create blocked ip sync job: %w", err)
+	}
+
+	j.scheduler.Start()
+	j.isRunning = true
+	j.logger.Info().Msg("HAProxy blocked ip sync job started")
+	return nil
+}
+
+// Sync 执行一次同步
+func (j *BlockedIPSyncJob) Sync(ctx context.Context) error {
+	// HAProxy 未运行时不同步，启动后由下一次调度补齐
+	if j.runner.GetState() != daemon.ServiceRunning {
+		return nil
+	}
+
+	queryCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	records, err := j.blockedIPRepo.GetActiveBlockedIPs(queryCtx)
+	if err != nil {
+		return fmt.Errorf("failed to get active blocked ips: %w", err)
+	}
+
+	appConfig, err := config.GetAppConfig()
+	if err != nil {
+		return fmt.Errorf("failed to get app config: %w", err)
+	}
+
+	return j.runner.SyncBlockedIPs(blockedIPEntries(records, appConfig.Engine.FlowController))
+}
+
+// blockedIPEntries 生成所有生效中的封禁IP条目，由 HAProxy 在发送 SPOE 消息前按处置动作处置
+// 处置动作与引擎拒绝被封禁IP时一致，没有对应已启用限制的封禁（如网段升级封禁、手动封禁）直接拒绝
+// 同一IP可能有多条封禁记录，使用截止时间最晚的记录
+func blockedIPEntries(records []model.BlockedIPRecord, flowControl model.FlowControlConfig) map[string]haproxy.BlockedIPEntry {
+	entries := make(map[string]haproxy.BlockedIPEntry, len(records))
+	for _, record := range records {
+		until := record.BlockedUntil.Unix()
+		if entry, ok := entries[record.IP]; ok && entry.Until >= until {
+			continue
+		}
+		action, redirectURL := flowControl.EnforcementAction(record.Reason)
+		entries[record.IP] = haproxy.BlockedIPEntry{Until: until, Action: action, RedirectURL: redirectURL}
+	}
+	return entries
+}
+
+// Stop 停止定时任务
+func (j *BlockedIPSyncJob) Stop(ctx context.Context) error {
+	if !j.isRunning {
+		return nil
+	}
+
+	j.isRunning = false
+	if err := j.scheduler.Shutdown(); err != nil {
+		j.logger.Error().Err(err).Msg("Failed to shutdown blocked ip sync scheduler")
+		return fmt.Errorf("scheduler shutdown error: %w", err)
+	}
+
+	j.logger.Info().Msg("HAProxy blocked ip sync job stopped")
+	return nil
+}
@@ -0,0 +1,91 @@
+package cornjob
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/HUAHUAI23/simple-waf/pkg/model"
+	"github.com/HUAHUAI23/simple-waf/server/service/daemon/haproxy"
+)
+
+// TestBlockedIPEntries 测试所有生效中的封禁都同步到 map，同一IP使用截止时间最晚的记录及其处置动作
+func TestBlockedIPEntries(t *testing.T) {
+	base := time.Unix(1700000000, 0)
+	record := func(ip, reason string, minutes int) model.BlockedIPRecord {
+		return model.BlockedIPRecord{IP: ip, Reason: reason, BlockedUntil: base.Add(time.Duration(minutes) * time.Minute)}
+	}
+	entry := func(minutes int, action, redirectURL string) haproxy.BlockedIPEntry {
+		return haproxy.BlockedIPEntry{Until: base.Add(time.Duration(minutes) * time.Minute).Unix(), Action: action, RedirectURL: redirectURL}
+	}
+
+	var flowControl model.FlowControlConfig
+	flowControl.VisitLimit.Enabled = true
+	flowControl.AttackLimit.Enabled = true
+	flowControl.ErrorPolicies = []model.ErrorPolicyConfig{
+		{Name: "login", Enabled: true, Action: model.FlowControlActionDrop},
+		{Name: "api", Enabled: true, Action: model.FlowControlActionRedirect, RedirectURL: "https://example.com/wait"},
+	}
+
+	tests := []struct {
+		name    string
+		records []model.BlockedIPRecord
+		want    map[string]haproxy.BlockedIPEntry
+	}{
+		{
+			name:    "没有封禁记录",
+			records: nil,
+			want:    map[string]haproxy.BlockedIPEntry{},
+		},
+		{
+			name: "同一IP使用截止时间最晚的记录",
+			records: []model.BlockedIPRecord{
+				record("10.0.0.1", model.FlowControlReasonAttack, 30),
+				record("10.0.0.1", model.FlowControlReasonError+":login", 60),
+				record("10.0.0.1", model.FlowControlReasonAttack, 10),
+				record("10.0.0.2", model.FlowControlReasonAttack, 5),
+			},
+			want: map[string]haproxy.BlockedIPEntry{
+				"10.0.0.1": entry(60, model.FlowControlActionDrop, ""),
+				"10.0.0.2": entry(5, model.FlowControlActionDeny, ""),
+			},
+		},
+		{
+			name: "访问限制默认返回 429",
+			records: []model.BlockedIPRecord{
+				record("10.0.0.1", model.FlowControlReasonVisit, 60),
+			},
+			want: map[string]haproxy.BlockedIPEntry{
+				"10.0.0.1": entry(60, model.FlowControlActionThrottle, ""),
+			},
+		},
+		{
+			name: "跳转带跳转地址，没有对应限制的封禁直接拒绝",
+			records: []model.BlockedIPRecord{
+				record("10.0.0.1", model.FlowControlReasonError+":api", 60),
+				record("10.0.0.2", model.FlowControlReasonError+":deleted", 60),
+				record("10.0.0.0/24", model.FlowControlReasonSubnetEscalation, 120),
+			},
+			want: map[string]haproxy.BlockedIPEntry{
+				"10.0.0.1":    entry(60, model.FlowControlActionRedirect, "https://example.com/wait"),
+				"10.0.0.2":    entry(60, model.FlowControlActionDeny, ""),
+				"10.0.0.0/24": entry(120, model.FlowControlActionDeny, ""),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := blockedIPEntries(tt.records, flowControl); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("blockedIPEntries() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// 关闭访问限制后遗留的封禁没有对应的处置动作，与引擎一致直接拒绝
+	flowControl.VisitLimit.Enabled = false
+	got := blockedIPEntries([]model.BlockedIPRecord{record("10.0.0.1", model.FlowControlReasonVisit, 60)}, flowControl)
+	if got["10.0.0.1"] != entry(60, model.FlowControlActionDeny, "") {
+		t.Errorf("关闭访问限制后遗留的封禁应直接拒绝: %v", got)
+	}
+}
@@ -20,12 +20,13 @@ var (
 
 // CronJobService 定时任务服务
 type CronJobService struct {
-	statsJob  *StatsJob          // HAProxy统计数据定时任务
-	logger    zerolog.Logger     // 日志记录器
-	ctx       context.Context    // 上下文
-	cancel    context.CancelFunc // 上下文取消函数
-	isRunning bool               // 是否正在运行
-	mu        sync.Mutex         // 实例内部锁，用于Start/Stop操作
+	statsJob     *StatsJob          // HAProxy统计数据定时任务
+	blockedIPJob *BlockedIPSyncJob  // 封禁IP同步定时任务
+	logger       zerolog.Logger     // 日志记录器
+	ctx          context.Context    // 上下文
+	cancel       context.CancelFunc // 上下文取消函数
+	isRunning    bool               // 是否正在运行
+	mu           sync.Mutex         // 实例内部锁，用于Start/Stop操作
 }
 
 // 创建新的CronJobService实例（内部方法）
@@ -39,13 +40,20 @@ func newCronJobService(runner daemon.ServiceRunner, targetList []string) (*CronJ
 		return nil, fmt.Errorf("failed to create stats job: %w", err)
 	}
 
+	// 创建封禁IP同步定时任务
+	blockedIPJob, err := NewBlockedIPSyncJob(runner)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create blocked ip sync job: %w", err)
+	}
+
 	ctx, cancel := context.WithCancel(context.Background())
 	return &CronJobService{
-		statsJob:  statsJob,
-		logger:    logger,
-		ctx:       ctx,
-		cancel:    cancel,
-		isRunning: false,
+		statsJob:     statsJob,
+		blockedIPJob: blockedIPJob,
+		logger:       logger,
+		ctx:          ctx,
+		cancel:       cancel,
+		isRunning:    false,
 	}, nil
 }
 
@@ -104,6 +112,9 @@ func ResetInstance() {
 			if err != nil {
 				instance.logger.Error().Err(err).Msg("Failed to stop HAProxy stats job during reset")
 			}
+			if err := instance.blockedIPJob.Stop(ctx); err != nil {
+				instance.logger.Error().Err(err).Msg("Failed to stop HAProxy blocked ip sync job during reset")
+			}
 
 			// 取消上下文
 			instance.cancel()
@@ -137,6 +148,15 @@ func (s *CronJobService) Start() error {
 		return fmt.Errorf("failed to start stats job: %w", err)
 	}
 
+	// 启动封禁IP同步定时任务
+	if err := s.blockedIPJob.Start(s.ctx); err != nil {
+		s.logger.Error().Err(err).Msg("Failed to start HAProxy blocked ip sync job")
+		stopCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		_ = s.statsJob.Stop(stopCtx) // 忽略停止错误
+		return fmt.Errorf("failed to start blocked ip sync job: %w", err)
+	}
+
 	s.isRunning = true
 	s.logger.Info().Msg("All cron jobs started")
 	return nil
@@ -159,6 +179,7 @@ func (s *CronJobService) Stop() error {
 
 	// 用新context停止任务
 	err := s.statsJob.Stop(ctx)
+	syncErr := s.blockedIPJob.Stop(ctx)
 
 	// 然后取消服务自己的context
 	s.cancel()
@@ -167,6 +188,10 @@ func (s *CronJobService) Stop() error {
 		s.logger.Error().Err(err).Msg("Failed to stop HAProxy stats job")
 		return fmt.Errorf("failed to stop stats job: %w", err)
 	}
+	if syncErr != nil {
+		s.logger.Error().Err(syncErr).Msg("Failed to stop HAProxy blocked ip sync job")
+		return fmt.Errorf("failed to stop blocked ip sync job: %w", syncErr)
+	}
 
 	s.logger.Info().Msg("All cron jobs stopped")
 	return nil
@@ -0,0 +1,257 @@
+// server/service/custom_rule.go
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/HUAHUAI23/simple-waf/pkg/model"
+	"github.com/HUAHUAI23/simple-waf/pkg/utils/secrule"
+	"github.com/HUAHUAI23/simple-waf/server/config"
+	"github.com/HUAHUAI23/simple-waf/server/dto"
+	"github.com/HUAHUAI23/simple-waf/server/repository"
+	coreruleset "github.com/corazawaf/coraza-coreruleset"
+	"github.com/corazawaf/coraza/v3"
+	"github.com/jcchavezs/mergefs"
+	"github.com/jcchavezs/mergefs/io"
+	"github.com/rs/zerolog"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+var (
+	ErrCustomRuleNotFound   = errors.New("自定义规则不存在")
+	ErrCustomRuleNameExists = errors.New("自定义规则名称已存在")
+	ErrInvalidCustomRule    = errors.New("无效的自定义规则")
+	ErrCustomRuleIDConflict = errors.New("规则ID冲突")
+)
+
+// CustomRuleService 自定义规则服务接口
+// 规则在保存前编译校验，引擎重新加载应用时按优先级追加到应用的指令之后
+type CustomRuleService interface {
+	CreateCustomRule(ctx context.Context, req *dto.CustomRuleCreateRequest) (*model.CustomRule, error)
+	GetCustomRules(ctx context.Context, pageStr, sizeStr string) ([]model.CustomRule, int64, error)
+	GetCustomRuleByID(ctx context.Context, id bson.ObjectID) (*model.CustomRule, error)
+	UpdateCustomRule(ctx context.Context, id bson.ObjectID, req *dto.CustomRuleUpdateRequest) (*model.CustomRule, error)
+	DeleteCustomRule(ctx context.Context, id bson.ObjectID) error
+}
+
+// CustomRuleServiceImpl 自定义规则服务实现
+type CustomRuleServiceImpl struct {
+	ruleRepo repository.CustomRuleRepository
+	logger   zerolog.Logger
+}
+
+// NewCustomRuleService 创建自定义规则服务
+func NewCustomRuleService(ruleRepo repository.CustomRuleRepository) CustomRuleService {
+	logger := config.GetServiceLogger("customrule")
+	return &CustomRuleServiceImpl{
+		ruleRepo: ruleRepo,
+		logger:   logger,
+	}
+}
+
+// CreateCustomRule 创建自定义规则
+func (s *CustomRuleServiceImpl) CreateCustomRule(ctx context.Context, req *dto.CustomRuleCreateRequest) (*model.CustomRule, error) {
+	exists, err := s.ruleRepo.CheckCustomRuleNameExists(ctx, req.Name, bson.NilObjectID)
+	if err != nil {
+		return nil, err
+	}
+	if exists {
+		return nil, ErrCustomRuleNameExists
+	}
+
+	now := time.Now()
+	rule := &model.CustomRule{
+		Name:        req.Name,
+		Description: req.Description,
+		Enabled:     req.Enabled == nil || *req.Enabled,
+		Priority:    req.Priority,
+		Apps:        req.Apps,
+		Directives:  req.Directives,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if err := s.compileCustomRule(ctx, rule); err != nil {
+		return nil, err
+	}
+
+	if err := s.ruleRepo.CreateCustomRule(ctx, rule); err != nil {
+		s.logger.Error().Err(err).Msg("创建自定义规则失败")
+		return nil, err
+	}
+
+	s.logger.Info().Str("id", rule.ID.Hex()).Str("name", rule.Name).Ints("ruleIds", rule.RuleIDs).Msg("自定义规则创建成功")
+	return rule, nil
+}
+
+// GetCustomRules 获取自定义规则列表
+func (s *CustomRuleServiceImpl) GetCustomRules(ctx context.Context, pageStr, sizeStr string) ([]model.CustomRule, int64, error) {
+	page, err := strconv.ParseInt(pageStr, 10, 64)
+	if err != nil || page < 1 {
+		page = 1
+	}
+
+	size, err := strconv.ParseInt(sizeStr, 10, 64)
+	if err != nil || size < 1 {
+		size = 10
+	}
+
+	rules, total, err := s.ruleRepo.GetCustomRules(ctx, page, size)
+	if err != nil {
+		s.logger.Error().Err(err).Msg("获取自定义规则列表失败")
+		return nil, 0, err
+	}
+
+	return rules, total, nil
+}
+
+// GetCustomRuleByID 根据ID获取自定义规则
+func (s *CustomRuleServiceImpl) GetCustomRuleByID(ctx context.Context, id bson.ObjectID) (*model.CustomRule, error) {
+	rule, err := s.ruleRepo.GetCustomRuleByID(ctx, id)
+	if err != nil {
+		if errors.Is(err, repository.ErrCustomRuleNotFound) {
+			return nil, ErrCustomRuleNotFound
+		}
+		s.logger.Error().Err(err).Str("id", id.Hex()).Msg("获取自定义规则失败")
+		return nil, err
+	}
+
+	return rule, nil
+}
+
+// UpdateCustomRule 更新自定义规则
+func (s *CustomRuleServiceImpl) UpdateCustomRule(ctx context.Context, id bson.ObjectID, req *dto.CustomRuleUpdateRequest) (*model.CustomRule, error) {
+	rule, err := s.ruleRepo.GetCustomRuleByID(ctx, id)
+	if err != nil {
+		if errors.Is(err, repository.ErrCustomRuleNotFound) {
+			return nil, ErrCustomRuleNotFound
+		}
+		return nil, err
+	}
+
+	// 检查名称是否已存在（如果要更新名称）
+	if req.Name != nil && *req.Name != "" && *req.Name != rule.Name {
+		exists, err := s.ruleRepo.CheckCustomRuleNameExists(ctx, *req.Name, id)
+		if err != nil {
+			return nil, err
+		}
+		if exists {
+			return nil, ErrCustomRuleNameExists
+		}
+		rule.Name = *req.Name
+	}
+
+	// 只更新传入的字段
+	if req.Description != nil {
+		rule.Description = *req.Description
+	}
+	if req.Enabled != nil {
+		rule.Enabled = *req.Enabled
+	}
+	if req.Priority != nil {
+		rule.Priority = *req.Priority
+	}
+	if req.Apps != nil {
+		rule.Apps = req.Apps
+	}
+	if req.Directives != nil {
+		rule.Directives = *req.Directives
+	}
+	if err := s.compileCustomRule(ctx, rule); err != nil {
+		return nil, err
+	}
+	rule.UpdatedAt = time.Now()
+
+	if err := s.ruleRepo.UpdateCustomRule(ctx, rule); err != nil {
+		s.logger.Error().Err(err).Str("id", id.Hex()).Msg("更新自定义规则失败")
+		return nil, err
+	}
+
+	s.logger.Info().Str("id", id.Hex()).Str("name", rule.Name).Ints("ruleIds", rule.RuleIDs).Msg("自定义规则更新成功")
+	return rule, nil
+}
+
+// DeleteCustomRule 删除自定义规则
+func (s *CustomRuleServiceImpl) DeleteCustomRule(ctx context.Context, id bson.ObjectID) error {
+	if err := s.ruleRepo.DeleteCustomRule(ctx, id); err != nil {
+		if errors.Is(err, repository.ErrCustomRuleNotFound) {
+			return ErrCustomRuleNotFound
+		}
+		s.logger.Error().Err(err).Str("id", id.Hex()).Msg("删除自定义规则失败")
+		return err
+	}
+
+	s.logger.Info().Str("id", id.Hex()).Msg("自定义规则删除成功")
+	return nil
+}
+
+// compileCustomRule 校验并编译自定义规则，解析出的规则ID写回 rule.RuleIDs
+// 依次检查指令类型、保留ID、与 CRS 及其他自定义规则的ID冲突，最后使用 coraza.NewWAF 编译
+func (s *CustomRuleServiceImpl) compileCustomRule(ctx context.Context, rule *model.CustomRule) error {
+	ruleIDs, err := secrule.ParseCustomRuleDirectives(rule.Directives)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidCustomRule, err)
+	}
+
+	crsIDs := crsRuleIDs()
+	for _, id := range ruleIDs {
+		if crsIDs[id] {
+			return fmt.Errorf("%w: 规则ID %d 与 CRS 规则冲突", ErrCustomRuleIDConflict, id)
+		}
+	}
+
+	conflicts, err := s.ruleRepo.FindRuleIDConflicts(ctx, ruleIDs, rule.ID)
+	if err != nil {
+		return err
+	}
+	if len(conflicts) > 0 {
+		names := make([]string, len(conflicts))
+		for i, conflict := range conflicts {
+			names[i] = conflict.Name
+		}
+		return fmt.Errorf("%w: 规则ID与自定义规则 %s 冲突", ErrCustomRuleIDConflict, strings.Join(names, "、"))
+	}
+
+	// 与引擎使用相同的根文件系统，使 @pmFromFile 等操作符可以引用 CRS 数据文件
+	_, err = coraza.NewWAF(coraza.NewWAFConfig().
+		WithDirectives(rule.Directives).
+		WithRootFS(mergefs.Merge(coreruleset.FS, io.OSFS)))
+	if err != nil {
+		return fmt.Errorf("%w: 编译失败: %v", ErrInvalidCustomRule, err)
+	}
+
+	rule.RuleIDs = ruleIDs
+	return nil
+}
+
+var (
+	crsRuleIDsOnce sync.Once
+	crsRuleIDSet   map[int]bool
+)
+
+// crsRuleIDs 返回内置 CRS 及推荐配置中定义的规则ID
+func crsRuleIDs() map[int]bool {
+	crsRuleIDsOnce.Do(func() {
+		crsRuleIDSet = make(map[int]bool)
+		_ = fs.WalkDir(coreruleset.FS, ".", func(path string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() || strings.HasSuffix(path, ".data") {
+				return nil
+			}
+			content, err := fs.ReadFile(coreruleset.FS, path)
+			if err != nil {
+				return nil
+			}
+			for _, id := range secrule.ParseRuleIDs(string(content)) {
+				crsRuleIDSet[id] = true
+			}
+			return nil
+		})
+	})
+	return crsRuleIDSet
+}
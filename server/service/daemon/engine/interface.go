@@ -12,6 +12,9 @@ type EngineService interface {
 	Restart() error
 	Stop() error
 	Reload() error
+	GetLastError() error
+	GetAgentStats() server.AgentStats
+	GetLogStoreStats() server.LogStoreStats
 }
 
 // NewEngineService 创建一个新的引擎服务实例
@@ -55,3 +58,18 @@ func (s *EngineServiceImpl) Stop() error {
 func (s *EngineServiceImpl) Reload() error {
 	return s.agent.UpdateApplications()
 }
+
+// GetLastError 获取引擎最后一次启动或重新加载失败的错误
+func (s *EngineServiceImpl) GetLastError() error {
+	return s.agent.GetLastError()
+}
+
+// GetAgentStats 获取 SPOE Agent 错误计数
+func (s *EngineServiceImpl) GetAgentStats() server.AgentStats {
+	return s.agent.GetAgentStats()
+}
+
+// GetLogStoreStats 获取 WAF 日志存储的丢弃、溢出和回放计数
+func (s *EngineServiceImpl) GetLogStoreStats() server.LogStoreStats {
+	return s.agent.GetLogStoreStats()
+}
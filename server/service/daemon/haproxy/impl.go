@@ -10,6 +10,7 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -18,6 +19,7 @@ import (
 	"text/template"
 	"time"
 
+	pkgmodel "github.com/HUAHUAI23/simple-waf/pkg/model"
 	"github.com/HUAHUAI23/simple-waf/server/config"
 	"github.com/HUAHUAI23/simple-waf/server/model"
 	client_native "github.com/haproxytech/client-native/v6"
@@ -39,6 +41,46 @@ const (
 	StatusError
 )
 
+const (
+	defaultSpoeEngine            = "coraza" // 默认 SPOE 引擎（作用域）名称
+	defaultSpoeProcessingTimeout = 500      // 默认 SPOE 处理超时（毫秒）
+	spoeHelloTimeout             = 2000     // 2s (毫秒)
+	spoeIdleTimeout              = 120000   // 2m (毫秒)
+
+	// spoeEngineVar 记录请求命中的站点级 SPOE 引擎，默认引擎在该变量存在时不再发送消息
+	spoeEngineVar = "txn.waf_spoe"
+	// spoeFailOpenVar 标记请求所属站点在 SPOE 代理出错或超时时放行
+	spoeFailOpenVar = "txn.waf_fail_open"
+	// spoeErrorCondTest 代理出错或超时且站点未配置放行时返回 500
+	spoeErrorCondTest = "{ var(txn.coraza.error) -m int gt 0 } !{ var(txn.waf_fail_open) -m bool }"
+
+	// requestIDFormat 请求ID格式，十六进制的客户端地址、前端地址、时间戳、请求计数和进程ID
+	requestIDFormat = "%{+X}o%ci%cp%fi%fp%Ts%rt%pid"
+	// requestIDHeader 携带请求ID的请求头和响应头，客户端上报问题时提供该值即可查询 WAF 日志
+	requestIDHeader = "X-Request-ID"
+
+	// wafDenyCondTest 引擎要求拒绝请求，站点拦截页面规则插入在第一条使用该条件的规则之前
+	wafDenyCondTest = "{ var(txn.coraza.action) -m str deny }"
+	// throttleCondTest 引擎要求限速请求
+	throttleCondTest = "{ var(txn.coraza.action) -m str throttle }"
+
+	// banActionVar 请求来源IP生效中的封禁的处置动作，由封禁IP规则设置，存在时不再发送 SPOE 消息
+	banActionVar = "txn.waf_ban_action"
+	// banMapSeparator 封禁IP map 条目值的字段分隔符，值的格式为 <截止时间>|<处置动作>[|<跳转地址>]
+	banMapSeparator = "|"
+	// acceptJSONCondTest 客户端接受 JSON 响应
+	acceptJSONCondTest = "{ req.hdr(accept) -m sub application/json }"
+)
+
+// blockPageSamples 拦截页面占位符及对应的 HAProxy 样本表达式
+var blockPageSamples = []string{
+	model.BlockPageRequestID, "%[unique-id]",
+	model.BlockPageReason, "%[var(txn.coraza.reason)]",
+	model.BlockPageRuleID, "%[var(txn.coraza.ruleid)]",
+	model.BlockPageClientIP, "%[src]",
+	model.BlockPageTimestamp, "%[date,utime(%Y-%m-%dT%H:%M:%SZ)]",
+}
+
 type HAProxyServiceImpl struct {
 	ConfigBaseDir      string
 	HAProxyConfigFile  string // 配置文件路径
@@ -51,6 +93,8 @@ type HAProxyServiceImpl struct {
 	SocketFile         string // 套接字文件路径
 	PidFile            string // PID文件路径
 	SpoeConfigFile     string // SPOE配置文件路径
+	BlockedIPMapFile   string // 封禁IP map文件路径
+	BlockPageDir       string // 站点拦截页面目录
 	SpoeAgentAddress   string // SPOE代理地址
 	SpoeAgentPort      int64  // SPOE代理端口
 
@@ -65,6 +109,7 @@ type HAProxyServiceImpl struct {
 	isDebug         bool                        // 是否为生产环境
 	isK8s           bool                        // 是否为K8s环境
 	thread          int                         // 线程数
+	tarpitTimeout   int                         // tarpit 处置的响应延迟（秒）
 
 	logger zerolog.Logger
 	ctx    context.Context
@@ -365,6 +410,26 @@ func (s *HAProxyServiceImpl) AddSiteConfig(site model.Site) error {
 
 	}
 
+	// 站点级 SPOE 设置同时作用于该端口的 HTTP 和 HTTPS 前端
+	for _, frontendName := range []string{fmt.Sprintf("fe_%d_http", site.ListenPort), fmt.Sprintf("fe_%d_https", site.ListenPort)} {
+		if err := s.createSiteSpoeRules(site, frontendName, transaction.ID); err != nil {
+			return err
+		}
+	}
+
+	// 站点拦截页面同样作用于该端口的 HTTP 和 HTTPS 前端
+	if site.BlockPage.Enabled() {
+		htmlFile, jsonFile, err := s.writeSiteBlockPages(site)
+		if err != nil {
+			return fmt.Errorf("写入拦截页面失败: %v", err)
+		}
+		for _, frontendName := range []string{fmt.Sprintf("fe_%d_http", site.ListenPort), fmt.Sprintf("fe_%d_https", site.ListenPort)} {
+			if err := s.createSiteBlockPageRules(site, frontendName, htmlFile, jsonFile, transaction.ID); err != nil {
+				return err
+			}
+		}
+	}
+
 	transaction, err = s.confClient.CommitTransaction(transaction.ID)
 	if err != nil {
 		return fmt.Errorf("提交事务失败: %v", err)
@@ -372,6 +437,12 @@ func (s *HAProxyServiceImpl) AddSiteConfig(site model.Site) error {
 
 	s.confClient.DeleteTransaction(transaction.ID)
 
+	if site.Spoe.HasDedicatedEngine() {
+		if err := s.addSiteSpoeScope(site); err != nil {
+			return fmt.Errorf("创建站点 SPOE 引擎失败: %v", err)
+		}
+	}
+
 	return nil
 }
 
@@ -403,12 +474,15 @@ func (s *HAProxyServiceImpl) HotReloadRemoveConfig() error {
 	// 保存 PidFile 和 SocketFile 的绝对路径，以便后续比较
 	pidFileAbs, _ := filepath.Abs(s.PidFile)
 	socketFileAbs, _ := filepath.Abs(s.SocketFile)
+	// 封禁IP map文件在热重载时保留，避免重载后到下一次同步之间封禁失效
+	blockedIPMapFileAbs, _ := filepath.Abs(s.BlockedIPMapFile)
 
 	// 需要删除的目录
 	dirsToRemove := []string{
 		s.TransactionDir,
 		s.SpoeTransactionDir,
 		s.CertDir,
+		s.BlockPageDir,
 	}
 
 	// 特殊处理 filepath.Dir(s.HAProxyConfigFile)
@@ -427,8 +501,8 @@ func (s *HAProxyServiceImpl) HotReloadRemoveConfig() error {
 				filePathAbs, _ := filepath.Abs(filePath)
 
 				// 检查是否是要保留的文件
-				if filePathAbs == pidFileAbs || filePathAbs == socketFileAbs {
-					continue // 跳过 PidFile 和 SocketFile
+				if filePathAbs == pidFileAbs || filePathAbs == socketFileAbs || filePathAbs == blockedIPMapFileAbs {
+					continue // 跳过 PidFile、SocketFile 和封禁IP map文件
 				}
 
 				s.logger.Info().Msgf("正在删除文件: %s", filePath)
@@ -501,6 +575,7 @@ func (s *HAProxyServiceImpl) RemoveConfig() error {
 		s.TransactionDir,
 		s.SpoeTransactionDir,
 		s.CertDir,
+		s.BlockPageDir,
 	}
 
 	// 删除文件
@@ -551,6 +626,7 @@ func (s *HAProxyServiceImpl) InitHAProxyConfig() error {
 		s.SpoeDir,
 		s.SpoeTransactionDir,
 		s.CertDir,
+		s.BlockPageDir,
 	}
 
 	for _, dir := range dirs {
@@ -661,6 +737,13 @@ frontend stats from http
 		return fmt.Errorf("failed to create basic config file: %v", err)
 	}
 
+	// 前端规则引用封禁IP map文件，文件不存在时 HAProxy 无法启动
+	if _, err := os.Stat(s.BlockedIPMapFile); os.IsNotExist(err) {
+		if err := os.WriteFile(s.BlockedIPMapFile, []byte{}, 0644); err != nil {
+			return fmt.Errorf("failed to create blocked ip map file: %v", err)
+		}
+	}
+
 	return nil
 }
 
@@ -702,70 +785,16 @@ func (s *HAProxyServiceImpl) InitSpoeConfig() error {
 	if err != nil {
 		return fmt.Errorf("启动 SPOE 事务错误: %v", err)
 	}
-	scopeName := models.SpoeScope("[coraza]")
-	err = singleSpoe.CreateScope(&scopeName, transaction.ID, 0)
-	if err != nil {
-		return fmt.Errorf("创建 SPOE 作用域错误: %v", err)
-	}
-
-	agent := &models.SpoeAgent{
-		Name: StringP("coraza-agent"),
-		// 根据 isResponseCheck 决定是否包含响应处理
-		Messages: func() string {
-			if s.isResponseCheck {
-				return "coraza-req coraza-res"
-			}
-			return "coraza-req"
-		}(),
-		OptionVarPrefix:   "coraza",
-		OptionSetOnError:  "error",
-		HelloTimeout:      2000,   // 2s (毫秒)
-		IdleTimeout:       120000, // 2m (毫秒)
-		ProcessingTimeout: 500,    // 500ms
-		UseBackend:        "coraza-spoa",
-		Log:               models.LogTargets{&models.LogTarget{Global: true}},
-	}
-
-	err = singleSpoe.CreateAgent(string(scopeName), agent, transaction.ID, 0)
+	// 默认引擎处理所有未绑定站点级引擎的请求，被封禁IP的请求由封禁IP规则处置，不发送消息
+	err = s.createSpoeScope(singleSpoe, transaction.ID, spoeScopeSettings{
+		engine:            defaultSpoeEngine,
+		processingTimeout: defaultSpoeProcessingTimeout,
+		cond:              "unless",
+		condTest:          fmt.Sprintf("{ var(%s) -m found } || { var(%s) -m found }", spoeEngineVar, banActionVar),
+	})
 	if err != nil {
 		singleSpoe.Transaction.DeleteTransaction(transaction.ID)
-		return fmt.Errorf("创建 SPOE 代理错误: %v", err)
-	}
-
-	// 创建 coraza-req 消息
-	reqEvent := &models.SpoeMessageEvent{
-		Name: StringP("on-frontend-http-request"),
-	}
-	reqMsg := &models.SpoeMessage{
-		Name:  StringP("coraza-req"),
-		Event: reqEvent,
-		Args:  "app=str(coraza) src-ip=src src-port=src_port dst-ip=dst dst-port=dst_port method=method path=path query=query version=req.ver headers=req.hdrs body=req.body",
-	}
-
-	// 在 coraza section 下创建 message
-	err = singleSpoe.CreateMessage(string(scopeName), reqMsg, transaction.ID, 0)
-	if err != nil {
-		singleSpoe.Transaction.DeleteTransaction(transaction.ID)
-		return fmt.Errorf("创建 SPOE 请求消息错误: %v", err)
-	}
-
-	// 创建 coraza-res 消息
-	if s.isResponseCheck {
-		resEvent := &models.SpoeMessageEvent{
-			Name: StringP("on-http-response"),
-		}
-		resMsg := &models.SpoeMessage{
-			Name:  StringP("coraza-res"),
-			Event: resEvent,
-			Args:  "app=str(coraza) id=var(txn.coraza.id) version=res.ver status=status headers=res.hdrs body=res.body",
-		}
-
-		err = singleSpoe.CreateMessage(string(scopeName), resMsg, transaction.ID, 0)
-		if err != nil {
-			singleSpoe.Transaction.DeleteTransaction(transaction.ID)
-			return fmt.Errorf("创建 SPOE 响应消息错误: %v", err)
-		}
-
+		return err
 	}
 
 	_, err = singleSpoe.Transaction.CommitTransaction(transaction.ID)
@@ -883,6 +912,7 @@ func (s *HAProxyServiceImpl) Reset() error {
 	}
 
 	s.thread = appConfig.Haproxy.Thread
+	s.tarpitTimeout = appConfig.Haproxy.TarpitTimeout
 	s.isResponseCheck = appConfig.IsResponseCheck
 	s.isDebug = appConfig.IsDebug
 	s.isK8s = appConfig.IsK8s
@@ -902,6 +932,95 @@ func (s *HAProxyServiceImpl) GetStats() (models.NativeStats, error) {
 	return stats, nil
 }
 
+// BlockedIPEntry 同步到 HAProxy map 的封禁IP条目
+type BlockedIPEntry struct {
+	Until       int64  // 封禁截止时间（Unix 秒）
+	Action      string // 处置动作
+	RedirectURL string // 处置动作为 redirect 时的跳转地址
+}
+
+// mapValue 返回 map 条目的值，格式为 <截止时间>|<处置动作>[|<跳转地址>]
+// 跳转地址包含分隔符或空白时无法写入 map，按引擎的处理方式改为直接拒绝
+func (e BlockedIPEntry) mapValue() string {
+	value := strconv.FormatInt(e.Until, 10) + banMapSeparator
+	if e.Action != pkgmodel.FlowControlActionRedirect {
+		return value + e.Action
+	}
+	if e.RedirectURL == "" || strings.ContainsAny(e.RedirectURL, banMapSeparator+" \t") {
+		return value + pkgmodel.FlowControlActionDeny
+	}
+	return value + e.Action + banMapSeparator + e.RedirectURL
+}
+
+// SyncBlockedIPs 将当前生效的封禁IP同步到 HAProxy map
+// entries 的键为 IP 或网段，不在 entries 中的条目会被删除
+func (s *HAProxyServiceImpl) SyncBlockedIPs(entries map[string]BlockedIPEntry) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	// 先写入 map 文件，保证 HAProxy 重启或重载后封禁依然生效
+	if err := s.writeBlockedIPMapFile(entries); err != nil {
+		return err
+	}
+
+	if HAProxyStatus(s.status.Load()) != StatusRunning {
+		return nil
+	}
+
+	if err := s.ensureRuntimeClient(); err != nil {
+		return err
+	}
+
+	// runtime 客户端通过不带扩展名的文件名查找 map
+	mapName := strings.TrimSuffix(filepath.Base(s.BlockedIPMapFile), filepath.Ext(s.BlockedIPMapFile))
+	current, err := s.runtimeClient.ShowMapEntries(mapName)
+	if err != nil {
+		return fmt.Errorf("获取封禁IP map条目失败: %v", err)
+	}
+
+	existing := make(map[string]string, len(current))
+	for _, entry := range current {
+		if _, ok := entries[entry.Key]; !ok {
+			// 已解封或已过期
+			if err := s.runtimeClient.DeleteMapEntry(mapName, entry.Key); err != nil {
+				s.logger.Error().Err(err).Str("ip", entry.Key).Msg("删除封禁IP map条目失败")
+			}
+			continue
+		}
+		existing[entry.Key] = entry.Value
+	}
+
+	added, updated := 0, 0
+	for ip, entry := range entries {
+		value := entry.mapValue()
+		old, ok := existing[ip]
+		if !ok {
+			if err := s.runtimeClient.AddMapEntry(mapName, ip, value); err != nil {
+				s.logger.Error().Err(err).Str("ip", ip).Msg("添加封禁IP map条目失败")
+				continue
+			}
+			added++
+		} else if old != value {
+			// 封禁被延长或处置动作变化
+			if err := s.runtimeClient.SetMapEntry(mapName, ip, value); err != nil {
+				s.logger.Error().Err(err).Str("ip", ip).Msg("更新封禁IP map条目失败")
+				continue
+			}
+			updated++
+		}
+	}
+
+	if added > 0 || updated > 0 || len(current) != len(existing) {
+		s.logger.Debug().
+			Int("added", added).
+			Int("updated", updated).
+			Int("removed", len(current)-len(existing)).
+			Msg("封禁IP map同步完成")
+	}
+
+	return nil
+}
+
 // ========================== internal method ==========================
 func (s *HAProxyServiceImpl) initConfClient() error {
 	confClient, err := configuration.New(s.ctx,
@@ -1363,8 +1482,13 @@ func (s *HAProxyServiceImpl) createFeCombined(port int, isHttpsRedirect bool) er
 			DefaultBackend: fmt.Sprintf("p%d_backend", port),
 			Enabled:        true,
 			From:           "http",
+			// 流控 tarpit 处置的响应延迟
+			TarpitTimeout: s.tarpitTimeoutMs(),
+			// 请求ID，发送给 SPOE 代理作为 WAF 日志的 requestId，并转发给后端
+			UniqueIDFormat: requestIDFormat,
+			UniqueIDHeader: requestIDHeader,
 			// 日志格式使用反斜杠转义空格和特殊字符
-			LogFormat: "\"%ci:%cp\\ [%t]\\ %ft\\ %b/%s\\ %Th/%Ti/%TR/%Tq/%Tw/%Tc/%Tr/%Tt\\ %ST\\ %B\\ %CC\\ %CS\\ %tsc\\ %ac/%fc/%bc/%sc/%rc\\ %sq/%bq\\ %hr\\ %hs\\ %{+Q}r\\ %[var(txn.coraza.id)]\\ spoa-error:\\ %[var(txn.coraza.error)]\\ waf-hit:\\ %[var(txn.coraza.status)]\"",
+			LogFormat: "\"%ci:%cp\\ [%t]\\ %ft\\ %b/%s\\ %Th/%Ti/%TR/%Tq/%Tw/%Tc/%Tr/%Tt\\ %ST\\ %B\\ %CC\\ %CS\\ %tsc\\ %ac/%fc/%bc/%sc/%rc\\ %sq/%bq\\ %hr\\ %hs\\ %{+Q}r\\ %ID\\ spoa-error:\\ %[var(txn.coraza.error)]\\ waf-hit:\\ %[var(txn.coraza.status)]\"",
 			Forwardfor: &models.Forwardfor{
 				Enabled: StringP("enabled"),
 				Ifnone:  true,
@@ -1390,6 +1514,11 @@ func (s *HAProxyServiceImpl) createFeCombined(port int, isHttpsRedirect bool) er
 		return fmt.Errorf("创建绑定失败: %v", err)
 	}
 
+	// 封禁IP在 SPOE 之前直接拒绝
+	if err := s.createBlockedIPRules(fe_http.Name, transaction.ID); err != nil {
+		return err
+	}
+
 	// 添加 spoe 过滤
 	fe_http_filter := &models.Filter{
 		Type:       "spoe",           // 过滤器类型
@@ -1431,7 +1560,7 @@ func (s *HAProxyServiceImpl) createFeCombined(port int, isHttpsRedirect bool) er
 				HdrName:    "waf-block", // 设置头部名称
 				HdrFormat:  "request",   // 设置头部值
 				Cond:       "if",
-				CondTest:   "{ var(txn.coraza.action) -m str deny }",
+				CondTest:   wafDenyCondTest,
 			}},
 			{3, &models.HTTPRequestRule{
 				Type:     "silent-drop",
@@ -1442,7 +1571,7 @@ func (s *HAProxyServiceImpl) createFeCombined(port int, isHttpsRedirect bool) er
 				Type:       "deny",
 				DenyStatus: Int64P(500),
 				Cond:       "if",
-				CondTest:   "{ var(txn.coraza.error) -m int gt 0 }",
+				CondTest:   spoeErrorCondTest,
 			}},
 		}
 	} else {
@@ -1465,7 +1594,7 @@ func (s *HAProxyServiceImpl) createFeCombined(port int, isHttpsRedirect bool) er
 				HdrName:    "waf-block", // 设置头部名称
 				HdrFormat:  "request",   // 设置头部值
 				Cond:       "if",
-				CondTest:   "{ var(txn.coraza.action) -m str deny }",
+				CondTest:   wafDenyCondTest,
 			}},
 			{2, &models.HTTPRequestRule{
 				Type:     "silent-drop",
@@ -1476,7 +1605,7 @@ func (s *HAProxyServiceImpl) createFeCombined(port int, isHttpsRedirect bool) er
 				Type:       "deny",
 				DenyStatus: Int64P(500),
 				Cond:       "if",
-				CondTest:   "{ var(txn.coraza.error) -m int gt 0 }",
+				CondTest:   spoeErrorCondTest,
 			}},
 		}
 
@@ -1489,6 +1618,10 @@ func (s *HAProxyServiceImpl) createFeCombined(port int, isHttpsRedirect bool) er
 		}
 	}
 
+	if err := s.createEnforcementRules(fe_http.Name, int64(len(fe_http_request_rule)), transaction.ID); err != nil {
+		return err
+	}
+
 	// 添加HTTP响应规则 - 确保HTTP响应规则结构正确
 	fe_http_response_rule := []struct {
 		index int64
@@ -1508,7 +1641,7 @@ func (s *HAProxyServiceImpl) createFeCombined(port int, isHttpsRedirect bool) er
 			HdrName:    "waf-block", // 设置头部名称
 			HdrFormat:  "response",  // 设置头部值
 			Cond:       "if",
-			CondTest:   "{ var(txn.coraza.action) -m str deny }",
+			CondTest:   wafDenyCondTest,
 		}},
 		{2, &models.HTTPResponseRule{
 			Type:     "silent-drop",
@@ -1519,7 +1652,7 @@ func (s *HAProxyServiceImpl) createFeCombined(port int, isHttpsRedirect bool) er
 			Type:       "deny",
 			DenyStatus: Int64P(500),
 			Cond:       "if",
-			CondTest:   "{ var(txn.coraza.error) -m int gt 0 }",
+			CondTest:   spoeErrorCondTest,
 		}},
 	}
 
@@ -1530,6 +1663,10 @@ func (s *HAProxyServiceImpl) createFeCombined(port int, isHttpsRedirect bool) er
 		}
 	}
 
+	if err := s.createRequestIDRules(fe_http.Name, transaction.ID); err != nil {
+		return err
+	}
+
 	// fe_(port)_https
 	fe_https := &models.Frontend{
 		FrontendBase: models.FrontendBase{
@@ -1538,8 +1675,13 @@ func (s *HAProxyServiceImpl) createFeCombined(port int, isHttpsRedirect bool) er
 			DefaultBackend: fmt.Sprintf("p%d_backend", port),
 			Enabled:        true,
 			From:           "http",
+			// 流控 tarpit 处置的响应延迟
+			TarpitTimeout: s.tarpitTimeoutMs(),
+			// 请求ID，发送给 SPOE 代理作为 WAF 日志的 requestId，并转发给后端
+			UniqueIDFormat: requestIDFormat,
+			UniqueIDHeader: requestIDHeader,
 			// 日志格式使用反斜杠转义空格和特殊字符
-			LogFormat: "\"%ci:%cp\\ [%t]\\ %ft\\ %b/%s\\ %Th/%Ti/%TR/%Tq/%Tw/%Tc/%Tr/%Tt\\ %ST\\ %B\\ %CC\\ %CS\\ %tsc\\ %ac/%fc/%bc/%sc/%rc\\ %sq/%bq\\ %hr\\ %hs\\ %{+Q}r\\ %[var(txn.coraza.id)]\\ spoa-error:\\ %[var(txn.coraza.error)]\\ waf-hit:\\ %[var(txn.coraza.status)]\"",
+			LogFormat: "\"%ci:%cp\\ [%t]\\ %ft\\ %b/%s\\ %Th/%Ti/%TR/%Tq/%Tw/%Tc/%Tr/%Tt\\ %ST\\ %B\\ %CC\\ %CS\\ %tsc\\ %ac/%fc/%bc/%sc/%rc\\ %sq/%bq\\ %hr\\ %hs\\ %{+Q}r\\ %ID\\ spoa-error:\\ %[var(txn.coraza.error)]\\ waf-hit:\\ %[var(txn.coraza.status)]\"",
 			Forwardfor: &models.Forwardfor{
 				Enabled: StringP("enabled"),
 				Ifnone:  true,
@@ -1563,6 +1705,11 @@ func (s *HAProxyServiceImpl) createFeCombined(port int, isHttpsRedirect bool) er
 		return fmt.Errorf("创建绑定失败: %v", err)
 	}
 
+	// 封禁IP在 SPOE 之前直接拒绝
+	if err := s.createBlockedIPRules(fe_https.Name, transaction.ID); err != nil {
+		return err
+	}
+
 	// 添加 spoe 过滤
 	fe_https_filter := &models.Filter{
 		Type:       "spoe",           // 过滤器类型
@@ -1593,7 +1740,7 @@ func (s *HAProxyServiceImpl) createFeCombined(port int, isHttpsRedirect bool) er
 			HdrName:    "waf-block", // 设置头部名称
 			HdrFormat:  "request",   // 设置头部值
 			Cond:       "if",
-			CondTest:   "{ var(txn.coraza.action) -m str deny }",
+			CondTest:   wafDenyCondTest,
 		}},
 		{2, &models.HTTPRequestRule{
 			Type:     "silent-drop",
@@ -1604,7 +1751,7 @@ func (s *HAProxyServiceImpl) createFeCombined(port int, isHttpsRedirect bool) er
 			Type:       "deny",
 			DenyStatus: Int64P(500),
 			Cond:       "if",
-			CondTest:   "{ var(txn.coraza.error) -m int gt 0 }",
+			CondTest:   spoeErrorCondTest,
 		}},
 	}
 
@@ -1615,6 +1762,10 @@ func (s *HAProxyServiceImpl) createFeCombined(port int, isHttpsRedirect bool) er
 		}
 	}
 
+	if err := s.createEnforcementRules(fe_https.Name, int64(len(fe_https_request_rule)), transaction.ID); err != nil {
+		return err
+	}
+
 	// 添加HTTPs响应规则 - 确保HTTP响应规则结构正确
 	fe_https_response_rule := []struct {
 		index int64
@@ -1634,7 +1785,7 @@ func (s *HAProxyServiceImpl) createFeCombined(port int, isHttpsRedirect bool) er
 			HdrName:    "waf-block", // 设置头部名称
 			HdrFormat:  "response",  // 设置头部值
 			Cond:       "if",
-			CondTest:   "{ var(txn.coraza.action) -m str deny }",
+			CondTest:   wafDenyCondTest,
 		}},
 		{2, &models.HTTPResponseRule{
 			Type:     "silent-drop",
@@ -1645,7 +1796,7 @@ func (s *HAProxyServiceImpl) createFeCombined(port int, isHttpsRedirect bool) er
 			Type:       "deny",
 			DenyStatus: Int64P(500),
 			Cond:       "if",
-			CondTest:   "{ var(txn.coraza.error) -m int gt 0 }",
+			CondTest:   spoeErrorCondTest,
 		}},
 	}
 
@@ -1656,6 +1807,10 @@ func (s *HAProxyServiceImpl) createFeCombined(port int, isHttpsRedirect bool) er
 		}
 	}
 
+	if err := s.createRequestIDRules(fe_https.Name, transaction.ID); err != nil {
+		return err
+	}
+
 	// default backend
 	be_default := &models.Backend{
 		BackendBase: models.BackendBase{
@@ -1696,6 +1851,494 @@ func (s *HAProxyServiceImpl) createFeCombined(port int, isHttpsRedirect bool) er
 
 }
 
+// createRequestIDRules 为前端添加请求ID相关规则，请求ID由 unique-id-format 生成
+func (s *HAProxyServiceImpl) createRequestIDRules(frontendName string, transactionID string) error {
+	// 删除客户端携带的同名请求头，转发给后端的请求头只包含 unique-id-header 添加的请求ID
+	delRule := &models.HTTPRequestRule{
+		Type:    "del-header",
+		HdrName: requestIDHeader,
+	}
+	if err := s.confClient.CreateHTTPRequestRule(0, "frontend", frontendName, delRule, transactionID, 0); err != nil {
+		return fmt.Errorf("添加请求ID请求规则错误: %v", err)
+	}
+
+	// http-after-response 同样作用于 deny、redirect 等 HAProxy 生成的响应，拦截页面也能看到请求ID
+	setRule := &models.HTTPAfterResponseRule{
+		Type:      "set-header",
+		HdrName:   requestIDHeader,
+		HdrFormat: "%[unique-id]",
+	}
+	if err := s.confClient.CreateHTTPAfterResponseRule(0, "frontend", frontendName, setRule, transactionID, 0); err != nil {
+		return fmt.Errorf("添加请求ID响应规则错误: %v", err)
+	}
+	return nil
+}
+
+// createBlockedIPRules 为前端添加封禁IP规则，按 map 中的处置动作设置 txn.waf_ban_action
+// tcp-request content 规则在 HTTP 分析器之前执行：deny 直接拒绝，drop 静默断开，
+// 其余动作由 createEnforcementRules 添加的请求规则处置，设置了处置动作的请求不会再发送到 SPOE 代理
+// 过期条目即使尚未被同步任务删除也不会生效
+func (s *HAProxyServiceImpl) createBlockedIPRules(frontendName string, transactionID string) error {
+	activeCondTest := "{ var(txn.waf_ban_ttl) -m int gt 0 }"
+	rules := []*models.TCPRequestRule{
+		{
+			Type:     "content",
+			Action:   "set-var",
+			VarScope: "txn",
+			VarName:  "waf_ban",
+			Expr:     fmt.Sprintf("src,map_ip(%s)", s.BlockedIPMapFile),
+		},
+		{
+			Type:     "content",
+			Action:   "set-var",
+			VarScope: "txn",
+			VarName:  "waf_ban_until",
+			Expr:     fmt.Sprintf("var(txn.waf_ban),field(1,%s)", banMapSeparator),
+		},
+		{
+			Type:     "content",
+			Action:   "set-var",
+			VarScope: "txn",
+			VarName:  "waf_ban_ttl",
+			Expr:     "date,neg,add(txn.waf_ban_until)",
+		},
+		{
+			Type:     "content",
+			Action:   "set-var",
+			VarScope: "txn",
+			VarName:  strings.TrimPrefix(banActionVar, "txn."),
+			Expr:     fmt.Sprintf("var(txn.waf_ban),field(2,%s)", banMapSeparator),
+			Cond:     "if",
+			CondTest: activeCondTest,
+		},
+		{
+			Type:     "content",
+			Action:   "set-var",
+			VarScope: "txn",
+			VarName:  "waf_ban_url",
+			Expr:     fmt.Sprintf("var(txn.waf_ban),field(3,%s)", banMapSeparator),
+			Cond:     "if",
+			CondTest: fmt.Sprintf("{ var(%s) -m str %s }", banActionVar, pkgmodel.FlowControlActionRedirect),
+		},
+		{
+			Type:     "content",
+			Action:   "reject",
+			Cond:     "if",
+			CondTest: fmt.Sprintf("{ var(%s) -m str %s }", banActionVar, pkgmodel.FlowControlActionDeny),
+		},
+		{
+			Type:     "content",
+			Action:   "silent-drop",
+			Cond:     "if",
+			CondTest: fmt.Sprintf("{ var(%s) -m str %s }", banActionVar, pkgmodel.FlowControlActionDrop),
+		},
+	}
+
+	for i, rule := range rules {
+		if err := s.confClient.CreateTCPRequestRule(int64(i), "frontend", frontendName, rule, transactionID, 0); err != nil {
+			return fmt.Errorf("添加封禁IP规则 #%d 错误: %v", i, err)
+		}
+	}
+	return nil
+}
+
+// createEnforcementRules 添加流控处置动作对应的请求规则
+// 引擎通过 txn.coraza.action 指定动作：throttle 返回 429 并按 txn.coraza.retry_after 设置 Retry-After，
+// tarpit 在 tarpit 超时后返回 429；deny、drop、redirect 复用已有的 WAF 拦截规则
+// 封禁IP规则设置的处置动作同样在此处置，Retry-After 为封禁的剩余时间；deny 和 drop 已在连接层处置
+func (s *HAProxyServiceImpl) createEnforcementRules(frontendName string, index int64, transactionID string) error {
+	banCondTest := func(action string) string {
+		return fmt.Sprintf("{ var(%s) -m str %s }", banActionVar, action)
+	}
+	rules := []*models.HTTPRequestRule{
+		{
+			Type:                "return",
+			ReturnStatusCode:    Int64P(429),
+			ReturnContentType:   StringP("text/plain"),
+			ReturnContentFormat: "string",
+			ReturnContent:       `"Too Many Requests"`,
+			ReturnHeaders: []*models.ReturnHeader{
+				{Name: StringP("Retry-After"), Fmt: StringP("%[var(txn.coraza.retry_after)]")},
+			},
+			Cond:     "if",
+			CondTest: throttleCondTest,
+		},
+		{
+			Type:       "tarpit",
+			DenyStatus: Int64P(429),
+			Cond:       "if",
+			CondTest:   "{ var(txn.coraza.action) -m str tarpit }",
+		},
+		{
+			Type:                "return",
+			ReturnStatusCode:    Int64P(429),
+			ReturnContentType:   StringP("text/plain"),
+			ReturnContentFormat: "string",
+			ReturnContent:       `"Too Many Requests"`,
+			ReturnHeaders: []*models.ReturnHeader{
+				{Name: StringP("Retry-After"), Fmt: StringP("%[var(txn.waf_ban_ttl)]")},
+			},
+			Cond:     "if",
+			CondTest: banCondTest(pkgmodel.FlowControlActionThrottle),
+		},
+		{
+			Type:       "tarpit",
+			DenyStatus: Int64P(429),
+			Cond:       "if",
+			CondTest:   banCondTest(pkgmodel.FlowControlActionTarpit),
+		},
+		{
+			Type:       "redirect",
+			RedirCode:  Int64P(302),
+			RedirType:  "location",
+			RedirValue: "%[var(txn.waf_ban_url)]",
+			Cond:       "if",
+			CondTest:   banCondTest(pkgmodel.FlowControlActionRedirect),
+		},
+	}
+
+	for i, rule := range rules {
+		if err := s.confClient.CreateHTTPRequestRule(index+int64(i), "frontend", frontendName, rule, transactionID, 0); err != nil {
+			return fmt.Errorf("添加流控处置规则 #%d 错误: %v", i, err)
+		}
+	}
+	return nil
+}
+
+// spoeScopeSettings 描述一个 SPOE 引擎作用域的代理与消息参数
+type spoeScopeSettings struct {
+	engine            string // 引擎名称，同时作为作用域名称
+	processingTimeout int64  // 处理超时（毫秒）
+	maxBodySize       int64  // 发送给代理的最大消息体字节数，0 表示不截断
+	cond              string // 消息事件条件 if/unless
+	condTest          string // 消息事件条件表达式
+}
+
+// createSpoeScope 在 SPOE 配置中创建引擎作用域及其代理和消息
+// 所有作用域共用 coraza-spoa 后端、coraza 变量前缀和消息名，代理侧无需区分引擎
+func (s *HAProxyServiceImpl) createSpoeScope(singleSpoe *spoe.SingleSpoe, transactionID string, settings spoeScopeSettings) error {
+	scopeName := models.SpoeScope(fmt.Sprintf("[%s]", settings.engine))
+	if err := singleSpoe.CreateScope(&scopeName, transactionID, 0); err != nil {
+		return fmt.Errorf("创建 SPOE 作用域错误: %v", err)
+	}
+
+	agent := &models.SpoeAgent{
+		Name: StringP("coraza-agent"),
+		// 根据 isResponseCheck 决定是否包含响应处理
+		Messages: func() string {
+			if s.isResponseCheck {
+				return "coraza-req coraza-res"
+			}
+			return "coraza-req"
+		}(),
+		OptionVarPrefix:   "coraza",
+		OptionSetOnError:  "error",
+		HelloTimeout:      spoeHelloTimeout,
+		IdleTimeout:       spoeIdleTimeout,
+		ProcessingTimeout: settings.processingTimeout,
+		UseBackend:        "coraza-spoa",
+		Log:               models.LogTargets{&models.LogTarget{Global: true}},
+	}
+	if err := singleSpoe.CreateAgent(string(scopeName), agent, transactionID, 0); err != nil {
+		return fmt.Errorf("创建 SPOE 代理错误: %v", err)
+	}
+
+	// 创建 coraza-req 消息
+	reqMsg := &models.SpoeMessage{
+		Name: StringP("coraza-req"),
+		Event: &models.SpoeMessageEvent{
+			Name:     StringP("on-frontend-http-request"),
+			Cond:     settings.cond,
+			CondTest: settings.condTest,
+		},
+		Args: "app=str(coraza) id=unique-id src-ip=src src-port=src_port dst-ip=dst dst-port=dst_port method=method path=path query=query version=req.ver headers=req.hdrs body=" + spoeBodyExpr("req.body", settings.maxBodySize),
+	}
+	if err := singleSpoe.CreateMessage(string(scopeName), reqMsg, transactionID, 0); err != nil {
+		return fmt.Errorf("创建 SPOE 请求消息错误: %v", err)
+	}
+
+	// 创建 coraza-res 消息
+	if s.isResponseCheck {
+		resMsg := &models.SpoeMessage{
+			Name: StringP("coraza-res"),
+			Event: &models.SpoeMessageEvent{
+				Name:     StringP("on-http-response"),
+				Cond:     settings.cond,
+				CondTest: settings.condTest,
+			},
+			Args: "app=str(coraza) id=var(txn.coraza.id) version=res.ver status=status headers=res.hdrs body=" + spoeBodyExpr("res.body", settings.maxBodySize),
+		}
+		if err := singleSpoe.CreateMessage(string(scopeName), resMsg, transactionID, 0); err != nil {
+			return fmt.Errorf("创建 SPOE 响应消息错误: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// spoeBodyExpr 返回发送给代理的消息体表达式，maxBodySize 大于 0 时截断到指定字节数
+func spoeBodyExpr(fetch string, maxBodySize int64) string {
+	if maxBodySize <= 0 {
+		return fetch
+	}
+	return fmt.Sprintf("%s,bytes(0,%d)", fetch, maxBodySize)
+}
+
+// siteSpoeEngine 返回站点级 SPOE 引擎名称，同一域名可以监听多个端口，因此名称包含端口
+func siteSpoeEngine(site model.Site) string {
+	return fmt.Sprintf("%s-%s-%d", defaultSpoeEngine, getDashDomain(site.Domain), site.ListenPort)
+}
+
+// addSiteSpoeScope 为配置了超时或消息体大小的站点创建独立的 SPOE 引擎作用域
+func (s *HAProxyServiceImpl) addSiteSpoeScope(site model.Site) error {
+	if err := s.ensureSpoeClient(); err != nil {
+		return fmt.Errorf("初始化SPOE客户端失败: %v", err)
+	}
+
+	singleSpoe, err := s.spoeClient.GetSingleSpoe(filepath.Base(s.SpoeConfigFile))
+	if err != nil {
+		return fmt.Errorf("获取 SPOE 配置错误: %v", err)
+	}
+	version, err := singleSpoe.Transaction.TransactionClient.GetVersion("")
+	if err != nil {
+		return fmt.Errorf("获取 SPOE 版本错误: %v", err)
+	}
+	transaction, err := singleSpoe.Transaction.StartTransaction(version)
+	if err != nil {
+		return fmt.Errorf("启动 SPOE 事务错误: %v", err)
+	}
+
+	processingTimeout := int64(site.Spoe.ProcessingTimeout)
+	if processingTimeout <= 0 {
+		processingTimeout = defaultSpoeProcessingTimeout
+	}
+	engine := siteSpoeEngine(site)
+	err = s.createSpoeScope(singleSpoe, transaction.ID, spoeScopeSettings{
+		engine:            engine,
+		processingTimeout: processingTimeout,
+		maxBodySize:       int64(site.Spoe.MaxBodySize),
+		cond:              "if",
+		condTest:          fmt.Sprintf("{ var(%s) -m str %s } !{ var(%s) -m found }", spoeEngineVar, engine, banActionVar),
+	})
+	if err != nil {
+		singleSpoe.Transaction.DeleteTransaction(transaction.ID)
+		return err
+	}
+
+	if _, err = singleSpoe.Transaction.CommitTransaction(transaction.ID); err != nil {
+		return fmt.Errorf("提交 SPOE 事务错误: %v", err)
+	}
+	singleSpoe.Transaction.DeleteTransaction(transaction.ID)
+	return nil
+}
+
+// siteHostCondTest 请求的 Host 去掉端口后与站点域名完全相同，不区分大小写
+func siteHostCondTest(domain string) string {
+	return fmt.Sprintf("{ req.hdr(host),field(1,:),lower -m str %s }", strings.ToLower(domain))
+}
+
+// createSiteSpoeRules 为站点添加 SPOE 相关的前端配置
+// tcp-request content 规则在 SPOE 发送请求消息之前执行，按 Host 为请求标记站点级引擎和失败策略，
+// 标记了站点级引擎的请求只由该引擎的过滤器发送消息
+func (s *HAProxyServiceImpl) createSiteSpoeRules(site model.Site, frontendName string, transactionID string) error {
+	hostCondTest := siteHostCondTest(site.Domain)
+
+	var rules []*models.TCPRequestRule
+	if site.Spoe.HasDedicatedEngine() {
+		rules = append(rules, &models.TCPRequestRule{
+			Type:     "content",
+			Action:   "set-var",
+			VarScope: "txn",
+			VarName:  strings.TrimPrefix(spoeEngineVar, "txn."),
+			Expr:     fmt.Sprintf("str(%s)", siteSpoeEngine(site)),
+			Cond:     "if",
+			CondTest: hostCondTest,
+		})
+	}
+	if site.Spoe.FailOpen() {
+		rules = append(rules, &models.TCPRequestRule{
+			Type:     "content",
+			Action:   "set-var",
+			VarScope: "txn",
+			VarName:  strings.TrimPrefix(spoeFailOpenVar, "txn."),
+			Expr:     "bool(true)",
+			Cond:     "if",
+			CondTest: hostCondTest,
+		})
+	}
+	if len(rules) == 0 {
+		return nil
+	}
+
+	_, tcpRules, err := s.confClient.GetTCPRequestRules("frontend", frontendName, transactionID)
+	if err != nil {
+		return fmt.Errorf("获取 TCP 请求规则失败: %v", err)
+	}
+	for i, rule := range rules {
+		if err := s.confClient.CreateTCPRequestRule(int64(len(tcpRules)+i), "frontend", frontendName, rule, transactionID, 0); err != nil {
+			return fmt.Errorf("添加站点 SPOE 规则 #%d 错误: %v", i, err)
+		}
+	}
+
+	if !site.Spoe.HasDedicatedEngine() {
+		return nil
+	}
+	_, filters, err := s.confClient.GetFilters("frontend", frontendName, transactionID)
+	if err != nil {
+		return fmt.Errorf("获取过滤器失败: %v", err)
+	}
+	filter := &models.Filter{
+		Type:       "spoe",
+		SpoeEngine: siteSpoeEngine(site),
+		SpoeConfig: s.SpoeConfigFile,
+	}
+	if err := s.confClient.CreateFilter(int64(len(filters)), "frontend", frontendName, filter, transactionID, 0); err != nil {
+		return fmt.Errorf("创建过滤器失败: %v", err)
+	}
+	return nil
+}
+
+// renderBlockPage 将拦截页面模板转换为 HAProxy log-format，模板中的 % 转义后再替换占位符
+func renderBlockPage(template string) string {
+	escaped := strings.ReplaceAll(template, "%", "%%")
+	return strings.NewReplacer(blockPageSamples...).Replace(escaped)
+}
+
+// writeSiteBlockPages 写入站点的拦截页面文件，返回 HTML 和 JSON 页面的路径，未配置的模板返回空路径
+func (s *HAProxyServiceImpl) writeSiteBlockPages(site model.Site) (string, string, error) {
+	if err := os.MkdirAll(s.BlockPageDir, 0755); err != nil {
+		return "", "", fmt.Errorf("failed to create block page directory: %w", err)
+	}
+
+	write := func(template, ext string) (string, error) {
+		if template == "" {
+			return "", nil
+		}
+		path := filepath.Join(s.BlockPageDir, fmt.Sprintf("%s_%d.%s", site.Domain, site.ListenPort, ext))
+		if err := os.WriteFile(path, []byte(renderBlockPage(template)), 0644); err != nil {
+			return "", fmt.Errorf("failed to write block page file: %w", err)
+		}
+		return path, nil
+	}
+
+	htmlFile, err := write(site.BlockPage.HTML, "html")
+	if err != nil {
+		return "", "", err
+	}
+	jsonFile, err := write(site.BlockPage.JSON, "json")
+	if err != nil {
+		return "", "", err
+	}
+	return htmlFile, jsonFile, nil
+}
+
+// createSiteBlockPageRules 为站点添加拦截页面规则，引擎要求拒绝或限速时按 Host 返回站点的拦截页面
+// 规则插入在通用的 WAF 拒绝规则之前，tarpit、drop 和响应阶段的拒绝仍使用 HAProxy 默认响应
+// 封禁IP由 HAProxy 按 map 直接处置，不发送 SPOE 消息，也不使用拦截页面
+func (s *HAProxyServiceImpl) createSiteBlockPageRules(site model.Site, frontendName, htmlFile, jsonFile string, transactionID string) error {
+	hostCondTest := siteHostCondTest(site.Domain)
+
+	type variant struct {
+		file        string
+		contentType string
+		condTest    string
+	}
+	var variants []variant
+	switch {
+	case htmlFile != "" && jsonFile != "":
+		variants = []variant{
+			{jsonFile, "application/json", " " + acceptJSONCondTest},
+			{htmlFile, "text/html", ""},
+		}
+	case jsonFile != "":
+		variants = []variant{{jsonFile, "application/json", ""}}
+	default:
+		variants = []variant{{htmlFile, "text/html", ""}}
+	}
+
+	var rules []*models.HTTPRequestRule
+	for _, v := range variants {
+		rules = append(rules,
+			&models.HTTPRequestRule{
+				Type:                "deny",
+				DenyStatus:          Int64P(403),
+				ReturnContentType:   StringP(v.contentType),
+				ReturnContentFormat: "lf-file",
+				ReturnContent:       v.file,
+				Cond:                "if",
+				CondTest:            wafDenyCondTest + " " + hostCondTest + v.condTest,
+			},
+			&models.HTTPRequestRule{
+				Type:                "return",
+				ReturnStatusCode:    Int64P(429),
+				ReturnContentType:   StringP(v.contentType),
+				ReturnContentFormat: "lf-file",
+				ReturnContent:       v.file,
+				ReturnHeaders: []*models.ReturnHeader{
+					{Name: StringP("Retry-After"), Fmt: StringP("%[var(txn.coraza.retry_after)]")},
+				},
+				Cond:     "if",
+				CondTest: throttleCondTest + " " + hostCondTest + v.condTest,
+			},
+		)
+	}
+
+	_, requestRules, err := s.confClient.GetHTTPRequestRules("frontend", frontendName, transactionID)
+	if err != nil {
+		return fmt.Errorf("获取 HTTP 请求规则失败: %v", err)
+	}
+	index := int64(len(requestRules))
+	for i, rule := range requestRules {
+		if rule.CondTest == wafDenyCondTest {
+			index = int64(i)
+			break
+		}
+	}
+	for i, rule := range rules {
+		if err := s.confClient.CreateHTTPRequestRule(index+int64(i), "frontend", frontendName, rule, transactionID, 0); err != nil {
+			return fmt.Errorf("添加站点拦截页面规则 #%d 错误: %v", i, err)
+		}
+	}
+	return nil
+}
+
+// tarpitTimeoutMs 返回前端的 tarpit 超时时间（毫秒），未配置时为 10 秒
+func (s *HAProxyServiceImpl) tarpitTimeoutMs() *int64 {
+	seconds := s.tarpitTimeout
+	if seconds <= 0 {
+		seconds = 10
+	}
+	return Int64P(int64(seconds) * 1000)
+}
+
+// writeBlockedIPMapFile 原子地重写封禁IP map文件
+func (s *HAProxyServiceImpl) writeBlockedIPMapFile(entries map[string]BlockedIPEntry) error {
+	dir := filepath.Dir(s.BlockedIPMapFile)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("unable to create directory %s: %v", dir, err)
+	}
+
+	ips := make([]string, 0, len(entries))
+	for ip := range entries {
+		ips = append(ips, ip)
+	}
+	sort.Strings(ips)
+
+	var buf bytes.Buffer
+	for _, ip := range ips {
+		fmt.Fprintf(&buf, "%s %s\n", ip, entries[ip].mapValue())
+	}
+
+	tmpFile := s.BlockedIPMapFile + ".tmp"
+	if err := os.WriteFile(tmpFile, buf.Bytes(), 0644); err != nil {
+		return fmt.Errorf("写入封禁IP map文件失败: %v", err)
+	}
+	if err := os.Rename(tmpFile, s.BlockedIPMapFile); err != nil {
+		return fmt.Errorf("替换封禁IP map文件失败: %v", err)
+	}
+	return nil
+}
+
 func (s *HAProxyServiceImpl) createBackendServer(name, address string, port int, transactionID string, backendName string, isSsl bool) error {
 	server := &models.Server{
 		Name:    name,
@@ -0,0 +1,283 @@
+package haproxy
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/haproxytech/client-native/v6/configuration"
+	"github.com/haproxytech/client-native/v6/models"
+	runtime_api "github.com/haproxytech/client-native/v6/runtime"
+	"github.com/rs/zerolog"
+)
+
+// fakeRuntime 在内存中维护 map 条目的运行时客户端，记录每次修改
+type fakeRuntime struct {
+	runtime_api.Runtime
+	maps    map[string]map[string]string
+	changes []string
+}
+
+func (r *fakeRuntime) ShowMapEntries(name string) (models.MapEntries, error) {
+	var entries models.MapEntries
+	for key, value := range r.maps[name] {
+		entries = append(entries, &models.MapEntry{Key: key, Value: value})
+	}
+	return entries, nil
+}
+
+func (r *fakeRuntime) AddMapEntry(name, key, value string) error {
+	r.maps[name][key] = value
+	r.changes = append(r.changes, "add "+key+" "+value)
+	return nil
+}
+
+func (r *fakeRuntime) SetMapEntry(name, id, value string) error {
+	r.maps[name][id] = value
+	r.changes = append(r.changes, "set "+id+" "+value)
+	return nil
+}
+
+func (r *fakeRuntime) DeleteMapEntry(name, id string) error {
+	delete(r.maps[name], id)
+	r.changes = append(r.changes, "del "+id)
+	return nil
+}
+
+// TestBlockedIPEntryMapValue 测试封禁IP map 条目值的格式
+func TestBlockedIPEntryMapValue(t *testing.T) {
+	tests := []struct {
+		name  string
+		entry BlockedIPEntry
+		want  string
+	}{
+		{"直接拒绝", BlockedIPEntry{Until: 1700000600, Action: "deny"}, "1700000600|deny"},
+		{"返回 429", BlockedIPEntry{Until: 1700000600, Action: "throttle"}, "1700000600|throttle"},
+		{"跳转带跳转地址", BlockedIPEntry{Until: 1700000600, Action: "redirect", RedirectURL: "https://example.com/wait?a=1"}, "1700000600|redirect|https://example.com/wait?a=1"},
+		{"跳转地址包含分隔符时直接拒绝", BlockedIPEntry{Until: 1700000600, Action: "redirect", RedirectURL: "https://example.com/a|b"}, "1700000600|deny"},
+		{"跳转地址包含空白时直接拒绝", BlockedIPEntry{Until: 1700000600, Action: "redirect", RedirectURL: "https://example.com/a b"}, "1700000600|deny"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.entry.mapValue(); got != tt.want {
+				t.Errorf("mapValue() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestSyncBlockedIPs 测试封禁IP同步时只对变化的 map 条目执行添加、更新和删除
+func TestSyncBlockedIPs(t *testing.T) {
+	ban := func(until int64, action string) BlockedIPEntry {
+		return BlockedIPEntry{Until: until, Action: action}
+	}
+
+	tests := []struct {
+		name    string
+		current map[string]string
+		entries map[string]BlockedIPEntry
+		changes []string
+		file    string
+	}{
+		{
+			name:    "新增封禁",
+			current: map[string]string{},
+			entries: map[string]BlockedIPEntry{"10.0.0.1": ban(1700000600, "deny"), "10.0.0.0/24": ban(1700000900, "throttle")},
+			changes: []string{"add 10.0.0.0/24 1700000900|throttle", "add 10.0.0.1 1700000600|deny"},
+			file:    "10.0.0.0/24 1700000900|throttle\n10.0.0.1 1700000600|deny\n",
+		},
+		{
+			name:    "封禁被延长时更新截止时间",
+			current: map[string]string{"10.0.0.1": "1700000600|deny"},
+			entries: map[string]BlockedIPEntry{"10.0.0.1": ban(1700001200, "deny")},
+			changes: []string{"set 10.0.0.1 1700001200|deny"},
+			file:    "10.0.0.1 1700001200|deny\n",
+		},
+		{
+			name:    "处置动作变化时更新",
+			current: map[string]string{"10.0.0.1": "1700000600|throttle"},
+			entries: map[string]BlockedIPEntry{"10.0.0.1": ban(1700000600, "tarpit")},
+			changes: []string{"set 10.0.0.1 1700000600|tarpit"},
+			file:    "10.0.0.1 1700000600|tarpit\n",
+		},
+		{
+			name:    "已解封或已过期的条目被删除",
+			current: map[string]string{"10.0.0.1": "1700000600|deny", "10.0.0.2": "1700000900|deny"},
+			entries: map[string]BlockedIPEntry{"10.0.0.2": ban(1700000900, "deny")},
+			changes: []string{"del 10.0.0.1"},
+			file:    "10.0.0.2 1700000900|deny\n",
+		},
+		{
+			name:    "没有变化时不修改",
+			current: map[string]string{"10.0.0.1": "1700000600|throttle"},
+			entries: map[string]BlockedIPEntry{"10.0.0.1": ban(1700000600, "throttle")},
+			file:    "10.0.0.1 1700000600|throttle\n",
+		},
+		{
+			name:    "旧格式的条目被更新",
+			current: map[string]string{"10.0.0.1": "1700000600"},
+			entries: map[string]BlockedIPEntry{"10.0.0.1": ban(1700000600, "deny")},
+			changes: []string{"set 10.0.0.1 1700000600|deny"},
+			file:    "10.0.0.1 1700000600|deny\n",
+		},
+		{
+			name:    "同时添加、更新和删除",
+			current: map[string]string{"10.0.0.1": "1700000600|deny", "10.0.0.2": "1700000900|deny"},
+			entries: map[string]BlockedIPEntry{"10.0.0.2": ban(1700001800, "deny"), "10.0.0.3": ban(1700000300, "drop")},
+			changes: []string{"add 10.0.0.3 1700000300|drop", "del 10.0.0.1", "set 10.0.0.2 1700001800|deny"},
+			file:    "10.0.0.2 1700001800|deny\n10.0.0.3 1700000300|drop\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mapFile := filepath.Join(t.TempDir(), "maps", "blocked_ips.map")
+			runtime := &fakeRuntime{maps: map[string]map[string]string{"blocked_ips": tt.current}}
+			s := &HAProxyServiceImpl{
+				BlockedIPMapFile: mapFile,
+				runtimeClient:    runtime,
+				logger:           zerolog.Nop(),
+			}
+			s.status.Store(int32(StatusRunning))
+
+			if err := s.SyncBlockedIPs(tt.entries); err != nil {
+				t.Fatalf("同步封禁IP失败: %v", err)
+			}
+
+			sort.Strings(runtime.changes)
+			if len(runtime.changes) != 0 || len(tt.changes) != 0 {
+				if !reflect.DeepEqual(runtime.changes, tt.changes) {
+					t.Errorf("map 修改为 %v，期望 %v", runtime.changes, tt.changes)
+				}
+			}
+			content, err := os.ReadFile(mapFile)
+			if err != nil {
+				t.Fatalf("读取 map 文件失败: %v", err)
+			}
+			if string(content) != tt.file {
+				t.Errorf("map 文件内容为 %q，期望 %q", content, tt.file)
+			}
+		})
+	}
+}
+
+// TestSyncBlockedIPsNotRunning 测试 HAProxy 未运行时只写入 map 文件
+func TestSyncBlockedIPsNotRunning(t *testing.T) {
+	mapFile := filepath.Join(t.TempDir(), "blocked_ips.map")
+	runtime := &fakeRuntime{maps: map[string]map[string]string{"blocked_ips": {}}}
+	s := &HAProxyServiceImpl{
+		BlockedIPMapFile: mapFile,
+		runtimeClient:    runtime,
+		logger:           zerolog.Nop(),
+	}
+
+	if err := s.SyncBlockedIPs(map[string]BlockedIPEntry{"10.0.0.1": {Until: 1700000600, Action: "deny"}}); err != nil {
+		t.Fatalf("同步封禁IP失败: %v", err)
+	}
+	if len(runtime.changes) != 0 {
+		t.Errorf("HAProxy 未运行时不应修改运行时 map: %v", runtime.changes)
+	}
+	if content, _ := os.ReadFile(mapFile); string(content) != "10.0.0.1 1700000600|deny\n" {
+		t.Errorf("map 文件内容为 %q", content)
+	}
+}
+
+// fakeConfiguration 记录创建的 tcp-request 规则的配置客户端
+type fakeConfiguration struct {
+	configuration.Configuration
+	rules        []*models.TCPRequestRule
+	requestRules []*models.HTTPRequestRule
+}
+
+func (c *fakeConfiguration) CreateTCPRequestRule(id int64, parentType string, parentName string, data *models.TCPRequestRule, transactionID string, version int64) error {
+	if int(id) != len(c.rules) || parentType != "frontend" || parentName != "fe_http" || transactionID != "tx" {
+		return os.ErrInvalid
+	}
+	c.rules = append(c.rules, data)
+	return nil
+}
+
+func (c *fakeConfiguration) CreateHTTPRequestRule(id int64, parentType string, parentName string, data *models.HTTPRequestRule, transactionID string, version int64) error {
+	if int(id) != len(c.requestRules) || parentType != "frontend" || parentName != "fe_http" || transactionID != "tx" {
+		return os.ErrInvalid
+	}
+	c.requestRules = append(c.requestRules, data)
+	return nil
+}
+
+// TestCreateBlockedIPRules 测试封禁IP规则按截止时间判断封禁是否生效，并按处置动作在连接层拒绝或断开
+func TestCreateBlockedIPRules(t *testing.T) {
+	conf := &fakeConfiguration{}
+	s := &HAProxyServiceImpl{
+		BlockedIPMapFile: "/etc/haproxy/maps/blocked_ips.map",
+		confClient:       conf,
+	}
+
+	if err := s.createBlockedIPRules("fe_http", "tx"); err != nil {
+		t.Fatalf("创建封禁IP规则失败: %v", err)
+	}
+
+	want := []models.TCPRequestRule{
+		{Type: "content", Action: "set-var", VarScope: "txn", VarName: "waf_ban", Expr: "src,map_ip(/etc/haproxy/maps/blocked_ips.map)"},
+		{Type: "content", Action: "set-var", VarScope: "txn", VarName: "waf_ban_until", Expr: "var(txn.waf_ban),field(1,|)"},
+		{Type: "content", Action: "set-var", VarScope: "txn", VarName: "waf_ban_ttl", Expr: "date,neg,add(txn.waf_ban_until)"},
+		{Type: "content", Action: "set-var", VarScope: "txn", VarName: "waf_ban_action", Expr: "var(txn.waf_ban),field(2,|)", Cond: "if", CondTest: "{ var(txn.waf_ban_ttl) -m int gt 0 }"},
+		{Type: "content", Action: "set-var", VarScope: "txn", VarName: "waf_ban_url", Expr: "var(txn.waf_ban),field(3,|)", Cond: "if", CondTest: "{ var(txn.waf_ban_action) -m str redirect }"},
+		{Type: "content", Action: "reject", Cond: "if", CondTest: "{ var(txn.waf_ban_action) -m str deny }"},
+		{Type: "content", Action: "silent-drop", Cond: "if", CondTest: "{ var(txn.waf_ban_action) -m str drop }"},
+	}
+	if len(conf.rules) != len(want) {
+		t.Fatalf("创建了 %d 条规则，期望 %d 条", len(conf.rules), len(want))
+	}
+	for i := range want {
+		if !reflect.DeepEqual(*conf.rules[i], want[i]) {
+			t.Errorf("规则 #%d 为 %+v，期望 %+v", i, *conf.rules[i], want[i])
+		}
+	}
+}
+
+// TestCreateEnforcementRulesBan 测试封禁IP的 throttle、tarpit 和 redirect 由请求规则处置，Retry-After 为封禁的剩余时间
+func TestCreateEnforcementRulesBan(t *testing.T) {
+	conf := &fakeConfiguration{}
+	s := &HAProxyServiceImpl{confClient: conf}
+
+	if err := s.createEnforcementRules("fe_http", 0, "tx"); err != nil {
+		t.Fatalf("创建流控处置规则失败: %v", err)
+	}
+
+	rules := make(map[string]*models.HTTPRequestRule)
+	for _, rule := range conf.requestRules {
+		rules[rule.CondTest] = rule
+	}
+	throttle := rules["{ var(txn.waf_ban_action) -m str throttle }"]
+	if throttle == nil || throttle.Type != "return" || *throttle.ReturnStatusCode != 429 ||
+		len(throttle.ReturnHeaders) != 1 || *throttle.ReturnHeaders[0].Fmt != "%[var(txn.waf_ban_ttl)]" {
+		t.Errorf("封禁IP的 throttle 规则错误: %+v", throttle)
+	}
+	if tarpit := rules["{ var(txn.waf_ban_action) -m str tarpit }"]; tarpit == nil || tarpit.Type != "tarpit" {
+		t.Errorf("封禁IP的 tarpit 规则错误: %+v", tarpit)
+	}
+	if redirect := rules["{ var(txn.waf_ban_action) -m str redirect }"]; redirect == nil || redirect.Type != "redirect" || redirect.RedirValue != "%[var(txn.waf_ban_url)]" {
+		t.Errorf("封禁IP的 redirect 规则错误: %+v", redirect)
+	}
+}
+
+// TestRenderBlockPage 测试拦截页面模板转义 % 并将占位符替换为 HAProxy 样本表达式，拦截原因取 Agent 设置的 txn.coraza.reason
+func TestRenderBlockPage(t *testing.T) {
+	got := renderBlockPage(`<p>100% {{reason}} {{ruleId}} {{requestId}}</p>`)
+	want := `<p>100%% %[var(txn.coraza.reason)] %[var(txn.coraza.ruleid)] %[unique-id]</p>`
+	if got != want {
+		t.Errorf("renderBlockPage() = %q, 期望 %q", got, want)
+	}
+}
+
+// TestSiteHostCondTest 测试站点 Host 条件去掉端口后按小写域名完全匹配
+func TestSiteHostCondTest(t *testing.T) {
+	want := "{ req.hdr(host),field(1,:),lower -m str www.example.com }"
+	if got := siteHostCondTest("WWW.Example.com"); got != want {
+		t.Errorf("siteHostCondTest() = %q, 期望 %q", got, want)
+	}
+}
@@ -23,6 +23,7 @@ type HAProxyService interface {
 	Stop() error
 	GetStatus() HAProxyStatus
 	GetStats() (models.NativeStats, error)
+	SyncBlockedIPs(entries map[string]BlockedIPEntry) error
 	Reset() error
 }
 
@@ -61,6 +62,8 @@ func NewHAProxyService(configBaseDir, haproxyBin string, ctx context.Context) (H
 		SocketFile:         filepath.Join(configBaseDir, "/haproxy/conf/haproxy-master.sock"),
 		PidFile:            filepath.Join(configBaseDir, "/haproxy/conf/haproxy.pid"),
 		SpoeConfigFile:     filepath.Join(configBaseDir, "/haproxy/spoe/coraza-spoa.yaml"),
+		BlockedIPMapFile:   filepath.Join(configBaseDir, "/haproxy/conf/blocked_ips.map"),
+		BlockPageDir:       filepath.Join(configBaseDir, "/haproxy/blockpages"),
 		SpoeAgentAddress:   "127.0.0.1",
 		SpoeAgentPort:      2342,
 		isResponseCheck:    false,
@@ -68,6 +71,7 @@ func NewHAProxyService(configBaseDir, haproxyBin string, ctx context.Context) (H
 		logger:             logger,
 		isDebug:            !config.Global.IsProduction,
 		thread:             appConfig.Haproxy.Thread,
+		tarpitTimeout:      appConfig.Haproxy.TarpitTimeout,
 		isK8s:              config.Global.IsK8s,
 	}, nil
 }
@@ -6,6 +6,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/HUAHUAI23/simple-waf/coraza-spoa/pkg/server"
 	mongodb "github.com/HUAHUAI23/simple-waf/pkg/database/mongo"
 	"github.com/haproxytech/client-native/v6/models"
 
@@ -32,7 +33,11 @@ type ServiceRunner interface {
 	Restart() error
 	HotReload() error
 	GetState() ServiceState
+	GetLastError() error
+	GetEngineStats() server.AgentStats
+	GetLogStoreStats() server.LogStoreStats
 	GetStats() (models.NativeStats, error)
+	SyncBlockedIPs(entries map[string]haproxy.BlockedIPEntry) error
 }
 
 // ServiceRunner 负责管理和协调所有后台服务
@@ -445,6 +450,30 @@ func (r *ServiceRunnerImpl) GetState() ServiceState {
 	return r.state
 }
 
+// GetLastError 获取Engine服务最后一次启动或重新加载失败的错误
+func (r *ServiceRunnerImpl) GetLastError() error {
+	if r.engineService == nil {
+		return nil
+	}
+	return r.engineService.GetLastError()
+}
+
+// GetEngineStats 获取Engine服务的 SPOE Agent 错误计数
+func (r *ServiceRunnerImpl) GetEngineStats() server.AgentStats {
+	if r.engineService == nil {
+		return server.AgentStats{}
+	}
+	return r.engineService.GetAgentStats()
+}
+
+// GetLogStoreStats 获取Engine服务的 WAF 日志存储计数
+func (r *ServiceRunnerImpl) GetLogStoreStats() server.LogStoreStats {
+	if r.engineService == nil {
+		return server.LogStoreStats{}
+	}
+	return r.engineService.GetLogStoreStats()
+}
+
 // GetStats 获取HAProxy的统计信息
 func (r *ServiceRunnerImpl) GetStats() (models.NativeStats, error) {
 	if r.haproxyService == nil {
@@ -452,3 +481,11 @@ func (r *ServiceRunnerImpl) GetStats() (models.NativeStats, error) {
 	}
 	return r.haproxyService.GetStats()
 }
+
+// SyncBlockedIPs 将生效中的封禁IP同步到HAProxy
+func (r *ServiceRunnerImpl) SyncBlockedIPs(entries map[string]haproxy.BlockedIPEntry) error {
+	if r.haproxyService == nil {
+		return fmt.Errorf("haproxy service not initialized")
+	}
+	return r.haproxyService.SyncBlockedIPs(entries)
+}
@@ -0,0 +1,282 @@
+// server/service/rule_exclusion.go
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/HUAHUAI23/simple-waf/coraza-spoa/pkg/server"
+	mongodb "github.com/HUAHUAI23/simple-waf/pkg/database/mongo"
+	"github.com/HUAHUAI23/simple-waf/pkg/model"
+	"github.com/HUAHUAI23/simple-waf/pkg/utils/secrule"
+	"github.com/HUAHUAI23/simple-waf/server/config"
+	"github.com/HUAHUAI23/simple-waf/server/dto"
+	"github.com/HUAHUAI23/simple-waf/server/repository"
+	"github.com/rs/zerolog"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+var (
+	ErrRuleExclusionNotFound   = errors.New("规则排除不存在")
+	ErrRuleExclusionNameExists = errors.New("规则排除名称已存在")
+	ErrInvalidRuleExclusion    = errors.New("无效的规则排除")
+)
+
+// RuleExclusionService 规则排除服务接口
+// 规则排除在引擎重新加载应用时渲染为 SecRuleRemoveById、SecRuleUpdateTargetById 或 ctl 指令
+type RuleExclusionService interface {
+	CreateRuleExclusion(ctx context.Context, req *dto.RuleExclusionCreateRequest) (*model.RuleExclusion, error)
+	GetRuleExclusions(ctx context.Context, pageStr, sizeStr string) ([]model.RuleExclusion, int64, error)
+	GetRuleExclusionByID(ctx context.Context, id bson.ObjectID) (*model.RuleExclusion, error)
+	UpdateRuleExclusion(ctx context.Context, id bson.ObjectID, req *dto.RuleExclusionUpdateRequest) (*model.RuleExclusion, error)
+	DeleteRuleExclusion(ctx context.Context, id bson.ObjectID) error
+}
+
+// RuleExclusionServiceImpl 规则排除服务实现
+type RuleExclusionServiceImpl struct {
+	exclusionRepo repository.RuleExclusionRepository
+	configRepo    repository.ConfigRepository
+	logger        zerolog.Logger
+}
+
+// NewRuleExclusionService 创建规则排除服务
+func NewRuleExclusionService(exclusionRepo repository.RuleExclusionRepository, configRepo repository.ConfigRepository) RuleExclusionService {
+	logger := config.GetServiceLogger("ruleexclusion")
+	return &RuleExclusionServiceImpl{
+		exclusionRepo: exclusionRepo,
+		configRepo:    configRepo,
+		logger:        logger,
+	}
+}
+
+// CreateRuleExclusion 创建规则排除
+func (s *RuleExclusionServiceImpl) CreateRuleExclusion(ctx context.Context, req *dto.RuleExclusionCreateRequest) (*model.RuleExclusion, error) {
+	exists, err := s.exclusionRepo.CheckRuleExclusionNameExists(ctx, req.Name, bson.NilObjectID)
+	if err != nil {
+		return nil, err
+	}
+	if exists {
+		return nil, ErrRuleExclusionNameExists
+	}
+
+	now := time.Now()
+	exclusion := &model.RuleExclusion{
+		Name:        req.Name,
+		Description: req.Description,
+		Enabled:     req.Enabled == nil || *req.Enabled,
+		Type:        req.Type,
+		RuleIDs:     req.RuleIDs,
+		Tags:        req.Tags,
+		Targets:     req.Targets,
+		Host:        req.Host,
+		Path:        req.Path,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if err := validateRuleExclusion(exclusion); err != nil {
+		return nil, err
+	}
+	if err := s.compileRuleExclusions(ctx, exclusion); err != nil {
+		return nil, err
+	}
+
+	if err := s.exclusionRepo.CreateRuleExclusion(ctx, exclusion); err != nil {
+		s.logger.Error().Err(err).Msg("创建规则排除失败")
+		return nil, err
+	}
+
+	s.logger.Info().Str("id", exclusion.ID.Hex()).Str("name", exclusion.Name).Msg("规则排除创建成功")
+	return exclusion, nil
+}
+
+// GetRuleExclusions 获取规则排除列表
+func (s *RuleExclusionServiceImpl) GetRuleExclusions(ctx context.Context, pageStr, sizeStr string) ([]model.RuleExclusion, int64, error) {
+	page, err := strconv.ParseInt(pageStr, 10, 64)
+	if err != nil || page < 1 {
+		page = 1
+	}
+
+	size, err := strconv.ParseInt(sizeStr, 10, 64)
+	if err != nil || size < 1 {
+		size = 10
+	}
+
+	exclusions, total, err := s.exclusionRepo.GetRuleExclusions(ctx, page, size)
+	if err != nil {
+		s.logger.Error().Err(err).Msg("获取规则排除列表失败")
+		return nil, 0, err
+	}
+
+	return exclusions, total, nil
+}
+
+// GetRuleExclusionByID 根据ID获取规则排除
+func (s *RuleExclusionServiceImpl) GetRuleExclusionByID(ctx context.Context, id bson.ObjectID) (*model.RuleExclusion, error) {
+	exclusion, err := s.exclusionRepo.GetRuleExclusionByID(ctx, id)
+	if err != nil {
+		if errors.Is(err, repository.ErrRuleExclusionNotFound) {
+			return nil, ErrRuleExclusionNotFound
+		}
+		s.logger.Error().Err(err).Str("id", id.Hex()).Msg("获取规则排除失败")
+		return nil, err
+	}
+
+	return exclusion, nil
+}
+
+// UpdateRuleExclusion 更新规则排除
+func (s *RuleExclusionServiceImpl) UpdateRuleExclusion(ctx context.Context, id bson.ObjectID, req *dto.RuleExclusionUpdateRequest) (*model.RuleExclusion, error) {
+	exclusion, err := s.exclusionRepo.GetRuleExclusionByID(ctx, id)
+	if err != nil {
+		if errors.Is(err, repository.ErrRuleExclusionNotFound) {
+			return nil, ErrRuleExclusionNotFound
+		}
+		return nil, err
+	}
+
+	// 检查名称是否已存在（如果要更新名称）
+	if req.Name != nil && *req.Name != "" && *req.Name != exclusion.Name {
+		exists, err := s.exclusionRepo.CheckRuleExclusionNameExists(ctx, *req.Name, id)
+		if err != nil {
+			return nil, err
+		}
+		if exists {
+			return nil, ErrRuleExclusionNameExists
+		}
+		exclusion.Name = *req.Name
+	}
+
+	// 只更新传入的字段
+	if req.Description != nil {
+		exclusion.Description = *req.Description
+	}
+	if req.Enabled != nil {
+		exclusion.Enabled = *req.Enabled
+	}
+	if req.Type != nil {
+		exclusion.Type = *req.Type
+	}
+	if req.RuleIDs != nil {
+		exclusion.RuleIDs = req.RuleIDs
+	}
+	if req.Tags != nil {
+		exclusion.Tags = req.Tags
+	}
+	if req.Targets != nil {
+		exclusion.Targets = req.Targets
+	}
+	if req.Host != nil {
+		exclusion.Host = *req.Host
+	}
+	if req.Path != nil {
+		exclusion.Path = *req.Path
+	}
+	if err := validateRuleExclusion(exclusion); err != nil {
+		return nil, err
+	}
+	if err := s.compileRuleExclusions(ctx, exclusion); err != nil {
+		return nil, err
+	}
+	exclusion.UpdatedAt = time.Now()
+
+	if err := s.exclusionRepo.UpdateRuleExclusion(ctx, exclusion); err != nil {
+		s.logger.Error().Err(err).Str("id", id.Hex()).Msg("更新规则排除失败")
+		return nil, err
+	}
+
+	s.logger.Info().Str("id", id.Hex()).Str("name", exclusion.Name).Msg("规则排除更新成功")
+	return exclusion, nil
+}
+
+// DeleteRuleExclusion 删除规则排除
+func (s *RuleExclusionServiceImpl) DeleteRuleExclusion(ctx context.Context, id bson.ObjectID) error {
+	if err := s.exclusionRepo.DeleteRuleExclusion(ctx, id); err != nil {
+		if errors.Is(err, repository.ErrRuleExclusionNotFound) {
+			return ErrRuleExclusionNotFound
+		}
+		s.logger.Error().Err(err).Str("id", id.Hex()).Msg("删除规则排除失败")
+		return err
+	}
+
+	s.logger.Info().Str("id", id.Hex()).Msg("规则排除删除成功")
+	return nil
+}
+
+// validateRuleExclusion 规范化并校验规则排除，保证渲染出的指令能被引擎加载
+func validateRuleExclusion(exclusion *model.RuleExclusion) error {
+	exclusion.Host = strings.ToLower(strings.TrimSpace(exclusion.Host))
+	exclusion.Path = strings.TrimSpace(exclusion.Path)
+
+	// 与排除类型无关的字段不保存，避免切换类型后残留
+	switch exclusion.Type {
+	case model.ExclusionRemoveByID:
+		exclusion.Tags, exclusion.Targets = nil, nil
+	case model.ExclusionRemoveByTag:
+		exclusion.RuleIDs, exclusion.Targets = nil, nil
+	case model.ExclusionRemoveTargetID:
+		exclusion.Tags = nil
+	}
+
+	if err := secrule.ValidateExclusion(exclusion); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidRuleExclusion, err)
+	}
+	return nil
+}
+
+// compileRuleExclusions 将规则排除与其他已启用的规则排除按引擎加载的顺序组装到当前配置的各应用中并编译
+// SecRuleUpdateTargetById 等指令引用未加载的规则ID时会导致引擎重新加载应用失败，需在保存前拦截
+func (s *RuleExclusionServiceImpl) compileRuleExclusions(ctx context.Context, exclusion *model.RuleExclusion) error {
+	// 未启用的规则排除不会被加载
+	if !exclusion.Enabled {
+		return nil
+	}
+
+	cfg, err := s.configRepo.GetConfig(ctx)
+	if err != nil {
+		// 尚未创建配置时没有需要加载的应用
+		if errors.Is(err, repository.ErrConfigNotFound) {
+			return nil
+		}
+		s.logger.Error().Err(err).Msg("获取配置失败")
+		return err
+	}
+
+	stored, err := s.exclusionRepo.GetEnabledRuleExclusions(ctx)
+	if err != nil {
+		return err
+	}
+	// 替换已保存的同一规则排除，新创建或重新启用的规则排除按创建时间插入
+	exclusions := make([]model.RuleExclusion, 0, len(stored)+1)
+	inserted := false
+	for _, item := range stored {
+		if item.ID == exclusion.ID {
+			continue
+		}
+		if !inserted && item.CreatedAt.After(exclusion.CreatedAt) {
+			exclusions = append(exclusions, *exclusion)
+			inserted = true
+		}
+		exclusions = append(exclusions, item)
+	}
+	if !inserted {
+		exclusions = append(exclusions, *exclusion)
+	}
+
+	client, err := mongodb.Connect(config.Global.DBConfig.URI)
+	if err != nil {
+		s.logger.Error().Err(err).Msg("连接数据库失败")
+		return err
+	}
+	if err := server.ValidateRuleExclusions(cfg, client.Database(config.Global.DBConfig.Database), exclusions); err != nil {
+		if errors.Is(err, server.ErrInvalidAppConfig) {
+			return fmt.Errorf("%w: %v", ErrInvalidRuleExclusion, err)
+		}
+		s.logger.Error().Err(err).Msg("预检规则排除失败")
+		return err
+	}
+	return nil
+}
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 
+	"github.com/HUAHUAI23/simple-waf/coraza-spoa/pkg/server"
 	"github.com/HUAHUAI23/simple-waf/server/config"
 	cornjob "github.com/HUAHUAI23/simple-waf/server/service/cornjob/haproxy"
 	"github.com/HUAHUAI23/simple-waf/server/service/daemon"
@@ -22,6 +23,12 @@ var (
 type RunnerService interface {
 	// 获取运行器状态
 	GetStatus(ctx context.Context) (daemon.ServiceState, error)
+	// 获取引擎最后一次启动或重新加载失败的错误，重新加载失败时引擎继续使用之前的配置
+	GetLastError(ctx context.Context) error
+	// 获取引擎 SPOE Agent 的错误计数
+	GetEngineStats(ctx context.Context) server.AgentStats
+	// 获取引擎 WAF 日志存储的丢弃、溢出和回放计数
+	GetLogStoreStats(ctx context.Context) server.LogStoreStats
 
 	// 运行器操作
 	Start(ctx context.Context) error
@@ -61,6 +68,21 @@ func (s *RunnerServiceImpl) GetStatus(ctx context.Context) (daemon.ServiceState,
 	return s.runner.GetState(), nil
 }
 
+// GetLastError 获取引擎最后一次启动或重新加载失败的错误
+func (s *RunnerServiceImpl) GetLastError(ctx context.Context) error {
+	return s.runner.GetLastError()
+}
+
+// GetEngineStats 获取引擎 SPOE Agent 的错误计数
+func (s *RunnerServiceImpl) GetEngineStats(ctx context.Context) server.AgentStats {
+	return s.runner.GetEngineStats()
+}
+
+// GetLogStoreStats 获取引擎 WAF 日志存储的丢弃、溢出和回放计数
+func (s *RunnerServiceImpl) GetLogStoreStats(ctx context.Context) server.LogStoreStats {
+	return s.runner.GetLogStoreStats()
+}
+
 // Start 启动运行器
 func (s *RunnerServiceImpl) Start(ctx context.Context) error {
 	// 检查当前状态
@@ -46,6 +46,12 @@ func (s *SiteServiceImpl) CreateSite(ctx context.Context, req *dto.CreateSiteReq
 	site.WAFEnabled = req.WAFEnabled
 	site.WAFMode = model.WAFModeFromString(req.WAFMode)
 	site.ActiveStatus = req.ActiveStatus
+	if req.Spoe != nil {
+		site.Spoe = toSpoeSettings(req.Spoe)
+	}
+	if req.BlockPage != nil {
+		site.BlockPage = toBlockPageSettings(req.BlockPage)
+	}
 	// 设置后端服务器
 	site.Backend.Servers = make([]model.Server, len(req.Backend.Servers))
 	for i, server := range req.Backend.Servers {
@@ -158,6 +164,12 @@ func (s *SiteServiceImpl) UpdateSite(ctx context.Context, id bson.ObjectID, req
 		site.WAFMode = model.WAFModeFromString(req.WAFMode)
 	}
 	site.ActiveStatus = req.ActiveStatus
+	if req.Spoe != nil {
+		site.Spoe = toSpoeSettings(req.Spoe)
+	}
+	if req.BlockPage != nil {
+		site.BlockPage = toBlockPageSettings(req.BlockPage)
+	}
 
 	// 更新后端服务器
 	if req.Backend != nil && len(req.Backend.Servers) > 0 {
@@ -218,3 +230,20 @@ func (s *SiteServiceImpl) DeleteSite(ctx context.Context, id bson.ObjectID) erro
 	s.logger.Info().Str("id", id.Hex()).Str("name", site.Name).Msg("站点删除成功")
 	return nil
 }
+
+// toSpoeSettings 将请求中的 SPOE 设置转换为模型
+func toSpoeSettings(req *dto.SpoeDTO) model.SpoeSettings {
+	return model.SpoeSettings{
+		ProcessingTimeout: req.ProcessingTimeout,
+		MaxBodySize:       req.MaxBodySize,
+		FailPolicy:        model.SpoeFailPolicy(req.FailPolicy),
+	}
+}
+
+// toBlockPageSettings 将请求中的拦截页面设置转换为模型
+func toBlockPageSettings(req *dto.BlockPageDTO) model.BlockPageSettings {
+	return model.BlockPageSettings{
+		HTML: req.HTML,
+		JSON: req.JSON,
+	}
+}
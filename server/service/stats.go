@@ -7,6 +7,7 @@ import (
 	"time"
 
 	mongodb "github.com/HUAHUAI23/simple-waf/pkg/database/mongo"
+	pkgmodel "github.com/HUAHUAI23/simple-waf/pkg/model"
 	"github.com/HUAHUAI23/simple-waf/server/config"
 	"github.com/HUAHUAI23/simple-waf/server/dto"
 	"github.com/HUAHUAI23/simple-waf/server/model"
@@ -16,6 +17,9 @@ import (
 	"go.mongodb.org/mongo-driver/v2/mongo"
 )
 
+// nonBlockingModes 未拦截请求的决策模式，拦截统计中排除
+var nonBlockingModes = bson.A{pkgmodel.DecisionModeObserve, pkgmodel.DecisionModeNearMiss}
+
 type StatsService interface {
 	GetOverviewStats(ctx context.Context, timeRange string) (*dto.OverviewStats, error)
 	GetRealtimeQPS(ctx context.Context, limit int) (*dto.RealtimeQPSResponse, error)
@@ -490,13 +494,14 @@ func (s *StatsServiceImpl) getMinuteStatsAggregate(ctx context.Context, db *mong
 
 // 辅助方法 - 获取WAF拦截统计
 func (s *StatsServiceImpl) getWAFBlockStats(ctx context.Context, startTime time.Time) (int64, int64, error) {
-	// 构建时间过滤条件
+	// 构建时间过滤条件，监控模式和接近拦截阈值的未拦截记录不计入拦截数
 	timeFilter := bson.D{
 		{Key: "createdAt", Value: bson.D{{Key: "$gte", Value: startTime}}},
+		{Key: "mode", Value: bson.D{{Key: "$nin", Value: nonBlockingModes}}},
 	}
 
-	// 获取拦截总数
-	blockCount, err := s.wafLogRepository.CountAttackLogs(ctx, timeFilter)
+	// 获取拦截总数，聚合记录按事件数计数
+	blockCount, err := s.wafLogRepository.SumAttackLogEvents(ctx, timeFilter)
 	if err != nil {
 		return 0, 0, fmt.Errorf("计算拦截总数失败: %w", err)
 	}
@@ -506,6 +511,7 @@ func (s *StatsServiceImpl) getWAFBlockStats(ctx context.Context, startTime time.
 		{
 			{Key: "$match", Value: bson.D{
 				{Key: "createdAt", Value: bson.D{{Key: "$gte", Value: startTime}}},
+				{Key: "mode", Value: bson.D{{Key: "$nin", Value: nonBlockingModes}}},
 			}},
 		},
 		{
@@ -617,9 +623,10 @@ func (s *StatsServiceImpl) getBlockTimeSeries(ctx context.Context, startTime tim
 
 	collection := db.Collection("waf_log")
 
-	// 构建时间过滤条件
+	// 构建时间过滤条件，监控模式和接近拦截阈值的未拦截记录不计入拦截数
 	matchStage := bson.D{{Key: "$match", Value: bson.D{
 		{Key: "createdAt", Value: bson.D{{Key: "$gte", Value: startTime}}},
+		{Key: "mode", Value: bson.D{{Key: "$nin", Value: nonBlockingModes}}},
 	}}}
 
 	// 根据interval决定如何分组
@@ -632,7 +639,7 @@ func (s *StatsServiceImpl) getBlockTimeSeries(ctx context.Context, startTime tim
 				{Key: "date", Value: "$date"},
 				{Key: "hour", Value: "$hour"},
 			}},
-			{Key: "count", Value: bson.D{{Key: "$sum", Value: 1}}},
+			{Key: "count", Value: bson.D{{Key: "$sum", Value: wafLogEventCount}}},
 			{Key: "timestamp", Value: bson.D{{Key: "$min", Value: "$createdAt"}}},
 		}}}
 	} else if interval == "6hour" {
@@ -642,14 +649,14 @@ func (s *StatsServiceImpl) getBlockTimeSeries(ctx context.Context, startTime tim
 				{Key: "date", Value: "$date"},
 				{Key: "hourGroup", Value: "$hourGroupSix"},
 			}},
-			{Key: "count", Value: bson.D{{Key: "$sum", Value: 1}}},
+			{Key: "count", Value: bson.D{{Key: "$sum", Value: wafLogEventCount}}},
 			{Key: "timestamp", Value: bson.D{{Key: "$min", Value: "$createdAt"}}},
 		}}}
 	} else {
 		// 按日期分组
 		groupStage = bson.D{{Key: "$group", Value: bson.D{
 			{Key: "_id", Value: bson.D{{Key: "date", Value: "$date"}}},
-			{Key: "count", Value: bson.D{{Key: "$sum", Value: 1}}},
+			{Key: "count", Value: bson.D{{Key: "$sum", Value: wafLogEventCount}}},
 			{Key: "timestamp", Value: bson.D{{Key: "$min", Value: "$createdAt"}}},
 		}}}
 	}
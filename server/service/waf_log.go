@@ -12,9 +12,17 @@ import (
 	"go.mongodb.org/mongo-driver/v2/mongo"
 )
 
+// 聚合记录代表的事件数和首次、最后一次事件时间，未聚合的记录为 1 次和 createdAt
+var (
+	wafLogEventCount = bson.D{{Key: "$ifNull", Value: bson.A{"$count", 1}}}
+	wafLogFirstSeen  = bson.D{{Key: "$ifNull", Value: bson.A{"$firstSeenAt", "$createdAt"}}}
+	wafLogLastSeen   = bson.D{{Key: "$ifNull", Value: bson.A{"$lastSeenAt", "$createdAt"}}}
+)
+
 type WAFLogService interface {
 	GetAttackEvents(ctx context.Context, req dto.AttackEventRequset, page, pageSize int) (*dto.AttackEventResponse, error)
 	GetAttackLogs(ctx context.Context, req dto.AttackLogRequest, page, pageSize int) (*dto.AttackLogResponse, error)
+	GetAuditLog(ctx context.Context, requestID string) (*model.AuditLog, error)
 }
 
 type WAFLogServiceImpl struct {
@@ -48,10 +56,10 @@ func (s *WAFLogServiceImpl) GetAttackEvents(
 				{Key: "dstPort", Value: "$dstPort"},
 				{Key: "domain", Value: "$domain"},
 			}},
-			{Key: "count", Value: bson.D{{Key: "$sum", Value: 1}}},
-			{Key: "firstAttackTime", Value: bson.D{{Key: "$min", Value: "$createdAt"}}},
-			{Key: "lastAttackTime", Value: bson.D{{Key: "$max", Value: "$createdAt"}}},
-			{Key: "allTimes", Value: bson.D{{Key: "$push", Value: "$createdAt"}}},
+			{Key: "count", Value: bson.D{{Key: "$sum", Value: wafLogEventCount}}},
+			{Key: "firstAttackTime", Value: bson.D{{Key: "$min", Value: wafLogFirstSeen}}},
+			{Key: "lastAttackTime", Value: bson.D{{Key: "$max", Value: wafLogLastSeen}}},
+			{Key: "allTimes", Value: bson.D{{Key: "$push", Value: wafLogLastSeen}}},
 			{Key: "srcIpInfo", Value: bson.D{{Key: "$first", Value: "$srcIpInfo"}}},
 		}},
 	}
@@ -224,6 +232,18 @@ func (s *WAFLogServiceImpl) buildAttackLogFilter(req dto.AttackLogRequest) bson.
 	if req.RuleID > 0 {
 		filter = append(filter, bson.E{Key: "ruleId", Value: req.RuleID})
 	}
+	if req.RequestID != "" {
+		filter = append(filter, bson.E{Key: "requestId", Value: req.RequestID})
+	}
+	if req.Engine != "" {
+		filter = append(filter, bson.E{Key: "engine", Value: req.Engine})
+	}
+	if req.Action != "" {
+		filter = append(filter, bson.E{Key: "action", Value: req.Action})
+	}
+	if req.Mode != "" {
+		filter = append(filter, bson.E{Key: "mode", Value: req.Mode})
+	}
 
 	// Add time range filter if provided
 	timeFilter := bson.D{}
@@ -239,3 +259,8 @@ func (s *WAFLogServiceImpl) buildAttackLogFilter(req dto.AttackLogRequest) bson.
 
 	return filter
 }
+
+// GetAuditLog retrieves the Coraza audit log of a request
+func (s *WAFLogServiceImpl) GetAuditLog(ctx context.Context, requestID string) (*model.AuditLog, error) {
+	return s.wafLogRepository.FindAuditLogByRequestID(ctx, requestID)
+}
@@ -0,0 +1,36 @@
+package validator
+
+import (
+	"regexp"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// 初始化流控相关验证器
+func init() {
+	Register("httpstatus", HTTPStatusValidator)
+	Register("policyname", PolicyNameValidator)
+}
+
+var (
+	httpStatusRegex = regexp.MustCompile(`^([1-5][0-9]{2}|[1-5][xX]{2})$`)
+	policyNameRegex = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,64}$`)
+)
+
+// HTTPStatusValidator 验证字符串是否为HTTP状态码（如 404）或状态码类别（如 4xx）
+var HTTPStatusValidator validator.Func = func(fl validator.FieldLevel) bool {
+	value, ok := fl.Field().Interface().(string)
+	if !ok {
+		return false
+	}
+	return httpStatusRegex.MatchString(value)
+}
+
+// PolicyNameValidator 验证策略名称，名称会出现在封禁原因和计数键中，只允许字母、数字、下划线和连字符
+var PolicyNameValidator validator.Func = func(fl validator.FieldLevel) bool {
+	value, ok := fl.Field().Interface().(string)
+	if !ok {
+		return false
+	}
+	return policyNameRegex.MatchString(value)
+}